@@ -73,6 +73,7 @@ var (
 		"COPYING",
 		executablePath("abigen"),
 		executablePath("bootnode"),
+		executablePath("devp2p"),
 		executablePath("evm"),
 		executablePath("gwat"),
 		executablePath("puppwat"),
@@ -91,6 +92,10 @@ var (
 			Name:        "bootnode",
 			Description: "watchain bootnode.",
 		},
+		{
+			Name:        "devp2p",
+			Description: "Developer utility for DNS node lists and p2p network inspection.",
+		},
 		{
 			Name:        "evm",
 			Description: "Developer utility version of the EVM (watchain Virtual Machine) that is capable of running bytecode snippets within a configurable environment and execution mode.",
@@ -0,0 +1,207 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	crand "crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/discover"
+)
+
+const (
+	crawlWorkers   = 16               // number of concurrent lookups and revalidations
+	nodeRemoveTime = 24 * time.Hour   // nodes not responding for this long are dropped
+	rlpxRecheck    = 30 * time.Minute // minimum time between two RLPx probes of a node
+)
+
+// resolver is the part of a discovery table used by the crawler.
+type resolver interface {
+	Resolve(id discover.NodeID) *discover.Node
+	Lookup(target discover.NodeID) []*discover.Node
+}
+
+// crawler walks the discovery table, revalidating the nodes of a previous crawl
+// and collecting the nodes found by random lookups.
+type crawler struct {
+	input  nodeSet
+	disc   resolver
+	prober *rlpxProber // optional, queries client information via RLPx
+
+	mu      sync.Mutex
+	output  nodeSet
+	checked map[discover.NodeID]bool
+
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newCrawler(input nodeSet, disc resolver, prober *rlpxProber) *crawler {
+	c := &crawler{
+		input:   input,
+		disc:    disc,
+		prober:  prober,
+		output:  make(nodeSet, len(input)),
+		checked: make(map[discover.NodeID]bool),
+		closed:  make(chan struct{}),
+	}
+	for id, n := range input {
+		c.output[id] = n
+	}
+	return c
+}
+
+// run crawls the network until the timeout expires and returns the updated set.
+// Nodes of the input set which couldn't be checked in time are kept unchanged.
+func (c *crawler) run(timeout time.Duration) nodeSet {
+	ids := make(chan discover.NodeID)
+	go func() {
+		defer close(ids)
+		for id := range c.input {
+			select {
+			case ids <- id:
+			case <-c.closed:
+				return
+			}
+		}
+	}()
+	for i := 0; i < crawlWorkers; i++ {
+		c.wg.Add(2)
+		go c.revalidateLoop(ids)
+		go c.lookupLoop()
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	status := time.NewTicker(10 * time.Second)
+	defer status.Stop()
+	for running := true; running; {
+		select {
+		case <-timer.C:
+			running = false
+		case <-status.C:
+			c.mu.Lock()
+			log.Info("Crawling in progress", "checked", len(c.checked), "nodes", len(c.output))
+			c.mu.Unlock()
+		}
+	}
+	close(c.closed)
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.output
+}
+
+// revalidateLoop checks whwater the nodes of the input set are still online.
+func (c *crawler) revalidateLoop(ids <-chan discover.NodeID) {
+	defer c.wg.Done()
+	for id := range ids {
+		c.updateNode(id, c.disc.Resolve(id))
+	}
+}
+
+// lookupLoop performs lookups of random targets until the crawl ends.
+func (c *crawler) lookupLoop() {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+		var target discover.NodeID
+		crand.Read(target[:])
+		nodes := c.disc.Lookup(target)
+		if len(nodes) == 0 {
+			// Don't spin while the table is empty.
+			select {
+			case <-time.After(time.Second):
+			case <-c.closed:
+			}
+		}
+		for _, n := range nodes {
+			c.updateNode(n.ID, n)
+		}
+	}
+}
+
+// updateNode records the result of checking a node, n is nil if the node didn't
+// respond. Every node is only checked once during a crawl.
+func (c *crawler) updateNode(id discover.NodeID, n *discover.Node) {
+	c.mu.Lock()
+	if c.checked[id] {
+		c.mu.Unlock()
+		return
+	}
+	c.checked[id] = true
+	entry := c.output[id]
+	c.mu.Unlock()
+
+	now := time.Now()
+	entry.LastCheck = now
+	if n == nil {
+		if now.Sub(entry.LastResponse) > nodeRemoveTime {
+			log.Debug("Removing unresponsive node", "id", id)
+			c.mu.Lock()
+			delete(c.output, id)
+			c.mu.Unlock()
+			return
+		}
+		entry.Score /= 2
+	} else {
+		if entry.FirstResponse.IsZero() {
+			entry.FirstResponse = now
+		}
+		entry.LastResponse = now
+		entry.Score++
+		entry.URL = n.String()
+		if r := n.Record(); r != nil && (entry.Record == nil || r.Seq() > entry.Seq) {
+			entry.Seq, entry.Record = r.Seq(), &enrJSON{r}
+		}
+		if c.prober != nil && now.Sub(entry.LastRLPx) > rlpxRecheck {
+			c.probeNode(n, &entry)
+		}
+	}
+	c.mu.Lock()
+	c.output[id] = entry
+	c.mu.Unlock()
+}
+
+// probeNode connects to the node via RLPx, storing the reported client
+// information in the entry.
+func (c *crawler) probeNode(n *discover.Node, entry *nodeJSON) {
+	info, err := c.prober.probe(n, c.closed)
+	if err != nil {
+		log.Trace("RLPx probe failed", "id", n.ID, "err", err)
+		return
+	}
+	entry.LastRLPx = time.Now()
+	entry.Client = info.name
+	entry.Caps = make([]string, len(info.caps))
+	for i, cap := range info.caps {
+		entry.Caps[i] = cap.String()
+	}
+	if s := info.status; s != nil {
+		entry.NetworkID = s.NetworkId
+		entry.Genesis = &s.GenesisBlock
+		entry.Head = &s.CurrentBlock
+		entry.ForkID = s.forkID()
+	}
+}
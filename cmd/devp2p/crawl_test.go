@@ -0,0 +1,130 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/enr"
+)
+
+// newTestNode creates a node advertising a signed record with the given
+// sequence number.
+func newTestNode(t *testing.T, key *ecdsa.PrivateKey, seq uint64) *discover.Node {
+	var r enr.Record
+	r.Set(enr.IP4(net.IP{127, 0, 0, 1}))
+	r.Set(enr.TCP(30303))
+	r.SetSeq(seq - 1) // signing increments the sequence number
+	if err := r.Sign(key); err != nil {
+		t.Fatalf("failed to sign record: %v", err)
+	}
+	n, err := discover.NodeFromRecord(&r)
+	if err != nil {
+		t.Fatalf("invalid record: %v", err)
+	}
+	return n
+}
+
+// Tests that responding nodes are merged into the entries of a previous crawl.
+func TestCrawlerUpdateNodeMerge(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	n := newTestNode(t, key, 5)
+
+	first := time.Now().Add(-time.Hour)
+	input := nodeSet{n.ID: {Score: 3, FirstResponse: first, LastResponse: first, Client: "wat/v1"}}
+	c := newCrawler(input, nil, nil)
+
+	c.updateNode(n.ID, n)
+	entry := c.output[n.ID]
+	if entry.Score != 4 {
+		t.Errorf("score mismatch: have %d, want 4", entry.Score)
+	}
+	if !entry.FirstResponse.Equal(first) {
+		t.Errorf("first response changed: have %v, want %v", entry.FirstResponse, first)
+	}
+	if !entry.LastResponse.After(first) || !entry.LastCheck.Equal(entry.LastResponse) {
+		t.Errorf("response times not updated: last response %v, last check %v", entry.LastResponse, entry.LastCheck)
+	}
+	if entry.URL != n.String() {
+		t.Errorf("url mismatch: have %q, want %q", entry.URL, n.String())
+	}
+	if entry.Seq != 5 || entry.Record == nil {
+		t.Errorf("record not stored: seq %d, record %v", entry.Seq, entry.Record)
+	}
+	if entry.Client != "wat/v1" {
+		t.Errorf("client information lost: have %q", entry.Client)
+	}
+	// Nodes are only checked once per crawl.
+	c.updateNode(n.ID, n)
+	if c.output[n.ID].Score != 4 {
+		t.Errorf("node checked twice: score %d", c.output[n.ID].Score)
+	}
+}
+
+// Tests that only records with a higher sequence number replace the stored one.
+func TestCrawlerUpdateNodeRecord(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	older, newer := newTestNode(t, key, 3), newTestNode(t, key, 7)
+
+	c := newCrawler(nodeSet{}, nil, nil)
+	c.updateNode(newer.ID, newer)
+	if c.output[newer.ID].Seq != 7 {
+		t.Fatalf("record not stored: seq %d", c.output[newer.ID].Seq)
+	}
+	c.checked = make(map[discover.NodeID]bool)
+	c.updateNode(older.ID, older)
+	if entry := c.output[older.ID]; entry.Seq != 7 || entry.Record.Seq() != 7 {
+		t.Errorf("record replaced by older one: seq %d", entry.Seq)
+	}
+}
+
+// Tests that unresponsive nodes are demoted and only dropped after they didn't
+// respond for nodeRemoveTime.
+func TestCrawlerUpdateNodeRemove(t *testing.T) {
+	var recent, stale discover.NodeID
+	recent[0], stale[0] = 1, 2
+
+	input := nodeSet{
+		recent: {Score: 4, LastResponse: time.Now().Add(-time.Hour)},
+		stale:  {Score: 4, LastResponse: time.Now().Add(-nodeRemoveTime - time.Hour)},
+	}
+	c := newCrawler(input, nil, nil)
+
+	c.updateNode(recent, nil)
+	entry, ok := c.output[recent]
+	if !ok {
+		t.Fatal("recently responding node removed")
+	}
+	if entry.Score != 2 {
+		t.Errorf("score mismatch: have %d, want 2", entry.Score)
+	}
+	if entry.LastCheck.IsZero() {
+		t.Error("last check not updated")
+	}
+	c.updateNode(stale, nil)
+	if _, ok := c.output[stale]; ok {
+		t.Error("stale node not removed")
+	}
+	if _, ok := input[stale]; !ok {
+		t.Error("input set modified")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	discv4Command = cli.Command{
+		Name:  "discv4",
+		Usage: "Node Discovery v4 tools",
+		Subcommands: []cli.Command{
+			discv4CrawlCommand,
+		},
+	}
+	discv4CrawlCommand = cli.Command{
+		Name:      "crawl",
+		Usage:     "Update a nodes file by crawling the DHT",
+		ArgsUsage: "<nodes.json>",
+		Description: `
+Revalidates the nodes contained in the nodes file and adds all nodes found by
+random lookups until the timeout expires. The file is created if it doesn't
+exist. Nodes which haven't responded for a day are removed.`,
+		Action: discv4Crawl,
+		Flags: []cli.Flag{
+			bootnodesFlag,
+			listenAddrFlag,
+			crawlTimeoutFlag,
+			crawlRLPxFlag,
+		},
+	}
+)
+
+// Flags shared by the crawl commands.
+var (
+	bootnodesFlag = cli.StringFlag{
+		Name:  "bootnodes",
+		Usage: "comma separated enode URLs of the nodes to start from (defaults to the mainnet bootnodes)",
+	}
+	listenAddrFlag = cli.StringFlag{
+		Name:  "addr",
+		Usage: "UDP listening address",
+		Value: "0.0.0.0:0",
+	}
+	crawlTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "duration of the crawl",
+		Value: 30 * time.Minute,
+	}
+	crawlRLPxFlag = cli.BoolFlag{
+		Name:  "rlpx",
+		Usage: "connect to the found nodes to query their client version, capabilities and chain",
+	}
+)
+
+// discv4Crawl performs discv4 crawl.
+func discv4Crawl(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	nodesFile := ctx.Args().First()
+	input, err := loadNodesJSON(nodesFile)
+	if err != nil {
+		return err
+	}
+	var bootnodes []*discover.Node
+	for _, url := range bootnodeURLs(ctx, params.MainnetBootnodes) {
+		n, err := discover.ParseNode(url)
+		if err != nil {
+			return fmt.Errorf("invalid bootnode %q: %v", url, err)
+		}
+		bootnodes = append(bootnodes, n)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	conn, err := listenUDP(ctx)
+	if err != nil {
+		return err
+	}
+	tab, err := discover.ListenUDP(conn, discover.Config{PrivateKey: key, Bootnodes: bootnodes})
+	if err != nil {
+		return err
+	}
+	defer tab.Close()
+
+	output, err := crawl(ctx, input, tab)
+	if err != nil {
+		return err
+	}
+	return writeNodesJSON(nodesFile, output)
+}
+
+// crawl runs a crawler on the given table, probing the found nodes via RLPx
+// if requested.
+func crawl(ctx *cli.Context, input nodeSet, disc resolver) (nodeSet, error) {
+	var prober *rlpxProber
+	if ctx.Bool(crawlRLPxFlag.Name) {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		if prober, err = newRLPxProber(key); err != nil {
+			return nil, err
+		}
+		defer prober.stop()
+	}
+	c := newCrawler(input, disc, prober)
+	output := c.run(ctx.Duration(crawlTimeoutFlag.Name))
+	log.Info("Crawl finished", "input", len(input), "output", len(output))
+	return output, nil
+}
+
+// bootnodeURLs returns the URLs given by the bootnodes flag, or the default
+// ones if the flag is not set.
+func bootnodeURLs(ctx *cli.Context, defaults []string) []string {
+	if !ctx.IsSet(bootnodesFlag.Name) {
+		return defaults
+	}
+	var urls []string
+	for _, url := range strings.Split(ctx.String(bootnodesFlag.Name), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// listenUDP opens the UDP socket of the discovery protocol.
+func listenUDP(ctx *cli.Context) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", ctx.String(listenAddrFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid listening address: %v", err)
+	}
+	return net.ListenUDP("udp", addr)
+}
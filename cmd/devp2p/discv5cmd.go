@@ -0,0 +1,124 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/discv5"
+	"github.com/watchain/go-watchain/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	discv5Command = cli.Command{
+		Name:  "discv5",
+		Usage: "Node Discovery v5 tools",
+		Subcommands: []cli.Command{
+			discv5CrawlCommand,
+		},
+	}
+	discv5CrawlCommand = cli.Command{
+		Name:      "crawl",
+		Usage:     "Update a nodes file by crawling the topic discovery DHT",
+		ArgsUsage: "<nodes.json>",
+		Description: `
+Works like 'discv4 crawl' on the v5 network. Since v5 nodes don't advertise node
+records, the nodes of the output file only carry their enode URL.`,
+		Action: discv5Crawl,
+		Flags: []cli.Flag{
+			bootnodesFlag,
+			listenAddrFlag,
+			crawlTimeoutFlag,
+			crawlRLPxFlag,
+		},
+	}
+)
+
+// discv5Crawl performs discv5 crawl.
+func discv5Crawl(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	nodesFile := ctx.Args().First()
+	input, err := loadNodesJSON(nodesFile)
+	if err != nil {
+		return err
+	}
+	var bootnodes []*discv5.Node
+	for _, url := range bootnodeURLs(ctx, params.DiscoveryV5Bootnodes) {
+		n, err := discv5.ParseNode(url)
+		if err != nil {
+			return fmt.Errorf("invalid bootnode %q: %v", url, err)
+		}
+		bootnodes = append(bootnodes, n)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	conn, err := listenUDP(ctx)
+	if err != nil {
+		return err
+	}
+	network, err := discv5.ListenUDP(key, conn, conn.LocalAddr().(*net.UDPAddr), "", nil)
+	if err != nil {
+		return err
+	}
+	defer network.Close()
+	if err := network.SetFallbackNodes(bootnodes); err != nil {
+		return err
+	}
+
+	output, err := crawl(ctx, input, discv5Resolver{network})
+	if err != nil {
+		return err
+	}
+	return writeNodesJSON(nodesFile, output)
+}
+
+// discv5Resolver adapts a v5 network to the resolver interface of the crawler.
+type discv5Resolver struct {
+	net *discv5.Network
+}
+
+func (r discv5Resolver) Resolve(id discover.NodeID) *discover.Node {
+	if n := r.net.Resolve(discv5.NodeID(id)); n != nil {
+		return r.convert(n)
+	}
+	return nil
+}
+
+func (r discv5Resolver) Lookup(target discover.NodeID) []*discover.Node {
+	var (
+		self  = r.net.Self().ID
+		nodes []*discover.Node
+	)
+	for _, n := range r.net.Lookup(discv5.NodeID(target)) {
+		if n.ID != self {
+			nodes = append(nodes, r.convert(n))
+		}
+	}
+	return nodes
+}
+
+func (r discv5Resolver) convert(n *discv5.Node) *discover.Node {
+	return discover.NewNode(discover.NodeID(n.ID), n.IP, n.UDP, n.TCP)
+}
@@ -0,0 +1,244 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/dnsdisc"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	treeMetaFile  = "enrtree-info.json"
+	treeNodesFile = "nodes.json"
+)
+
+var (
+	dnsCommand = cli.Command{
+		Name:  "dns",
+		Usage: "DNS discovery commands",
+		Subcommands: []cli.Command{
+			dnsSyncCommand,
+			dnsSignCommand,
+			dnsTXTCommand,
+		},
+	}
+	dnsSyncCommand = cli.Command{
+		Name:      "sync",
+		Usage:     "Download a DNS discovery tree",
+		ArgsUsage: "<url> [ <directory> ]",
+		Action:    dnsSync,
+	}
+	dnsSignCommand = cli.Command{
+		Name:      "sign",
+		Usage:     "Build and sign a DNS discovery tree from a nodes file",
+		ArgsUsage: "<tree-directory> <key-file>",
+		Description: `
+Builds the tree of the node records contained in the nodes.json file of the tree
+directory, e.g. the output of a crawl, and signs it with the hex encoded private
+key in the key file. The sequence number of the tree is only increased if its
+content changed since the last signature.`,
+		Action: dnsSign,
+		Flags: []cli.Flag{
+			dnsDomainFlag,
+			dnsLinksFlag,
+		},
+	}
+	dnsTXTCommand = cli.Command{
+		Name:      "to-txt",
+		Usage:     "Create the DNS TXT records of a signed tree",
+		ArgsUsage: "<tree-directory> <output-file>",
+		Action:    dnsToTXT,
+	}
+)
+
+var (
+	dnsDomainFlag = cli.StringFlag{
+		Name:  "domain",
+		Usage: "domain name of the tree (defaults to the one it was last signed for)",
+	}
+	dnsLinksFlag = cli.StringSliceFlag{
+		Name:  "link",
+		Usage: "enrtree:// URL of another tree to link to (replaces the existing links)",
+	}
+)
+
+// treeMeta is the content of the tree meta file.
+type treeMeta struct {
+	URL          string    `json:"url,omitempty"`
+	Seq          uint      `json:"seq"`
+	Sig          string    `json:"signature,omitempty"`
+	Links        []string  `json:"links"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// dnsSync performs dns sync.
+func dnsSync(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree URL as argument")
+	}
+	url := ctx.Args().Get(0)
+	domain, _, err := dnsdisc.ParseURL(url)
+	if err != nil {
+		return err
+	}
+	dir := ctx.Args().Get(1)
+	if dir == "" {
+		dir = domain
+	}
+	client, err := dnsdisc.NewClient(dnsdisc.Config{})
+	if err != nil {
+		return err
+	}
+	t, err := client.SyncTree(url)
+	if err != nil {
+		return err
+	}
+	meta := treeMeta{URL: url, Seq: t.Seq(), Sig: t.Signature(), Links: t.Links(), LastModified: time.Now()}
+	nodes := make(nodeSet)
+	for _, r := range t.Nodes() {
+		n, err := discover.NodeFromRecord(r)
+		if err != nil {
+			continue
+		}
+		nodes[n.ID] = nodeJSON{Seq: r.Seq(), Record: &enrJSON{r}, URL: n.String()}
+	}
+	return writeTreeDir(dir, meta, nodes)
+}
+
+// dnsSign performs dns sign.
+func dnsSign(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return fmt.Errorf("need tree definition directory and key file as arguments")
+	}
+	dir, keyfile := ctx.Args().Get(0), ctx.Args().Get(1)
+	meta, nodes, err := loadTreeDir(dir)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.LoadECDSA(keyfile)
+	if err != nil {
+		return fmt.Errorf("can't load key: %v", err)
+	}
+	var signedDomain string
+	if meta.URL != "" {
+		if signedDomain, _, err = dnsdisc.ParseURL(meta.URL); err != nil {
+			return err
+		}
+	}
+	domain := ctx.String(dnsDomainFlag.Name)
+	if domain == "" {
+		domain = signedDomain
+	}
+	if domain == "" {
+		return fmt.Errorf("need --%s for an unsigned tree", dnsDomainFlag.Name)
+	}
+	if ctx.IsSet(dnsLinksFlag.Name) {
+		meta.Links = ctx.StringSlice(dnsLinksFlag.Name)
+	}
+	// Keep the previous signature if the tree didn't change
+	t, err := dnsdisc.MakeTree(meta.Seq, nodes.records(), meta.Links)
+	if err != nil {
+		return err
+	}
+	if domain == signedDomain && meta.Sig != "" && t.SetSignature(&key.PublicKey, meta.Sig) == nil {
+		fmt.Println("Tree unchanged, keeping signature of sequence number", meta.Seq)
+		return nil
+	}
+	if t, err = dnsdisc.MakeTree(meta.Seq+1, nodes.records(), meta.Links); err != nil {
+		return err
+	}
+	url, err := t.Sign(key, domain)
+	if err != nil {
+		return fmt.Errorf("can't sign: %v", err)
+	}
+	meta.URL, meta.Seq, meta.Sig, meta.LastModified = url, t.Seq(), t.Signature(), time.Now()
+	fmt.Println(url)
+	return writeTreeMeta(dir, meta)
+}
+
+// dnsToTXT performs dns to-txt.
+func dnsToTXT(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return fmt.Errorf("need tree definition directory and output file as arguments")
+	}
+	dir, output := ctx.Args().Get(0), ctx.Args().Get(1)
+	meta, nodes, err := loadTreeDir(dir)
+	if err != nil {
+		return err
+	}
+	if meta.URL == "" || meta.Sig == "" {
+		return fmt.Errorf("tree in %s is not signed", dir)
+	}
+	domain, pubkey, err := dnsdisc.ParseURL(meta.URL)
+	if err != nil {
+		return err
+	}
+	t, err := dnsdisc.MakeTree(meta.Seq, nodes.records(), meta.Links)
+	if err != nil {
+		return err
+	}
+	if err := t.SetSignature(pubkey, meta.Sig); err != nil {
+		return fmt.Errorf("tree in %s changed since it was signed, sign it again", dir)
+	}
+	return writeJSON(output, t.ToTXT(domain))
+}
+
+// loadTreeDir loads the meta and nodes files of a tree directory.
+func loadTreeDir(dir string) (treeMeta, nodeSet, error) {
+	var meta treeMeta
+	blob, err := ioutil.ReadFile(filepath.Join(dir, treeMetaFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(blob, &meta); err != nil {
+			return meta, nil, fmt.Errorf("invalid %s: %v", treeMetaFile, err)
+		}
+	case !os.IsNotExist(err):
+		return meta, nil, err
+	}
+	nodes, err := loadNodesJSON(filepath.Join(dir, treeNodesFile))
+	if err != nil {
+		return meta, nil, err
+	}
+	if len(nodes) == 0 {
+		return meta, nil, fmt.Errorf("no nodes in %s", filepath.Join(dir, treeNodesFile))
+	}
+	return meta, nodes, nil
+}
+
+// writeTreeDir writes the meta and nodes files of a tree directory.
+func writeTreeDir(dir string, meta treeMeta, nodes nodeSet) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := writeTreeMeta(dir, meta); err != nil {
+		return err
+	}
+	return writeNodesJSON(filepath.Join(dir, treeNodesFile), nodes)
+}
+
+func writeTreeMeta(dir string, meta treeMeta) error {
+	return writeJSON(filepath.Join(dir, treeMetaFile), meta)
+}
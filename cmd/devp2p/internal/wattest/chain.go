@@ -0,0 +1,145 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package wattest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/core/forkid"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+// Chain is the chain the node under test is expected to serve.
+type Chain struct {
+	genesis *core.Genesis
+	blocks  []*types.Block // blocks[0] is the genesis block
+}
+
+// loadChain reads the genesis specification and the exported blocks of the
+// chain. The blocks must form a chain on top of the genesis block.
+func loadChain(chainfile, genesisfile string) (*Chain, error) {
+	blob, err := ioutil.ReadFile(genesisfile)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(core.Genesis)
+	if err := json.Unmarshal(blob, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file: %v", err)
+	}
+	if genesis.Config == nil {
+		return nil, fmt.Errorf("genesis file has no chain config")
+	}
+	chain := &Chain{genesis: genesis, blocks: []*types.Block{genesis.ToBlock(nil)}}
+
+	fh, err := os.Open(chainfile)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	var reader io.Reader = fh
+	if strings.HasSuffix(chainfile, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return nil, err
+		}
+	}
+	stream := rlp.NewStream(reader, 0)
+	for {
+		block := new(types.Block)
+		if err := stream.Decode(block); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("at block %d: %v", len(chain.blocks), err)
+		}
+		if block.NumberU64() == 0 {
+			continue // exports usually include the genesis block
+		}
+		if parent := chain.Head(); block.ParentHash() != parent.Hash() || block.NumberU64() != parent.NumberU64()+1 {
+			return nil, fmt.Errorf("block %d (%x) is not a child of block %d (%x)", block.NumberU64(), block.Hash().Bytes()[:4], parent.NumberU64(), parent.Hash().Bytes()[:4])
+		}
+		chain.blocks = append(chain.blocks, block)
+	}
+	return chain, nil
+}
+
+// Len returns the number of blocks in the chain, including the genesis block.
+func (c *Chain) Len() int {
+	return len(c.blocks)
+}
+
+// Head returns the last block of the chain.
+func (c *Chain) Head() *types.Block {
+	return c.blocks[len(c.blocks)-1]
+}
+
+// Block returns the block at the given height.
+func (c *Chain) Block(number uint64) *types.Block {
+	return c.blocks[number]
+}
+
+// TD returns the total difficulty of the chain.
+func (c *Chain) TD() *big.Int {
+	td := new(big.Int)
+	for _, block := range c.blocks {
+		td.Add(td, block.Difficulty())
+	}
+	return td
+}
+
+// Config returns the fork configuration of the chain.
+func (c *Chain) Config() *params.ChainConfig {
+	return c.genesis.Config
+}
+
+// Genesis returns the genesis block of the chain.
+func (c *Chain) Genesis() *types.Block {
+	return c.blocks[0]
+}
+
+// CurrentHeader returns the header of the chain head.
+func (c *Chain) CurrentHeader() *types.Header {
+	return c.Head().Header()
+}
+
+// ForkID returns the fork identifier of the chain head.
+func (c *Chain) ForkID() forkid.ID {
+	return forkid.NewID(c)
+}
+
+// Nonce returns the next nonce of the given account after the chain.
+func (c *Chain) Nonce(addr common.Address) uint64 {
+	nonce := c.genesis.Alloc[addr].Nonce
+	for _, block := range c.blocks[1:] {
+		signer := types.MakeSigner(c.Config(), block.Number())
+		for _, tx := range block.Transactions() {
+			if from, err := types.Sender(signer, tx); err == nil && from == addr {
+				nonce++
+			}
+		}
+	}
+	return nonce
+}
@@ -0,0 +1,224 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package wattest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/forkid"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/wat"
+)
+
+// Status is the status message of wat/64 and later.
+type Status struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+	ForkID          forkid.ID
+}
+
+// GetBlockHeaders is a header query by block number.
+type GetBlockHeaders struct {
+	Origin  uint64
+	Amount  uint64
+	Skip    uint64
+	Reverse bool
+}
+
+// Supported versions of the wat protocol. The fork identifier of the status
+// message is required by the suite, so versions before wat/64 are not tested.
+var protocolVersions = []uint{65, 64}
+
+var errDisconnected = errors.New("disconnected")
+
+// rawMsg is a message received from the node under test.
+type rawMsg struct {
+	Code    uint64
+	Payload []byte
+}
+
+// Decode decodes the payload of the message into val.
+func (m rawMsg) Decode(val interface{}) error {
+	if err := rlp.DecodeBytes(m.Payload, val); err != nil {
+		return fmt.Errorf("invalid message %d: %v", m.Code, err)
+	}
+	return nil
+}
+
+// Conn is a connection to the node under test. It runs a dedicated p2p server
+// which dials the node and hands over the wat protocol stream to the test.
+type Conn struct {
+	srv     *p2p.Server
+	peer    *p2p.Peer
+	rw      p2p.MsgReadWriter
+	version uint
+
+	msgs    chan rawMsg // closed when the node disconnects
+	closing chan struct{}
+}
+
+// dial connects to the node and waits for the wat protocol to start.
+func dial(dest *discover.Node, timeout time.Duration) (*Conn, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		connc     = make(chan *Conn, 1)
+		closing   = make(chan struct{})
+		connected int32 // set once the protocol ran, later connections are refused
+		protocols []p2p.Protocol
+	)
+	for _, version := range protocolVersions {
+		version := version
+		protocols = append(protocols, p2p.Protocol{
+			Name:    wat.ProtocolName,
+			Version: version,
+			Length:  wat.ProtocolLengths[0],
+			Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+				// The node is dialed exactly once, a test must never end up
+				// talking to a second connection it did not ask for.
+				if !atomic.CompareAndSwapInt32(&connected, 0, 1) {
+					return errors.New("already connected")
+				}
+				c := &Conn{peer: peer, rw: rw, version: version, msgs: make(chan rawMsg, 64), closing: closing}
+				connc <- c
+				return c.readLoop()
+			},
+		})
+	}
+	srv := &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		Name:        "wattest",
+		MaxPeers:    1,
+		NoDiscovery: true,
+		Protocols:   protocols,
+	}}
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	srv.AddPeer(dest)
+
+	select {
+	case c := <-connc:
+		// Stop the static dialer from reconnecting once the node drops us
+		srv.RemovePeer(dest)
+		c.srv = srv
+		return c, nil
+	case <-time.After(timeout):
+		srv.Stop()
+		return nil, fmt.Errorf("connection to %v timed out", dest)
+	}
+}
+
+// Close disconnects from the node.
+func (c *Conn) Close() {
+	close(c.closing)
+	c.srv.Stop()
+}
+
+// readLoop reads messages from the node until it disconnects.
+func (c *Conn) readLoop() error {
+	defer close(c.msgs)
+	for {
+		msg, err := c.rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		payload, err := ioutil.ReadAll(msg.Payload)
+		if err != nil {
+			return err
+		}
+		select {
+		case c.msgs <- rawMsg{msg.Code, payload}:
+		case <-c.closing:
+			return nil
+		}
+	}
+}
+
+// Write sends a message to the node.
+func (c *Conn) Write(code uint64, data interface{}) error {
+	return p2p.Send(c.rw, code, data)
+}
+
+// WriteRaw sends a message with the given payload, which doesn't need to be
+// valid RLP.
+func (c *Conn) WriteRaw(code uint64, payload []byte) error {
+	return c.rw.WriteMsg(p2p.Msg{Code: code, Size: uint32(len(payload)), Payload: bytes.NewReader(payload)})
+}
+
+// Read waits for the next message. It returns errDisconnected if the node
+// disconnected.
+func (c *Conn) Read(timeout time.Duration) (rawMsg, error) {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			return rawMsg{}, errDisconnected
+		}
+		return msg, nil
+	case <-time.After(timeout):
+		return rawMsg{}, fmt.Errorf("no message received within %v", timeout)
+	}
+}
+
+// ReadCode waits for a message of the given code and decodes it into val,
+// skipping the announcements the node may send at any time.
+func (c *Conn) ReadCode(code uint64, val interface{}, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		msg, err := c.Read(time.Until(deadline))
+		if err != nil {
+			return err
+		}
+		switch msg.Code {
+		case code:
+			return msg.Decode(val)
+		case wat.NewBlockHashesMsg, wat.NewBlockMsg, wat.TxMsg, wat.NewPooledTransactionHashesMsg:
+			continue
+		default:
+			return fmt.Errorf("unexpected message %d, want %d", msg.Code, code)
+		}
+	}
+}
+
+// WaitDisconnect waits until the node drops the connection.
+func (c *Conn) WaitDisconnect(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := c.Read(time.Until(deadline))
+		if err == errDisconnected {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("node didn't disconnect: %v", err)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+// Package wattest implements a test suite checking the conformance of a node
+// to the wat protocol.
+package wattest
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/forkid"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/internal/utesting"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/wat"
+)
+
+const (
+	dialTimeout       = 10 * time.Second
+	responseTimeout   = 5 * time.Second
+	disconnectTimeout = 5 * time.Second
+	propagateTimeout  = 20 * time.Second
+)
+
+// Suite runs the conformance tests against a single node, which must have
+// imported the given chain and nothing else.
+type Suite struct {
+	dest  *discover.Node
+	chain *Chain
+	txKey *ecdsa.PrivateKey
+}
+
+// NewSuite creates a test suite for the node. The transaction tests are only
+// run if a key is given which is funded in the genesis block of the chain.
+func NewSuite(dest *discover.Node, chainfile, genesisfile string, txKey *ecdsa.PrivateKey) (*Suite, error) {
+	chain, err := loadChain(chainfile, genesisfile)
+	if err != nil {
+		return nil, err
+	}
+	return &Suite{dest: dest, chain: chain, txKey: txKey}, nil
+}
+
+// AllTests returns the tests of the suite.
+func (s *Suite) AllTests() []utesting.Test {
+	tests := []utesting.Test{
+		{Name: "Status", Fn: s.TestStatus},
+		{Name: "StatusWrongGenesis", Fn: s.TestStatusWrongGenesis},
+		{Name: "StatusWrongNetwork", Fn: s.TestStatusWrongNetwork},
+		{Name: "ExtraStatus", Fn: s.TestExtraStatus},
+		{Name: "GetBlockHeaders", Fn: s.TestGetBlockHeaders},
+		{Name: "GetBlockBodies", Fn: s.TestGetBlockBodies},
+		{Name: "MalformedRequest", Fn: s.TestMalformedRequest},
+		{Name: "UnknownMessage", Fn: s.TestUnknownMessage},
+		{Name: "LargeMessage", Fn: s.TestLargeMessage},
+	}
+	if s.txKey != nil {
+		tests = append(tests, utesting.Test{Name: "Transaction", Fn: s.TestTransaction})
+	}
+	return tests
+}
+
+// TestStatus checks the handshake and the status of the node.
+func (s *Suite) TestStatus(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	status := s.handshake(t, c)
+	if status.Head != s.chain.Head().Hash() {
+		t.Errorf("wrong head block %x, want %x", status.Head, s.chain.Head().Hash())
+	}
+	if status.TD.Cmp(s.chain.TD()) != 0 {
+		t.Errorf("wrong total difficulty %v, want %v", status.TD, s.chain.TD())
+	}
+	if err := c.WaitDisconnect(time.Second); err == nil {
+		t.Fatal("node disconnected after successful handshake")
+	}
+}
+
+// TestStatusWrongGenesis checks that the node drops peers of another chain.
+func (s *Suite) TestStatusWrongGenesis(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	status := s.readStatus(t, c)
+	status.Genesis = common.Hash{0x01}
+	s.expectDropAfter(t, c, wat.StatusMsg, status)
+}
+
+// TestStatusWrongNetwork checks that the node drops peers of another network.
+func (s *Suite) TestStatusWrongNetwork(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	status := s.readStatus(t, c)
+	status.NetworkID++
+	s.expectDropAfter(t, c, wat.StatusMsg, status)
+}
+
+// TestExtraStatus checks that the node drops peers repeating the handshake.
+func (s *Suite) TestExtraStatus(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	status := s.handshake(t, c)
+	s.expectDropAfter(t, c, wat.StatusMsg, status)
+}
+
+// TestGetBlockHeaders checks that the node serves the headers of the chain.
+func (s *Suite) TestGetBlockHeaders(t *utesting.T) {
+	if s.chain.Len() < 4 {
+		t.Fatalf("chain too short for header queries: %d blocks", s.chain.Len())
+	}
+	c := s.dial(t)
+	defer c.Close()
+	s.handshake(t, c)
+
+	head := s.chain.Head().NumberU64()
+	queries := []struct {
+		query GetBlockHeaders
+		want  []uint64
+	}{
+		{GetBlockHeaders{Origin: 1, Amount: 3}, []uint64{1, 2, 3}},
+		{GetBlockHeaders{Origin: head, Amount: 2, Skip: 1, Reverse: true}, []uint64{head, head - 2}},
+		{GetBlockHeaders{Origin: head, Amount: 5}, []uint64{head}},
+		{GetBlockHeaders{Origin: head + 1, Amount: 1}, nil},
+	}
+	for _, q := range queries {
+		if err := c.Write(wat.GetBlockHeadersMsg, &q.query); err != nil {
+			t.Fatalf("can't send query: %v", err)
+		}
+		var headers []*types.Header
+		if err := c.ReadCode(wat.BlockHeadersMsg, &headers, responseTimeout); err != nil {
+			t.Fatalf("query %+v: %v", q.query, err)
+		}
+		if len(headers) != len(q.want) {
+			t.Errorf("query %+v: got %d headers, want %d", q.query, len(headers), len(q.want))
+			continue
+		}
+		for i, header := range headers {
+			if want := s.chain.Block(q.want[i]).Hash(); header.Hash() != want {
+				t.Errorf("query %+v: header %d has hash %x, want %x", q.query, i, header.Hash(), want)
+			}
+		}
+	}
+}
+
+// TestGetBlockBodies checks that the node serves the bodies of the chain.
+func (s *Suite) TestGetBlockBodies(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+	s.handshake(t, c)
+
+	var hashes []common.Hash
+	for i := s.chain.Len() - 1; i > 0 && len(hashes) < 8; i-- {
+		hashes = append(hashes, s.chain.Block(uint64(i)).Hash())
+	}
+	if err := c.Write(wat.GetBlockBodiesMsg, hashes); err != nil {
+		t.Fatalf("can't send query: %v", err)
+	}
+	var bodies []*types.Body
+	if err := c.ReadCode(wat.BlockBodiesMsg, &bodies, responseTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != len(hashes) {
+		t.Fatalf("got %d bodies, want %d", len(bodies), len(hashes))
+	}
+	for i, body := range bodies {
+		header := s.chain.Block(s.chain.Head().NumberU64() - uint64(i)).Header()
+		if types.DeriveSha(types.Transactions(body.Transactions)) != header.TxHash {
+			t.Errorf("body %d: transactions don't match header", i)
+		}
+		if types.CalcUncleHash(body.Uncles) != header.UncleHash {
+			t.Errorf("body %d: uncles don't match header", i)
+		}
+	}
+}
+
+// TestMalformedRequest checks that the node drops peers sending undecodable
+// requests.
+func (s *Suite) TestMalformedRequest(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+	s.handshake(t, c)
+
+	if err := c.WriteRaw(wat.GetBlockHeadersMsg, []byte{0xff, 0x00}); err != nil {
+		t.Fatalf("can't send request: %v", err)
+	}
+	if err := c.WaitDisconnect(disconnectTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUnknownMessage checks that the node drops peers sending messages of an
+// unassigned code.
+func (s *Suite) TestUnknownMessage(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+	s.handshake(t, c)
+
+	s.expectDropAfter(t, c, 0x0b, []uint{})
+}
+
+// TestLargeMessage checks that the node drops peers exceeding the maximum
+// message size.
+func (s *Suite) TestLargeMessage(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+	s.handshake(t, c)
+
+	hashes := make([]common.Hash, wat.ProtocolMaxMsgSize/common.HashLength+1)
+	s.expectDropAfter(t, c, wat.GetBlockBodiesMsg, hashes)
+}
+
+// TestTransaction checks that a transaction sent by one peer is propagated to
+// another one. The node must be synced or mining, otherwise it ignores incoming
+// transactions.
+func (s *Suite) TestTransaction(t *utesting.T) {
+	sender := s.dial(t)
+	defer sender.Close()
+	s.handshake(t, sender)
+	receiver := s.dial(t)
+	defer receiver.Close()
+	s.handshake(t, receiver)
+
+	tx, err := s.signTx()
+	if err != nil {
+		t.Fatalf("can't sign transaction: %v", err)
+	}
+	if err := sender.Write(wat.TxMsg, []*types.Transaction{tx}); err != nil {
+		t.Fatalf("can't send transaction: %v", err)
+	}
+	deadline := time.Now().Add(propagateTimeout)
+	for {
+		msg, err := receiver.Read(time.Until(deadline))
+		if err != nil {
+			t.Fatalf("transaction %x not propagated: %v", tx.Hash(), err)
+		}
+		var hashes []common.Hash
+		switch msg.Code {
+		case wat.TxMsg:
+			var txs []*types.Transaction
+			if err := msg.Decode(&txs); err != nil {
+				t.Fatal(err)
+			}
+			for _, tx := range txs {
+				hashes = append(hashes, tx.Hash())
+			}
+		case wat.NewPooledTransactionHashesMsg:
+			if err := msg.Decode(&hashes); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, hash := range hashes {
+			if hash == tx.Hash() {
+				return
+			}
+		}
+	}
+}
+
+// dial connects to the node, failing the test if that's not possible.
+func (s *Suite) dial(t *utesting.T) *Conn {
+	c, err := dial(s.dest, dialTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// readStatus waits for the status of the node and checks that it belongs to
+// the chain of the suite.
+func (s *Suite) readStatus(t *utesting.T, c *Conn) *Status {
+	status := new(Status)
+	if err := c.ReadCode(wat.StatusMsg, status, responseTimeout); err != nil {
+		t.Fatalf("no status: %v", err)
+	}
+	if status.ProtocolVersion != uint32(c.version) {
+		t.Fatalf("wrong protocol version %d in status, negotiated %d", status.ProtocolVersion, c.version)
+	}
+	if status.Genesis != s.chain.Genesis().Hash() {
+		t.Fatalf("wrong genesis block %x, want %x", status.Genesis, s.chain.Genesis().Hash())
+	}
+	if err := forkid.NewFilter(s.chain)(status.ForkID); err != nil {
+		t.Fatalf("fork ID %x/%d rejected: %v", status.ForkID.Hash, status.ForkID.Next, err)
+	}
+	return status
+}
+
+// handshake performs the wat handshake, answering with the head of the chain.
+func (s *Suite) handshake(t *utesting.T, c *Conn) *Status {
+	status := s.readStatus(t, c)
+	ours := &Status{
+		ProtocolVersion: uint32(c.version),
+		NetworkID:       status.NetworkID,
+		TD:              s.chain.TD(),
+		Head:            s.chain.Head().Hash(),
+		Genesis:         s.chain.Genesis().Hash(),
+		ForkID:          s.chain.ForkID(),
+	}
+	if err := c.Write(wat.StatusMsg, ours); err != nil {
+		t.Fatalf("can't send status: %v", err)
+	}
+	return status
+}
+
+// expectDropAfter sends a message and checks that the node disconnects.
+func (s *Suite) expectDropAfter(t *utesting.T, c *Conn, code uint64, data interface{}) {
+	if err := c.Write(code, data); err != nil {
+		t.Fatalf("can't send message %d: %v", code, err)
+	}
+	if err := c.WaitDisconnect(disconnectTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signTx creates a value transfer from the funded account of the suite.
+func (s *Suite) signTx() (*types.Transaction, error) {
+	from := crypto.PubkeyToAddress(s.txKey.PublicKey)
+	tx := types.NewTransaction(s.chain.Nonce(from), from, big.NewInt(1), 21000, big.NewInt(1000000000), nil)
+	number := new(big.Int).Add(s.chain.Head().Number(), common.Big1)
+	return types.SignTx(tx, types.MakeSigner(s.chain.Config(), number), s.txKey)
+}
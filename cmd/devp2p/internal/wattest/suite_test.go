@@ -0,0 +1,158 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package wattest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/watchain/go-watchain/consensus/ethash"
+	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/internal/utesting"
+	"github.com/watchain/go-watchain/node"
+	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/wat"
+	"github.com/watchain/go-watchain/wat/downloader"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// Tests that the suite passes against an in-process node serving a generated
+// chain.
+func TestWatSuite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wattest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	genesis := &core.Genesis{
+		Config:     params.TestChainConfig,
+		Difficulty: big.NewInt(131072),
+		GasLimit:   params.GenesisGasLimit,
+		Alloc:      core.GenesisAlloc{},
+	}
+	blocks := makeTestChain(t, filepath.Join(dir, "node", "wattest", "chaindata"), genesis, 16)
+
+	genesisfile := filepath.Join(dir, "genesis.json")
+	blob, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatalf("failed to encode genesis: %v", err)
+	}
+	if err := ioutil.WriteFile(genesisfile, blob, 0644); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	chainfile := filepath.Join(dir, "chain.rlp")
+	fh, err := os.Create(chainfile)
+	if err != nil {
+		t.Fatalf("failed to create chain file: %v", err)
+	}
+	for _, block := range blocks {
+		if err := rlp.Encode(fh, block); err != nil {
+			t.Fatalf("failed to export block %d: %v", block.NumberU64(), err)
+		}
+	}
+	fh.Close()
+
+	stack := runTestNode(t, filepath.Join(dir, "node"), genesis)
+	defer stack.Stop()
+
+	suite, err := NewSuite(stack.Server().Self(), chainfile, genesisfile, nil)
+	if err != nil {
+		t.Fatalf("failed to create suite: %v", err)
+	}
+	for _, test := range suite.AllTests() {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			if failed, output := utesting.Run(test); failed {
+				t.Fatal(output)
+			}
+		})
+	}
+}
+
+// makeTestChain generates a chain of n blocks on top of genesis and writes it
+// into a fresh database at path, which the test node opens as its chain data.
+func makeTestChain(t *testing.T, path string, genesis *core.Genesis, n int) []*types.Block {
+	db, err := watdb.NewLDBDatabase(path, 16, 16)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	gblock := genesis.MustCommit(db)
+	blocks, _ := core.GenerateChain(genesis.Config, gblock, ethash.NewFaker(), db, n, nil)
+
+	td := new(big.Int).Set(gblock.Difficulty())
+	for _, block := range blocks {
+		td.Add(td, block.Difficulty())
+		if err := core.WriteBlock(db, block); err != nil {
+			t.Fatalf("failed to write block %d: %v", block.NumberU64(), err)
+		}
+		if err := core.WriteTd(db, block.Hash(), block.NumberU64(), td); err != nil {
+			t.Fatalf("failed to write td %d: %v", block.NumberU64(), err)
+		}
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to write canonical hash %d: %v", block.NumberU64(), err)
+		}
+	}
+	head := blocks[len(blocks)-1].Hash()
+	if err := core.WriteHeadBlockHash(db, head); err != nil {
+		t.Fatalf("failed to write head block: %v", err)
+	}
+	if err := core.WriteHeadHeaderHash(db, head); err != nil {
+		t.Fatalf("failed to write head header: %v", err)
+	}
+	if err := core.WriteHeadFastBlockHash(db, head); err != nil {
+		t.Fatalf("failed to write head fast block: %v", err)
+	}
+	return blocks
+}
+
+// runTestNode starts a node with the wat protocol on the local interface,
+// serving the chain already stored in its data directory.
+func runTestNode(t *testing.T, datadir string, genesis *core.Genesis) *node.Node {
+	stack, err := node.New(&node.Config{
+		DataDir: datadir,
+		Name:    "wattest",
+		P2P: p2p.Config{
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			MaxPeers:    10,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	config := wat.DefaultConfig
+	config.Genesis = genesis
+	config.NetworkId = 1
+	config.SyncMode = downloader.FullSync
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) { return wat.New(ctx, &config) }); err != nil {
+		t.Fatalf("failed to register wat protocol: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	return stack
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+// devp2p is a utility for node operators to maintain DNS node lists and
+// inspect the p2p network.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/watchain/go-watchain/cmd/utils"
+	"github.com/watchain/go-watchain/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Git SHA1 commit hash of the release (set via linker flags)
+var gitCommit = ""
+
+var app *cli.App
+
+func init() {
+	app = utils.NewApp(gitCommit, "watchain p2p network utility")
+	app.Flags = []cli.Flag{
+		verbosityFlag,
+	}
+	app.Before = func(ctx *cli.Context) error {
+		glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+		glogger.Verbosity(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)))
+		log.Root().SetHandler(glogger)
+		return nil
+	}
+	app.Commands = []cli.Command{
+		dnsCommand,
+		discv4Command,
+		discv5Command,
+		rlpxCommand,
+	}
+}
+
+// Commonly used command line flags.
+var (
+	verbosityFlag = cli.IntFlag{
+		Name:  "verbosity",
+		Usage: "log verbosity (0-9)",
+		Value: int(log.LvlInfo),
+	}
+)
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
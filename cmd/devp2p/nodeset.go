@@ -0,0 +1,156 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/enr"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+// nodeSet is the content of a nodes file, keyed by node ID.
+type nodeSet map[discover.NodeID]nodeJSON
+
+// nodeJSON is the information known about a single node.
+type nodeJSON struct {
+	Seq    uint64   `json:"seq"`
+	Record *enrJSON `json:"record,omitempty"`
+	URL    string   `json:"url,omitempty"`
+	Score  int      `json:"score,omitempty"`
+
+	FirstResponse time.Time `json:"firstResponse,omitempty"`
+	LastResponse  time.Time `json:"lastResponse,omitempty"`
+	LastCheck     time.Time `json:"lastCheck,omitempty"`
+
+	// Client information, only set if the node was probed via RLPx.
+	Client    string       `json:"client,omitempty"`
+	Caps      []string     `json:"caps,omitempty"`
+	NetworkID uint64       `json:"networkId,omitempty"`
+	Genesis   *common.Hash `json:"genesis,omitempty"`
+	Head      *common.Hash `json:"head,omitempty"`
+	ForkID    *forkJSON    `json:"forkId,omitempty"`
+	LastRLPx  time.Time    `json:"lastRLPx,omitempty"`
+}
+
+// enrJSON wraps a node record to encode it in its text form.
+type enrJSON struct {
+	*enr.Record
+}
+
+func (r enrJSON) MarshalText() ([]byte, error) {
+	return []byte(encodeRecord(r.Record)), nil
+}
+
+func (r *enrJSON) UnmarshalText(text []byte) error {
+	rec, err := parseRecord(string(text))
+	if err != nil {
+		return err
+	}
+	r.Record = rec
+	return nil
+}
+
+// encodeRecord returns the text form of a node record.
+func encodeRecord(r *enr.Record) string {
+	enc, _ := rlp.EncodeToBytes(r)
+	return "enr:" + base64.RawURLEncoding.EncodeToString(enc)
+}
+
+// parseRecord parses the text form of a node record.
+func parseRecord(s string) (*enr.Record, error) {
+	if !strings.HasPrefix(s, "enr:") {
+		return nil, errors.New("missing 'enr:' prefix")
+	}
+	enc, err := base64.RawURLEncoding.DecodeString(s[4:])
+	if err != nil {
+		return nil, err
+	}
+	r := new(enr.Record)
+	if err := rlp.DecodeBytes(enc, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// loadNodesJSON reads a nodes file. A missing file yields an empty set.
+func loadNodesJSON(file string) (nodeSet, error) {
+	blob, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return make(nodeSet), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nodes nodeSet
+	if err := json.Unmarshal(blob, &nodes); err != nil {
+		return nil, fmt.Errorf("invalid nodes file %s: %v", file, err)
+	}
+	return nodes, nil
+}
+
+// writeNodesJSON writes a nodes file.
+func writeNodesJSON(file string, nodes nodeSet) error {
+	return writeJSON(file, nodes)
+}
+
+// records returns the node records of the set, sorted by the score of the
+// nodes, best first.
+func (ns nodeSet) records() []*enr.Record {
+	ids := make([]discover.NodeID, 0, len(ns))
+	for id, n := range ns {
+		if n.Record != nil && n.Record.Record != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ns[ids[i]].Score != ns[ids[j]].Score {
+			return ns[ids[i]].Score > ns[ids[j]].Score
+		}
+		return ids[i].String() < ids[j].String()
+	})
+	records := make([]*enr.Record, len(ids))
+	for i, id := range ids {
+		records[i] = ns[id].Record.Record
+	}
+	return records
+}
+
+// writeJSON writes a value to a file as indented JSON, or to stdout if the file
+// name is "-".
+func writeJSON(file string, value interface{}) error {
+	blob, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	blob = append(blob, '\n')
+	if file == "-" {
+		_, err := os.Stdout.Write(blob)
+		return err
+	}
+	return ioutil.WriteFile(file, blob, 0644)
+}
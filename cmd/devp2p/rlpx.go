@@ -0,0 +1,232 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/common/hexutil"
+	"github.com/watchain/go-watchain/core/forkid"
+	"github.com/watchain/go-watchain/event"
+	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/wat"
+)
+
+const probeTimeout = 15 * time.Second
+
+var (
+	errProbeTimeout = errors.New("probe timed out")
+	errProbeAborted = errors.New("probe aborted")
+)
+
+// rlpxInfo is the information reported by a node during the RLPx handshake
+// and the wat protocol handshake.
+type rlpxInfo struct {
+	name   string
+	caps   []p2p.Cap
+	status *watStatus // nil if the wat handshake failed
+}
+
+// watStatus is the status message of the wat protocol. The fork identifier is
+// only sent by wat/64 and later.
+type watStatus struct {
+	ProtocolVersion uint32
+	NetworkId       uint64
+	TD              *big.Int
+	CurrentBlock    common.Hash
+	GenesisBlock    common.Hash
+	Rest            []rlp.RawValue `rlp:"tail"`
+}
+
+// forkJSON is the JSON encoding of a fork identifier.
+type forkJSON struct {
+	Hash hexutil.Bytes `json:"hash"`
+	Next uint64        `json:"next"`
+}
+
+// forkID decodes the fork identifier of the status, if present.
+func (s *watStatus) forkID() *forkJSON {
+	if len(s.Rest) == 0 {
+		return nil
+	}
+	var id forkid.ID
+	if err := rlp.DecodeBytes(s.Rest[0], &id); err != nil {
+		return nil
+	}
+	return &forkJSON{Hash: id.Hash[:], Next: id.Next}
+}
+
+// rlpxProber connects to nodes to query their client information. It runs a
+// p2p server which dials the probed nodes as static peers. The client name and
+// capabilities are recorded as soon as a node is added, nodes that don't speak
+// the wat protocol are disconnected right away and wat nodes as soon as their
+// status was received.
+type rlpxProber struct {
+	srv *p2p.Server
+	sub event.Subscription
+
+	mu      sync.Mutex
+	pending map[discover.NodeID]chan *rlpxInfo
+}
+
+func newRLPxProber(key *ecdsa.PrivateKey) (*rlpxProber, error) {
+	p := &rlpxProber{pending: make(map[discover.NodeID]chan *rlpxInfo)}
+	var protocols []p2p.Protocol
+	for i, version := range wat.ProtocolVersions {
+		protocols = append(protocols, p2p.Protocol{
+			Name:    wat.ProtocolName,
+			Version: version,
+			Length:  wat.ProtocolLengths[i],
+			Run:     p.runPeer,
+		})
+	}
+	p.srv = &p2p.Server{Config: p2p.Config{
+		PrivateKey:         key,
+		Name:               "devp2p-crawler",
+		MaxPeers:           2 * crawlWorkers,
+		NoDiscovery:        true,
+		Protocols:          protocols,
+		AcceptUselessPeers: true,
+	}}
+	if err := p.srv.Start(); err != nil {
+		return nil, err
+	}
+	events := make(chan *p2p.PeerEvent, 2*crawlWorkers)
+	p.sub = p.srv.SubscribeEvents(events)
+	go p.eventLoop(events)
+	return p, nil
+}
+
+// stop shuts down the p2p server of the prober.
+func (p *rlpxProber) stop() {
+	p.sub.Unsubscribe()
+	p.srv.Stop()
+}
+
+// probe connects to the given node and waits for its client information. The
+// status is only reported if the node speaks the wat protocol.
+func (p *rlpxProber) probe(n *discover.Node, abort <-chan struct{}) (*rlpxInfo, error) {
+	ch := make(chan *rlpxInfo, 1)
+	p.mu.Lock()
+	if _, ok := p.pending[n.ID]; ok {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("probe of %x already in progress", n.ID[:8])
+	}
+	p.pending[n.ID] = ch
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, n.ID)
+		p.mu.Unlock()
+		p.srv.RemovePeer(n)
+	}()
+	p.srv.AddPeer(n)
+
+	timeout := time.NewTimer(probeTimeout)
+	defer timeout.Stop()
+	select {
+	case info := <-ch:
+		return info, nil
+	case <-timeout.C:
+		return nil, errProbeTimeout
+	case <-abort:
+		return nil, errProbeAborted
+	}
+}
+
+// eventLoop reports the client information of added nodes which share no
+// protocol with the prober, the status of wat nodes is awaited by runPeer.
+func (p *rlpxProber) eventLoop(events <-chan *p2p.PeerEvent) {
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type != p2p.PeerEventTypeAdd {
+				continue
+			}
+			for _, peer := range p.srv.Peers() {
+				if peer.ID() == ev.Peer && !p.sharesProtocol(peer.Caps()) {
+					p.deliver(ev.Peer, &rlpxInfo{name: peer.Name(), caps: peer.Caps()})
+				}
+			}
+		case <-p.sub.Err():
+			return
+		}
+	}
+}
+
+// sharesProtocol reports whwater any of the capabilities is run by the prober.
+func (p *rlpxProber) sharesProtocol(caps []p2p.Cap) bool {
+	for _, cap := range caps {
+		for _, proto := range p.srv.Protocols {
+			if cap.Name == proto.Name && cap.Version == proto.Version {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deliver hands the client information to the probe of the node, if any.
+func (p *rlpxProber) deliver(id discover.NodeID, info *rlpxInfo) {
+	p.mu.Lock()
+	ch := p.pending[id]
+	p.mu.Unlock()
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- info:
+	default: // node reconnected during the probe
+	}
+}
+
+// runPeer is the protocol handler of the prober. It reads the status message
+// of the remote node and returns, causing a disconnect.
+func (p *rlpxProber) runPeer(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+	p.mu.Lock()
+	_, ok := p.pending[peer.ID()]
+	p.mu.Unlock()
+	if !ok {
+		return errors.New("unexpected peer")
+	}
+	info := &rlpxInfo{name: peer.Name(), caps: peer.Caps()}
+	defer p.deliver(peer.ID(), info)
+
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+	if msg.Code != wat.StatusMsg {
+		return fmt.Errorf("first message has code %d, want status", msg.Code)
+	}
+	status := new(watStatus)
+	if err := msg.Decode(status); err != nil {
+		return err
+	}
+	info.status = status
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-watereum.
+//
+// go-watereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-watereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-watereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+
+	"github.com/watchain/go-watchain/cmd/devp2p/internal/wattest"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/internal/utesting"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	rlpxCommand = cli.Command{
+		Name:  "rlpx",
+		Usage: "RLPx commands",
+		Subcommands: []cli.Command{
+			rlpxWatTestCommand,
+		},
+	}
+	rlpxWatTestCommand = cli.Command{
+		Name:      "wat-test",
+		Usage:     "Runs the wat protocol conformance tests against a node",
+		ArgsUsage: "<node> <chain.rlp> <genesis.json>",
+		Description: `
+Connects to the node at the given enode URL and checks its handshake, its
+responses to chain queries and its handling of malformed messages. The node must
+have imported exactly the blocks of the chain file (e.g. created by 'gtst export')
+on top of the genesis block of the genesis file.
+
+If --txkey is given, transaction propagation is tested as well. The account of
+the key must be funded in the genesis block and the node must accept
+transactions, i.e. be mining or have finished syncing.`,
+		Action: rlpxWatTest,
+		Flags: []cli.Flag{
+			txKeyFlag,
+		},
+	}
+)
+
+var txKeyFlag = cli.StringFlag{
+	Name:  "txkey",
+	Usage: "file containing the hex encoded key of a funded account",
+}
+
+// rlpxWatTest runs the wat protocol test suite.
+func rlpxWatTest(ctx *cli.Context) error {
+	if ctx.NArg() < 3 {
+		return fmt.Errorf("need node URL, chain file and genesis file as arguments")
+	}
+	dest, err := discover.ParseNode(ctx.Args().Get(0))
+	if err != nil {
+		return fmt.Errorf("invalid node URL: %v", err)
+	}
+	var txKey *ecdsa.PrivateKey
+	if file := ctx.String(txKeyFlag.Name); file != "" {
+		if txKey, err = crypto.LoadECDSA(file); err != nil {
+			return fmt.Errorf("can't load key: %v", err)
+		}
+	}
+	suite, err := wattest.NewSuite(dest, ctx.Args().Get(1), ctx.Args().Get(2), txKey)
+	if err != nil {
+		return err
+	}
+	results := utesting.RunTests(suite.AllTests(), os.Stdout)
+	if fails := utesting.CountFailures(results); fails > 0 {
+		return fmt.Errorf("%v of %v tests passed", len(results)-fails, len(results))
+	}
+	fmt.Printf("all %d tests passed\n", len(results))
+	return nil
+}
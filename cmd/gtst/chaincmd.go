@@ -19,9 +19,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -31,6 +33,7 @@ import (
 	"github.com/watchain/go-watchain/core"
 	"github.com/watchain/go-watchain/core/state"
 	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/wat/downloader"
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/event"
@@ -70,6 +73,9 @@ It expects the genesis file as argument.`,
 			utils.GCModeFlag,
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
+			utils.CacheNoPrefetchFlag,
+			utils.ArchiveRangeFlag,
+			utils.ArchiveTrustedFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -77,7 +83,14 @@ The import command imports blocks from an RLP-encoded form. The form can be one
 with several RLP-encoded blocks, or several files can be used.
 
 If only one file is used, import error will result in failure. If several files are used,
-processing will proceed even if an individual RLP-file import failure occurs.`,
+processing will proceed even if an individual RLP-file import failure occurs.
+
+Chain archives created with 'export --archive' are detected automatically. Their
+segments are verified in parallel and segments already present locally are skipped,
+so an interrupted import can simply be rerun. Use --archive.range to only import a
+slice of the archived blocks. Archives exported with --archive.receipts from a source
+you trust can be imported with --archive.trusted, which stores the archived receipts
+instead of executing the blocks; the state is then synced from the network.`,
 	}
 	exportCommand = cli.Command{
 		Action:    utils.MigrateFlags(exportChain),
@@ -88,13 +101,20 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 			utils.DataDirFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
+			utils.ArchiveFlag,
+			utils.ArchiveSegmentFlag,
+			utils.ArchiveReceiptsFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 Requires a first argument of the file to write to.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
-if already existing.`,
+if already existing.
+
+With --archive the blocks are written into an indexed chain archive made of
+compressed, checksummed segments of --archive.segment blocks, optionally
+including the receipts. Archives are always overwritten, never appended.`,
 	}
 	copydbCommand = cli.Command{
 		Action:    utils.MigrateFlags(copyDb),
@@ -141,6 +161,23 @@ Remove blockchain and state databases`,
 The arguments are interpreted as block numbers or hashes.
 Use "watereum dump 0" to dump the genesis block.`,
 	}
+	checkpointCommand = cli.Command{
+		Action:    utils.MigrateFlags(makeCheckpoint),
+		Name:      "checkpoint",
+		Usage:     "Create a signed sync checkpoint from a local block",
+		ArgsUsage: "<blockNum> <keyfile> <filename>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.LightModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The checkpoint command signs the number, hash and total difficulty of a local
+canonical block with the hex encoded private key in <keyfile> and saves them as
+a checkpoint file. Nodes trusting the signer (--sync.checkpoint.signers) can sync
+an empty chain starting from it via --sync.checkpoint <filename>.`,
+	}
 )
 
 // initGenesis will initialise the given JSON format genesis file and writes it as
@@ -203,13 +240,25 @@ func importChain(ctx *cli.Context) error {
 	// Import the chain
 	start := time.Now()
 
+	importFile := func(fn string) error { return utils.ImportChain(chain, fn) }
+	if ctx.GlobalIsSet(utils.ArchiveRangeFlag.Name) || ctx.GlobalBool(utils.ArchiveTrustedFlag.Name) {
+		first, last := uint64(0), uint64(math.MaxUint64)
+		if ctx.GlobalIsSet(utils.ArchiveRangeFlag.Name) {
+			var err error
+			if first, last, err = parseArchiveRange(ctx.GlobalString(utils.ArchiveRangeFlag.Name)); err != nil {
+				utils.Fatalf("Option %q: %v", utils.ArchiveRangeFlag.Name, err)
+			}
+		}
+		trusted := ctx.GlobalBool(utils.ArchiveTrustedFlag.Name)
+		importFile = func(fn string) error { return utils.ImportArchive(chain, fn, first, last, trusted) }
+	}
 	if len(ctx.Args()) == 1 {
-		if err := utils.ImportChain(chain, ctx.Args().First()); err != nil {
+		if err := importFile(ctx.Args().First()); err != nil {
 			log.Error("Import error", "err", err)
 		}
 	} else {
 		for _, arg := range ctx.Args() {
-			if err := utils.ImportChain(chain, arg); err != nil {
+			if err := importFile(arg); err != nil {
 				log.Error("Import error", "file", arg, "err", err)
 			}
 		}
@@ -268,7 +317,21 @@ func exportChain(ctx *cli.Context) error {
 
 	var err error
 	fp := ctx.Args().First()
-	if len(ctx.Args()) < 3 {
+	if ctx.GlobalBool(utils.ArchiveFlag.Name) {
+		first, last := uint64(0), chain.CurrentBlock().NumberU64()
+		if len(ctx.Args()) >= 3 {
+			var ferr, lerr error
+			first, ferr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+			last, lerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+			if ferr != nil || lerr != nil {
+				utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+			}
+		}
+		err = utils.ExportArchive(chain, fp, first, last, core.ArchiveConfig{
+			SegmentSize: ctx.GlobalUint64(utils.ArchiveSegmentFlag.Name),
+			Receipts:    ctx.GlobalBool(utils.ArchiveReceiptsFlag.Name),
+		})
+	} else if len(ctx.Args()) < 3 {
 		err = utils.ExportChain(chain, fp)
 	} else {
 		// This can be improved to allow for numbers larger than 9223372036854775807
@@ -290,6 +353,26 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// parseArchiveRange parses a block range in the "first:last" format.
+func parseArchiveRange(s string) (uint64, uint64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q, want first:last", s)
+	}
+	first, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid first block %q: %v", parts[0], err)
+	}
+	last, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid last block %q: %v", parts[1], err)
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("first block %d is greater than last %d", first, last)
+	}
+	return first, last, nil
+}
+
 func copyDb(ctx *cli.Context) error {
 	// Ensure we have a source chain directory to copy
 	if len(ctx.Args()) != 1 {
@@ -300,7 +383,7 @@ func copyDb(ctx *cli.Context) error {
 	chain, chainDb := utils.MakeChain(ctx, stack)
 
 	syncmode := *utils.GlobalTextMarshaler(ctx, utils.SyncModeFlag.Name).(*downloader.SyncMode)
-	dl := downloader.New(syncmode, chainDb, new(event.TypeMux), chain, nil, nil)
+	dl := downloader.New(syncmode, nil, chainDb, new(event.TypeMux), chain, nil, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
 	db, err := watdb.NewLDBDatabase(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name), 256)
@@ -315,6 +398,9 @@ func copyDb(ctx *cli.Context) error {
 	if err = dl.RegisterPeer("local", 63, peer); err != nil {
 		return err
 	}
+	if err = dl.SnapSyncer().Register(peer); err != nil {
+		return err
+	}
 	// Synchronise with the simulated peer
 	start := time.Now()
 
@@ -393,6 +479,39 @@ func dump(ctx *cli.Context) error {
 	return nil
 }
 
+// makeCheckpoint signs a local canonical block as a sync checkpoint.
+func makeCheckpoint(ctx *cli.Context) error {
+	if len(ctx.Args()) != 3 {
+		utils.Fatalf("This command requires three arguments.")
+	}
+	number, err := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	if err != nil {
+		utils.Fatalf("Invalid block number: %v", err)
+	}
+	key, err := crypto.LoadECDSA(ctx.Args().Get(1))
+	if err != nil {
+		utils.Fatalf("Failed to load signing key: %v", err)
+	}
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	header := chain.GetHeaderByNumber(number)
+	if header == nil {
+		utils.Fatalf("Block #%d not found", number)
+	}
+	cp := &downloader.Checkpoint{
+		Number: number,
+		Hash:   header.Hash(),
+		TD:     chain.GetTd(header.Hash(), number),
+	}
+	if err := downloader.WriteCheckpointFile(ctx.Args().Get(2), cp, key); err != nil {
+		utils.Fatalf("Failed to write checkpoint: %v", err)
+	}
+	fmt.Printf("Checkpoint %v signed by %x\n", cp, crypto.PubkeyToAddress(key.PublicKey))
+	return nil
+}
+
 // hashish returns true for strings that look like hashes.
 func hashish(x string) bool {
 	_, err := strconv.Atoi(x)
@@ -86,12 +86,19 @@ var (
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
 		utils.GCModeFlag,
+		utils.SyncCheckpointFlag,
+		utils.SyncCheckpointSignersFlag,
+		utils.FinalityMaxDepthFlag,
+		utils.FinalityCheckpointsFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
+		utils.ULCServersFlag,
+		utils.ULCMinTrustedFractionFlag,
 		utils.LightKDFFlag,
 		utils.CacheFlag,
 		utils.CacheDatabaseFlag,
 		utils.CacheGCFlag,
+		utils.CacheNoPrefetchFlag,
 		utils.TrieCacheGenFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -104,6 +111,7 @@ var (
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
+		utils.DiscoveryDNSFlag,
 		utils.NetrestrictFlag,
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
@@ -159,6 +167,7 @@ func init() {
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
+		checkpointCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
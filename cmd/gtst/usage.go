@@ -76,10 +76,16 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RinkebyFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
+			utils.SyncCheckpointFlag,
+			utils.SyncCheckpointSignersFlag,
+			utils.FinalityMaxDepthFlag,
+			utils.FinalityCheckpointsFlag,
 			utils.watStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
 			utils.LightPeersFlag,
+			utils.ULCServersFlag,
+			utils.ULCMinTrustedFractionFlag,
 			utils.LightKDFFlag,
 		},
 	},
@@ -131,6 +137,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.CacheFlag,
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
+			utils.CacheNoPrefetchFlag,
 			utils.TrieCacheGenFlag,
 		},
 	},
@@ -174,6 +181,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.NATFlag,
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
+			utils.DiscoveryDNSFlag,
 			utils.NetrestrictFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
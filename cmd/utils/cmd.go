@@ -18,9 +18,11 @@
 package utils
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/signal"
 	"runtime"
@@ -82,19 +84,22 @@ func StartNode(stack *node.Node) {
 }
 
 func ImportChain(chain *core.BlockChain, fn string) error {
+	// Indexed chain archives are imported segment by segment
+	fh, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	if core.IsArchive(fh) {
+		log.Info("Importing chain archive", "file", fn)
+		return importArchive(chain, fh, 0, math.MaxUint64, false)
+	}
 	// Watch for Ctrl-C while the import is running.
 	// If a signal is received, the import will stop at the next batch.
-	interrupt := make(chan os.Signal, 1)
-	stop := make(chan struct{})
-	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(interrupt)
-	defer close(interrupt)
-	go func() {
-		if _, ok := <-interrupt; ok {
-			log.Info("Interrupted during import, stopping at next batch")
-		}
-		close(stop)
-	}()
+	stop, release := watchInterrupt()
+	defer release()
+
 	checkInterrupt := func() bool {
 		select {
 		case <-stop:
@@ -103,13 +108,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 			return false
 		}
 	}
-
 	log.Info("Importing blockchain", "file", fn)
-	fh, err := os.Open(fn)
-	if err != nil {
-		return err
-	}
-	defer fh.Close()
 
 	var reader io.Reader = fh
 	if strings.HasSuffix(fn, ".gz") {
@@ -162,6 +161,57 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 	return nil
 }
 
+// ImportArchive imports the given block range from an indexed chain archive,
+// verifying the archive segments in parallel. Segments already present in the
+// local chain are skipped, so an interrupted import can simply be rerun. The
+// blocks of a trusted archive are stored with their receipts without being
+// executed.
+func ImportArchive(chain *core.BlockChain, fn string, first uint64, last uint64, trusted bool) error {
+	log.Info("Importing chain archive", "file", fn, "first", first, "last", last, "trusted", trusted)
+	fh, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	return importArchive(chain, fh, first, last, trusted)
+}
+
+// importArchive imports a block range from an opened chain archive.
+func importArchive(chain *core.BlockChain, fh *os.File, first uint64, last uint64, trusted bool) error {
+	stop, release := watchInterrupt()
+	defer release()
+
+	stat, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+	archive, err := core.OpenArchive(fh, stat.Size())
+	if err != nil {
+		return err
+	}
+	return chain.ImportArchive(archive, first, last, runtime.NumCPU(), trusted, stop)
+}
+
+// watchInterrupt watches for Ctrl-C while an import is running, closing the
+// returned channel if a signal is received. The release function must be called
+// once the import is done to stop watching.
+func watchInterrupt() (<-chan struct{}, func()) {
+	interrupt := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			log.Info("Interrupted during import, stopping at next batch")
+		}
+		close(stop)
+	}()
+	return stop, func() {
+		signal.Stop(interrupt)
+		close(interrupt)
+	}
+}
+
 func missingBlocks(chain *core.BlockChain, blocks []*types.Block) []*types.Block {
 	head := chain.CurrentBlock()
 	for i, block := range blocks {
@@ -202,6 +252,27 @@ func ExportChain(blockchain *core.BlockChain, fn string) error {
 	return nil
 }
 
+// ExportArchive exports the given block range into an indexed chain archive,
+// overwriting the file if it already exists.
+func ExportArchive(blockchain *core.BlockChain, fn string, first uint64, last uint64, config core.ArchiveConfig) error {
+	log.Info("Exporting chain archive", "file", fn)
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	writer := bufio.NewWriter(fh)
+	if err := blockchain.ExportArchive(writer, first, last, config); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	log.Info("Exported chain archive", "file", fn)
+	return nil
+}
+
 func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, last uint64) error {
 	log.Info("Exporting blockchain", "file", fn)
 	// TODO verify mode perms
@@ -167,7 +167,7 @@ var (
 	defaultSyncMode = wat.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "light" or "snap")`,
 		Value: &defaultSyncMode,
 	}
 	GCModeFlag = cli.StringFlag{
@@ -175,6 +175,22 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	SyncCheckpointFlag = cli.StringFlag{
+		Name:  "sync.checkpoint",
+		Usage: "Trusted checkpoint (number:hash or signed checkpoint file) to sync an empty chain from",
+	}
+	SyncCheckpointSignersFlag = cli.StringFlag{
+		Name:  "sync.checkpoint.signers",
+		Usage: "Comma separated accounts trusted to sign checkpoint files",
+	}
+	FinalityMaxDepthFlag = cli.Uint64Flag{
+		Name:  "finality.maxdepth",
+		Usage: "Maximum number of canonical blocks a chain reorg may drop (0 = unlimited)",
+	}
+	FinalityCheckpointsFlag = cli.StringFlag{
+		Name:  "finality.checkpoints",
+		Usage: "Comma separated trusted checkpoints (number:hash) the canonical chain must contain",
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -185,6 +201,15 @@ var (
 		Usage: "Maximum number of LES client peers",
 		Value: wat.DefaultConfig.LightPeers,
 	}
+	ULCServersFlag = cli.StringFlag{
+		Name:  "ulc.servers",
+		Usage: "Comma separated enode URLs of the trusted LES servers (enables ultra light client mode)",
+	}
+	ULCMinTrustedFractionFlag = cli.IntFlag{
+		Name:  "ulc.fraction",
+		Usage: "Minimum percentage of trusted LES servers announcing a head to follow it (1-100)",
+		Value: 75,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -310,6 +335,10 @@ var (
 		Usage: "Percentage of cache memory allowance to use for trie pruning",
 		Value: 25,
 	}
+	CacheNoPrefetchFlag = cli.BoolFlag{
+		Name:  "cache.noprefetch",
+		Usage: "Disable speculative pre-execution of the next block during chain import",
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
@@ -377,6 +406,27 @@ var (
 		Name:  "nocompaction",
 		Usage: "Disables db compaction after import",
 	}
+	ArchiveFlag = cli.BoolFlag{
+		Name:  "archive",
+		Usage: "Export into an indexed, segmented chain archive instead of an RLP stream",
+	}
+	ArchiveSegmentFlag = cli.Uint64Flag{
+		Name:  "archive.segment",
+		Usage: "Number of blocks per chain archive segment",
+		Value: core.DefaultArchiveSegment,
+	}
+	ArchiveReceiptsFlag = cli.BoolFlag{
+		Name:  "archive.receipts",
+		Usage: "Include the block receipts in exported chain archives",
+	}
+	ArchiveRangeFlag = cli.StringFlag{
+		Name:  "archive.range",
+		Usage: "Block range (first:last) to import from chain archives",
+	}
+	ArchiveTrustedFlag = cli.BoolFlag{
+		Name:  "archive.trusted",
+		Usage: "Import the receipts of trusted chain archives instead of executing the blocks",
+	}
 	// RPC settings
 	RPCEnabledFlag = cli.BoolFlag{
 		Name:  "rpc",
@@ -500,6 +550,11 @@ var (
 		Name:  "v5disc",
 		Usage: "Enables the experimental RLPx V5 (Topic Discovery) mechanism",
 	}
+	DiscoveryDNSFlag = cli.StringFlag{
+		Name:  "discovery.dns",
+		Usage: "Comma separated enrtree:// URLs of DNS node lists used to find peers",
+		Value: "",
+	}
 	NetrestrictFlag = cli.StringFlag{
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
@@ -751,6 +806,29 @@ func makeDatabaseHandles() int {
 	return limit / 2 // Leave half for networking and other stuff
 }
 
+// makeSyncCheckpoint creates the trusted sync checkpoint either from its
+// number:hash form, or by loading a checkpoint file signed by a trusted signer.
+func makeSyncCheckpoint(ctx *cli.Context) *downloader.Checkpoint {
+	value := ctx.GlobalString(SyncCheckpointFlag.Name)
+	if cp, err := downloader.ParseCheckpoint(value); err == nil {
+		return cp
+	}
+	var signers []common.Address
+	if ctx.GlobalIsSet(SyncCheckpointSignersFlag.Name) {
+		for _, entry := range strings.Split(ctx.GlobalString(SyncCheckpointSignersFlag.Name), ",") {
+			if entry = strings.TrimSpace(entry); !common.IsHexAddress(entry) {
+				Fatalf("Option %q: invalid signer address %q", SyncCheckpointSignersFlag.Name, entry)
+			}
+			signers = append(signers, common.HexToAddress(entry))
+		}
+	}
+	cp, err := downloader.LoadCheckpointFile(value, signers)
+	if err != nil {
+		Fatalf("Option %q: %v", SyncCheckpointFlag.Name, err)
+	}
+	return cp
+}
+
 // MakeAddress converts an account specified directly as a hex encoded string or
 // a key index in the key store to an internal account representation.
 func MakeAddress(ks *keystore.KeyStore, account string) (accounts.Account, error) {
@@ -853,6 +931,10 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.DiscoveryV5 = true
 	}
 
+	if urls := ctx.GlobalString(DiscoveryDNSFlag.Name); urls != "" {
+		cfg.DiscoveryDNS = strings.Split(urls, ",")
+	}
+
 	if netrestrict := ctx.GlobalString(NetrestrictFlag.Name); netrestrict != "" {
 		list, err := netutil.ParseNetlist(netrestrict)
 		if err != nil {
@@ -1012,12 +1094,36 @@ func SetShhConfig(ctx *cli.Context, stack *node.Node, cfg *whisper.Config) {
 }
 
 // SetwatConfig applies wat-related command line flags to the config.
+// setULC configures the ultra light client mode from the command line flags.
+// Trusting a set of LES servers implies light synchronisation.
+func setULC(ctx *cli.Context, cfg *wat.Config) {
+	if !ctx.GlobalIsSet(ULCServersFlag.Name) {
+		return
+	}
+	var servers []string
+	for _, url := range strings.Split(ctx.GlobalString(ULCServersFlag.Name), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			servers = append(servers, url)
+		}
+	}
+	if len(servers) == 0 {
+		Fatalf("Option %q: no trusted servers specified", ULCServersFlag.Name)
+	}
+	fraction := ctx.GlobalInt(ULCMinTrustedFractionFlag.Name)
+	if fraction <= 0 || fraction > 100 {
+		Fatalf("Option %q: must be between 1 and 100", ULCMinTrustedFractionFlag.Name)
+	}
+	cfg.ULC = &wat.ULCConfig{TrustedServers: servers, MinTrustedFraction: fraction}
+	cfg.SyncMode = downloader.LightSync
+}
+
 func SetwatConfig(ctx *cli.Context, stack *node.Node, cfg *wat.Config) {
 	// Avoid conflicting network flags
 	checkExclusive(ctx, DeveloperFlag, TestnetFlag, RinkebyFlag)
 	checkExclusive(ctx, FastSyncFlag, LightModeFlag, SyncModeFlag)
 	checkExclusive(ctx, LightServFlag, LightModeFlag)
 	checkExclusive(ctx, LightServFlag, SyncModeFlag, "light")
+	checkExclusive(ctx, LightServFlag, ULCServersFlag)
 
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 	setwaterbase(ctx, ks, cfg)
@@ -1039,6 +1145,7 @@ func SetwatConfig(ctx *cli.Context, stack *node.Node, cfg *wat.Config) {
 	if ctx.GlobalIsSet(LightPeersFlag.Name) {
 		cfg.LightPeers = ctx.GlobalInt(LightPeersFlag.Name)
 	}
+	setULC(ctx, cfg)
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
@@ -1053,9 +1160,28 @@ func SetwatConfig(ctx *cli.Context, stack *node.Node, cfg *wat.Config) {
 	}
 	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
 
+	if ctx.GlobalIsSet(SyncCheckpointFlag.Name) {
+		cfg.SyncCheckpoint = makeSyncCheckpoint(ctx)
+	}
+	if ctx.GlobalIsSet(FinalityMaxDepthFlag.Name) {
+		cfg.MaxReorgDepth = ctx.GlobalUint64(FinalityMaxDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(FinalityCheckpointsFlag.Name) {
+		for _, entry := range strings.Split(ctx.GlobalString(FinalityCheckpointsFlag.Name), ",") {
+			cp, err := core.ParseCheckpoint(strings.TrimSpace(entry))
+			if err != nil {
+				Fatalf("Option %q: %v", FinalityCheckpointsFlag.Name, err)
+			}
+			cfg.Checkpoints = append(cfg.Checkpoints, cp)
+		}
+	}
+
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
+	if ctx.GlobalIsSet(CacheNoPrefetchFlag.Name) {
+		cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
+	}
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.GlobalInt(MinerThreadsFlag.Name)
 	}
@@ -1246,6 +1372,7 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
 		TrieNodeLimit: wat.DefaultConfig.TrieCache,
 		TrieTimeLimit: wat.DefaultConfig.TrieTimeout,
+		NoPrefetch:    ctx.GlobalBool(CacheNoPrefetchFlag.Name),
 	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieNodeLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
@@ -0,0 +1,237 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/log"
+)
+
+var (
+	// errChainNotEmpty is returned when trying to anchor a chain that already
+	// contains blocks beyond the genesis at a checkpoint.
+	errChainNotEmpty = errors.New("chain not empty")
+
+	// errChainComplete is returned when backfilling a chain that isn't missing
+	// any ancestors.
+	errChainComplete = errors.New("chain already complete")
+)
+
+// TdMismatchError is returned when the total difficulty of the genesis block,
+// derived from a trusted checkpoint by backfilling its ancestors, doesn't match
+// the local genesis. The checkpoint's total difficulty was wrong.
+type TdMismatchError struct {
+	Have *big.Int
+	Want *big.Int
+}
+
+func (err *TdMismatchError) Error() string {
+	return fmt.Sprintf("checkpoint total difficulty mismatch: genesis has %v, want %v", err.Have, err.Want)
+}
+
+// ChainTail retrieves the oldest header of a chain anchored at a trusted
+// checkpoint whose ancestors are not yet backfilled, or nil if the chain is
+// complete down to the genesis block.
+func (bc *BlockChain) ChainTail() *types.Header {
+	tail, _ := bc.chainTail.Load().(*types.Header)
+	return tail
+}
+
+// InsertCheckpoint anchors an empty chain at a trusted checkpoint block, making
+// it both the head header and the head fast block, so that syncing can continue
+// from it without downloading and verifying all its ancestors first. These are
+// missing until backfilled via BackfillChain.
+//
+// The total difficulty of the checkpoint can't be verified until the backfill
+// reaches the genesis block, hence it needs to be trusted too.
+func (bc *BlockChain) InsertCheckpoint(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.hc.CurrentHeader().Number.Uint64() != 0 || bc.CurrentFastBlock().NumberU64() != 0 {
+		return errChainNotEmpty
+	}
+	var (
+		hash   = block.Hash()
+		number = block.NumberU64()
+	)
+	if number == 0 {
+		return fmt.Errorf("invalid checkpoint: genesis block")
+	}
+	if td == nil || td.Cmp(block.Difficulty()) < 0 {
+		return fmt.Errorf("invalid checkpoint total difficulty %v", td)
+	}
+	// A checkpoint right above the genesis block can be verified immediately
+	if number == 1 {
+		if block.ParentHash() != bc.genesisBlock.Hash() {
+			return fmt.Errorf("checkpoint #1 [%x…] not a child of the genesis block", hash[:4])
+		}
+		genesisTd := bc.GetTd(bc.genesisBlock.Hash(), 0)
+		if want := new(big.Int).Sub(td, block.Difficulty()); want.Cmp(genesisTd) != 0 {
+			return &TdMismatchError{Have: genesisTd, Want: want}
+		}
+	}
+	// Write the entire block along with its metadata as if it was fast synced
+	batch := bc.db.NewBatch()
+	if err := WriteTd(batch, hash, number, td); err != nil {
+		return err
+	}
+	if err := WriteHeader(batch, block.Header()); err != nil {
+		return err
+	}
+	if err := WriteCanonicalHash(batch, hash, number); err != nil {
+		return err
+	}
+	SetReceiptsData(bc.chainConfig, block, receipts)
+	if err := WriteBody(batch, hash, number, block.Body()); err != nil {
+		return fmt.Errorf("failed to write block body: %v", err)
+	}
+	if err := WriteBlockReceipts(batch, hash, number, receipts); err != nil {
+		return fmt.Errorf("failed to write block receipts: %v", err)
+	}
+	if err := WriteTxLookupEntries(batch, block); err != nil {
+		return fmt.Errorf("failed to write lookup metadata: %v", err)
+	}
+	if number > 1 {
+		if err := WriteChainTailHash(batch, hash); err != nil {
+			return err
+		}
+	}
+	if err := WriteHeadFastBlockHash(batch, hash); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	bc.hc.SetCurrentHeader(block.Header())
+	bc.currentFastBlock.Store(block)
+	if number > 1 {
+		bc.chainTail.Store(block.Header())
+	}
+	log.Info("Anchored chain at checkpoint", "number", number, "hash", hash, "td", td)
+	return nil
+}
+
+// BackfillChain inserts a batch of blocks along with their receipts directly
+// below the tail of a chain anchored at a trusted checkpoint, linking to it by
+// hash. The blocks are not verified beyond their linkage, which the checkpoint
+// vouches for. Their total difficulties are derived from the tail's and verified
+// against the genesis block once that is reached.
+func (bc *BlockChain) BackfillChain(blockChain types.Blocks, receiptChain []types.Receipts) (int, error) {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	tail := bc.ChainTail()
+	if tail == nil {
+		return 0, errChainComplete
+	}
+	if len(blockChain) == 0 {
+		return 0, nil
+	}
+	if len(blockChain) != len(receiptChain) {
+		return 0, fmt.Errorf("receipts mismatch: have %d, want %d", len(receiptChain), len(blockChain))
+	}
+	// Do a sanity check that the provided chain is ordered and linked to the tail
+	for i := 1; i < len(blockChain); i++ {
+		if blockChain[i].NumberU64() != blockChain[i-1].NumberU64()+1 || blockChain[i].ParentHash() != blockChain[i-1].Hash() {
+			return 0, fmt.Errorf("non contiguous backfill: item %d is #%d [%x…], item %d is #%d [%x…] (parent [%x…])", i-1, blockChain[i-1].NumberU64(),
+				blockChain[i-1].Hash().Bytes()[:4], i, blockChain[i].NumberU64(), blockChain[i].Hash().Bytes()[:4], blockChain[i].ParentHash().Bytes()[:4])
+		}
+	}
+	if last := blockChain[len(blockChain)-1]; last.Hash() != tail.ParentHash || last.NumberU64()+1 != tail.Number.Uint64() {
+		return 0, fmt.Errorf("backfill not linked to tail #%d [%x…]: have #%d [%x…]", tail.Number, tail.Hash().Bytes()[:4], last.NumberU64(), last.Hash().Bytes()[:4])
+	}
+	// Derive the total difficulties downwards from the tail, verifying the genesis
+	first := blockChain[0]
+
+	tds := make([]*big.Int, len(blockChain))
+	td := new(big.Int).Sub(bc.GetTd(tail.Hash(), tail.Number.Uint64()), tail.Difficulty)
+	for i := len(blockChain) - 1; i >= 0; i-- {
+		tds[i] = td
+		td = new(big.Int).Sub(td, blockChain[i].Difficulty())
+	}
+	if first.NumberU64() == 1 {
+		if first.ParentHash() != bc.genesisBlock.Hash() {
+			return 0, fmt.Errorf("backfilled block #1 [%x…] not a child of the genesis block", first.Hash().Bytes()[:4])
+		}
+		if genesisTd := bc.GetTd(bc.genesisBlock.Hash(), 0); td.Cmp(genesisTd) != 0 {
+			return 0, &TdMismatchError{Have: genesisTd, Want: td}
+		}
+	} else if td.Sign() < 0 {
+		return 0, &TdMismatchError{Have: bc.GetTd(bc.genesisBlock.Hash(), 0), Want: td}
+	}
+	// Write all the data out into the database and move the tail
+	var (
+		start = time.Now()
+		batch = bc.db.NewBatch()
+	)
+	for i, block := range blockChain {
+		hash, number := block.Hash(), block.NumberU64()
+
+		if err := WriteTd(batch, hash, number, tds[i]); err != nil {
+			return i, err
+		}
+		if err := WriteHeader(batch, block.Header()); err != nil {
+			return i, err
+		}
+		if err := WriteCanonicalHash(batch, hash, number); err != nil {
+			return i, err
+		}
+		SetReceiptsData(bc.chainConfig, block, receiptChain[i])
+		if err := WriteBody(batch, hash, number, block.Body()); err != nil {
+			return i, fmt.Errorf("failed to write block body: %v", err)
+		}
+		if err := WriteBlockReceipts(batch, hash, number, receiptChain[i]); err != nil {
+			return i, fmt.Errorf("failed to write block receipts: %v", err)
+		}
+		if err := WriteTxLookupEntries(batch, block); err != nil {
+			return i, fmt.Errorf("failed to write lookup metadata: %v", err)
+		}
+	}
+	if first.NumberU64() > 1 {
+		if err := WriteChainTailHash(batch, first.Hash()); err != nil {
+			return 0, err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	bc.mu.Lock()
+	if first.NumberU64() > 1 {
+		bc.chainTail.Store(first.Header())
+	} else {
+		DeleteChainTailHash(bc.db)
+		bc.chainTail.Store((*types.Header)(nil))
+	}
+	bc.mu.Unlock()
+
+	log.Debug("Backfilled chain segment", "count", len(blockChain), "elapsed", common.PrettyDuration(time.Since(start)),
+		"number", first.Number(), "hash", first.Hash())
+	if first.NumberU64() == 1 {
+		log.Info("Backfilled chain down to the genesis block")
+	}
+	return 0, nil
+}
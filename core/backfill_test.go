@@ -0,0 +1,142 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/watchain/go-watchain/consensus/ethash"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/core/vm"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// newBackfillTestChains creates a source chain of n blocks and an empty chain
+// sharing its genesis, returning the blocks, their receipts and total difficulties.
+func newBackfillTestChains(t *testing.T, n int) (*BlockChain, watdb.Database, []*types.Block, []types.Receipts, []*big.Int) {
+	source, genesis, blocks := newFinalityTestChain(t, n)
+
+	receipts := make([]types.Receipts, len(blocks))
+	tds := make([]*big.Int, len(blocks))
+	for i, block := range blocks {
+		receipts[i] = source.GetReceiptsByHash(block.Hash())
+		tds[i] = source.GetTd(block.Hash(), block.NumberU64())
+	}
+	db, _ := watdb.NewMemDatabase()
+	(&Genesis{Config: params.TestChainConfig}).MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{})
+	if blockchain.Genesis().Hash() != genesis.Hash() {
+		t.Fatalf("genesis mismatch")
+	}
+	return blockchain, db, blocks, receipts, tds
+}
+
+// Tests that a chain can be anchored at a checkpoint, extended on top of it and
+// backfilled below it down to the genesis block, also across restarts.
+func TestCheckpointBackfill(t *testing.T) {
+	blockchain, db, blocks, receipts, tds := newBackfillTestChains(t, 12)
+	defer blockchain.Stop()
+
+	// Anchor the chain at block #8 and ensure it became the head
+	if err := blockchain.InsertCheckpoint(blocks[7], receipts[7], tds[7]); err != nil {
+		t.Fatalf("failed to insert checkpoint: %v", err)
+	}
+	if head := blockchain.CurrentHeader(); head.Hash() != blocks[7].Hash() {
+		t.Fatalf("head header mismatch: have #%d, want #%d", head.Number, blocks[7].Number())
+	}
+	if head := blockchain.CurrentFastBlock(); head.Hash() != blocks[7].Hash() {
+		t.Fatalf("head fast block mismatch: have #%d, want #%d", head.Number(), blocks[7].Number())
+	}
+	if tail := blockchain.ChainTail(); tail == nil || tail.Hash() != blocks[7].Hash() {
+		t.Fatalf("chain tail mismatch: have %v, want #%d", tail, blocks[7].Number())
+	}
+	if header := blockchain.GetHeaderByNumber(5); header != nil {
+		t.Fatalf("header #5 present before backfill")
+	}
+	if err := blockchain.InsertCheckpoint(blocks[7], receipts[7], tds[7]); err != errChainNotEmpty {
+		t.Fatalf("reanchoring error mismatch: have %v, want %v", err, errChainNotEmpty)
+	}
+	// Extend the chain above the checkpoint
+	headers := make([]*types.Header, 0, len(blocks)-8)
+	for _, block := range blocks[8:] {
+		headers = append(headers, block.Header())
+	}
+	if _, err := blockchain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to extend anchored chain: %v", err)
+	}
+	if _, err := blockchain.InsertReceiptChain(blocks[8:], receipts[8:]); err != nil {
+		t.Fatalf("failed to extend anchored chain: %v", err)
+	}
+	if td := blockchain.GetTd(blocks[11].Hash(), 12); td.Cmp(tds[11]) != 0 {
+		t.Fatalf("head td mismatch: have %v, want %v", td, tds[11])
+	}
+	// Backfill a batch not linked to the tail and ensure it's rejected
+	if _, err := blockchain.BackfillChain(blocks[3:6], receipts[3:6]); err == nil {
+		t.Fatalf("unlinked backfill accepted")
+	}
+	// Backfill the middle of the chain, restart and backfill the rest
+	if _, err := blockchain.BackfillChain(blocks[4:7], receipts[4:7]); err != nil {
+		t.Fatalf("failed to backfill chain: %v", err)
+	}
+	blockchain.Stop()
+
+	blockchain, _ = NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{})
+	if tail := blockchain.ChainTail(); tail == nil || tail.Hash() != blocks[4].Hash() {
+		t.Fatalf("chain tail mismatch after restart: have %v, want #%d", tail, blocks[4].Number())
+	}
+	if _, err := blockchain.BackfillChain(blocks[:4], receipts[:4]); err != nil {
+		t.Fatalf("failed to backfill chain: %v", err)
+	}
+	if tail := blockchain.ChainTail(); tail != nil {
+		t.Fatalf("chain tail present after full backfill: #%d", tail.Number)
+	}
+	if _, err := blockchain.BackfillChain(blocks[:1], receipts[:1]); err != errChainComplete {
+		t.Fatalf("completed backfill error mismatch: have %v, want %v", err, errChainComplete)
+	}
+	for i, block := range blocks {
+		if header := blockchain.GetHeaderByNumber(block.NumberU64()); header == nil || header.Hash() != block.Hash() {
+			t.Errorf("block #%d: canonical header mismatch", block.Number())
+		}
+		if !blockchain.HasBlock(block.Hash(), block.NumberU64()) {
+			t.Errorf("block #%d: body missing", block.Number())
+		}
+		if td := blockchain.GetTd(block.Hash(), block.NumberU64()); td.Cmp(tds[i]) != 0 {
+			t.Errorf("block #%d: td mismatch: have %v, want %v", block.Number(), td, tds[i])
+		}
+	}
+}
+
+// Tests that a checkpoint with a wrong total difficulty is detected once the
+// backfill reaches the genesis block.
+func TestCheckpointBackfillTdMismatch(t *testing.T) {
+	blockchain, _, blocks, receipts, tds := newBackfillTestChains(t, 6)
+	defer blockchain.Stop()
+
+	if err := blockchain.InsertCheckpoint(blocks[4], receipts[4], new(big.Int).Add(tds[4], big.NewInt(1))); err != nil {
+		t.Fatalf("failed to insert checkpoint: %v", err)
+	}
+	_, err := blockchain.BackfillChain(blocks[:4], receipts[:4])
+	if _, ok := err.(*TdMismatchError); !ok {
+		t.Fatalf("backfill error mismatch: have %v, want TdMismatchError", err)
+	}
+	if tail := blockchain.ChainTail(); tail == nil || tail.Hash() != blocks[4].Hash() {
+		t.Fatalf("chain tail moved by failed backfill")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"math/big"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/watchain/go-watchain/common"
 	"github.com/watchain/go-watchain/common/math"
@@ -70,6 +71,24 @@ func BenchmarkInsertChain_ring1000_diskdb(b *testing.B) {
 	benchInsertChain(b, true, genTxRing(1000))
 }
 
+// The benchmarks below disable the speculative pre-execution of the followup
+// block, measuring the import speedup gained by prefetching.
+func BenchmarkInsertChain_valueTx_diskdb_noprefetch(b *testing.B) {
+	benchInsertChainPrefetch(b, true, false, genValueTx(0))
+}
+func BenchmarkInsertChain_ring200_memdb_noprefetch(b *testing.B) {
+	benchInsertChainPrefetch(b, false, false, genTxRing(200))
+}
+func BenchmarkInsertChain_ring200_diskdb_noprefetch(b *testing.B) {
+	benchInsertChainPrefetch(b, true, false, genTxRing(200))
+}
+func BenchmarkInsertChain_ring1000_memdb_noprefetch(b *testing.B) {
+	benchInsertChainPrefetch(b, false, false, genTxRing(1000))
+}
+func BenchmarkInsertChain_ring1000_diskdb_noprefetch(b *testing.B) {
+	benchInsertChainPrefetch(b, true, false, genTxRing(1000))
+}
+
 var (
 	// This is the content of the genesis block used by the benchmarks.
 	benchRootKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
@@ -145,6 +164,10 @@ func genUncles(i int, gen *BlockGen) {
 }
 
 func benchInsertChain(b *testing.B, disk bool, gen func(int, *BlockGen)) {
+	benchInsertChainPrefetch(b, disk, true, gen)
+}
+
+func benchInsertChainPrefetch(b *testing.B, disk bool, prefetch bool, gen func(int, *BlockGen)) {
 	// Create the database in memory or in a temporary directory.
 	var db watdb.Database
 	if !disk {
@@ -173,7 +196,12 @@ func benchInsertChain(b *testing.B, disk bool, gen func(int, *BlockGen)) {
 
 	// Time the insertion of the new chain.
 	// State and blocks are stored in the same DB.
-	chainman, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	cache := &CacheConfig{
+		TrieNodeLimit: 256 * 1024 * 1024,
+		TrieTimeLimit: 5 * time.Minute,
+		NoPrefetch:    !prefetch,
+	}
+	chainman, _ := NewBlockChain(db, cache, gspec.Config, ethash.NewFaker(), vm.Config{})
 	defer chainman.Stop()
 	b.ReportAllocs()
 	b.ResetTimer()
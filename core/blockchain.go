@@ -48,6 +48,14 @@ import (
 var (
 	blockInsertTimer = metrics.NewRegisteredTimer("chain/inserts", nil)
 
+	blockPrefetchExecuteTimer   = metrics.NewRegisteredTimer("chain/prefetch/executes", nil)
+	blockPrefetchInterruptMeter = metrics.NewRegisteredMeter("chain/prefetch/interrupts", nil)
+
+	reorgMeter          = metrics.NewRegisteredMeter("chain/reorg/executes", nil)
+	reorgDropMeter      = metrics.NewRegisteredMeter("chain/reorg/drop", nil)
+	reorgAddMeter       = metrics.NewRegisteredMeter("chain/reorg/add", nil)
+	reorgDepthHistogram = metrics.NewRegisteredHistogram("chain/reorg/depth", nil, metrics.NewExpDecaySample(1028, 0.015))
+
 	ErrNoGenesis = errors.New("Genesis not found in chain")
 )
 
@@ -69,6 +77,7 @@ type CacheConfig struct {
 	Disabled      bool          // Whwater to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+	NoPrefetch    bool          // Whwater to disable speculative pre-execution of the next block during import
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -99,6 +108,8 @@ type BlockChain struct {
 	chainSideFeed event.Feed
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
+	reorgFeed     event.Feed
+	finalityFeed  event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -107,8 +118,10 @@ type BlockChain struct {
 	procmu  sync.RWMutex // block processor lock
 
 	checkpoint       int          // checkpoint counts towards the new checkpoint
+	finality         *finality    // Operator configured reorg limits and trusted checkpoints
 	currentBlock     atomic.Value // Current head of the block chain
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
+	chainTail        atomic.Value // Oldest header of a checkpoint anchored chain missing its ancestors (nil if complete)
 
 	stateCache   state.Database // State database to reuse between imports (contains state cache)
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
@@ -122,10 +135,11 @@ type BlockChain struct {
 	procInterrupt int32          // interrupt signaler for block processing
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 
-	engine    consensus.Engine
-	processor Processor // block processor interface
-	validator Validator // block and state validator interface
-	vmConfig  vm.Config
+	engine     consensus.Engine
+	processor  Processor  // block processor interface
+	prefetcher Prefetcher // block state prefetcher interface
+	validator  Validator  // block and state validator interface
+	vmConfig   vm.Config
 
 	badBlocks *lru.Cache // Bad block cache
 }
@@ -160,9 +174,11 @@ func NewBlockChain(db watdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		engine:       engine,
 		vmConfig:     vmConfig,
 		badBlocks:    badBlocks,
+		finality:     newFinality(),
 	}
 	bc.SetValidator(NewBlockValidator(chainConfig, bc, engine))
 	bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine))
+	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
 
 	var err error
 	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.getProcInterrupt)
@@ -243,6 +259,13 @@ func (bc *BlockChain) loadLaswatate() error {
 		}
 	}
 
+	// Restore the tail of a chain anchored at a checkpoint, if not yet backfilled
+	bc.chainTail.Store((*types.Header)(nil))
+	if tail := GetChainTailHash(bc.db); tail != (common.Hash{}) {
+		if header := bc.GetHeaderByHash(tail); header != nil {
+			bc.chainTail.Store(header)
+		}
+	}
 	// Issue a status log for the user
 	currentFastBlock := bc.CurrentFastBlock()
 
@@ -274,6 +297,10 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Drop the tail of a checkpoint anchored chain if it was rewound below it
+	if tail := bc.ChainTail(); tail != nil && tail.Number.Uint64() > currentHeader.Number.Uint64() {
+		DeleteChainTailHash(bc.db)
+	}
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -387,6 +414,11 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache)
 }
 
+// StateCache returns the caching database underpinning the blockchain instance.
+func (bc *BlockChain) StateCache() state.Database {
+	return bc.stateCache
+}
+
 // Reset purges the entire blockchain, restoring it to its genesis state.
 func (bc *BlockChain) Reset() error {
 	return bc.ResetWithGenesisBlock(bc.genesisBlock)
@@ -1056,6 +1088,11 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 			bc.reportBlock(block, nil, ErrBlacklistedHash)
 			return i, events, coalescedLogs, ErrBlacklistedHash
 		}
+		// If the block contradicts a trusted checkpoint, abort
+		if err := bc.finality.verifyHeader(block.Header()); err != nil {
+			bc.reportFinalityViolation(block.Header(), err)
+			return i, events, coalescedLogs, err
+		}
 		// Wait for the block's verification to complete
 		bstart := time.Now()
 
@@ -1125,20 +1162,31 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 			bc.reportBlock(block, nil, err)
 			return i, events, coalescedLogs, err
 		}
-		// Create a new statedb using the parent block and report an
-		// error if it fails.
 		var parent *types.Block
 		if i == 0 {
 			parent = bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
 		} else {
 			parent = chain[i-1]
 		}
+		// If we have a followup block, run that against the current state to pre-cache
+		// transactions and probabilistically some of the account/storage trie nodes.
+		var followupInterrupt uint32
+
+		if !bc.cacheConfig.NoPrefetch && i+1 < len(chain) {
+			if throwaway, err := state.New(parent.Root(), bc.stateCache); err == nil {
+				go bc.prefetch(chain[i+1], throwaway, &followupInterrupt)
+			}
+		}
+		// Create a new statedb using the parent block and report an
+		// error if it fails.
 		state, err := state.New(parent.Root(), bc.stateCache)
 		if err != nil {
+			atomic.StoreUint32(&followupInterrupt, 1)
 			return i, events, coalescedLogs, err
 		}
 		// Process block using the parent state as reference point.
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
+		atomic.StoreUint32(&followupInterrupt, 1)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
@@ -1187,6 +1235,14 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	return 0, events, coalescedLogs, nil
 }
 
+// prefetch speculatively executes a block on top of a throwaway state to warm
+// up the signature and trie caches ahead of the real processing.
+func (bc *BlockChain) prefetch(block *types.Block, throwaway *state.StateDB, interrupt *uint32) {
+	start := time.Now()
+	bc.prefetcher.Prefetch(block, throwaway, bc.vmConfig, interrupt)
+	blockPrefetchExecuteTimer.UpdateSince(start)
+}
+
 // inserwatats tracks and reports on block insertion.
 type inserwatats struct {
 	queued, processed, ignored int
@@ -1242,6 +1298,7 @@ func countTransactions(chain []*types.Block) (c int) {
 // event about them
 func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	var (
+		newHead     = newBlock
 		newChain    types.Blocks
 		oldChain    types.Blocks
 		commonBlock *types.Block
@@ -1304,6 +1361,11 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			return fmt.Errorf("Invalid new chain")
 		}
 	}
+	// Refuse reorgs dropping finalized blocks
+	if err := bc.finality.verifyReorg(commonBlock.NumberU64(), uint64(len(oldChain))); err != nil {
+		bc.reportFinalityViolation(newHead.Header(), err)
+		return err
+	}
 	// Ensure the user sees large reorgs
 	if len(oldChain) > 0 && len(newChain) > 0 {
 		logFn := log.Debug
@@ -1343,7 +1405,27 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			}
 		}()
 	}
-
+	if len(oldChain) > 0 || len(newChain) > 0 {
+		reorgMeter.Mark(1)
+		reorgDropMeter.Mark(int64(len(oldChain)))
+		reorgAddMeter.Mark(int64(len(newChain)))
+		reorgDepthHistogram.Update(int64(len(oldChain)))
+
+		// Both branches were collected head first, flip them for the notification
+		ev := ChainReorgEvent{
+			CommonAncestor: commonBlock,
+			OldChain:       make(types.Blocks, len(oldChain)),
+			NewChain:       make(types.Blocks, len(newChain)),
+		}
+		for i, block := range oldChain {
+			ev.OldChain[len(oldChain)-1-i] = block
+		}
+		for i, block := range newChain {
+			ev.NewChain[len(newChain)-1-i] = block
+		}
+		// Send synchronously, so subscribers receive consecutive reorgs in order
+		bc.reorgFeed.Send(ev)
+	}
 	return nil
 }
 
@@ -1439,6 +1521,10 @@ func (bc *BlockChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (i
 	if i, err := bc.hc.ValidateHeaderChain(chain, checkFreq); err != nil {
 		return i, err
 	}
+	if i, err := bc.verifyHeaderFinality(chain); err != nil {
+		bc.reportFinalityViolation(chain[i], err)
+		return i, err
+	}
 
 	// Make sure only one thread manipulates the chain at once
 	bc.chainmu.Lock()
@@ -1552,6 +1638,16 @@ func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Su
 	return bc.scope.Track(bc.chainSideFeed.Subscribe(ch))
 }
 
+// SubscribeChainReorgEvent registers a subscription of ChainReorgEvent.
+func (bc *BlockChain) SubscribeChainReorgEvent(ch chan<- ChainReorgEvent) event.Subscription {
+	return bc.scope.Track(bc.reorgFeed.Subscribe(ch))
+}
+
+// SubscribeFinalityViolationEvent registers a subscription of FinalityViolationEvent.
+func (bc *BlockChain) SubscribeFinalityViolationEvent(ch chan<- FinalityViolationEvent) event.Subscription {
+	return bc.scope.Track(bc.finalityFeed.Subscribe(ch))
+}
+
 // SubscribeLogsEvent registers a subscription of []*types.Log.
 func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
@@ -978,6 +978,95 @@ done:
 
 }
 
+// Tests that a reorg emits a single ChainReorgEvent carrying the common ancestor
+// and both branches ordered from the ancestor upwards.
+func TestReorgEvent(t *testing.T) {
+	var (
+		db, _   = watdb.NewMemDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig}
+		genesis = gspec.MustCommit(db)
+	)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	chain, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, gen *BlockGen) {})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	replacement, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 5, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	reorgCh := make(chan ChainReorgEvent, 8)
+	sub := blockchain.SubscribeChainReorgEvent(reorgCh)
+	defer sub.Unsubscribe()
+
+	if _, err := blockchain.InsertChain(replacement); err != nil {
+		t.Fatalf("failed to insert replacement chain: %v", err)
+	}
+	select {
+	case ev := <-reorgCh:
+		if ev.CommonAncestor.Hash() != genesis.Hash() {
+			t.Errorf("common ancestor mismatch: have %x, want %x", ev.CommonAncestor.Hash(), genesis.Hash())
+		}
+		if ev.Depth() != len(chain) {
+			t.Fatalf("reorg depth mismatch: have %d, want %d", ev.Depth(), len(chain))
+		}
+		for i, block := range ev.OldChain {
+			if block.Hash() != chain[i].Hash() {
+				t.Errorf("dropped block %d mismatch: have %x, want %x", i, block.Hash(), chain[i].Hash())
+			}
+		}
+		if len(ev.NewChain) < len(chain) {
+			t.Fatalf("added branch too short: have %d, want at least %d", len(ev.NewChain), len(chain))
+		}
+		for i, block := range ev.NewChain {
+			if block.Hash() != replacement[i].Hash() {
+				t.Errorf("added block %d mismatch: have %x, want %x", i, block.Hash(), replacement[i].Hash())
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout. There is no ChainReorgEvent has been sent.")
+	}
+}
+
+// Tests that consecutive reorgs are delivered to the subscribers in the order
+// they happened, by the time the insertion returns.
+func TestReorgEventOrder(t *testing.T) {
+	var (
+		db, _   = watdb.NewMemDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig}
+		genesis = gspec.MustCommit(db)
+	)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	reorgCh := make(chan ChainReorgEvent, 8)
+	sub := blockchain.SubscribeChainReorgEvent(reorgCh)
+	defer sub.Unsubscribe()
+
+	// Insert ever longer branches forking off the genesis block
+	var branches [][]*types.Block
+	for i := 0; i < 4; i++ {
+		branch, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2*i+1, func(n int, gen *BlockGen) {
+			gen.SetCoinbase(common.Address{byte(i)})
+		})
+		if _, err := blockchain.InsertChain(branch); err != nil {
+			t.Fatalf("branch %d: failed to insert: %v", i, err)
+		}
+		branches = append(branches, branch)
+	}
+	for i := 1; i < len(branches); i++ {
+		select {
+		case ev := <-reorgCh:
+			if ev.OldChain[0].Hash() != branches[i-1][0].Hash() || ev.NewChain[0].Hash() != branches[i][0].Hash() {
+				t.Errorf("reorg %d: branch mismatch: have %x -> %x, want %x -> %x", i, ev.OldChain[0].Hash(), ev.NewChain[0].Hash(), branches[i-1][0].Hash(), branches[i][0].Hash())
+			}
+		default:
+			t.Fatalf("reorg %d: event not delivered", i)
+		}
+	}
+}
+
 // Tests if the canonical block can be fetched from the database during chain insertion.
 func TestCanonicalBlockRetrieval(t *testing.T) {
 	_, blockchain, err := newCanonical(ethash.NewFaker(), 0, true)
@@ -0,0 +1,535 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+// Chain archives are single files made up of independently compressed segments
+// of consecutive blocks, followed by an index describing every segment:
+//
+//   magic | segment 0 | ... | segment N | RLP(index) | index offset (8 bytes) | magic
+//
+// Each segment is a gzip compressed stream of RLP encoded archive entries and is
+// checksummed in the index, so any block range can be located, verified and
+// imported without reading the archive from the start.
+
+const (
+	// DefaultArchiveSegment is the default number of blocks stored per segment.
+	DefaultArchiveSegment = 2048
+
+	// MaxArchiveSegment is the maximum number of blocks stored per segment.
+	MaxArchiveSegment = 65536
+
+	archiveVersion = 1       // Current version of the archive format
+	archiveMaxData = 1 << 30 // Maximum decompressed size of a segment
+)
+
+var (
+	archiveMagic = []byte("WATARCH1") // Marker at the start and end of an archive
+
+	errArchiveMagic   = errors.New("not a chain archive")
+	errArchiveVersion = errors.New("unsupported chain archive version")
+	errArchiveSegment = errors.New("unknown archive segment")
+	errArchiveTooBig  = errors.New("archive segment too big")
+	errArchiveAborted = errors.New("archive import aborted")
+	errArchiveTrusted = errors.New("trusted import needs an archive with receipts")
+)
+
+// ArchiveConfig contains the parameters of a chain archive export.
+type ArchiveConfig struct {
+	SegmentSize uint64 // Number of blocks per segment (0 = DefaultArchiveSegment, at most MaxArchiveSegment)
+	Receipts    bool   // Whwater to include the block receipts
+}
+
+// ArchiveSegment is the index entry of a single archive segment.
+type ArchiveSegment struct {
+	First    uint64      // Number of the first block in the segment
+	Last     uint64      // Number of the last block in the segment
+	LastHash common.Hash // Hash of the last block, used to skip known segments
+	Offset   uint64      // Position of the compressed segment in the archive
+	Size     uint64      // Length of the compressed segment in bytes
+	Checksum common.Hash // Keccak256 hash of the compressed segment
+}
+
+// archiveIndex is the trailing index of a chain archive.
+type archiveIndex struct {
+	Version     uint
+	Receipts    bool
+	SegmentSize uint64 // Maximum number of blocks in a segment
+	Segments    []ArchiveSegment
+}
+
+// validSegment reports whwater the block range of a segment is well formed and
+// doesn't exceed the segment size of the archive.
+func (index *archiveIndex) validSegment(segment ArchiveSegment) bool {
+	return segment.First <= segment.Last && segment.Last-segment.First < index.SegmentSize
+}
+
+// archiveEntry is a single block stored in an archive segment.
+type archiveEntry struct {
+	Block    *types.Block
+	Receipts []*types.ReceiptForStorage
+}
+
+// ArchiveBatch is the verified content of an archive segment.
+type ArchiveBatch struct {
+	Segment  ArchiveSegment
+	Blocks   types.Blocks
+	Receipts []types.Receipts // Empty if the archive contains no receipts
+	Err      error            // Set if the segment could not be read or verified
+}
+
+// countingWriter tracks the number of bytes written to an underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += uint64(n)
+	return n, err
+}
+
+// ExportArchive writes the given range of the active chain into a segmented,
+// indexed chain archive.
+func (bc *BlockChain) ExportArchive(w io.Writer, first uint64, last uint64, config ArchiveConfig) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	if config.SegmentSize == 0 {
+		config.SegmentSize = DefaultArchiveSegment
+	}
+	if config.SegmentSize > MaxArchiveSegment {
+		return fmt.Errorf("export failed: segment size %d exceeds the maximum of %d", config.SegmentSize, MaxArchiveSegment)
+	}
+	log.Info("Exporting chain archive", "count", last-first+1, "segment", config.SegmentSize, "receipts", config.Receipts)
+
+	out := &countingWriter{w: w}
+	if _, err := out.Write(archiveMagic); err != nil {
+		return err
+	}
+	index := archiveIndex{Version: archiveVersion, Receipts: config.Receipts, SegmentSize: config.SegmentSize}
+	for start := first; start <= last; start += config.SegmentSize {
+		end := start + config.SegmentSize - 1
+		if end > last || end < start {
+			end = last
+		}
+		segment, err := bc.exportSegment(out, start, end, config.Receipts)
+		if err != nil {
+			return err
+		}
+		index.Segments = append(index.Segments, segment)
+		log.Debug("Exported archive segment", "first", segment.First, "last", segment.Last, "size", segment.Size)
+
+		if end == last {
+			break
+		}
+	}
+	// Append the index and the trailer pointing to it
+	offset := out.n
+	if err := rlp.Encode(out, &index); err != nil {
+		return err
+	}
+	trailer := make([]byte, 8, 8+len(archiveMagic))
+	binary.BigEndian.PutUint64(trailer, offset)
+	_, err := out.Write(append(trailer, archiveMagic...))
+	return err
+}
+
+// exportSegment compresses and writes a single segment of blocks, returning
+// its index entry.
+func (bc *BlockChain) exportSegment(out *countingWriter, first uint64, last uint64, receipts bool) (ArchiveSegment, error) {
+	var (
+		buf = new(bytes.Buffer)
+		zw  = gzip.NewWriter(buf)
+
+		hash common.Hash
+	)
+	for nr := first; nr <= last; nr++ {
+		block := bc.GetBlockByNumber(nr)
+		if block == nil {
+			return ArchiveSegment{}, fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		entry := archiveEntry{Block: block}
+		if receipts {
+			for _, receipt := range GetBlockReceipts(bc.db, block.Hash(), nr) {
+				entry.Receipts = append(entry.Receipts, (*types.ReceiptForStorage)(receipt))
+			}
+		}
+		if err := rlp.Encode(zw, &entry); err != nil {
+			return ArchiveSegment{}, err
+		}
+		hash = block.Hash()
+	}
+	if err := zw.Close(); err != nil {
+		return ArchiveSegment{}, err
+	}
+	segment := ArchiveSegment{
+		First:    first,
+		Last:     last,
+		LastHash: hash,
+		Offset:   out.n,
+		Size:     uint64(buf.Len()),
+		Checksum: crypto.Keccak256Hash(buf.Bytes()),
+	}
+	_, err := out.Write(buf.Bytes())
+	return segment, err
+}
+
+// IsArchive reports whwater the given data source starts with the chain archive
+// magic marker.
+func IsArchive(r io.ReaderAt) bool {
+	magic := make([]byte, len(archiveMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, archiveMagic)
+}
+
+// ArchiveReader provides random access to the segments of a chain archive. It
+// is safe for concurrent use if the underlying io.ReaderAt is.
+type ArchiveReader struct {
+	r     io.ReaderAt
+	index archiveIndex
+}
+
+// OpenArchive parses the index of a chain archive of the given total size.
+func OpenArchive(r io.ReaderAt, size int64) (*ArchiveReader, error) {
+	trailer := make([]byte, 8+len(archiveMagic))
+	if size < int64(len(archiveMagic)+len(trailer)) || !IsArchive(r) {
+		return nil, errArchiveMagic
+	}
+	if _, err := r.ReadAt(trailer, size-int64(len(trailer))); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(trailer[8:], archiveMagic) {
+		return nil, errArchiveMagic
+	}
+	offset := binary.BigEndian.Uint64(trailer[:8])
+	if offset < uint64(len(archiveMagic)) || offset > uint64(size)-uint64(len(trailer)) {
+		return nil, fmt.Errorf("invalid archive index offset %d", offset)
+	}
+	var index archiveIndex
+	section := io.NewSectionReader(r, int64(offset), size-int64(len(trailer))-int64(offset))
+	if err := rlp.Decode(section, &index); err != nil {
+		return nil, fmt.Errorf("invalid archive index: %v", err)
+	}
+	if index.Version != archiveVersion {
+		return nil, errArchiveVersion
+	}
+	if index.SegmentSize == 0 || index.SegmentSize > MaxArchiveSegment {
+		return nil, fmt.Errorf("invalid archive segment size %d", index.SegmentSize)
+	}
+	for i, segment := range index.Segments {
+		if !index.validSegment(segment) || segment.Offset+segment.Size < segment.Offset || segment.Offset+segment.Size > offset {
+			return nil, fmt.Errorf("invalid archive segment %d", i)
+		}
+		if i > 0 && segment.First != index.Segments[i-1].Last+1 {
+			return nil, fmt.Errorf("non contiguous archive segment %d: #%d after #%d", i, segment.First, index.Segments[i-1].Last)
+		}
+	}
+	return &ArchiveReader{r: r, index: index}, nil
+}
+
+// Segments returns the index entries of all the segments in the archive.
+func (a *ArchiveReader) Segments() []ArchiveSegment {
+	return append([]ArchiveSegment{}, a.index.Segments...)
+}
+
+// HasReceipts reports whwater the archive contains the block receipts.
+func (a *ArchiveReader) HasReceipts() bool {
+	return a.index.Receipts
+}
+
+// Range returns the indices of the segments overlapping the given block range.
+func (a *ArchiveReader) Range(first uint64, last uint64) []int {
+	segments := a.index.Segments
+	start := sort.Search(len(segments), func(i int) bool { return segments[i].Last >= first })
+
+	var indices []int
+	for i := start; i < len(segments) && segments[i].First <= last; i++ {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// ReadSegment loads a single segment, verifying its checksum, the integrity of
+// each block body (and receipts if present) and the linkage of the blocks.
+func (a *ArchiveReader) ReadSegment(idx int) (types.Blocks, []types.Receipts, error) {
+	if idx < 0 || idx >= len(a.index.Segments) {
+		return nil, nil, errArchiveSegment
+	}
+	segment := a.index.Segments[idx]
+	if !a.index.validSegment(segment) {
+		return nil, nil, fmt.Errorf("invalid archive segment %d: #%d-#%d", idx, segment.First, segment.Last)
+	}
+	data := make([]byte, segment.Size)
+	if _, err := a.r.ReadAt(data, int64(segment.Offset)); err != nil {
+		return nil, nil, err
+	}
+	if hash := crypto.Keccak256Hash(data); hash != segment.Checksum {
+		return nil, nil, fmt.Errorf("segment %d checksum mismatch: have %x, want %x", idx, hash, segment.Checksum)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(zr, archiveMaxData+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) > archiveMaxData {
+		return nil, nil, errArchiveTooBig
+	}
+	var (
+		stream   = rlp.NewStream(bytes.NewReader(raw), uint64(len(raw)))
+		blocks   = make(types.Blocks, 0, segment.Last-segment.First+1)
+		receipts []types.Receipts
+	)
+	for nr := segment.First; nr <= segment.Last; nr++ {
+		var entry archiveEntry
+		if err := stream.Decode(&entry); err != nil {
+			return nil, nil, fmt.Errorf("segment %d: block #%d: %v", idx, nr, err)
+		}
+		if err := verifyArchiveEntry(&entry, nr, a.index.Receipts); err != nil {
+			return nil, nil, fmt.Errorf("segment %d: %v", idx, err)
+		}
+		if len(blocks) > 0 && entry.Block.ParentHash() != blocks[len(blocks)-1].Hash() {
+			return nil, nil, fmt.Errorf("segment %d: block #%d not linked to its parent", idx, nr)
+		}
+		blocks = append(blocks, entry.Block)
+
+		if a.index.Receipts {
+			list := make(types.Receipts, len(entry.Receipts))
+			for i, receipt := range entry.Receipts {
+				list[i] = (*types.Receipt)(receipt)
+			}
+			receipts = append(receipts, list)
+		}
+	}
+	if hash := blocks[len(blocks)-1].Hash(); hash != segment.LastHash {
+		return nil, nil, fmt.Errorf("segment %d last hash mismatch: have %x, want %x", idx, hash, segment.LastHash)
+	}
+	return blocks, receipts, nil
+}
+
+// verifyArchiveEntry checks that an archived block has the expected number and
+// that its body and receipts match the commitments in its header.
+func verifyArchiveEntry(entry *archiveEntry, number uint64, receipts bool) error {
+	block := entry.Block
+	if block == nil || block.NumberU64() != number {
+		return fmt.Errorf("block #%d missing", number)
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return fmt.Errorf("block #%d uncle root hash mismatch: have %x, want %x", number, hash, block.UncleHash())
+	}
+	if hash := types.DeriveSha(block.Transactions()); hash != block.TxHash() {
+		return fmt.Errorf("block #%d transaction root hash mismatch: have %x, want %x", number, hash, block.TxHash())
+	}
+	if receipts {
+		list := make(types.Receipts, len(entry.Receipts))
+		for i, receipt := range entry.Receipts {
+			list[i] = (*types.Receipt)(receipt)
+		}
+		if hash := types.DeriveSha(list); hash != block.ReceiptHash() {
+			return fmt.Errorf("block #%d receipt root hash mismatch: have %x, want %x", number, hash, block.ReceiptHash())
+		}
+	}
+	return nil
+}
+
+// Fetch concurrently reads and verifies the requested segments on the given
+// number of threads, delivering them in the requested order. Delivery stops on
+// the first failed segment or when abort is closed.
+func (a *ArchiveReader) Fetch(segments []int, threads int, abort <-chan struct{}) <-chan *ArchiveBatch {
+	if threads < 1 {
+		threads = 1
+	}
+	var (
+		results = make(chan *ArchiveBatch, threads)
+		pending = make(chan chan *ArchiveBatch, threads)
+	)
+	// Start reading segments in the background, limited by the pending queue
+	go func() {
+		defer close(pending)
+		for _, idx := range segments {
+			res := make(chan *ArchiveBatch, 1)
+			select {
+			case pending <- res:
+			case <-abort:
+				return
+			}
+			go func(idx int) {
+				batch := &ArchiveBatch{Segment: a.index.Segments[idx]}
+				batch.Blocks, batch.Receipts, batch.Err = a.ReadSegment(idx)
+				res <- batch
+			}(idx)
+		}
+	}()
+	// Deliver the verified segments in order
+	go func() {
+		defer close(results)
+		for res := range pending {
+			batch := <-res
+			select {
+			case results <- batch:
+			case <-abort:
+				return
+			}
+			if batch.Err != nil {
+				return
+			}
+		}
+	}()
+	return results
+}
+
+// ImportArchive inserts the given block range of a chain archive into the
+// chain, verifying segments in parallel ahead of the import. Segments already
+// present locally are skipped without being read, so an interrupted import can
+// be resumed cheaply.
+//
+// If the archive is trusted, its blocks are not executed. The headers, bodies
+// and archived receipts are written like during fast sync, advancing only the
+// fast sync head; the state has to be synced from the network afterwards.
+func (bc *BlockChain) ImportArchive(archive *ArchiveReader, first uint64, last uint64, threads int, trusted bool, abort <-chan struct{}) error {
+	if trusted && !archive.HasReceipts() {
+		return errArchiveTrusted
+	}
+	if first == 0 {
+		first = 1 // Genesis is never imported
+	}
+	head := bc.CurrentBlock
+	if trusted {
+		head = bc.CurrentFastBlock
+	}
+	var segments []int
+	for _, idx := range archive.Range(first, last) {
+		segment := archive.index.Segments[idx]
+		if head().NumberU64() >= segment.Last && bc.HasBlock(segment.LastHash, segment.Last) {
+			log.Debug("Skipping known archive segment", "first", segment.First, "last", segment.Last)
+			continue
+		}
+		segments = append(segments, idx)
+	}
+	log.Info("Importing chain archive", "segments", len(segments), "first", first, "last", last)
+
+	// Stop the fetchers if either the import fails or the caller aborts
+	var (
+		done = make(chan struct{})
+		stop = make(chan struct{})
+	)
+	defer close(done)
+	go func() {
+		defer close(stop)
+		select {
+		case <-abort:
+		case <-done:
+		}
+	}()
+	for batch := range archive.Fetch(segments, threads, stop) {
+		if batch.Err != nil {
+			return batch.Err
+		}
+		blocks, receipts := batch.Blocks, batch.Receipts
+		if batch.Segment.First < first {
+			blocks = blocks[first-batch.Segment.First:]
+			if trusted {
+				receipts = receipts[first-batch.Segment.First:]
+			}
+		}
+		if batch.Segment.Last > last {
+			blocks = blocks[:uint64(len(blocks))-(batch.Segment.Last-last)]
+			if trusted {
+				receipts = receipts[:len(blocks)]
+			}
+		}
+		if trusted {
+			if err := bc.insertArchiveReceipts(blocks, receipts); err != nil {
+				return err
+			}
+			continue
+		}
+		if blocks = bc.missingBlocks(blocks); len(blocks) == 0 {
+			continue
+		}
+		if n, err := bc.InsertChain(blocks); err != nil {
+			return fmt.Errorf("invalid block #%d: %v", blocks[n].NumberU64(), err)
+		}
+	}
+	select {
+	case <-abort:
+		return errArchiveAborted
+	default:
+		return nil
+	}
+}
+
+// insertArchiveReceipts writes the headers, bodies and receipts of trusted
+// archive blocks without executing them.
+func (bc *BlockChain) insertArchiveReceipts(blocks types.Blocks, receipts []types.Receipts) error {
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := bc.InsertHeaderChain(headers, 1); err != nil {
+		return fmt.Errorf("invalid header #%d: %v", headers[n].Number, err)
+	}
+	if n, err := bc.InsertReceiptChain(blocks, receipts); err != nil {
+		return fmt.Errorf("invalid block #%d: %v", blocks[n].NumberU64(), err)
+	}
+	return nil
+}
+
+// missingBlocks returns the suffix of the given blocks not yet present in the
+// local chain.
+func (bc *BlockChain) missingBlocks(blocks types.Blocks) types.Blocks {
+	head := bc.CurrentBlock()
+	for i, block := range blocks {
+		// If we're behind the chain head, only check block, state is available at head
+		if head.NumberU64() > block.NumberU64() {
+			if !bc.HasBlock(block.Hash(), block.NumberU64()) {
+				return blocks[i:]
+			}
+			continue
+		}
+		// If we're above the chain head, state availability is a must
+		if !bc.HasBlockAndState(block.Hash(), block.NumberU64()) {
+			return blocks[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/watchain/go-watchain/consensus/ethash"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/core/vm"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// newArchiveTestChain creates a blockchain with n value transfer blocks, along
+// with a function to create empty chains sharing the same genesis.
+func newArchiveTestChain(t *testing.T, n int) (*BlockChain, func() *BlockChain) {
+	gspec := &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{benchRootAddr: {Balance: benchRootFunds}}}
+
+	empty := func() *BlockChain {
+		db, _ := watdb.NewMemDatabase()
+		gspec.MustCommit(db)
+		blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+		return blockchain
+	}
+	db, _ := watdb.NewMemDatabase()
+	genesis := gspec.MustCommit(db)
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, n, genValueTx(0))
+	blockchain := empty()
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert source chain: %v", err)
+	}
+	return blockchain, empty
+}
+
+// Tests that a chain exported into an archive can be indexed, verified and
+// imported back, both fully and as a block range.
+func TestArchiveExportImport(t *testing.T) {
+	source, empty := newArchiveTestChain(t, 25)
+	defer source.Stop()
+
+	buf := new(bytes.Buffer)
+	if err := source.ExportArchive(buf, 0, 25, ArchiveConfig{SegmentSize: 8, Receipts: true}); err != nil {
+		t.Fatalf("failed to export archive: %v", err)
+	}
+	archive, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if segments := archive.Segments(); len(segments) != 4 || segments[3].First != 24 || segments[3].Last != 25 {
+		t.Fatalf("segment layout mismatch: %+v", segments)
+	}
+	if !archive.HasReceipts() {
+		t.Fatalf("archive receipts flag not set")
+	}
+	if have := archive.Range(10, 17); len(have) != 2 || have[0] != 1 || have[1] != 2 {
+		t.Fatalf("range segments mismatch: have %v, want [1 2]", have)
+	}
+	// Import a slice of the archive, then the rest of it
+	dest := empty()
+	defer dest.Stop()
+
+	if err := dest.ImportArchive(archive, 0, 12, 2, false, nil); err != nil {
+		t.Fatalf("failed to import archive range: %v", err)
+	}
+	if head := dest.CurrentBlock().NumberU64(); head != 12 {
+		t.Fatalf("range import head mismatch: have %d, want %d", head, 12)
+	}
+	if err := dest.ImportArchive(archive, 0, 25, 2, false, nil); err != nil {
+		t.Fatalf("failed to import archive: %v", err)
+	}
+	if have, want := dest.CurrentBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+		t.Fatalf("head mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that corrupted archive segments are detected before import.
+func TestArchiveCorruption(t *testing.T) {
+	source, empty := newArchiveTestChain(t, 16)
+	defer source.Stop()
+
+	buf := new(bytes.Buffer)
+	if err := source.ExportArchive(buf, 0, 16, ArchiveConfig{SegmentSize: 8}); err != nil {
+		t.Fatalf("failed to export archive: %v", err)
+	}
+	data := buf.Bytes()
+	if _, err := OpenArchive(bytes.NewReader(data[:len(data)-1]), int64(len(data)-1)); err == nil {
+		t.Fatalf("truncated archive opened")
+	}
+	archive, err := OpenArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	// Flip a byte in the second segment and ensure only it fails verification
+	segment := archive.Segments()[1]
+	data[segment.Offset+segment.Size/2] ^= 0xff
+
+	if _, _, err := archive.ReadSegment(0); err != nil {
+		t.Fatalf("intact segment failed verification: %v", err)
+	}
+	if _, _, err := archive.ReadSegment(1); err == nil {
+		t.Fatalf("corrupted segment passed verification")
+	}
+	dest := empty()
+	defer dest.Stop()
+
+	if err := dest.ImportArchive(archive, 0, 16, 2, false, nil); err == nil {
+		t.Fatalf("corrupted archive imported")
+	}
+	if head := dest.CurrentBlock().NumberU64(); head != segment.First-1 {
+		t.Fatalf("head mismatch: have %d, want %d", head, segment.First-1)
+	}
+}
+
+// rewriteArchiveIndex modifies the index of an encoded archive in place of the
+// original one, returning the new archive data.
+func rewriteArchiveIndex(t *testing.T, data []byte, update func(*archiveIndex)) []byte {
+	end := len(data) - 8 - len(archiveMagic)
+	offset := binary.BigEndian.Uint64(data[end:])
+
+	var index archiveIndex
+	if err := rlp.DecodeBytes(data[offset:end], &index); err != nil {
+		t.Fatalf("failed to decode archive index: %v", err)
+	}
+	update(&index)
+	enc, err := rlp.EncodeToBytes(&index)
+	if err != nil {
+		t.Fatalf("failed to encode archive index: %v", err)
+	}
+	out := append(append([]byte{}, data[:offset]...), enc...)
+	return append(out, data[end:]...)
+}
+
+// Tests that archive indices with malformed or oversized segment ranges are
+// rejected instead of being trusted for allocations.
+func TestArchiveInvalidIndex(t *testing.T) {
+	source, _ := newArchiveTestChain(t, 16)
+	defer source.Stop()
+
+	buf := new(bytes.Buffer)
+	if err := source.ExportArchive(buf, 0, 16, ArchiveConfig{SegmentSize: 8}); err != nil {
+		t.Fatalf("failed to export archive: %v", err)
+	}
+	if err := source.ExportArchive(new(bytes.Buffer), 0, 16, ArchiveConfig{SegmentSize: MaxArchiveSegment + 1}); err == nil {
+		t.Fatalf("oversized segments exported")
+	}
+	tests := []func(*archiveIndex){
+		func(index *archiveIndex) { index.SegmentSize = 0 },
+		func(index *archiveIndex) { index.SegmentSize = MaxArchiveSegment + 1 },
+		func(index *archiveIndex) { index.Segments[0].Last = 1 << 62 },
+		func(index *archiveIndex) { index.Segments[1].First, index.Segments[1].Last = 16, 9 },
+		func(index *archiveIndex) { index.Segments[0].Last, index.Segments[1].First = 8, 9 },
+	}
+	for i, update := range tests {
+		data := rewriteArchiveIndex(t, buf.Bytes(), update)
+		if _, err := OpenArchive(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("test %d: invalid archive index accepted", i)
+		}
+	}
+	// Segments are checked on read as well, without allocating for the range
+	archive, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	archive.index.Segments[0].Last = 1 << 62
+	if _, _, err := archive.ReadSegment(0); err == nil {
+		t.Fatalf("oversized segment range read")
+	}
+}
+
+// Tests that trusted archives are imported by storing the archived receipts
+// instead of executing the blocks.
+func TestArchiveTrustedImport(t *testing.T) {
+	source, empty := newArchiveTestChain(t, 20)
+	defer source.Stop()
+
+	buf := new(bytes.Buffer)
+	if err := source.ExportArchive(buf, 0, 20, ArchiveConfig{SegmentSize: 8}); err != nil {
+		t.Fatalf("failed to export archive: %v", err)
+	}
+	archive, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	dest := empty()
+	defer dest.Stop()
+
+	if err := dest.ImportArchive(archive, 0, 20, 2, true, nil); err != errArchiveTrusted {
+		t.Fatalf("trusted import without receipts: have %v, want %v", err, errArchiveTrusted)
+	}
+	// Export again with receipts and import a range, then the rest
+	buf.Reset()
+	if err := source.ExportArchive(buf, 0, 20, ArchiveConfig{SegmentSize: 8, Receipts: true}); err != nil {
+		t.Fatalf("failed to export archive: %v", err)
+	}
+	if archive, err = OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if err := dest.ImportArchive(archive, 0, 10, 2, true, nil); err != nil {
+		t.Fatalf("failed to import trusted archive range: %v", err)
+	}
+	if head := dest.CurrentFastBlock().NumberU64(); head != 10 {
+		t.Fatalf("range import fast head mismatch: have %d, want %d", head, 10)
+	}
+	if err := dest.ImportArchive(archive, 0, 20, 2, true, nil); err != nil {
+		t.Fatalf("failed to import trusted archive: %v", err)
+	}
+	if have, want := dest.CurrentFastBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+		t.Fatalf("fast head mismatch: have %x, want %x", have, want)
+	}
+	// Blocks were not executed, but their bodies and receipts are available
+	if head := dest.CurrentBlock().NumberU64(); head != 0 {
+		t.Fatalf("blocks executed: head #%d", head)
+	}
+	for i := uint64(1); i <= 20; i++ {
+		block := source.GetBlockByNumber(i)
+		if !dest.HasBlock(block.Hash(), i) {
+			t.Fatalf("block #%d missing", i)
+		}
+		have, want := GetBlockReceipts(dest.db, block.Hash(), i), GetBlockReceipts(source.db, block.Hash(), i)
+		if len(have) != len(want) || types.DeriveSha(have) != types.DeriveSha(want) {
+			t.Fatalf("block #%d receipts mismatch", i)
+		}
+	}
+}
@@ -48,6 +48,10 @@ var (
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
 	trieSyncKey   = []byte("TrieSync")
+	syncProgKey   = []byte("SyncProgress")
+	chainTailKey  = []byte("ChainTail")
+
+	syncEntryPrefix = []byte("SyncEntry") // syncEntryPrefix + slot (uint64 big endian) -> pending state retrieval
 
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`).
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
@@ -157,6 +161,35 @@ func GetTrieSyncProgress(db DatabaseReader) uint64 {
 	return new(big.Int).SetBytes(data).Uint64()
 }
 
+// GetSyncProgress retrieves the encoded progress of an interrupted fast sync to
+// allow resuming it across restarts.
+func GetSyncProgress(db DatabaseReader) []byte {
+	data, _ := db.Get(syncProgKey)
+	return data
+}
+
+// syncEntryKey returns the database key of a pending state retrieval slot.
+func syncEntryKey(slot uint64) []byte {
+	return append(append([]byte{}, syncEntryPrefix...), encodeBlockNumber(slot)...)
+}
+
+// GetSyncEntry retrieves the encoded state retrieval left pending by a fast sync
+// in the given slot, or nil if the slot is empty.
+func GetSyncEntry(db DatabaseReader, slot uint64) []byte {
+	data, _ := db.Get(syncEntryKey(slot))
+	return data
+}
+
+// GetChainTailHash retrieves the hash of the oldest header of a chain anchored at
+// a trusted checkpoint whose ancestors are not yet backfilled.
+func GetChainTailHash(db DatabaseReader) common.Hash {
+	data, _ := db.Get(chainTailKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
 // GetHeaderRLP retrieves a block header in its raw RLP database encoding, or nil
 // if the header's not found.
 func GetHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
@@ -394,6 +427,24 @@ func WriteTrieSyncProgress(db watdb.Putter, count uint64) error {
 	return nil
 }
 
+// WriteSyncProgress stores the encoded progress of a running fast sync to support
+// resuming it across restarts.
+func WriteSyncProgress(db watdb.Putter, data []byte) error {
+	if err := db.Put(syncProgKey, data); err != nil {
+		log.Crit("Failed to store fast sync progress", "err", err)
+	}
+	return nil
+}
+
+// WriteChainTailHash stores the hash of the oldest header of a chain anchored at a
+// trusted checkpoint, below which the ancestors are still missing.
+func WriteChainTailHash(db watdb.Putter, hash common.Hash) error {
+	if err := db.Put(chainTailKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store chain tail hash", "err", err)
+	}
+	return nil
+}
+
 // WriteHeader serializes a block header into the database.
 func WriteHeader(db watdb.Putter, header *types.Header) error {
 	data, err := rlp.EncodeToBytes(header)
@@ -518,6 +569,31 @@ func DeleteCanonicalHash(db DatabaseDeleter, number uint64) {
 	db.Delete(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
 }
 
+// WriteSyncEntry stores an encoded state retrieval pending in a fast sync into
+// the given slot. An empty entry marks the slot as unused.
+func WriteSyncEntry(db watdb.Putter, slot uint64, data []byte) error {
+	if err := db.Put(syncEntryKey(slot), data); err != nil {
+		log.Crit("Failed to store pending state retrieval", "err", err)
+	}
+	return nil
+}
+
+// DeleteSyncEntry removes the state retrieval stored in the given slot.
+func DeleteSyncEntry(db DatabaseDeleter, slot uint64) {
+	db.Delete(syncEntryKey(slot))
+}
+
+// DeleteSyncProgress removes the progress of a finished fast sync.
+func DeleteSyncProgress(db DatabaseDeleter) {
+	db.Delete(syncProgKey)
+}
+
+// DeleteChainTailHash removes the chain tail marker once all ancestors of a
+// checkpoint were backfilled.
+func DeleteChainTailHash(db DatabaseDeleter) {
+	db.Delete(chainTailKey)
+}
+
 // DeleteHeader removes all block header data associated with a hash.
 func DeleteHeader(db DatabaseDeleter, hash common.Hash, number uint64) {
 	db.Delete(append(blockHashPrefix, hash.Bytes()...))
@@ -52,3 +52,21 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// ChainReorgEvent is posted when the canonical chain is switched to a different
+// branch. OldChain and NewChain are ordered from the common ancestor upwards.
+type ChainReorgEvent struct {
+	CommonAncestor *types.Block
+	OldChain       types.Blocks // Blocks dropped from the canonical chain
+	NewChain       types.Blocks // Blocks added to the canonical chain
+}
+
+// Depth returns the number of canonical blocks dropped by the reorg.
+func (ev ChainReorgEvent) Depth() int { return len(ev.OldChain) }
+
+// FinalityViolationEvent is posted when a chain is rejected for contradicting a
+// trusted checkpoint or exceeding the maximum reorg depth.
+type FinalityViolationEvent struct {
+	Header *types.Header // Header of the offending chain
+	Err    error
+}
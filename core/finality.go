@@ -0,0 +1,252 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/metrics"
+)
+
+var finalityViolationMeter = metrics.NewRegisteredMeter("chain/finality/violations", nil)
+
+// Checkpoint is a trusted block number and hash pair the canonical chain must
+// contain. Chains contradicting a checkpoint are refused.
+type Checkpoint struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+}
+
+// ParseCheckpoint parses a checkpoint in the "number:hash" format.
+func ParseCheckpoint(s string) (Checkpoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint %q, want number:hash", s)
+	}
+	number, err := strconv.ParseUint(parts[0], 0, 64)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint number %q: %v", parts[0], err)
+	}
+	hash := common.FromHex(parts[1])
+	if len(hash) != common.HashLength {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint hash %q", parts[1])
+	}
+	return Checkpoint{Number: number, Hash: common.BytesToHash(hash)}, nil
+}
+
+// String implements fmt.Stringer, returning the "number:hash" form.
+func (c Checkpoint) String() string {
+	return fmt.Sprintf("%d:%s", c.Number, c.Hash.Hex())
+}
+
+// finality tracks the operator configured finality rules of a chain: a maximum
+// reorg depth and a set of trusted checkpoints.
+type finality struct {
+	maxDepth    uint64                 // Maximum number of canonical blocks a reorg may drop (0 = unlimited)
+	checkpoints map[uint64]common.Hash // Trusted checkpoints keyed by block number
+	lock        sync.RWMutex
+}
+
+// newFinality creates an empty finality tracker imposing no restrictions.
+func newFinality() *finality {
+	return &finality{checkpoints: make(map[uint64]common.Hash)}
+}
+
+// enabled reports whwater any finality rule is configured.
+func (f *finality) enabled() bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.maxDepth > 0 || len(f.checkpoints) > 0
+}
+
+// verifyHeader checks whwater a header contradicts any known checkpoint.
+func (f *finality) verifyHeader(header *types.Header) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	number := header.Number.Uint64()
+	if hash, ok := f.checkpoints[number]; ok && hash != header.Hash() {
+		return &CheckpointError{Number: number, Want: hash, Have: header.Hash()}
+	}
+	return nil
+}
+
+// verifyReorg checks whwater a reorg dropping the given number of canonical
+// blocks on top of the common ancestor is permitted.
+func (f *finality) verifyReorg(ancestor uint64, depth uint64) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if f.maxDepth > 0 && depth > f.maxDepth {
+		return &ReorgDepthError{Depth: depth, Limit: f.maxDepth}
+	}
+	for number, hash := range f.checkpoints {
+		if number > ancestor && number <= ancestor+depth {
+			return &CheckpointError{Number: number, Want: hash}
+		}
+	}
+	return nil
+}
+
+// floor returns the highest block number that may not be reorged away, given
+// the current head of the chain.
+func (f *finality) floor(head uint64) uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	var floor uint64
+	if f.maxDepth > 0 && head > f.maxDepth {
+		floor = head - f.maxDepth
+	}
+	for number := range f.checkpoints {
+		if number <= head && number > floor {
+			floor = number
+		}
+	}
+	return floor
+}
+
+// CheckpointError is returned when a chain contradicts a trusted checkpoint.
+type CheckpointError struct {
+	Number uint64
+	Want   common.Hash
+	Have   common.Hash // Empty if the checkpoint would be reorged away
+}
+
+func (err *CheckpointError) Error() string {
+	if err.Have == (common.Hash{}) {
+		return fmt.Sprintf("reorg would drop checkpoint #%d [%x…]", err.Number, err.Want[:4])
+	}
+	return fmt.Sprintf("checkpoint mismatch at #%d: have %x, want %x", err.Number, err.Have, err.Want)
+}
+
+// ReorgDepthError is returned when a reorg would drop more canonical blocks
+// than the configured maximum reorg depth.
+type ReorgDepthError struct {
+	Depth uint64
+	Limit uint64
+}
+
+func (err *ReorgDepthError) Error() string {
+	return fmt.Sprintf("reorg too deep: %d blocks, limit %d", err.Depth, err.Limit)
+}
+
+// IsFinalityError reports whwater the error was raised due to a chain
+// contradicting the configured finality rules.
+func IsFinalityError(err error) bool {
+	switch err.(type) {
+	case *CheckpointError, *ReorgDepthError:
+		return true
+	}
+	return false
+}
+
+// SetMaxReorgDepth sets the maximum number of canonical blocks a reorg is
+// allowed to drop. Zero disables the limit.
+func (bc *BlockChain) SetMaxReorgDepth(depth uint64) {
+	bc.finality.lock.Lock()
+	defer bc.finality.lock.Unlock()
+
+	bc.finality.maxDepth = depth
+}
+
+// AddCheckpoint registers a trusted checkpoint the canonical chain must contain.
+// If the local canonical chain or a known checkpoint already contradicts it, an
+// error is returned and the checkpoint is not added. Checkpoints are only kept
+// in memory, they need to be configured again after a restart.
+func (bc *BlockChain) AddCheckpoint(cp Checkpoint) error {
+	bc.finality.lock.Lock()
+	defer bc.finality.lock.Unlock()
+
+	if hash, ok := bc.finality.checkpoints[cp.Number]; ok {
+		if hash != cp.Hash {
+			return fmt.Errorf("conflicting checkpoint at #%d: have %x, want %x", cp.Number, hash, cp.Hash)
+		}
+		return nil
+	}
+	if header := bc.GetHeaderByNumber(cp.Number); header != nil && header.Hash() != cp.Hash {
+		return &CheckpointError{Number: cp.Number, Want: cp.Hash, Have: header.Hash()}
+	}
+	bc.finality.checkpoints[cp.Number] = cp.Hash
+	log.Info("Added chain checkpoint", "number", cp.Number, "hash", cp.Hash)
+	return nil
+}
+
+// Checkpoints returns the list of trusted checkpoints, ordered by number.
+func (bc *BlockChain) Checkpoints() []Checkpoint {
+	bc.finality.lock.RLock()
+	defer bc.finality.lock.RUnlock()
+
+	cps := make([]Checkpoint, 0, len(bc.finality.checkpoints))
+	for number, hash := range bc.finality.checkpoints {
+		cps = append(cps, Checkpoint{Number: number, Hash: hash})
+	}
+	sort.Slice(cps, func(i, j int) bool { return cps[i].Number < cps[j].Number })
+	return cps
+}
+
+// FinalizedNumber returns the highest block number of the current canonical
+// chain that can not be reorged away anymore.
+func (bc *BlockChain) FinalizedNumber() uint64 {
+	return bc.finality.floor(bc.CurrentHeader().Number.Uint64())
+}
+
+// verifyHeaderFinality checks a header chain against the trusted checkpoints
+// and ensures it does not fork off the canonical chain below the finalized
+// block. It returns the index of the offending header if any.
+func (bc *BlockChain) verifyHeaderFinality(chain []*types.Header) (int, error) {
+	if len(chain) == 0 || !bc.finality.enabled() {
+		return 0, nil
+	}
+	for i, header := range chain {
+		if err := bc.finality.verifyHeader(header); err != nil {
+			return i, err
+		}
+	}
+	// Walk the ancestry back until we join the canonical chain or pass the floor
+	var (
+		head  = bc.CurrentHeader().Number.Uint64()
+		floor = bc.finality.floor(head)
+	)
+	parent := bc.GetHeader(chain[0].ParentHash, chain[0].Number.Uint64()-1)
+	for parent != nil && parent.Number.Uint64() >= floor {
+		if GetCanonicalHash(bc.db, parent.Number.Uint64()) == parent.Hash() {
+			return 0, nil
+		}
+		parent = bc.GetHeader(parent.ParentHash, parent.Number.Uint64()-1)
+	}
+	if parent == nil {
+		return 0, nil // Unknown ancestry, the header validator will reject it
+	}
+	return 0, &ReorgDepthError{Depth: head - parent.Number.Uint64(), Limit: head - floor}
+}
+
+// reportFinalityViolation logs and announces a chain refused for contradicting
+// the configured finality rules.
+func (bc *BlockChain) reportFinalityViolation(header *types.Header, err error) {
+	finalityViolationMeter.Mark(1)
+	log.Warn("Rejected chain violating finality", "number", header.Number, "hash", header.Hash(), "err", err)
+	go bc.finalityFeed.Send(FinalityViolationEvent{Header: header, Err: err})
+}
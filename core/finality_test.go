@@ -0,0 +1,195 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/consensus/ethash"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/core/vm"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// newFinalityTestChain creates a blockchain with n canonical blocks on top of
+// an empty genesis.
+func newFinalityTestChain(t *testing.T, n int) (*BlockChain, *types.Block, []*types.Block) {
+	db, _ := watdb.NewMemDatabase()
+	genesis := (&Genesis{Config: params.TestChainConfig}).MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{})
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, n, func(i int, gen *BlockGen) {})
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	return blockchain, genesis, blocks
+}
+
+// Tests that checkpoints can be parsed from their textual representation.
+func TestParseCheckpoint(t *testing.T) {
+	hash := common.HexToHash("0xdeadbeef")
+	tests := []struct {
+		input string
+		want  Checkpoint
+		fail  bool
+	}{
+		{input: "100:" + hash.Hex(), want: Checkpoint{Number: 100, Hash: hash}},
+		{input: "0x64:" + hash.Hex(), want: Checkpoint{Number: 100, Hash: hash}},
+		{input: "100", fail: true},
+		{input: "abc:" + hash.Hex(), fail: true},
+		{input: "100:0x1234", fail: true},
+	}
+	for i, tt := range tests {
+		cp, err := ParseCheckpoint(tt.input)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected failure for %q", i, tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to parse %q: %v", i, tt.input, err)
+			continue
+		}
+		if cp != tt.want {
+			t.Errorf("test %d: checkpoint mismatch: have %v, want %v", i, cp, tt.want)
+		}
+	}
+}
+
+// Tests that chains contradicting a trusted checkpoint are refused, both as
+// full blocks and as headers, and that a violation event is posted.
+func TestCheckpointEnforcement(t *testing.T) {
+	blockchain, genesis, blocks := newFinalityTestChain(t, 5)
+	defer blockchain.Stop()
+
+	if err := blockchain.AddCheckpoint(Checkpoint{Number: 3, Hash: common.Hash{0x01}}); err == nil {
+		t.Fatalf("contradicting checkpoint accepted")
+	}
+	if err := blockchain.AddCheckpoint(Checkpoint{Number: 3, Hash: blocks[2].Hash()}); err != nil {
+		t.Fatalf("failed to add checkpoint: %v", err)
+	}
+	violations := make(chan FinalityViolationEvent, 2)
+	sub := blockchain.SubscribeFinalityViolationEvent(violations)
+	defer sub.Unsubscribe()
+
+	fork, _ := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), blockchain.db, 6, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	if n, err := blockchain.InsertChain(fork); err == nil {
+		t.Fatalf("forked chain accepted")
+	} else if _, ok := err.(*CheckpointError); !ok || n != 2 {
+		t.Fatalf("failure mismatch: have %d/%v, want %d/checkpoint error", n, err, 2)
+	}
+	headers := make([]*types.Header, len(fork))
+	for i, block := range fork {
+		headers[i] = block.Header()
+	}
+	if _, err := blockchain.InsertHeaderChain(headers, 1); !IsFinalityError(err) {
+		t.Fatalf("forked header chain error mismatch: have %v, want finality error", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != blocks[4].Hash() {
+		t.Errorf("head block changed: have %x, want %x", head, blocks[4].Hash())
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-violations:
+			if !IsFinalityError(ev.Err) {
+				t.Errorf("violation %d: error mismatch: have %v, want finality error", i, ev.Err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("violation %d: no event posted", i)
+		}
+	}
+}
+
+// Tests that checkpoints conflicting with known ones are refused, also when added
+// concurrently, while duplicates are accepted.
+func TestCheckpointConflicts(t *testing.T) {
+	blockchain, _, _ := newFinalityTestChain(t, 5)
+	defer blockchain.Stop()
+
+	if err := blockchain.AddCheckpoint(Checkpoint{Number: 10, Hash: common.Hash{0x01}}); err != nil {
+		t.Fatalf("failed to add checkpoint: %v", err)
+	}
+	if err := blockchain.AddCheckpoint(Checkpoint{Number: 10, Hash: common.Hash{0x01}}); err != nil {
+		t.Fatalf("duplicate checkpoint refused: %v", err)
+	}
+	if err := blockchain.AddCheckpoint(Checkpoint{Number: 10, Hash: common.Hash{0x02}}); err == nil {
+		t.Fatalf("conflicting checkpoint accepted")
+	}
+	// Add conflicting checkpoints concurrently, only one of them may succeed
+	var (
+		wg    sync.WaitGroup
+		added int32
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if blockchain.AddCheckpoint(Checkpoint{Number: 20, Hash: common.Hash{byte(i + 1)}}) == nil {
+				atomic.AddInt32(&added, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Fatalf("concurrently added checkpoint count mismatch: have %d, want 1", added)
+	}
+	if cps := blockchain.Checkpoints(); len(cps) != 2 {
+		t.Fatalf("checkpoint count mismatch: have %d, want 2", len(cps))
+	}
+}
+
+// Tests that reorgs dropping more blocks than the configured maximum depth are
+// refused, while shallower ones are accepted.
+func TestMaxReorgDepth(t *testing.T) {
+	blockchain, _, blocks := newFinalityTestChain(t, 5)
+	defer blockchain.Stop()
+
+	blockchain.SetMaxReorgDepth(2)
+	if final := blockchain.FinalizedNumber(); final != 3 {
+		t.Fatalf("finalized number mismatch: have %d, want %d", final, 3)
+	}
+	// Fork off at block #1, which would drop 4 canonical blocks
+	deep, _ := GenerateChain(params.TestChainConfig, blocks[0], ethash.NewFaker(), blockchain.db, 6, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := blockchain.InsertChain(deep); err == nil {
+		t.Fatalf("deep reorg accepted")
+	} else if _, ok := err.(*ReorgDepthError); !ok {
+		t.Fatalf("deep reorg error mismatch: have %v, want reorg depth error", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != blocks[4].Hash() {
+		t.Fatalf("head block changed: have %x, want %x", head, blocks[4].Hash())
+	}
+	// Fork off at block #4, which would only drop a single canonical block
+	shallow, _ := GenerateChain(params.TestChainConfig, blocks[3], ethash.NewFaker(), blockchain.db, 2, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x02})
+	})
+	if _, err := blockchain.InsertChain(shallow); err != nil {
+		t.Fatalf("shallow reorg refused: %v", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != shallow[1].Hash() {
+		t.Errorf("head block mismatch: have %x, want %x", head, shallow[1].Hash())
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkid
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+// Tests that fork IDs are properly calculated given the chain config, genesis
+// hash and current head.
+func TestCreation(t *testing.T) {
+	type testcase struct {
+		head uint64
+		want ID
+	}
+	tests := []struct {
+		config  *params.ChainConfig
+		genesis common.Hash
+		cases   []testcase
+	}{
+		// Mainnet test cases, all forks activated at genesis
+		{
+			params.MainnetChainConfig,
+			params.MainnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0x38c6fd1c), Next: 0}},
+				{1000000, ID{Hash: checksumToBytes(0x38c6fd1c), Next: 0}},
+			},
+		},
+		// Testnet test cases
+		{
+			params.TestnetChainConfig,
+			params.TestnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 10}},            // Unsynced, last Frontier, Homestead and Tangerine block
+				{9, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 10}},            // Last Tangerine block
+				{10, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}},      // First Spurious block
+				{1699999, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}}, // Last Spurious block
+				{1700000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 0}},       // First Byzantium block
+				{10000000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 0}},      // Future Byzantium block
+			},
+		},
+	}
+	for i, tt := range tests {
+		for j, ttt := range tt.cases {
+			if have := newID(tt.config, tt.genesis, ttt.head); have != ttt.want {
+				t.Errorf("test %d, case %d: fork ID mismatch: have %x, want %x", i, j, have, ttt.want)
+			}
+		}
+	}
+}
+
+// Tests that fork blocks are gathered sorted, deduplicated and without the ones
+// activated at genesis.
+func TestGatherForks(t *testing.T) {
+	config := &params.ChainConfig{
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(20),
+		EIP155Block:         big.NewInt(10),
+		EIP158Block:         big.NewInt(10),
+		ByzantiumBlock:      big.NewInt(30),
+		ConstantinopleBlock: nil,
+	}
+	if have, want := gatherForks(config), []uint64{10, 20, 30}; !reflect.DeepEqual(have, want) {
+		t.Errorf("forks mismatch: have %v, want %v", have, want)
+	}
+	if have := gatherForks(params.MainnetChainConfig); len(have) != 0 {
+		t.Errorf("mainnet forks mismatch: have %v, want none", have)
+	}
+}
+
+// Tests that IDs advertised by remote peers at various past and future fork
+// combinations are accepted or rejected correctly.
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		head uint64
+		id   ID
+		err  error
+	}{
+		// Local is pre-Spurious, remote announces the same. No future fork is announced.
+		{0, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 0}, nil},
+
+		// Local is pre-Spurious, remote announces the same. Remote also announces
+		// the next fork at block 10, which we know about.
+		{0, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 10}, nil},
+
+		// Local is pre-Spurious, remote announces the same. Remote also announces a
+		// fork at block 5, unknown to us, but not yet passed.
+		{0, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 5}, nil},
+
+		// Local is pre-Spurious, remote announces the same. Remote also announces a
+		// fork at block 5, unknown to us, and we already passed it.
+		{9, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 5}, ErrLocalIncompatibleOrStale},
+
+		// Local is Spurious, remote announces the same, also announcing Byzantium.
+		{10, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}, nil},
+
+		// Local is Spurious, remote announces the same with an unknown fork at
+		// block 1500000, not yet passed by us.
+		{1000000, ID{Hash: checksumToBytes(0x63760190), Next: 1500000}, nil},
+
+		// Local is Spurious, remote announces the same with an unknown fork at
+		// block 1500000, which we already passed.
+		{1600000, ID{Hash: checksumToBytes(0x63760190), Next: 1500000}, ErrLocalIncompatibleOrStale},
+
+		// Local is Spurious, remote is pre-Spurious but announces Spurious next.
+		// Remote is simply out of sync, accept.
+		{10, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 10}, nil},
+
+		// Local is Spurious, remote is pre-Spurious and doesn't know about Spurious.
+		// Remote needs a software update.
+		{10, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 0}, ErrRemoteStale},
+
+		// Local is Byzantium, remote is pre-Spurious and announces an unknown fork.
+		// Remote needs a software update.
+		{1700000, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 5}, ErrRemoteStale},
+
+		// Local is Byzantium, remote is Spurious and announces Byzantium next.
+		// Remote is simply out of sync, accept.
+		{1700000, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}, nil},
+
+		// Local is pre-Spurious, remote is Spurious. Local is out of sync, accept.
+		{5, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}, nil},
+
+		// Local is pre-Spurious, remote is Byzantium. Local is out of sync, accept.
+		{5, ID{Hash: checksumToBytes(0x3ea159c7), Next: 0}, nil},
+
+		// Local is Byzantium, remote announces the same with a future fork.
+		{1700000, ID{Hash: checksumToBytes(0x3ea159c7), Next: math.MaxUint64}, nil},
+
+		// Local is Byzantium and passed the block remote announces as its next
+		// fork. Local is incompatible or needs a software update.
+		{2000000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 2000000}, ErrLocalIncompatibleOrStale},
+
+		// Local is Byzantium, remote is on a fork beyond Byzantium unknown to us.
+		// Local is incompatible or needs a software update.
+		{1700000, ID{Hash: checksumToBytes(checksumUpdate(0x3ea159c7, 2000000)), Next: 0}, ErrLocalIncompatibleOrStale},
+
+		// Remote is on a different chain altogether.
+		{0, ID{Hash: checksumToBytes(0xdeadbeef), Next: 0}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		filter := newFilter(params.TestnetChainConfig, params.TestnetGenesisHash, func() uint64 { return tt.head })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that IDs are properly RLP encoded (specifically important because we
+// use uint32 to store the hash, but we need to encode it as [4]byte).
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		id   ID
+		want []byte
+	}{
+		{ID{Hash: checksumToBytes(0), Next: 0}, common.Hex2Bytes("c6840000000080")},
+		{ID{Hash: checksumToBytes(0xdeadbeef), Next: 0xBADDCAFE}, common.Hex2Bytes("ca84deadbeef84baddcafe")},
+		{ID{Hash: checksumToBytes(math.MaxUint32), Next: math.MaxUint64}, common.Hex2Bytes("ce84ffffffff88ffffffffffffffff")},
+	}
+	for i, tt := range tests {
+		have, err := rlp.EncodeToBytes(tt.id)
+		if err != nil {
+			t.Errorf("test %d: failed to encode forkid: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: RLP mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
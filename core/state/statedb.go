@@ -36,6 +36,14 @@ type revision struct {
 	journalIndex int
 }
 
+// proofList collects the trie nodes of a Merkle proof in order, root first.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
 var (
 	// emptyState is the known hash of an empty state trie entry.
 	emptyState = crypto.Keccak256Hash(nil)
@@ -259,6 +267,26 @@ func (self *StateDB) StorageTrie(a common.Address) Trie {
 	return cpy.updateTrie(self.db)
 }
 
+// GetProof returns the Merkle proof of an account in the state trie. If the
+// account does not exist, the proof shows its absence.
+func (self *StateDB) GetProof(a common.Address) ([][]byte, error) {
+	var proof proofList
+	err := self.trie.Prove(crypto.Keccak256(a.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
+// StorageProof returns the Merkle proof of a storage slot in the storage trie of
+// an account. An error is returned if the account does not exist.
+func (self *StateDB) StorageProof(a common.Address, key common.Hash) ([][]byte, error) {
+	var proof proofList
+	trie := self.StorageTrie(a)
+	if trie == nil {
+		return proof, fmt.Errorf("storage trie of %x does not exist", a)
+	}
+	err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
 func (self *StateDB) HasSuicided(addr common.Address) bool {
 	stateObject := self.gewatateObject(addr)
 	if stateObject != nil {
@@ -26,6 +26,12 @@ import (
 
 // NewStateSync create a new state trie download scheduler.
 func NewStateSync(root common.Hash, database trie.DatabaseReader) *trie.TrieSync {
+	return ResumeStateSync(root, database, nil)
+}
+
+// ResumeStateSync creates a new state trie download scheduler, rescheduling the
+// retrievals left pending by a previous sync of the same root.
+func ResumeStateSync(root common.Hash, database trie.DatabaseReader, pending []trie.SyncEntry) *trie.TrieSync {
 	var syncer *trie.TrieSync
 	callback := func(leaf []byte, parent common.Hash) error {
 		var obj Account
@@ -37,5 +43,15 @@ func NewStateSync(root common.Hash, database trie.DatabaseReader) *trie.TrieSync
 		return nil
 	}
 	syncer = trie.NewTrieSync(root, database, callback)
+	for _, entry := range pending {
+		switch {
+		case entry.Raw:
+			syncer.AddRawEntry(entry.Hash, int(entry.Depth), common.Hash{})
+		case entry.Leaf:
+			syncer.AddSubTrie(entry.Hash, int(entry.Depth), common.Hash{}, callback)
+		default:
+			syncer.AddSubTrie(entry.Hash, int(entry.Depth), common.Hash{}, nil)
+		}
+	}
 	return syncer
 }
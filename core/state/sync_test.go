@@ -288,6 +288,71 @@ func TestIterativeRandomDelayedStateSync(t *testing.T) {
 	checkStateAccounts(t, dstDb, srcRoot, srcAccounts)
 }
 
+// Tests that a state sync interrupted midway can be resumed from its pending
+// retrievals, without having to rediscover them from the root first.
+func TestResumedStateSync(t *testing.T) {
+	// Create a random state to copy
+	srcDb, srcRoot, srcAccounts := makeTeswatate()
+
+	// Create a destination state and sync a few rounds with the scheduler
+	dstDb, _ := watdb.NewMemDatabase()
+	sched := NewStateSync(srcRoot, dstDb)
+
+	for i := 0; i < 3; i++ {
+		queue := sched.Missing(10)
+		results := make([]trie.SyncResult, len(queue))
+		for j, hash := range queue {
+			data, err := srcDb.TrieDB().Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x", hash)
+			}
+			results[j] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if index, err := sched.Commit(dstDb); err != nil {
+			t.Fatalf("failed to commit data #%d: %v", index, err)
+		}
+	}
+	// Abandon the scheduler and resume from its pending entries
+	entries := sched.Entries()
+	if len(entries) == 0 {
+		t.Fatalf("no pending entries after partial sync")
+	}
+	sched = ResumeStateSync(srcRoot, dstDb, entries)
+
+	missing := make(map[common.Hash]struct{})
+	queue := append([]common.Hash{}, sched.Missing(0)...)
+	for _, hash := range queue {
+		missing[hash] = struct{}{}
+	}
+	for _, entry := range entries {
+		if _, ok := missing[entry.Hash]; !ok {
+			t.Fatalf("pending entry %x not rescheduled", entry.Hash)
+		}
+	}
+	for len(queue) > 0 {
+		results := make([]trie.SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := srcDb.TrieDB().Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x", hash)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if index, err := sched.Commit(dstDb); err != nil {
+			t.Fatalf("failed to commit data #%d: %v", index, err)
+		}
+		queue = append(queue[:0], sched.Missing(0)...)
+	}
+	// Cross check that the two states are in sync
+	checkStateAccounts(t, dstDb, srcRoot, srcAccounts)
+}
+
 // Tests that at any point in time during a sync, only complete sub-tries are in
 // the database.
 func TestIncompleteStateSync(t *testing.T) {
@@ -0,0 +1,88 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/consensus/ethash"
+	"github.com/watchain/go-watchain/core/state"
+	"github.com/watchain/go-watchain/core/vm"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// Tests that prefetching executes the block on the throwaway state only, and
+// that an interrupted prefetch does not execute anything at all.
+func TestStatePrefetch(t *testing.T) {
+	var (
+		db, _   = watdb.NewMemDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{benchRootAddr: {Balance: benchRootFunds}}}
+		genesis = gspec.MustCommit(db)
+	)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 1, genValueTx(0))
+
+	// Prefetch with an already set interrupt flag, nothing should be executed
+	throwaway, _ := state.New(genesis.Root(), blockchain.stateCache)
+	interrupt := uint32(1)
+	blockchain.prefetcher.Prefetch(blocks[0], throwaway, vm.Config{}, &interrupt)
+
+	if nonce := throwaway.GetNonce(benchRootAddr); nonce != 0 {
+		t.Fatalf("interrupted prefetch executed transactions: nonce %d", nonce)
+	}
+	// Prefetch the block for real, the throwaway state should be modified
+	interrupt = 0
+	blockchain.prefetcher.Prefetch(blocks[0], throwaway, vm.Config{}, &interrupt)
+
+	if nonce := throwaway.GetNonce(benchRootAddr); nonce != 1 {
+		t.Fatalf("prefetch nonce mismatch: have %d, want %d", nonce, 1)
+	}
+	// The canonical state must remain untouched
+	statedb, _ := blockchain.State()
+	if nonce := statedb.GetNonce(benchRootAddr); nonce != 0 {
+		t.Fatalf("prefetch leaked into canonical state: nonce %d", nonce)
+	}
+}
+
+// Tests that chain import yields the same head with and without prefetching.
+func TestInsertChainPrefetch(t *testing.T) {
+	var heads [2]*BlockChain
+	for i, prefetch := range []bool{false, true} {
+		var (
+			db, _   = watdb.NewMemDatabase()
+			gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{benchRootAddr: {Balance: benchRootFunds}}}
+			genesis = gspec.MustCommit(db)
+			cache   = &CacheConfig{TrieNodeLimit: 256 * 1024 * 1024, TrieTimeLimit: 5 * time.Minute, NoPrefetch: !prefetch}
+		)
+		blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 16, genTxRing(20))
+
+		blockchain, _ := NewBlockChain(db, cache, gspec.Config, ethash.NewFaker(), vm.Config{})
+		defer blockchain.Stop()
+
+		if n, err := blockchain.InsertChain(blocks); err != nil {
+			t.Fatalf("prefetch %v: failed to insert block %d: %v", prefetch, n, err)
+		}
+		heads[i] = blockchain
+	}
+	if a, b := heads[0].CurrentBlock(), heads[1].CurrentBlock(); a.Hash() != b.Hash() || a.Root() != b.Root() {
+		t.Errorf("head mismatch: have %x/%x, want %x/%x", b.Hash(), b.Root(), a.Hash(), a.Root())
+	}
+}
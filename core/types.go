@@ -44,3 +44,12 @@ type Validator interface {
 type Processor interface {
 	Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error)
 }
+
+// Prefetcher is an interface for pre-caching transaction signatures and state.
+//
+// Prefetch speculatively executes the block on a throwaway state to warm up the
+// caches, discarding any changes. It must abort as soon as the interrupt flag
+// is set to 1.
+type Prefetcher interface {
+	Prefetch(block *types.Block, statedb *state.StateDB, cfg vm.Config, interrupt *uint32)
+}
@@ -76,6 +76,8 @@ func (s *PublicwatchainAPI) ProtocolVersion() hexutil.Uint {
 // - highestBlock:  block number of the highest block header this node has received from peers
 // - pulledStates:  number of state entries processed until now
 // - knownStates:   number of known state entries that still need to be pulled
+// - pivotBlock:    block number of the fast sync pivot, kept across restarts
+// - headerBlock:   block number of the highest header already downloaded
 func (s *PublicwatchainAPI) Syncing() (interface{}, error) {
 	progress := s.b.Downloader().Progress()
 
@@ -90,6 +92,8 @@ func (s *PublicwatchainAPI) Syncing() (interface{}, error) {
 		"highestBlock":  hexutil.Uint64(progress.HighestBlock),
 		"pulledStates":  hexutil.Uint64(progress.PulledStates),
 		"knownStates":   hexutil.Uint64(progress.KnownStates),
+		"pivotBlock":    hexutil.Uint64(progress.PivotBlock),
+		"headerBlock":   hexutil.Uint64(progress.HeaderBlock),
 	}, nil
 }
 
@@ -502,6 +506,79 @@ func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Add
 	return b, state.Error()
 }
 
+// AccountResult is the Merkle proof of an account and some of its storage slots
+// in the state of a block, along with the proven account fields.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the Merkle proof of a storage slot in the storage trie of an
+// account, along with the proven value.
+type StorageResult struct {
+	Key   string          `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the Merkle proof of an account and the requested storage keys
+// in the state of the given block number, which can be verified against the state
+// root of the block. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta
+// block numbers are also allowed.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	// Non-existent accounts have an empty storage trie and no code
+	storageTrie := state.StorageTrie(address)
+	storageHash, codeHash := types.EmptyRootHash, crypto.Keccak256Hash(nil)
+	if storageTrie != nil {
+		storageHash, codeHash = storageTrie.Hash(), state.GetCodeHash(address)
+	}
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		if storageTrie == nil {
+			storageProof[i] = StorageResult{Key: key, Value: new(hexutil.Big), Proof: []hexutil.Bytes{}}
+			continue
+		}
+		hash := common.HexToHash(key)
+		proof, err := state.StorageProof(address, hash)
+		if err != nil {
+			return nil, err
+		}
+		value := state.Gewatate(address, hash)
+		storageProof[i] = StorageResult{Key: key, Value: (*hexutil.Big)(value.Big()), Proof: toHexProof(proof)}
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: toHexProof(accountProof),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		StorageHash:  storageHash,
+		StorageProof: storageProof,
+	}, state.Error()
+}
+
+// toHexProof converts the nodes of a Merkle proof into their JSON representation.
+func toHexProof(proof [][]byte) []hexutil.Bytes {
+	nodes := make([]hexutil.Bytes, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes
+}
+
 // GetBlockByNumber returns the requested block. When blockNr is -1 the chain head is returned. When fullTx is true all
 // transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
@@ -0,0 +1,64 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package utesting
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTest(t *testing.T) {
+	tests := []Test{
+		{
+			Name: "successful test",
+			Fn:   func(t *T) {},
+		},
+		{
+			Name: "failing test",
+			Fn: func(t *T) {
+				t.Log("output")
+				t.Error("failed")
+			},
+		},
+		{
+			Name: "fatal test",
+			Fn: func(t *T) {
+				t.Fatal("fatal error")
+				t.Error("not reached")
+			},
+		},
+	}
+
+	var report bytes.Buffer
+	results := RunTests(tests, &report)
+	if results[0].Failed || results[0].Output != "" {
+		t.Fatalf("wrong result for successful test: %#v", results[0])
+	}
+	if !results[1].Failed || results[1].Output != "output\nfailed\n" {
+		t.Fatalf("wrong result for failing test: %#v", results[1])
+	}
+	if !results[2].Failed || results[2].Output != "fatal error\n" {
+		t.Fatalf("wrong result for fatal test: %#v", results[2])
+	}
+	if n := CountFailures(results); n != 2 {
+		t.Fatalf("wrong failure count %d, want 2", n)
+	}
+	if !strings.Contains(report.String(), "-- FAIL fatal test") {
+		t.Fatalf("report doesn't mention failed test:\n%s", report.String())
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"github.com/watchain/go-watchain/p2p/discover"
+)
+
+// ClientInfo is the serving status of a light client.
+type ClientInfo struct {
+	ID        discover.NodeID `json:"id"`
+	Capacity  uint64          `json:"capacity"`  // Minimum recharge rate of the client's flow control buffer
+	Priority  bool            `json:"priority"`  // Whwater the capacity is reserved for the client
+	Connected bool            `json:"connected"` // Whwater the client is currently connected
+}
+
+// PrivateLightServerAPI is the collection of LES server related APIs exposed
+// over the private les endpoint, allowing the operator to reserve capacity for
+// priority clients.
+type PrivateLightServerAPI struct {
+	server *LesServer
+}
+
+// NewPrivateLightServerAPI creates a new API definition for the LES server.
+func NewPrivateLightServerAPI(server *LesServer) *PrivateLightServerAPI {
+	return &PrivateLightServerAPI{server: server}
+}
+
+// TotalCapacity returns the total capacity the server can assign to its clients.
+func (api *PrivateLightServerAPI) TotalCapacity() uint64 {
+	return api.server.pool.totalCapacity()
+}
+
+// Clients returns the status of the connected light clients and the disconnected
+// priority ones.
+func (api *PrivateLightServerAPI) Clients() []ClientInfo {
+	return api.server.pool.clientInfos()
+}
+
+// SetClientCapacity reserves capacity for a priority client, or demotes it to a
+// free client if the capacity is zero. Connected clients whose capacity changes
+// are disconnected to pick up the new flow control parameters on reconnect.
+func (api *PrivateLightServerAPI) SetClientCapacity(id discover.NodeID, capacity uint64) error {
+	return api.server.pool.setCapacity(id, capacity)
+}
@@ -91,6 +91,16 @@ func (b *LesApiBackend) GetLogs(ctx context.Context, blockHash common.Hash) ([][
 	return light.GetBlockLogs(ctx, b.wat.odr, blockHash, core.GetBlockNumber(b.wat.chainDb, blockHash))
 }
 
+// GetLogsBatch retrieves the logs of multiple blocks, requesting the receipts
+// missing locally from the network in one go.
+func (b *LesApiBackend) GetLogsBatch(ctx context.Context, blockHashes []common.Hash) ([][][]*types.Log, error) {
+	numbers := make([]uint64, len(blockHashes))
+	for i, hash := range blockHashes {
+		numbers[i] = core.GetBlockNumber(b.wat.chainDb, hash)
+	}
+	return light.GetBlockLogsBatch(ctx, b.wat.odr, blockHashes, numbers)
+}
+
 func (b *LesApiBackend) GetTd(blockHash common.Hash) *big.Int {
 	return b.wat.blockchain.GetTdByHash(blockHash)
 }
@@ -153,6 +163,10 @@ func (b *LesApiBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEven
 	return b.wat.blockchain.SubscribeRemovedLogsEvent(ch)
 }
 
+func (b *LesApiBackend) SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription {
+	return b.wat.blockchain.SubscribeChainReorgEvent(ch)
+}
+
 func (b *LesApiBackend) Downloader() *downloader.Downloader {
 	return b.wat.Downloader()
 }
@@ -75,6 +75,7 @@ type Lightwatchain struct {
 
 	networkId     uint64
 	netRPCService *ethapi.PublicNetAPI
+	limitSub      event.Subscription // Subscription to runtime changes of the server's peer limit
 
 	wg sync.WaitGroup
 }
@@ -126,7 +127,7 @@ func New(ctx *node.ServiceContext, config *wat.Config) (*Lightwatchain, error) {
 	}
 
 	lwat.txPool = light.NewTxPool(lwat.chainConfig, lwat.blockchain, lwat.relay)
-	if lwat.protocolManager, err = NewProtocolManager(lwat.chainConfig, true, ClientProtocolVersions, config.NetworkId, lwat.eventMux, lwat.engine, lwat.peers, lwat.blockchain, nil, chainDb, lwat.odr, lwat.relay, quitSync, &lwat.wg); err != nil {
+	if lwat.protocolManager, err = NewProtocolManager(lwat.chainConfig, true, ClientProtocolVersions, config.NetworkId, lwat.eventMux, lwat.engine, lwat.peers, lwat.blockchain, nil, chainDb, lwat.odr, lwat.relay, quitSync, &lwat.wg, config.ULC); err != nil {
 		return nil, err
 	}
 	lwat.ApiBackend = &LesApiBackend{lwat, nil}
@@ -227,13 +228,43 @@ func (s *Lightwatchain) Start(srvr *p2p.Server) error {
 	// clients are searching for the first advertised protocol in the list
 	protocolVersion := AdvertiseProtocolVersions[0]
 	s.serverPool.start(srvr, lesTopic(s.blockchain.Genesis().Hash(), protocolVersion))
+	if ulc := s.protocolManager.ulc; ulc != nil {
+		// Keep connected to the trusted servers of the ultra light client
+		for _, node := range ulc.servers {
+			srvr.AddPeer(node)
+		}
+		log.Info("Ultra light client mode enabled", "servers", len(ulc.servers), "fraction", ulc.fraction)
+	}
+	// All peers of a light client are servers, so follow runtime changes of the
+	// server's peer limit instead of the configured light peer count once changed
+	limitCh := make(chan int, 1)
+	s.limitSub = srvr.SubscribeMaxPeers(limitCh)
+	go s.peerLimitLoop(limitCh, s.limitSub)
+
 	s.protocolManager.Start(s.config.LightPeers)
 	return nil
 }
 
+// peerLimitLoop applies the changes of the server's peer limit to the light
+// servers until the subscription is terminated.
+func (s *Lightwatchain) peerLimitLoop(limitCh <-chan int, sub event.Subscription) {
+	for {
+		select {
+		case maxPeers := <-limitCh:
+			log.Debug("Changing light server peer limit", "max", maxPeers)
+			s.protocolManager.SetMaxPeers(maxPeers)
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
 // Stop implements node.Service, terminating all internal goroutines used by the
 // watchain protocol.
 func (s *Lightwatchain) Stop() error {
+	if s.limitSub != nil {
+		s.limitSub.Unsubscribe()
+	}
 	s.odr.Stop()
 	if s.bloomIndexer != nil {
 		s.bloomIndexer.Close()
@@ -0,0 +1,319 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+var (
+	errNoCapacity       = errors.New("no free capacity available")
+	errTotalCapExceeded = errors.New("total capacity exceeded")
+	errPoolConnected    = errors.New("client already connected")
+)
+
+// priorityClientsKey -> RLP encoded list of the priority clients and their capacities
+var priorityClientsKey = []byte("_priorityClients")
+
+type priorityClientsRlp []struct {
+	ID       discover.NodeID
+	Capacity uint64
+}
+
+// poolClient is a light client connected to the server, either a priority one
+// with reserved capacity or a free one served with the default capacity.
+type poolClient struct {
+	id         discover.NodeID
+	capacity   uint64
+	priority   bool
+	seq        uint64                // Connection order of the client, oldest first
+	update     func(capacity uint64) // Callback to adjust the serving capacity of the client
+	disconnect func()                // Callback to drop the client from the server
+}
+
+// clientPool distributes the serving capacity of a LES server among the connected
+// light clients. Priority clients are assigned a reserved capacity by the server
+// operator and may evict free clients when connecting, while free clients share
+// whatever capacity is left, each one receiving the same default amount.
+//
+// Capacity is measured in the minimum recharge rate of the flow control buffer.
+type clientPool struct {
+	db       watdb.Database
+	totalCap uint64 // Total capacity that can be assigned to the connected clients
+	freeCap  uint64 // Capacity of a single free client
+	usedCap  uint64 // Capacity assigned to the currently connected clients
+	connSeq  uint64 // Number of clients connected so far, ordering them for eviction
+
+	priority map[discover.NodeID]uint64      // Reserved capacities of the priority clients
+	clients  map[discover.NodeID]*poolClient // Currently connected clients
+
+	lock sync.Mutex
+}
+
+// newClientPool creates a client pool with the given total capacity, loading the
+// list of priority clients from the database.
+func newClientPool(db watdb.Database, totalCap, freeCap uint64) *clientPool {
+	pool := &clientPool{
+		db:       db,
+		totalCap: totalCap,
+		freeCap:  freeCap,
+		priority: make(map[discover.NodeID]uint64),
+		clients:  make(map[discover.NodeID]*poolClient),
+	}
+	if db != nil {
+		var list priorityClientsRlp
+		data, err := db.Get(priorityClientsKey)
+		if err == nil {
+			err = rlp.DecodeBytes(data, &list)
+			if err != nil {
+				log.Error("Failed to decode priority clients", "err", err)
+			}
+		}
+		if err == nil {
+			for _, c := range list {
+				pool.priority[c.ID] = c.Capacity
+			}
+		}
+	}
+	return pool
+}
+
+// isPriority returns whwater the given client has reserved capacity.
+func (pool *clientPool) isPriority(id discover.NodeID) bool {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	_, ok := pool.priority[id]
+	return ok
+}
+
+// capacity returns the capacity a client would be served with when connecting.
+func (pool *clientPool) capacity(id discover.NodeID) uint64 {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if capacity, ok := pool.priority[id]; ok {
+		return capacity
+	}
+	return pool.freeCap
+}
+
+// connect registers a light client in the pool, returning the capacity it should
+// be served with. Priority clients evict the longest connected free clients if
+// not enough capacity is available, free clients are rejected in that case.
+func (pool *clientPool) connect(id discover.NodeID, update func(uint64), disconnect func()) (uint64, error) {
+	var evicted []*poolClient
+	defer func() {
+		for _, c := range evicted {
+			c.disconnect()
+		}
+	}()
+
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if _, ok := pool.clients[id]; ok {
+		return 0, errPoolConnected
+	}
+	client := &poolClient{
+		id:         id,
+		capacity:   pool.freeCap,
+		seq:        pool.connSeq,
+		update:     update,
+		disconnect: disconnect,
+	}
+	if capacity, ok := pool.priority[id]; ok {
+		client.capacity, client.priority = capacity, true
+	}
+	if pool.usedCap+client.capacity > pool.totalCap {
+		if !client.priority {
+			return 0, errNoCapacity
+		}
+		evicted = pool.evict(client.capacity, id)
+	}
+	pool.clients[id] = client
+	pool.usedCap += client.capacity
+	pool.connSeq++
+	return client.capacity, nil
+}
+
+// disconnect removes a light client from the pool, releasing its capacity.
+func (pool *clientPool) disconnect(id discover.NodeID) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if client, ok := pool.clients[id]; ok {
+		pool.usedCap -= client.capacity
+		delete(pool.clients, id)
+	}
+}
+
+// evictable returns the capacity of the free clients which could be evicted.
+func (pool *clientPool) evictable(skip discover.NodeID) uint64 {
+	var capacity uint64
+	for _, c := range pool.clients {
+		if !c.priority && c.id != skip {
+			capacity += c.capacity
+		}
+	}
+	return capacity
+}
+
+// evict removes the longest connected free clients from the pool until the
+// requested capacity becomes available, returning the evicted clients. The
+// caller is responsible for disconnecting them after releasing the lock.
+func (pool *clientPool) evict(capacity uint64, skip discover.NodeID) []*poolClient {
+	var free []*poolClient
+	for _, c := range pool.clients {
+		if !c.priority && c.id != skip {
+			free = append(free, c)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool { return free[i].seq < free[j].seq })
+
+	var evicted []*poolClient
+	for _, c := range free {
+		if pool.usedCap+capacity <= pool.totalCap {
+			break
+		}
+		pool.usedCap -= c.capacity
+		delete(pool.clients, c.id)
+		evicted = append(evicted, c)
+	}
+	return evicted
+}
+
+// setCapacity assigns a reserved capacity to a priority client, or demotes it to
+// a free client if the capacity is zero. The reserved capacities of all priority
+// clients may not exceed the total capacity of the server, and a connected client
+// must fit into it after evicting the free clients. If the client is connected,
+// its update callback is invoked with the new serving capacity.
+func (pool *clientPool) setCapacity(id discover.NodeID, capacity uint64) error {
+	var (
+		updated *poolClient
+		evicted []*poolClient
+	)
+	defer func() {
+		if updated != nil {
+			updated.update(capacity)
+		}
+		for _, c := range evicted {
+			c.disconnect()
+		}
+	}()
+
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	reserved := capacity
+	for node, c := range pool.priority {
+		if node != id {
+			reserved += c
+		}
+	}
+	if reserved > pool.totalCap {
+		return errTotalCapExceeded
+	}
+	// Reject the change if a connected client could not be served with the new
+	// capacity, even after evicting all other free clients
+	client, connected := pool.clients[id]
+	if connected {
+		needed := capacity
+		if needed == 0 {
+			needed = pool.freeCap
+		}
+		if pool.usedCap-client.capacity+needed > pool.totalCap+pool.evictable(id) {
+			return errNoCapacity
+		}
+	}
+	if capacity == 0 {
+		delete(pool.priority, id)
+	} else {
+		pool.priority[id] = capacity
+	}
+	pool.store()
+
+	if !connected {
+		return nil
+	}
+	pool.usedCap -= client.capacity
+	client.capacity, client.priority = capacity, capacity != 0
+	if !client.priority {
+		client.capacity = pool.freeCap
+	}
+	if pool.usedCap+client.capacity > pool.totalCap {
+		evicted = pool.evict(client.capacity, id)
+	}
+	pool.usedCap += client.capacity
+	capacity, updated = client.capacity, client
+	return nil
+}
+
+// totalCapacity returns the total capacity that can be assigned to the clients.
+func (pool *clientPool) totalCapacity() uint64 {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	return pool.totalCap
+}
+
+// clientInfos returns the status of the connected clients and the disconnected
+// priority ones.
+func (pool *clientPool) clientInfos() []ClientInfo {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	infos := make([]ClientInfo, 0, len(pool.clients)+len(pool.priority))
+	for _, c := range pool.clients {
+		infos = append(infos, ClientInfo{ID: c.id, Capacity: c.capacity, Priority: c.priority, Connected: true})
+	}
+	for id, capacity := range pool.priority {
+		if _, ok := pool.clients[id]; !ok {
+			infos = append(infos, ClientInfo{ID: id, Capacity: capacity, Priority: true})
+		}
+	}
+	return infos
+}
+
+// store persists the list of priority clients.
+func (pool *clientPool) store() {
+	if pool.db == nil {
+		return
+	}
+	list := make(priorityClientsRlp, 0, len(pool.priority))
+	for id, capacity := range pool.priority {
+		list = append(list, struct {
+			ID       discover.NodeID
+			Capacity uint64
+		}{id, capacity})
+	}
+	data, err := rlp.EncodeToBytes(list)
+	if err != nil {
+		log.Error("Failed to encode priority clients", "err", err)
+		return
+	}
+	if err := pool.db.Put(priorityClientsKey, data); err != nil {
+		log.Error("Failed to store priority clients", "err", err)
+	}
+}
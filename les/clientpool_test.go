@@ -0,0 +1,152 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"testing"
+
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// poolTester tracks the callbacks invoked by a client pool.
+type poolTester struct {
+	updated      map[discover.NodeID]uint64
+	disconnected map[discover.NodeID]bool
+}
+
+func newPoolTester() *poolTester {
+	return &poolTester{
+		updated:      make(map[discover.NodeID]uint64),
+		disconnected: make(map[discover.NodeID]bool),
+	}
+}
+
+// connect registers a client in the pool, recording its callbacks in the tester.
+func (t *poolTester) connect(pool *clientPool, id discover.NodeID) (uint64, error) {
+	update := func(capacity uint64) { t.updated[id] = capacity }
+	disconnect := func() { t.disconnected[id] = true }
+	return pool.connect(id, update, disconnect)
+}
+
+// Tests that free clients are served until the total capacity is used up and
+// priority clients evict the longest connected free ones.
+func TestClientPoolEviction(t *testing.T) {
+	tester := newPoolTester()
+	pool := newClientPool(nil, 10, 2)
+
+	if err := pool.setCapacity(discover.NodeID{0xff}, 5); err != nil {
+		t.Fatalf("failed to set priority capacity: %v", err)
+	}
+	for i := byte(1); i <= 5; i++ {
+		if capacity, err := tester.connect(pool, discover.NodeID{i}); err != nil || capacity != 2 {
+			t.Fatalf("free client %d: capacity %d, error %v, want 2, nil", i, capacity, err)
+		}
+	}
+	if _, err := tester.connect(pool, discover.NodeID{6}); err != errNoCapacity {
+		t.Fatalf("free client over capacity: error mismatch: have %v, want %v", err, errNoCapacity)
+	}
+	if capacity, err := tester.connect(pool, discover.NodeID{0xff}); err != nil || capacity != 5 {
+		t.Fatalf("priority client: capacity %d, error %v, want 5, nil", capacity, err)
+	}
+	if len(tester.disconnected) != 3 {
+		t.Fatalf("evicted client count mismatch: have %d, want 3", len(tester.disconnected))
+	}
+	for i := byte(1); i <= 3; i++ {
+		if !tester.disconnected[discover.NodeID{i}] {
+			t.Errorf("free client %d not evicted", i)
+		}
+	}
+	if _, err := tester.connect(pool, discover.NodeID{0xff}); err != errPoolConnected {
+		t.Fatalf("duplicate client: error mismatch: have %v, want %v", err, errPoolConnected)
+	}
+	pool.disconnect(discover.NodeID{0xff})
+	if _, err := tester.connect(pool, discover.NodeID{6}); err != nil {
+		t.Fatalf("free client after priority disconnect: %v", err)
+	}
+}
+
+// Tests that reserved capacities can't exceed the total one, connected clients
+// are adjusted on changes and the priority list is persisted.
+func TestClientPoolSetCapacity(t *testing.T) {
+	db, _ := watdb.NewMemDatabase()
+	tester := newPoolTester()
+	pool := newClientPool(db, 10, 2)
+
+	if err := pool.setCapacity(discover.NodeID{1}, 6); err != nil {
+		t.Fatalf("failed to set priority capacity: %v", err)
+	}
+	if err := pool.setCapacity(discover.NodeID{2}, 5); err != errTotalCapExceeded {
+		t.Fatalf("over reservation: error mismatch: have %v, want %v", err, errTotalCapExceeded)
+	}
+	if err := pool.setCapacity(discover.NodeID{1}, 8); err != nil {
+		t.Fatalf("failed to raise priority capacity: %v", err)
+	}
+	tester.connect(pool, discover.NodeID{1})
+	tester.connect(pool, discover.NodeID{3})
+
+	if err := pool.setCapacity(discover.NodeID{1}, 0); err != nil {
+		t.Fatalf("failed to demote priority client: %v", err)
+	}
+	if tester.updated[discover.NodeID{1}] != 2 {
+		t.Fatalf("demoted client capacity mismatch: have %d, want 2", tester.updated[discover.NodeID{1}])
+	}
+	if err := pool.setCapacity(discover.NodeID{3}, 9); err != nil {
+		t.Fatalf("failed to promote free client: %v", err)
+	}
+	if tester.updated[discover.NodeID{3}] != 9 || !tester.disconnected[discover.NodeID{1}] {
+		t.Fatalf("promotion mismatch: capacity %d, demoted client evicted %v", tester.updated[discover.NodeID{3}], tester.disconnected[discover.NodeID{1}])
+	}
+	infos := make(map[discover.NodeID]ClientInfo)
+	for _, info := range pool.clientInfos() {
+		infos[info.ID] = info
+	}
+	if len(infos) != 1 || infos[discover.NodeID{3}] != (ClientInfo{ID: discover.NodeID{3}, Capacity: 9, Priority: true, Connected: true}) {
+		t.Fatalf("client infos mismatch: have %v", infos)
+	}
+	// Restart the pool and check the priority list
+	pool = newClientPool(db, 10, 2)
+	if capacity := pool.capacity(discover.NodeID{3}); capacity != 9 {
+		t.Fatalf("persisted capacity mismatch: have %d, want 9", capacity)
+	}
+	if pool.isPriority(discover.NodeID{1}) {
+		t.Fatalf("demoted client persisted as priority")
+	}
+}
+
+// Tests that capacity changes of connected clients are rejected if the pool could
+// not serve them even after evicting all free clients.
+func TestClientPoolSetCapacityOverflow(t *testing.T) {
+	tester := newPoolTester()
+	pool := newClientPool(nil, 10, 2)
+
+	pool.setCapacity(discover.NodeID{1}, 9)
+	pool.setCapacity(discover.NodeID{2}, 1)
+	tester.connect(pool, discover.NodeID{1})
+	tester.connect(pool, discover.NodeID{2})
+
+	// Demoting the small priority client would need the free capacity
+	if err := pool.setCapacity(discover.NodeID{2}, 0); err != errNoCapacity {
+		t.Fatalf("demotion over capacity: error mismatch: have %v, want %v", err, errNoCapacity)
+	}
+	if !pool.isPriority(discover.NodeID{2}) || pool.usedCap != 10 {
+		t.Fatalf("rejected demotion changed the pool: priority %v, used capacity %d", pool.isPriority(discover.NodeID{2}), pool.usedCap)
+	}
+	if _, ok := tester.updated[discover.NodeID{2}]; ok {
+		t.Fatalf("rejected demotion updated the client")
+	}
+}
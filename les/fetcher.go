@@ -50,6 +50,7 @@ type lightFetcher struct {
 	lastUpdateStats *updateStatsEntry
 	syncing         bool
 	syncDone        chan *peer
+	syncTo          func(p *peer, head blockInfo, trusted bool) // Synchronises with a peer up to a head, replaceable in tests
 
 	reqMu      sync.RWMutex // reqMu protects access to sent header fetch requests
 	requested  map[uint64]fetchRequest
@@ -95,6 +96,7 @@ type fetchRequest struct {
 	peer    *peer
 	sent    mclock.AbsTime
 	timeout bool
+	trusted bool // Whwater the headers skip seal verification, decided when requested
 }
 
 // fetchResponse represents a header download response
@@ -116,6 +118,7 @@ func newLightFetcher(pm *ProtocolManager) *lightFetcher {
 		timeoutChn:     make(chan uint64),
 		requestChn:     make(chan bool, 100),
 		syncDone:       make(chan *peer),
+		syncTo:         pm.synchroniseTo,
 		maxConfirmedTd: big.NewInt(0),
 	}
 	pm.peers.notify(f)
@@ -331,6 +334,9 @@ func (f *lightFetcher) announce(p *peer, head *announceData) {
 	p.headInfo = head
 	fp.lastAnnounced = n
 	p.lock.Unlock()
+	if p.isTrusted {
+		f.checkTrustedHeads()
+	}
 	f.checkUpdateStats(p, nil)
 	f.requestChn <- true
 }
@@ -394,17 +400,27 @@ func (f *lightFetcher) requestedID(reqID uint64) bool {
 func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 	var (
 		bestHash   common.Hash
+		bestNumber uint64
 		bestAmount uint64
 	)
 	bestTd := f.maxConfirmedTd
 	bestSyncing := false
+	ulcMode := f.pm.ulc.active()
 
 	for p, fp := range f.peers {
+		if ulcMode && !p.isTrusted {
+			continue
+		}
 		for hash, n := range fp.nodeByHash {
+			if ulcMode && !f.pm.ulc.quorum(f.trustedAnnounced(hash)) {
+				// Ultra light clients only follow heads announced by enough trusted servers
+				continue
+			}
 			if !f.checkKnownNode(p, n) && !n.requested && (bestTd == nil || n.td.Cmp(bestTd) >= 0) {
 				amount := f.requestAmount(p, n)
 				if bestTd == nil || n.td.Cmp(bestTd) > 0 || amount < bestAmount {
 					bestHash = hash
+					bestNumber = n.number
 					bestAmount = amount
 					bestTd = n.td
 					bestSyncing = fp.bestConfirmed == nil || fp.root == nil || !f.checkKnownNode(p, fp.root)
@@ -427,6 +443,9 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 			},
 			canSend: func(dp distPeer) bool {
 				p := dp.(*peer)
+				if ulcMode && !p.isTrusted {
+					return false
+				}
 				f.lock.Lock()
 				defer f.lock.Unlock()
 
@@ -437,7 +456,14 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 				go func() {
 					p := dp.(*peer)
 					p.Log().Debug("Synchronisation started")
-					f.pm.synchronise(p)
+
+					// Ultra light clients skip the seal checks of the synced headers,
+					// so only sync up to the head approved by the trusted servers
+					head := p.headBlockInfo()
+					if ulcMode {
+						head = blockInfo{Hash: bestHash, Number: bestNumber, Td: bestTd}
+					}
+					f.syncTo(p, head, ulcMode && p.isTrusted)
 					f.syncDone <- p
 				}()
 				return nil
@@ -451,6 +477,9 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 			},
 			canSend: func(dp distPeer) bool {
 				p := dp.(*peer)
+				if ulcMode && !p.isTrusted {
+					return false
+				}
 				f.lock.Lock()
 				defer f.lock.Unlock()
 
@@ -476,7 +505,7 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 				cost := p.GetRequestCost(GetBlockHeadersMsg, int(bestAmount))
 				p.fcServer.QueueRequest(reqID, cost)
 				f.reqMu.Lock()
-				f.requested[reqID] = fetchRequest{hash: bestHash, amount: bestAmount, peer: p, sent: mclock.Now()}
+				f.requested[reqID] = fetchRequest{hash: bestHash, amount: bestAmount, peer: p, sent: mclock.Now(), trusted: ulcMode && p.isTrusted}
 				f.reqMu.Unlock()
 				go func() {
 					time.Sleep(hardRequestTimeout)
@@ -489,6 +518,50 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 	return rq, reqID
 }
 
+// trustedAnnounced returns the number of trusted servers which have announced
+// the given block.
+func (f *lightFetcher) trustedAnnounced(hash common.Hash) int {
+	count := 0
+	for p, fp := range f.peers {
+		if p.isTrusted && fp.nodeByHash[hash] != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// checkTrustedHeads switches the ultra light client to the normal light client
+// rules if the trusted servers announce conflicting heads of the same height and
+// none of them is followed by a quorum, and switches back once a quorum of them
+// agrees on a head again.
+func (f *lightFetcher) checkTrustedHeads() {
+	var (
+		heads    = make(map[common.Hash]bool)
+		numbers  = make(map[uint64]common.Hash)
+		conflict bool
+	)
+	for p, fp := range f.peers {
+		if !p.isTrusted || fp.lastAnnounced == nil {
+			continue
+		}
+		n := fp.lastAnnounced
+		heads[n.hash] = true
+		if hash, ok := numbers[n.number]; ok && hash != n.hash {
+			conflict = true
+		}
+		numbers[n.number] = n.hash
+	}
+	for hash := range heads {
+		if f.pm.ulc.quorum(f.trustedAnnounced(hash)) {
+			f.pm.ulc.setFallback(false)
+			return
+		}
+	}
+	if conflict {
+		f.pm.ulc.setFallback(true)
+	}
+}
+
 // deliverHeaders delivers header download request responses for processing
 func (f *lightFetcher) deliverHeaders(peer *peer, reqID uint64, headers []*types.Header) {
 	f.deliverChn <- fetchResponse{reqID: reqID, headers: headers, peer: peer}
@@ -504,7 +577,12 @@ func (f *lightFetcher) processResponse(req fetchRequest, resp fetchResponse) boo
 	for i, header := range resp.headers {
 		headers[int(req.amount)-1-i] = header
 	}
-	if _, err := f.chain.InsertHeaderChain(headers, 1); err != nil {
+	// Headers requested from trusted servers in ultra light client mode are not verified
+	checkFreq := 1
+	if req.trusted {
+		checkFreq = 0
+	}
+	if _, err := f.chain.InsertHeaderChain(headers, checkFreq); err != nil {
 		if err == consensus.ErrFutureBlock {
 			return true
 		}
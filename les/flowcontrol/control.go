@@ -54,6 +54,14 @@ func (peer *ClientNode) Remove(cm *ClientManager) {
 	cm.removeNode(peer.cmNode)
 }
 
+// Params returns the flow control parameters the client is currently served with.
+func (peer *ClientNode) Params() *ServerParams {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+
+	return peer.params
+}
+
 func (peer *ClientNode) recalcBV(time mclock.AbsTime) {
 	dt := uint64(time - peer.lastTime)
 	if time < peer.lastTime {
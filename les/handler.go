@@ -24,6 +24,7 @@ import (
 	"math/big"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/watchain/go-watchain/common"
@@ -31,6 +32,7 @@ import (
 	"github.com/watchain/go-watchain/core"
 	"github.com/watchain/go-watchain/core/state"
 	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/wat"
 	"github.com/watchain/go-watchain/wat/downloader"
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/event"
@@ -105,11 +107,15 @@ type ProtocolManager struct {
 	lesTopic    discv5.Topic
 	reqDist     *requestDistributor
 	retriever   *retrieveManager
+	ulc         *ulc      // Ultra light client state, nil if not enabled
+	ulcChain    *ulcChain // Light chain of the downloader, nil if the ultra light client is not enabled
 
 	downloader *downloader.Downloader
 	fetcher    *lightFetcher
 	peers      *peerSet
-	maxPeers   int
+	maxPeers   int32                                // Maximum number of LES peers, accessed atomically
+	dropPeer   func(p *peer, reason p2p.DiscReason) // Disconnects a peer at the networking layer, replaceable in tests
+	syncing    int32                                // Flag whwater a light sync is running
 
 	SubProtocols []p2p.Protocol
 
@@ -127,7 +133,7 @@ type ProtocolManager struct {
 
 // NewProtocolManager returns a new watereum sub protocol manager. The watchain sub protocol manages peers capable
 // with the watereum network.
-func NewProtocolManager(chainConfig *params.ChainConfig, lightSync bool, protocolVersions []uint, networkId uint64, mux *event.TypeMux, engine consensus.Engine, peers *peerSet, blockchain BlockChain, txpool txPool, chainDb watdb.Database, odr *LesOdr, txrelay *LesTxRelay, quitSync chan struct{}, wg *sync.WaitGroup) (*ProtocolManager, error) {
+func NewProtocolManager(chainConfig *params.ChainConfig, lightSync bool, protocolVersions []uint, networkId uint64, mux *event.TypeMux, engine consensus.Engine, peers *peerSet, blockchain BlockChain, txpool txPool, chainDb watdb.Database, odr *LesOdr, txrelay *LesTxRelay, quitSync chan struct{}, wg *sync.WaitGroup, ulcConfig *wat.ULCConfig) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		lightSync:   lightSync,
@@ -144,11 +150,19 @@ func NewProtocolManager(chainConfig *params.ChainConfig, lightSync bool, protoco
 		quitSync:    quitSync,
 		wg:          wg,
 		noMorePeers: make(chan struct{}),
+		dropPeer:    func(p *peer, reason p2p.DiscReason) { p.Peer.Disconnect(reason) },
 	}
 	if odr != nil {
 		manager.retriever = odr.retriever
 		manager.reqDist = odr.retriever.dist
 	}
+	if ulcConfig != nil {
+		ulc, err := newULC(ulcConfig)
+		if err != nil {
+			return nil, err
+		}
+		manager.ulc = ulc
+	}
 
 	// Initiate a sub-protocol for every implemented version we can handle
 	manager.SubProtocols = make([]p2p.Protocol, 0, len(protocolVersions))
@@ -204,7 +218,12 @@ func NewProtocolManager(chainConfig *params.ChainConfig, lightSync bool, protoco
 	}
 
 	if lightSync {
-		manager.downloader = downloader.New(downloader.LightSync, chainDb, manager.eventMux, nil, blockchain, removePeer)
+		var lightchain downloader.LightChain = blockchain
+		if manager.ulc != nil {
+			manager.ulcChain = &ulcChain{BlockChain: blockchain}
+			lightchain = manager.ulcChain
+		}
+		manager.downloader = downloader.New(downloader.LightSync, nil, chainDb, manager.eventMux, nil, lightchain, removePeer, nil)
 		manager.peers.notify((*downloaderPeerNotify)(manager))
 		manager.fetcher = newLightFetcher(manager)
 	}
@@ -217,8 +236,15 @@ func (pm *ProtocolManager) removePeer(id string) {
 	pm.peers.Unregister(id)
 }
 
+// SetMaxPeers changes the maximum number of LES peers. Peers above the new limit
+// are not disconnected, but no new peers are accepted until the peer count has
+// dropped below it.
+func (pm *ProtocolManager) SetMaxPeers(maxPeers int) {
+	atomic.StoreInt32(&pm.maxPeers, int32(maxPeers))
+}
+
 func (pm *ProtocolManager) Start(maxPeers int) {
-	pm.maxPeers = maxPeers
+	pm.SetMaxPeers(maxPeers)
 
 	if pm.lightSync {
 		go pm.syncer()
@@ -254,16 +280,24 @@ func (pm *ProtocolManager) Stop() {
 }
 
 func (pm *ProtocolManager) newPeer(pv int, nv uint64, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
-	return newPeer(pv, nv, p, newMeteredMsgWriter(rw))
+	peer := newPeer(pv, nv, p, newMeteredMsgWriter(rw))
+	if pm.ulc != nil {
+		peer.isTrusted = pm.ulc.isTrusted(p.ID())
+	}
+	return peer
 }
 
 // handle is the callback invoked to manage the life cycle of a les peer. When
 // this function terminates, the peer is disconnected.
 func (pm *ProtocolManager) handle(p *peer) error {
-	// Ignore maxPeers if this is a trusted peer
-	if pm.peers.Len() >= pm.maxPeers && !p.Peer.Info().Network.Trusted {
+	// Ignore maxPeers if this is a trusted peer, a trusted server of an ultra light
+	// client or a client with reserved capacity
+	if pm.peers.Len() >= int(atomic.LoadInt32(&pm.maxPeers)) && !p.Peer.Info().Network.Trusted && !p.isTrusted && (pm.server == nil || !pm.server.pool.isPriority(p.ID())) {
 		return p2p.DiscTooManyPeers
 	}
+	if pm.server != nil {
+		p.fcParams = pm.server.clientParams(p.ID())
+	}
 
 	p.Log().Debug("Light watchain peer connected", "name", p.Name())
 
@@ -282,6 +316,31 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	if rw, ok := p.rw.(*meteredMsgReadWriter); ok {
 		rw.Init(p.version)
 	}
+	// Assign serving capacity to light clients, evicting free ones if needed
+	if p.fcClient != nil {
+		// The flow control parameters are only announced during the handshake and
+		// the client limits itself to them, so make it reconnect on any change.
+		update := func(capacity uint64) {
+			if capacity != p.fcParams.MinRecharge {
+				pm.dropPeer(p, p2p.DiscRequested)
+			}
+		}
+		disconnect := func() { pm.dropPeer(p, p2p.DiscTooManyPeers) }
+
+		capacity, err := pm.server.pool.connect(p.ID(), update, disconnect)
+		if err != nil {
+			p.Log().Debug("Light client rejected", "err", err)
+			p.fcClient.Remove(pm.server.fcManager)
+			return p2p.DiscTooManyPeers
+		}
+		defer pm.server.pool.disconnect(p.ID())
+
+		if capacity != p.fcParams.MinRecharge {
+			p.Log().Debug("Light client capacity changed during handshake")
+			p.fcClient.Remove(pm.server.fcManager)
+			return p2p.DiscRequested
+		}
+	}
 	// Register the peer locally
 	if err := pm.peers.Register(p); err != nil {
 		p.Log().Error("Light watchain peer registration failed", "err", err)
@@ -348,12 +407,13 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			return true
 		}
 		bufValue, _ := p.fcClient.AcceptRequest()
+		params := p.fcClient.Params()
 		cost := costs.baseCost + reqCnt*costs.reqCost
-		if cost > pm.server.defParams.BufLimit {
-			cost = pm.server.defParams.BufLimit
+		if cost > params.BufLimit {
+			cost = params.BufLimit
 		}
 		if cost > bufValue {
-			recharge := time.Duration((cost - bufValue) * 1000000 / pm.server.defParams.MinRecharge)
+			recharge := time.Duration((cost - bufValue) * 1000000 / params.MinRecharge)
 			p.Log().Error("Request came too early", "recharge", common.PrettyDuration(recharge))
 			return true
 		}
@@ -28,10 +28,12 @@ import (
 	"github.com/watchain/go-watchain/core"
 	"github.com/watchain/go-watchain/core/types"
 	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/les/flowcontrol"
 	"github.com/watchain/go-watchain/wat/downloader"
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/light"
 	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/discover"
 	"github.com/watchain/go-watchain/params"
 	"github.com/watchain/go-watchain/rlp"
 	"github.com/watchain/go-watchain/trie"
@@ -578,3 +580,62 @@ func TestTransactionStatusLes2(t *testing.T) {
 	test(tx1, false, txStatus{Status: core.TxStatusPending})
 	test(tx2, false, txStatus{Status: core.TxStatusPending})
 }
+
+// Tests that raising the capacity of a connected client disconnects it, as the
+// flow control parameters are only announced during the handshake, and that the
+// raised buffer is announced and served after it reconnects.
+func TestClientCapacityRaise(t *testing.T) {
+	db, _ := watdb.NewMemDatabase()
+	pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
+	bc := pm.blockchain.(*core.BlockChain)
+
+	// Test peers can't be disconnected at the networking layer, record the drops
+	dropped := make(chan p2p.DiscReason, 1)
+	pm.dropPeer = func(p *peer, reason p2p.DiscReason) { dropped <- reason }
+
+	var (
+		id      = discover.NodeID{1}
+		query   = &getBlockHeadersData{Origin: hashOrNumber{Number: 1}, Amount: 1}
+		headers = []*types.Header{bc.GetHeaderByNumber(1)}
+	)
+	peer, errc := newTestPeerWithID(t, "peer", lpv2, pm, id, &flowcontrol.ServerParams{BufLimit: testBufLimit, MinRecharge: 1})
+
+	sendRequest(peer.app, GetBlockHeadersMsg, 1, 0, query)
+	if err := expectResponse(peer.app, BlockHeadersMsg, 1, testBufLimit, headers); err != nil {
+		t.Fatalf("headers mismatch before raise: %v", err)
+	}
+	if err := pm.server.pool.setCapacity(id, 5); err != nil {
+		t.Fatalf("failed to raise capacity: %v", err)
+	}
+	select {
+	case reason := <-dropped:
+		if reason != p2p.DiscRequested {
+			t.Fatalf("disconnect reason mismatch: have %v, want %v", reason, p2p.DiscRequested)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("client not disconnected after capacity raise")
+	}
+	// Reconnect the client and check that it gets the raised parameters
+	peer.close()
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatalf("client handler not terminated")
+	}
+	raised := pm.server.capacityParams(5)
+	if raised.BufLimit <= testBufLimit {
+		t.Fatalf("raised buffer limit %d not above default %d", raised.BufLimit, testBufLimit)
+	}
+	peer, _ = newTestPeerWithID(t, "peer", lpv2, pm, id, raised)
+	defer peer.close()
+
+	sendRequest(peer.app, GetBlockHeadersMsg, 2, 0, query)
+	if err := expectResponse(peer.app, BlockHeadersMsg, 2, raised.BufLimit, headers); err != nil {
+		t.Fatalf("headers mismatch after reconnect: %v", err)
+	}
+	select {
+	case reason := <-dropped:
+		t.Fatalf("reconnected client disconnected: %v", reason)
+	default:
+	}
+}
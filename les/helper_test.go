@@ -178,7 +178,7 @@ func newTestProtocolManager(lightSync bool, blocks int, generator func(int, *cor
 	} else {
 		protocolVersions = ServerProtocolVersions
 	}
-	pm, err := NewProtocolManager(gspec.Config, lightSync, protocolVersions, NetworkId, evmux, engine, peers, chain, nil, db, odr, nil, make(chan struct{}), new(sync.WaitGroup))
+	pm, err := NewProtocolManager(gspec.Config, lightSync, protocolVersions, NetworkId, evmux, engine, peers, chain, nil, db, odr, nil, make(chan struct{}), new(sync.WaitGroup), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -193,6 +193,7 @@ func newTestProtocolManager(lightSync bool, blocks int, generator func(int, *cor
 
 		srv.fcManager = flowcontrol.NewClientManager(50, 10, 1000000000)
 		srv.fcCoswatats = newCoswatats(nil)
+		srv.pool = newClientPool(nil, srv.defParams.MinRecharge*1000, srv.defParams.MinRecharge)
 	}
 	pm.Start(1000)
 	return pm, nil
@@ -219,13 +220,24 @@ type testPeer struct {
 
 // newTestPeer creates a new peer registered at the given protocol manager.
 func newTestPeer(t *testing.T, name string, version int, pm *ProtocolManager, shake bool) (*testPeer, <-chan error) {
-	// Create a message pipe to communicate through
-	app, net := p2p.MsgPipe()
-
 	// Generate a random id and create the peer
 	var id discover.NodeID
 	rand.Read(id[:])
 
+	var params *flowcontrol.ServerParams
+	if shake {
+		params = &flowcontrol.ServerParams{BufLimit: testBufLimit, MinRecharge: 1}
+	}
+	return newTestPeerWithID(t, name, version, pm, id, params)
+}
+
+// newTestPeerWithID creates a new peer with the given id registered at the given
+// protocol manager. If flow control parameters are given, the handshake is run
+// expecting the server to announce them.
+func newTestPeerWithID(t *testing.T, name string, version int, pm *ProtocolManager, id discover.NodeID, params *flowcontrol.ServerParams) (*testPeer, <-chan error) {
+	// Create a message pipe to communicate through
+	app, net := p2p.MsgPipe()
+
 	peer := pm.newPeer(version, NetworkId, p2p.NewPeer(id, name, nil), net)
 
 	// Start the peer on a new thread
@@ -244,13 +256,13 @@ func newTestPeer(t *testing.T, name string, version int, pm *ProtocolManager, sh
 		peer: peer,
 	}
 	// Execute any implicitly requested handshakes and return
-	if shake {
+	if params != nil {
 		var (
 			genesis = pm.blockchain.Genesis()
 			head    = pm.blockchain.CurrentHeader()
 			td      = pm.blockchain.GetTd(head.Hash(), head.Number.Uint64())
 		)
-		tp.handshake(t, td, head.Hash(), head.Number.Uint64(), genesis.Hash())
+		tp.handshake(t, td, head.Hash(), head.Number.Uint64(), genesis.Hash(), params)
 	}
 	return tp, errc
 }
@@ -289,8 +301,8 @@ func newTestPeerPair(name string, version int, pm, pm2 *ProtocolManager) (*peer,
 }
 
 // handshake simulates a trivial handshake that expects the same state from the
-// remote side as we are simulating locally.
-func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNum uint64, genesis common.Hash) {
+// remote side as we are simulating locally and the given flow control parameters.
+func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNum uint64, genesis common.Hash, params *flowcontrol.ServerParams) {
 	var expList keyValueList
 	expList = expList.add("protocolVersion", uint64(p.version))
 	expList = expList.add("networkId", uint64(NetworkId))
@@ -304,8 +316,8 @@ func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNu
 	expList = expList.add("serveChainSince", uint64(0))
 	expList = expList.add("serveStateSince", uint64(0))
 	expList = expList.add("txRelay", nil)
-	expList = expList.add("flowControl/BL", testBufLimit)
-	expList = expList.add("flowControl/MRR", uint64(1))
+	expList = expList.add("flowControl/BL", params.BufLimit)
+	expList = expList.add("flowControl/MRR", params.MinRecharge)
 	expList = expList.add("flowControl/MRC", testRCL())
 
 	if err := p2p.ExpectMsg(p.app, StatusMsg, expList); err != nil {
@@ -315,10 +327,7 @@ func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNu
 		t.Fatalf("status send: %v", err)
 	}
 
-	p.fcServerParams = &flowcontrol.ServerParams{
-		BufLimit:    testBufLimit,
-		MinRecharge: 1,
-	}
+	p.fcServerParams = params
 }
 
 // close terminates the local side of the peer, notifying the remote protocol
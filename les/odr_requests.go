@@ -60,6 +60,8 @@ func LesRequest(req light.OdrRequest) LesOdrRequest {
 		return (*BlockRequest)(r)
 	case *light.ReceiptsRequest:
 		return (*ReceiptsRequest)(r)
+	case *light.ReceiptsBatchRequest:
+		return (*ReceiptsBatchRequest)(r)
 	case *light.TrieRequest:
 		return (*TrieRequest)(r)
 	case *light.CodeRequest:
@@ -178,6 +180,61 @@ func (r *ReceiptsRequest) Validate(db watdb.Database, msg *Msg) error {
 	return nil
 }
 
+// ReceiptsBatchRequest is the ODR request type for the receipts of multiple
+// blocks by block hash
+type ReceiptsBatchRequest light.ReceiptsBatchRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *ReceiptsBatchRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetReceiptsMsg, len(r.Hashes))
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *ReceiptsBatchRequest) CanSend(peer *peer) bool {
+	for i, hash := range r.Hashes {
+		if !peer.HasBlock(hash, r.Numbers[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *ReceiptsBatchRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting batch of block receipts", "count", len(r.Hashes))
+	return peer.RequestReceipts(reqID, r.GetCost(peer), r.Hashes)
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *ReceiptsBatchRequest) Validate(db watdb.Database, msg *Msg) error {
+	log.Debug("Validating batch of block receipts", "count", len(r.Hashes))
+
+	// Ensure we have a correct message with a receipt list for each block
+	if msg.MsgType != MsgReceipts {
+		return errInvalidMessageType
+	}
+	receipts := msg.Obj.([]types.Receipts)
+	if len(receipts) != len(r.Hashes) {
+		return errInvalidEntryCount
+	}
+	// Retrieve our stored headers and validate receipt contents against them
+	for i, hash := range r.Hashes {
+		header := core.GetHeader(db, hash, r.Numbers[i])
+		if header == nil {
+			return errHeaderUnavailable
+		}
+		if header.ReceiptHash != types.DeriveSha(receipts[i]) {
+			return errReceiptHashMismatch
+		}
+	}
+	// Validations passed, store and return
+	r.Receipts = receipts
+	return nil
+}
+
 type ProofReq struct {
 	BHash       common.Hash
 	AccKey, Key []byte
@@ -30,6 +30,7 @@ import (
 	"github.com/watchain/go-watchain/core/types"
 	"github.com/watchain/go-watchain/core/vm"
 	"github.com/watchain/go-watchain/wat"
+	"github.com/watchain/go-watchain/wat/filters"
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/light"
 	"github.com/watchain/go-watchain/params"
@@ -74,6 +75,32 @@ func odrGetReceipts(ctx context.Context, db watdb.Database, config *params.Chain
 	return rlp
 }
 
+func TestOdrGetLogsLes1(t *testing.T) { testOdr(t, 1, 1, odrGetLogs) }
+
+func TestOdrGetLogsLes2(t *testing.T) { testOdr(t, 2, 1, odrGetLogs) }
+
+func odrGetLogs(ctx context.Context, db watdb.Database, config *params.ChainConfig, bc *core.BlockChain, lc *light.LightChain, bhash common.Hash) []byte {
+	var logs [][]*types.Log
+	if bc != nil {
+		receipts := core.GetBlockReceipts(db, bhash, core.GetBlockNumber(db, bhash))
+		if receipts == nil {
+			return nil
+		}
+		logs = make([][]*types.Log, len(receipts))
+		for i, receipt := range receipts {
+			logs[i] = receipt.Logs
+		}
+	} else {
+		batch, err := light.GetBlockLogsBatch(ctx, lc.Odr(), []common.Hash{bhash}, []uint64{core.GetBlockNumber(db, bhash)})
+		if err != nil {
+			return nil
+		}
+		logs = batch[0]
+	}
+	rlp, _ := rlp.EncodeToBytes(logs)
+	return rlp
+}
+
 func TestOdrAccountsLes1(t *testing.T) { testOdr(t, 1, 1, odrAccounts) }
 
 func TestOdrAccountsLes2(t *testing.T) { testOdr(t, 2, 1, odrAccounts) }
@@ -213,3 +240,94 @@ func testOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	time.Sleep(time.Millisecond * 10) // ensure that all peerSetNotify callbacks are executed
 	test(5)
 }
+
+func TestOdrFilterLogsLes1(t *testing.T) { testOdrFilterLogs(t, 1) }
+
+func TestOdrFilterLogsLes2(t *testing.T) { testOdrFilterLogs(t, 2) }
+
+// testOdrFilterLogs checks that log filters on a light client retrieve and verify
+// the receipts of the blocks whose bloom matches the filter criteria, both for
+// blocks containing matching logs and for false positive bloom matches.
+func testOdrFilterLogs(t *testing.T, protocol int) {
+	// Assemble the test environment
+	peers := newPeerSet()
+	dist := newRequestDistributor(peers, make(chan struct{}))
+	rm := newRetrieveManager(peers, dist, nil)
+	db, _ := watdb.NewMemDatabase()
+	ldb, _ := watdb.NewMemDatabase()
+	odr := NewLesOdr(ldb, light.NewChtIndexer(db, true), light.NewBloomTrieIndexer(db, true), wat.NewBloomIndexer(db, light.BloomTrieFrequency), rm)
+	pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
+	lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr, ldb)
+	_, err1, lpeer, err2 := newTestPeerPair("peer", protocol, pm, lpm)
+	select {
+	case <-time.After(time.Millisecond * 100):
+	case err := <-err1:
+		t.Fatalf("peer 1 handshake error: %v", err)
+	case err := <-err2:
+		t.Fatalf("peer 1 handshake error: %v", err)
+	}
+	lpm.synchronise(lpeer)
+
+	lpeer.lock.Lock()
+	lpeer.hasBlock = func(common.Hash, uint64) bool { return true }
+	lpeer.lock.Unlock()
+
+	backend := &LesApiBackend{wat: &Lightwatchain{chainDb: ldb, odr: odr, blockchain: lpm.blockchain.(*light.LightChain)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The event emitter logs a single, topic only event when created in block 2
+	hash := core.GetCanonicalHash(db, 2)
+	var event *types.Log
+	for _, receipt := range core.GetBlockReceipts(db, hash, 2) {
+		for _, log := range receipt.Logs {
+			if log.Address == testEventEmitterAddr {
+				event = log
+			}
+		}
+	}
+	if event == nil || len(event.Topics) != 1 {
+		t.Fatalf("test event missing from the chain: %v", event)
+	}
+	// Filtering for the event topic in the wrong position matches the bloom of
+	// the block, but none of its logs
+	header := lpm.blockchain.GetHeaderByHash(hash)
+	if !types.BloomLookup(header.Bloom, event.Address) || !types.BloomLookup(header.Bloom, event.Topics[0]) {
+		t.Fatalf("event missing from the block bloom")
+	}
+	logs, err := filters.New(backend, 0, -1, []common.Address{event.Address}, [][]common.Hash{nil, {event.Topics[0]}}).Logs(ctx)
+	if err != nil {
+		t.Fatalf("false positive filter failed: %v", err)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("false positive filter matched logs: %v", logs)
+	}
+	if core.GetBlockReceipts(ldb, hash, 2) == nil {
+		t.Fatalf("receipts of the false positive block not retrieved")
+	}
+	// Filtering for the event itself should return it with all fields derived
+	logs, err = filters.New(backend, 0, -1, []common.Address{event.Address}, [][]common.Hash{{event.Topics[0]}}).Logs(ctx)
+	if err != nil {
+		t.Fatalf("positive filter failed: %v", err)
+	}
+	if len(logs) != 1 || logs[0].TxHash != event.TxHash || logs[0].BlockNumber != 2 {
+		t.Fatalf("positive filter mismatch: have %v, want %v", logs, event)
+	}
+	// Retrieve the logs of the entire chain in a single batch, some already local
+	hashes := make([]common.Hash, 4)
+	for i := range hashes {
+		hashes[i] = core.GetCanonicalHash(db, uint64(i+1))
+	}
+	batch, err := backend.GetLogsBatch(ctx, hashes)
+	if err != nil {
+		t.Fatalf("batched logs retrieval failed: %v", err)
+	}
+	for i, hash := range hashes {
+		want := odrGetLogs(light.NoOdr, db, pm.chainConfig, pm.blockchain.(*core.BlockChain), nil, hash)
+		have, _ := rlp.EncodeToBytes(batch[i])
+		if !bytes.Equal(have, want) {
+			t.Errorf("block %d: logs mismatch: have %x, want %x", i+1, have, want)
+		}
+	}
+}
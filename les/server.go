@@ -32,8 +32,10 @@ import (
 	"github.com/watchain/go-watchain/light"
 	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/discover"
 	"github.com/watchain/go-watchain/p2p/discv5"
 	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/rpc"
 )
 
 type LesServer struct {
@@ -42,6 +44,7 @@ type LesServer struct {
 	fcManager       *flowcontrol.ClientManager // nil if our node is client only
 	fcCoswatats     *requestCoswatats
 	defParams       *flowcontrol.ServerParams
+	pool            *clientPool
 	lesTopics       []discv5.Topic
 	privateKey      *ecdsa.PrivateKey
 	quitSync        chan struct{}
@@ -51,7 +54,7 @@ type LesServer struct {
 
 func NewLesServer(wat *wat.watchain, config *wat.Config) (*LesServer, error) {
 	quitSync := make(chan struct{})
-	pm, err := NewProtocolManager(wat.BlockChain().Config(), false, ServerProtocolVersions, config.NetworkId, wat.EventMux(), wat.Engine(), newPeerSet(), wat.BlockChain(), wat.TxPool(), wat.ChainDb(), nil, nil, quitSync, new(sync.WaitGroup))
+	pm, err := NewProtocolManager(wat.BlockChain().Config(), false, ServerProtocolVersions, config.NetworkId, wat.EventMux(), wat.Engine(), newPeerSet(), wat.BlockChain(), wat.TxPool(), wat.ChainDb(), nil, nil, quitSync, new(sync.WaitGroup), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -99,6 +102,7 @@ func NewLesServer(wat *wat.watchain, config *wat.Config) (*LesServer, error) {
 	}
 	srv.fcManager = flowcontrol.NewClientManager(uint64(config.LightServ), 10, 1000000000)
 	srv.fcCoswatats = newCoswatats(wat.ChainDb())
+	srv.pool = newClientPool(wat.ChainDb(), srv.defParams.MinRecharge*uint64(config.LightPeers), srv.defParams.MinRecharge)
 	return srv, nil
 }
 
@@ -106,6 +110,37 @@ func (s *LesServer) Protocols() []p2p.Protocol {
 	return s.protocolManager.SubProtocols
 }
 
+// APIs returns the collection of RPC services the LES server offers.
+func (s *LesServer) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPrivateLightServerAPI(s),
+			Public:    false,
+		},
+	}
+}
+
+// clientParams returns the flow control parameters a connecting client should
+// be served with, depending on whwater it has reserved capacity.
+func (s *LesServer) clientParams(id discover.NodeID) *flowcontrol.ServerParams {
+	return s.capacityParams(s.pool.capacity(id))
+}
+
+// capacityParams returns the flow control parameters serving a client with the
+// given capacity, keeping the buffer size proportional to the recharge rate of
+// the default parameters.
+func (s *LesServer) capacityParams(capacity uint64) *flowcontrol.ServerParams {
+	if capacity == s.defParams.MinRecharge {
+		return s.defParams
+	}
+	return &flowcontrol.ServerParams{
+		BufLimit:    capacity * (s.defParams.BufLimit / s.defParams.MinRecharge),
+		MinRecharge: capacity,
+	}
+}
+
 // Start starts the LES server
 func (s *LesServer) Start(srvr *p2p.Server) {
 	s.protocolManager.Start(s.config.LightPeers)
@@ -18,6 +18,7 @@ package les
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/watchain/go-watchain/core"
@@ -71,14 +72,30 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	if peer == nil {
 		return
 	}
+	pm.synchroniseTo(peer, peer.headBlockInfo(), pm.ulc.active() && peer.isTrusted)
+}
 
-	// Make sure the peer's TD is higher than our own.
-	if !pm.needToSync(peer.headBlockInfo()) {
+// synchroniseTo syncs up our local block chain with a remote peer up to the given
+// head announced by it, instead of the latest head of the peer. If trusted is set,
+// the seals of the synchronised headers are not verified.
+func (pm *ProtocolManager) synchroniseTo(peer *peer, head blockInfo, trusted bool) {
+	// Make sure the head's TD is higher than our own.
+	if !pm.needToSync(head) {
+		return
+	}
+	// Only run one sync at a time, so the trust of a running sync is not overwritten
+	if !atomic.CompareAndSwapInt32(&pm.syncing, 0, 1) {
 		return
 	}
+	defer atomic.StoreInt32(&pm.syncing, 0)
+
+	if pm.ulcChain != nil {
+		pm.ulcChain.setTrusted(trusted)
+		defer pm.ulcChain.setTrusted(false)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	pm.blockchain.(*light.LightChain).SyncCht(ctx)
-	pm.downloader.Synchronise(peer.id, peer.Head(), peer.Td(), downloader.LightSync)
+	pm.downloader.Synchronise(peer.id, head.Hash, head.Td, downloader.LightSync)
 }
@@ -0,0 +1,131 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/wat"
+)
+
+var (
+	errNoTrustedServers     = errors.New("no trusted servers configured")
+	errInvalidTrustFraction = errors.New("trusted fraction must be between 1 and 100")
+)
+
+// ulc holds the state of the ultra light client mode, in which the client only
+// follows the chain heads announced and signed by a quorum of trusted servers,
+// skipping the proof-of-work verification of the headers. If the trusted servers
+// disagree on the chain head, the client falls back to the normal light client
+// rules until they agree again.
+type ulc struct {
+	servers  []*discover.Node         // Trusted servers to keep connected to
+	keys     map[discover.NodeID]bool // Node IDs of the trusted servers
+	fraction int                      // Minimum percentage of trusted servers announcing a head to follow it
+	fallback int32                    // Flag whwater the trusted servers disagree (atomic)
+}
+
+// newULC creates the ultra light client state from the user configuration.
+func newULC(config *wat.ULCConfig) (*ulc, error) {
+	if len(config.TrustedServers) == 0 {
+		return nil, errNoTrustedServers
+	}
+	if config.MinTrustedFraction <= 0 || config.MinTrustedFraction > 100 {
+		return nil, errInvalidTrustFraction
+	}
+	u := &ulc{
+		keys:     make(map[discover.NodeID]bool),
+		fraction: config.MinTrustedFraction,
+	}
+	for _, url := range config.TrustedServers {
+		node, err := discover.ParseNode(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted server %q: %v", url, err)
+		}
+		if !u.keys[node.ID] {
+			u.servers = append(u.servers, node)
+			u.keys[node.ID] = true
+		}
+	}
+	return u, nil
+}
+
+// isTrusted returns whwater the given node is one of the trusted servers.
+func (u *ulc) isTrusted(id discover.NodeID) bool {
+	return u.keys[id]
+}
+
+// quorum returns whwater the given number of trusted servers is enough to
+// follow a chain head they announced.
+func (u *ulc) quorum(count int) bool {
+	return count*100 >= u.fraction*len(u.keys)
+}
+
+// isFallback returns whwater the client currently follows the normal light
+// client rules due to a disagreement of the trusted servers.
+func (u *ulc) isFallback() bool {
+	return atomic.LoadInt32(&u.fallback) == 1
+}
+
+// setFallback switches between the ultra light and the normal light client rules.
+func (u *ulc) setFallback(fallback bool) {
+	if fallback {
+		if atomic.CompareAndSwapInt32(&u.fallback, 0, 1) {
+			log.Warn("Trusted servers disagree, falling back to light client mode")
+		}
+		return
+	}
+	if atomic.CompareAndSwapInt32(&u.fallback, 1, 0) {
+		log.Info("Trusted servers agree again, resuming ultra light client mode")
+	}
+}
+
+// active returns whwater the ultra light client rules should be applied.
+func (u *ulc) active() bool {
+	return u != nil && !u.isFallback()
+}
+
+// ulcChain wraps the light chain passed to the downloader, skipping the seal
+// verification of the synchronised headers if the running sync was started
+// with a trusted server while the ultra light client mode was active.
+type ulcChain struct {
+	BlockChain
+	trusted int32 // Whwater the headers of the running sync skip seal verification
+}
+
+// setTrusted sets whwater the headers of the next sync skip seal verification.
+func (c *ulcChain) setTrusted(trusted bool) {
+	if trusted {
+		atomic.StoreInt32(&c.trusted, 1)
+	} else {
+		atomic.StoreInt32(&c.trusted, 0)
+	}
+}
+
+// InsertHeaderChain implements downloader.LightChain, inserting the headers
+// without verifying their seals if the sync follows a trusted server.
+func (c *ulcChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
+	if atomic.LoadInt32(&c.trusted) == 1 {
+		checkFreq = 0
+	}
+	return c.BlockChain.InsertHeaderChain(chain, checkFreq)
+}
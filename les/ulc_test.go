@@ -0,0 +1,284 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/consensus/ethash"
+	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/les/flowcontrol"
+	"github.com/watchain/go-watchain/light"
+	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/wat"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// ulcTestURL returns the enode URL of a trusted test server.
+func ulcTestURL(id discover.NodeID) string {
+	return fmt.Sprintf("enode://%x@127.0.0.1:30303", id[:])
+}
+
+// Tests that the ultra light client configuration is validated and parsed.
+func TestULCConfig(t *testing.T) {
+	if _, err := newULC(&wat.ULCConfig{MinTrustedFraction: 50}); err != errNoTrustedServers {
+		t.Errorf("no servers: error mismatch: have %v, want %v", err, errNoTrustedServers)
+	}
+	for _, fraction := range []int{0, -1, 101} {
+		config := &wat.ULCConfig{TrustedServers: []string{ulcTestURL(discover.NodeID{1})}, MinTrustedFraction: fraction}
+		if _, err := newULC(config); err != errInvalidTrustFraction {
+			t.Errorf("fraction %d: error mismatch: have %v, want %v", fraction, err, errInvalidTrustFraction)
+		}
+	}
+	if _, err := newULC(&wat.ULCConfig{TrustedServers: []string{"enode://invalid"}, MinTrustedFraction: 50}); err == nil {
+		t.Errorf("invalid server accepted")
+	}
+	config := &wat.ULCConfig{
+		TrustedServers:     []string{ulcTestURL(discover.NodeID{1}), ulcTestURL(discover.NodeID{2}), ulcTestURL(discover.NodeID{1})},
+		MinTrustedFraction: 50,
+	}
+	u, err := newULC(config)
+	if err != nil {
+		t.Fatalf("failed to create ultra light client: %v", err)
+	}
+	if len(u.servers) != 2 {
+		t.Errorf("trusted server count mismatch: have %d, want 2", len(u.servers))
+	}
+	if !u.isTrusted(discover.NodeID{1}) || !u.isTrusted(discover.NodeID{2}) || u.isTrusted(discover.NodeID{3}) {
+		t.Errorf("trusted server set mismatch")
+	}
+	if u.quorum(0) || !u.quorum(1) || !u.quorum(2) {
+		t.Errorf("quorum mismatch")
+	}
+}
+
+// Tests that the ultra light client falls back to the normal light client rules
+// if the trusted servers disagree, and resumes once a quorum agrees again.
+func TestULCFallback(t *testing.T) {
+	var urls []string
+	for i := byte(1); i <= 4; i++ {
+		urls = append(urls, ulcTestURL(discover.NodeID{i}))
+	}
+	u, err := newULC(&wat.ULCConfig{TrustedServers: urls, MinTrustedFraction: 75})
+	if err != nil {
+		t.Fatalf("failed to create ultra light client: %v", err)
+	}
+	f := &lightFetcher{
+		pm:    &ProtocolManager{ulc: u},
+		peers: make(map[*peer]*fetcherPeerInfo),
+	}
+	var peers []*peer
+	for i := byte(1); i <= 4; i++ {
+		p := &peer{Peer: p2p.NewPeer(discover.NodeID{i}, "", nil), isTrusted: true}
+		f.peers[p] = &fetcherPeerInfo{nodeByHash: make(map[common.Hash]*fetcherTreeNode)}
+		peers = append(peers, p)
+	}
+	announce := func(p *peer, number uint64, hash common.Hash) {
+		n := &fetcherTreeNode{hash: hash, number: number}
+		f.peers[p].lastAnnounced = n
+		f.peers[p].nodeByHash[hash] = n
+		f.checkTrustedHeads()
+	}
+	// Three out of four servers agree, the quorum head is followed
+	for _, p := range peers[:3] {
+		announce(p, 10, common.Hash{10})
+	}
+	announce(peers[3], 10, common.Hash{0xff})
+	if !u.active() {
+		t.Fatalf("ultra light client mode inactive with quorum")
+	}
+	// Servers split on the next head, fall back to light client rules
+	announce(peers[0], 11, common.Hash{11})
+	announce(peers[1], 11, common.Hash{11})
+	announce(peers[2], 11, common.Hash{0xfe})
+	if u.active() {
+		t.Fatalf("ultra light client mode active on disagreement")
+	}
+	if f.trustedAnnounced(common.Hash{11}) != 2 {
+		t.Fatalf("trusted announcement count mismatch: have %d, want 2", f.trustedAnnounced(common.Hash{11}))
+	}
+	// A quorum agrees again, resume the ultra light client mode
+	announce(peers[3], 11, common.Hash{11})
+	if !u.active() {
+		t.Fatalf("ultra light client mode inactive after agreement")
+	}
+}
+
+// Tests that ultra light clients only sync up to the heads announced by a quorum
+// of the trusted servers, and not to a newer head announced by a single one.
+func TestULCSyncQuorumHead(t *testing.T) {
+	var urls []string
+	for i := byte(1); i <= 4; i++ {
+		urls = append(urls, ulcTestURL(discover.NodeID{i}))
+	}
+	u, err := newULC(&wat.ULCConfig{TrustedServers: urls, MinTrustedFraction: 75})
+	if err != nil {
+		t.Fatalf("failed to create ultra light client: %v", err)
+	}
+	peers := newPeerSet()
+	rm := newRetrieveManager(peers, newRequestDistributor(peers, make(chan struct{})), nil)
+	db, _ := watdb.NewMemDatabase()
+	odr := NewLesOdr(db, light.NewChtIndexer(db, true), light.NewBloomTrieIndexer(db, true), wat.NewBloomIndexer(db, light.BloomTrieFrequency), rm)
+	lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr, db)
+
+	synced := make(chan blockInfo, 1)
+	syncTo := func(p *peer, head blockInfo, trusted bool) {
+		if !trusted {
+			t.Errorf("sync with trusted server not trusted")
+		}
+		synced <- head
+	}
+	f := &lightFetcher{
+		pm:             &ProtocolManager{ulc: u},
+		chain:          lpm.blockchain.(*light.LightChain),
+		peers:          make(map[*peer]*fetcherPeerInfo),
+		syncDone:       make(chan *peer, 1),
+		syncTo:         syncTo,
+		maxConfirmedTd: big.NewInt(0),
+	}
+	var servers []*peer
+	for i := byte(1); i <= 4; i++ {
+		p := &peer{Peer: p2p.NewPeer(discover.NodeID{i}, "", nil), isTrusted: true, headInfo: &announceData{}}
+		f.peers[p] = &fetcherPeerInfo{nodeByHash: make(map[common.Hash]*fetcherTreeNode)}
+		servers = append(servers, p)
+	}
+	announce := func(p *peer, number uint64, hash common.Hash) {
+		n := &fetcherTreeNode{hash: hash, number: number, td: new(big.Int).SetUint64(number)}
+		f.peers[p].lastAnnounced = n
+		f.peers[p].nodeByHash[hash] = n
+
+		p.headInfo = &announceData{Hash: hash, Number: number, Td: n.td}
+		f.checkTrustedHeads()
+	}
+	// A single trusted server announcing a head is not enough to sync
+	announce(servers[0], 10, common.Hash{10})
+	if rq, _ := f.nextRequest(); rq != nil {
+		t.Fatalf("sync requested without quorum")
+	}
+	// Sync once a quorum follows the head, even if the synced server moved on
+	for _, p := range servers[1:3] {
+		announce(p, 10, common.Hash{10})
+	}
+	announce(servers[0], 11, common.Hash{11})
+
+	rq, _ := f.nextRequest()
+	if rq == nil {
+		t.Fatalf("no sync requested with quorum")
+	}
+	if !rq.canSend(servers[0]) || rq.canSend(&peer{Peer: p2p.NewPeer(discover.NodeID{5}, "", nil)}) {
+		t.Fatalf("sync peer selection mismatch")
+	}
+	rq.request(servers[0])
+	select {
+	case head := <-synced:
+		if head.Hash != (common.Hash{10}) || head.Number != 10 {
+			t.Fatalf("synced head mismatch: have #%d [%x], want #10 [%x]", head.Number, head.Hash, common.Hash{10})
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("sync not started")
+	}
+}
+
+// Tests that the seal verification of fetched headers is decided when they are
+// requested, so a response of an untrusted server requested in fallback mode is
+// still verified if the ultra light client mode resumes while it is pending.
+func TestULCModeSwitchPendingResponse(t *testing.T) {
+	u, err := newULC(&wat.ULCConfig{TrustedServers: []string{ulcTestURL(discover.NodeID{1})}, MinTrustedFraction: 50})
+	if err != nil {
+		t.Fatalf("failed to create ultra light client: %v", err)
+	}
+	u.setFallback(true)
+
+	// Create a light chain failing the seal verification of block #1
+	peers := newPeerSet()
+	rm := newRetrieveManager(peers, newRequestDistributor(peers, make(chan struct{})), nil)
+	db, _ := watdb.NewMemDatabase()
+	gspec := core.Genesis{Config: params.TestChainConfig}
+	genesis := gspec.MustCommit(db)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 1, nil)
+	header := blocks[0].Header()
+
+	odr := NewLesOdr(db, light.NewChtIndexer(db, true), light.NewBloomTrieIndexer(db, true), wat.NewBloomIndexer(db, light.BloomTrieFrequency), rm)
+	chain, err := light.NewLightChain(odr, gspec.Config, ethash.NewFakeFailer(1))
+	if err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	f := &lightFetcher{
+		pm:             &ProtocolManager{ulc: u},
+		chain:          chain,
+		peers:          make(map[*peer]*fetcherPeerInfo),
+		requested:      make(map[uint64]fetchRequest),
+		timeoutChn:     make(chan uint64, 1),
+		maxConfirmedTd: genesis.Difficulty(),
+	}
+	// Announce block #1 from an untrusted server and request it in fallback mode
+	fcParams := &flowcontrol.ServerParams{BufLimit: testBufLimit, MinRecharge: 1}
+	p := &peer{
+		Peer:           p2p.NewPeer(discover.NodeID{2}, "", nil),
+		fcServer:       flowcontrol.NewServerNode(fcParams),
+		fcServerParams: fcParams,
+		fcCosts:        requestCostTable{GetBlockHeadersMsg: &requestCosts{}},
+	}
+	root := &fetcherTreeNode{hash: genesis.Hash(), td: genesis.Difficulty(), known: true}
+	head := &fetcherTreeNode{hash: header.Hash(), number: 1, td: new(big.Int).Add(genesis.Difficulty(), header.Difficulty), parent: root}
+	root.children = []*fetcherTreeNode{head}
+	f.peers[p] = &fetcherPeerInfo{
+		root:          root,
+		lastAnnounced: head,
+		bestConfirmed: root,
+		confirmedTd:   root.td,
+		nodeByHash:    map[common.Hash]*fetcherTreeNode{root.hash: root, head.hash: head},
+	}
+	rq, reqID := f.nextRequest()
+	if rq == nil {
+		t.Fatalf("no header request in fallback mode")
+	}
+	rq.request(p)
+
+	// Resume the ultra light client mode before the response arrives
+	u.setFallback(false)
+
+	f.reqMu.RLock()
+	req := f.requested[reqID]
+	f.reqMu.RUnlock()
+	if req.trusted {
+		t.Fatalf("request to untrusted server marked trusted")
+	}
+	resp := fetchResponse{reqID: reqID, headers: []*types.Header{header}, peer: p}
+	if f.processResponse(req, resp) {
+		t.Fatalf("header with invalid seal accepted from untrusted server")
+	}
+	if chain.GetHeaderByHash(header.Hash()) != nil {
+		t.Fatalf("header with invalid seal inserted")
+	}
+	// The same header requested from a trusted server skips the seal verification
+	f.peers = make(map[*peer]*fetcherPeerInfo)
+	req.trusted = true
+	if !f.processResponse(req, resp) {
+		t.Fatalf("header from trusted server rejected")
+	}
+	if chain.GetHeaderByHash(header.Hash()) == nil {
+		t.Fatalf("header from trusted server not inserted")
+	}
+}
@@ -128,6 +128,22 @@ func (req *ReceiptsRequest) StoreResult(db watdb.Database) {
 	core.WriteBlockReceipts(db, req.Hash, req.Number, req.Receipts)
 }
 
+// ReceiptsBatchRequest is the ODR request type for retrieving the receipts of
+// multiple blocks in a single network round trip
+type ReceiptsBatchRequest struct {
+	OdrRequest
+	Hashes   []common.Hash
+	Numbers  []uint64
+	Receipts []types.Receipts
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *ReceiptsBatchRequest) StoreResult(db watdb.Database) {
+	for i, hash := range req.Hashes {
+		core.WriteBlockReceipts(db, hash, req.Numbers[i], req.Receipts[i])
+	}
+}
+
 // ChtRequest is the ODR request type for state/storage trie entries
 type ChtRequest struct {
 	OdrRequest
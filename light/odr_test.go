@@ -73,6 +73,11 @@ func (odr *testOdr) Retrieve(ctx context.Context, req OdrRequest) error {
 		req.Rlp = core.GetBodyRLP(odr.sdb, req.Hash, core.GetBlockNumber(odr.sdb, req.Hash))
 	case *ReceiptsRequest:
 		req.Receipts = core.GetBlockReceipts(odr.sdb, req.Hash, core.GetBlockNumber(odr.sdb, req.Hash))
+	case *ReceiptsBatchRequest:
+		req.Receipts = make([]types.Receipts, len(req.Hashes))
+		for i, hash := range req.Hashes {
+			req.Receipts[i] = core.GetBlockReceipts(odr.sdb, hash, req.Numbers[i])
+		}
 	case *TrieRequest:
 		t, _ := trie.New(req.Id.Root, trie.NewDatabase(odr.sdb))
 		nodes := NewNodeSet()
@@ -170,6 +170,43 @@ func GetBlockLogs(ctx context.Context, odr OdrBackend, hash common.Hash, number
 	return logs, nil
 }
 
+// GetBlockLogsBatch retrieves the logs generated by the transactions included in
+// a batch of blocks given by their hashes and numbers. The receipts not available
+// locally are retrieved from the network in a single request, so the caller is
+// responsible for keeping the batch within the limits of the serving peers.
+func GetBlockLogsBatch(ctx context.Context, odr OdrBackend, hashes []common.Hash, numbers []uint64) ([][][]*types.Log, error) {
+	// Retrieve the potentially incomplete receipts from disk, gathering the missing ones
+	receipts := make([]types.Receipts, len(hashes))
+	req := new(ReceiptsBatchRequest)
+	var missing []int
+
+	for i, hash := range hashes {
+		if receipts[i] = core.GetBlockReceipts(odr.Database(), hash, numbers[i]); receipts[i] == nil {
+			req.Hashes = append(req.Hashes, hash)
+			req.Numbers = append(req.Numbers, numbers[i])
+			missing = append(missing, i)
+		}
+	}
+	// Retrieve all the missing receipts from the network at once
+	if len(missing) > 0 {
+		if err := odr.Retrieve(ctx, req); err != nil {
+			return nil, err
+		}
+		for i, idx := range missing {
+			receipts[idx] = req.Receipts[i]
+		}
+	}
+	// Return the logs without deriving any computed fields on the receipts
+	logs := make([][][]*types.Log, len(receipts))
+	for i, blockReceipts := range receipts {
+		logs[i] = make([][]*types.Log, len(blockReceipts))
+		for j, receipt := range blockReceipts {
+			logs[i][j] = receipt.Logs
+		}
+	}
+	return logs, nil
+}
+
 // GetBloomBits retrieves a batch of compressed bloomBits vectors belonging to the given bit index and section indexes
 func GetBloomBits(ctx context.Context, odr OdrBackend, bitIdx uint, sectionIdxList []uint64) ([][]byte, error) {
 	db := odr.Database()
@@ -177,6 +177,14 @@ func (self *Miner) PendingBlock() *types.Block {
 	return self.worker.pendingBlock()
 }
 
+// BuildReport returns the trace of the last block template assembled by the
+// worker: which transactions were included, which were skipped and why, and
+// how long the assembly took. Transactions applied to the pending block after
+// the assembly are appended to the trace.
+func (self *Miner) BuildReport() *BuildReport {
+	return self.worker.buildReport()
+}
+
 func (self *Miner) Setwaterbase(addr common.Address) {
 	self.coinbase = addr
 	self.worker.setwaterbase(addr)
@@ -0,0 +1,133 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/metrics"
+)
+
+// Reasons a transaction may be left out of a block under construction.
+const (
+	SkipGasLimit    = "gas limit reached"
+	SkipNonceTooLow = "nonce too low"
+	SkipNonceHigh   = "nonce too high"
+	SkipUnprotected = "replay protected before eip155"
+	SkipExecution   = "execution failed"
+)
+
+var (
+	commitTimer          = metrics.NewRegisteredTimer("miner/commit", nil)
+	includedTxMeter      = metrics.NewRegisteredMeter("miner/txs/included", nil)
+	skipGasLimitMeter    = metrics.NewRegisteredMeter("miner/txs/skip/gaslimit", nil)
+	skipNonceLowMeter    = metrics.NewRegisteredMeter("miner/txs/skip/noncelow", nil)
+	skipNonceHighMeter   = metrics.NewRegisteredMeter("miner/txs/skip/noncehigh", nil)
+	skipUnprotectedMeter = metrics.NewRegisteredMeter("miner/txs/skip/unprotected", nil)
+	skipExecutionMeter   = metrics.NewRegisteredMeter("miner/txs/skip/failed", nil)
+	blockGasUsedGauge    = metrics.NewRegisteredGauge("miner/block/gasused", nil)
+	blockTxsGauge        = metrics.NewRegisteredGauge("miner/block/txs", nil)
+)
+
+// TxTrace records the outcome of a single transaction the worker tried to
+// include into a block.
+type TxTrace struct {
+	Hash   common.Hash    `json:"hash"`
+	From   common.Address `json:"from"`
+	Nonce  uint64         `json:"nonce"`
+	Reason string         `json:"reason,omitempty"` // Empty if the transaction was included
+	Error  string         `json:"error,omitempty"`  // Execution error for SkipExecution
+}
+
+// BuildReport describes how the most recent block template was assembled,
+// containing every transaction attempted and why the skipped ones were left
+// out.
+type BuildReport struct {
+	Number     uint64        `json:"number"`
+	ParentHash common.Hash   `json:"parentHash"`
+	GasLimit   uint64        `json:"gasLimit"`
+	GasUsed    uint64        `json:"gasUsed"`
+	Uncles     int           `json:"uncles"`
+	Created    time.Time     `json:"created"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Included   []TxTrace     `json:"included"`
+	Skipped    []TxTrace     `json:"skipped"`
+}
+
+// newBuildReport creates an empty report for the block being built on top of
+// the given header.
+func newBuildReport(header *types.Header) *BuildReport {
+	return &BuildReport{
+		Number:     header.Number.Uint64(),
+		ParentHash: header.ParentHash,
+		GasLimit:   header.GasLimit,
+		Created:    time.Now(),
+		Included:   []TxTrace{},
+		Skipped:    []TxTrace{},
+	}
+}
+
+// include records a transaction that was successfully added to the block.
+func (r *BuildReport) include(tx *types.Transaction, from common.Address) {
+	r.Included = append(r.Included, TxTrace{Hash: tx.Hash(), From: from, Nonce: tx.Nonce()})
+	includedTxMeter.Mark(1)
+}
+
+// skip records a transaction that was left out of the block, along with the
+// reason and the execution error if any.
+func (r *BuildReport) skip(tx *types.Transaction, from common.Address, reason string, err error) {
+	trace := TxTrace{Hash: tx.Hash(), From: from, Nonce: tx.Nonce(), Reason: reason}
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	r.Skipped = append(r.Skipped, trace)
+
+	switch reason {
+	case SkipGasLimit:
+		skipGasLimitMeter.Mark(1)
+	case SkipNonceTooLow:
+		skipNonceLowMeter.Mark(1)
+	case SkipNonceHigh:
+		skipNonceHighMeter.Mark(1)
+	case SkipUnprotected:
+		skipUnprotectedMeter.Mark(1)
+	default:
+		skipExecutionMeter.Mark(1)
+	}
+}
+
+// finalize stamps the report with the final block statistics and updates the
+// block production metrics.
+func (r *BuildReport) finalize(header *types.Header, uncles int) {
+	r.GasUsed = header.GasUsed
+	r.Uncles = uncles
+	r.Elapsed = time.Since(r.Created)
+
+	commitTimer.Update(r.Elapsed)
+	blockGasUsedGauge.Update(int64(r.GasUsed))
+	blockTxsGauge.Update(int64(len(r.Included)))
+}
+
+// copy creates a deep copy of the report, safe to hand out to callers.
+func (r *BuildReport) copy() *BuildReport {
+	cpy := *r
+	cpy.Included = append([]TxTrace{}, r.Included...)
+	cpy.Skipped = append([]TxTrace{}, r.Skipped...)
+	return &cpy
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/params"
+)
+
+// Tests that the build report tracks included and skipped transactions along
+// with the skip reasons, and that handed out copies are detached.
+func TestBuildReportTracking(t *testing.T) {
+	header := &types.Header{Number: big.NewInt(10), GasLimit: 1000000}
+	report := newBuildReport(header)
+
+	from := common.Address{0x01}
+	txs := make([]*types.Transaction, 4)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	}
+	report.include(txs[0], from)
+	report.skip(txs[1], from, SkipNonceTooLow, nil)
+	report.skip(txs[2], from, SkipExecution, errors.New("out of gas"))
+	report.include(txs[3], from)
+
+	header.GasUsed = 42000
+	report.finalize(header, 1)
+
+	if len(report.Included) != 2 {
+		t.Fatalf("included count mismatch: have %d, want %d", len(report.Included), 2)
+	}
+	if len(report.Skipped) != 2 {
+		t.Fatalf("skipped count mismatch: have %d, want %d", len(report.Skipped), 2)
+	}
+	if report.Skipped[0].Reason != SkipNonceTooLow || report.Skipped[0].Error != "" {
+		t.Errorf("skip 0 mismatch: have %q/%q, want %q/%q", report.Skipped[0].Reason, report.Skipped[0].Error, SkipNonceTooLow, "")
+	}
+	if report.Skipped[1].Reason != SkipExecution || report.Skipped[1].Error != "out of gas" {
+		t.Errorf("skip 1 mismatch: have %q/%q, want %q/%q", report.Skipped[1].Reason, report.Skipped[1].Error, SkipExecution, "out of gas")
+	}
+	if report.GasUsed != 42000 || report.Uncles != 1 || report.Number != 10 {
+		t.Errorf("stats mismatch: have gas %d, uncles %d, number %d", report.GasUsed, report.Uncles, report.Number)
+	}
+	// Ensure modifying a copy leaves the original intact
+	cpy := report.copy()
+	cpy.Included[0].Nonce = 100
+	cpy.Skipped = cpy.Skipped[:0]
+
+	if report.Included[0].Nonce != 0 || len(report.Skipped) != 2 {
+		t.Errorf("copy not detached from original report")
+	}
+}
+
+// Tests that running out of block gas is traced for the transaction that was
+// next in line.
+func TestBuildReportGasExhausted(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	signer := types.HomesteadSigner{}
+
+	tx, err := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(0), params.TxGas, big.NewInt(1), nil), signer, key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(1), GasLimit: params.TxGas - 1}
+	work := &Work{config: params.TestChainConfig, signer: signer, header: header, report: newBuildReport(header)}
+
+	txs := types.NewTransactionsByPriceAndNonce(signer, map[common.Address]types.Transactions{from: {tx}})
+	work.commitTransactions(nil, txs, nil, common.Address{})
+
+	if len(work.report.Included) != 0 {
+		t.Errorf("included count mismatch: have %d, want 0", len(work.report.Included))
+	}
+	if len(work.report.Skipped) != 1 {
+		t.Fatalf("skipped count mismatch: have %d, want 1", len(work.report.Skipped))
+	}
+	if skip := work.report.Skipped[0]; skip.Hash != tx.Hash() || skip.From != from || skip.Reason != SkipGasLimit {
+		t.Errorf("skip mismatch: have %x/%x/%q, want %x/%x/%q", skip.Hash, skip.From, skip.Reason, tx.Hash(), from, SkipGasLimit)
+	}
+}
@@ -77,6 +77,7 @@ type Work struct {
 	header   *types.Header
 	txs      []*types.Transaction
 	receipts []*types.Receipt
+	report   *BuildReport // trace of the transactions tried while building
 
 	createdAt time.Time
 }
@@ -117,6 +118,9 @@ type worker struct {
 	currentMu sync.Mutex
 	current   *Work
 
+	reportMu sync.RWMutex
+	report   *BuildReport // report of the current block template, including pending updates
+
 	uncleMu        sync.Mutex
 	possibleUncles map[common.Hash]*types.Block
 
@@ -268,6 +272,7 @@ func (self *worker) update() {
 				txset := types.NewTransactionsByPriceAndNonce(self.current.signer, txs)
 
 				self.current.commitTransactions(self.mux, txset, self.chain, self.coinbase)
+				self.publishReport(self.current)
 				self.currentMu.Unlock()
 			} else {
 				// If we're mining, but nothing is being processed, wake on new transactions
@@ -368,6 +373,7 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 		family:    set.New(),
 		uncles:    set.New(),
 		header:    header,
+		report:    newBuildReport(header),
 		createdAt: time.Now(),
 	}
 
@@ -483,6 +489,9 @@ func (self *worker) commitNewWork() {
 		log.Error("Failed to finalize block for sealing", "err", err)
 		return
 	}
+	work.report.finalize(work.Block.Header(), len(uncles))
+	self.publishReport(work)
+
 	// We only care about logging if we're actually mining.
 	if atomic.LoadInt32(&self.mining) == 1 {
 		log.Info("Commit new mining work", "number", work.Block.Number(), "txs", work.tcount, "uncles", len(uncles), "elapsed", common.PrettyDuration(time.Since(watart)))
@@ -491,6 +500,30 @@ func (self *worker) commitNewWork() {
 	self.push(work)
 }
 
+// publishReport makes the trace of the given work visible to buildReport. It is
+// called once the block template is finalized and again whenever transactions
+// are applied to the pending block afterwards.
+func (self *worker) publishReport(work *Work) {
+	work.report.GasUsed = work.header.GasUsed
+
+	self.reportMu.Lock()
+	self.report = work.report.copy()
+	self.reportMu.Unlock()
+}
+
+// buildReport returns a copy of the trace recorded while assembling the last
+// block template and updating it with new pending transactions, or nil if no
+// block has been built yet.
+func (self *worker) buildReport() *BuildReport {
+	self.reportMu.RLock()
+	defer self.reportMu.RUnlock()
+
+	if self.report == nil {
+		return nil
+	}
+	return self.report.copy()
+}
+
 func (self *worker) commitUncle(work *Work, uncle *types.Header) error {
 	hash := uncle.Hash()
 	if work.uncles.Has(hash) {
@@ -515,6 +548,10 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 		// If we don't have enough gas for any further transactions then we're done
 		if gp.Gas() < params.TxGas {
 			log.Trace("Not enough gas for further transactions", "gp", gp)
+			if tx := txs.Peek(); tx != nil {
+				from, _ := types.Sender(env.signer, tx)
+				env.report.skip(tx, from, SkipGasLimit, nil)
+			}
 			break
 		}
 		// Retrieve the next transaction and abort if all done
@@ -531,6 +568,7 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 		// phase, start ignoring the sender until we do.
 		if tx.Protected() && !env.config.IsEIP155(env.header.Number) {
 			log.Trace("Ignoring reply protected transaction", "hash", tx.Hash(), "eip155", env.config.EIP155Block)
+			env.report.skip(tx, from, SkipUnprotected, nil)
 
 			txs.Pop()
 			continue
@@ -543,21 +581,25 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 		case core.ErrGasLimitReached:
 			// Pop the current out-of-gas transaction without shifting in the next from the account
 			log.Trace("Gas limit exceeded for current block", "sender", from)
+			env.report.skip(tx, from, SkipGasLimit, err)
 			txs.Pop()
 
 		case core.ErrNonceTooLow:
 			// New head notification data race between the transaction pool and miner, shift
 			log.Trace("Skipping transaction with low nonce", "sender", from, "nonce", tx.Nonce())
+			env.report.skip(tx, from, SkipNonceTooLow, err)
 			txs.Shift()
 
 		case core.ErrNonceTooHigh:
 			// Reorg notification data race between the transaction pool and miner, skip account =
 			log.Trace("Skipping account with hight nonce", "sender", from, "nonce", tx.Nonce())
+			env.report.skip(tx, from, SkipNonceHigh, err)
 			txs.Pop()
 
 		case nil:
 			// Everything ok, collect the logs and shift in the next transaction from the same account
 			coalescedLogs = append(coalescedLogs, logs...)
+			env.report.include(tx, from)
 			env.tcount++
 			txs.Shift()
 
@@ -565,6 +607,7 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 			// Strange error, discard the transaction and get the next in line (note, the
 			// nonce-too-high clause will prevent us from executing in vain).
 			log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
+			env.report.skip(tx, from, SkipExecution, err)
 			txs.Shift()
 		}
 	}
@@ -82,6 +82,8 @@ func (p *SyncProgress) GetCurrentBlock() int64  { return int64(p.progress.Curren
 func (p *SyncProgress) GetHighestBlock() int64  { return int64(p.progress.HighestBlock) }
 func (p *SyncProgress) GetPulledStates() int64  { return int64(p.progress.PulledStates) }
 func (p *SyncProgress) GetKnownStates() int64   { return int64(p.progress.KnownStates) }
+func (p *SyncProgress) GetPivotBlock() int64    { return int64(p.progress.PivotBlock) }
+func (p *SyncProgress) GetHeaderBlock() int64   { return int64(p.progress.HeaderBlock) }
 
 // Topics is a set of topic lists to filter events with.
 type Topics struct{ topics [][]common.Hash }
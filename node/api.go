@@ -43,7 +43,8 @@ func NewPrivateAdminAPI(node *Node) *PrivateAdminAPI {
 }
 
 // AddPeer requests connecting to a remote node, and also maintaining the new
-// connection at all times, even reconnecting if it is lost.
+// connection at all times, even reconnecting if it is lost. The node is added
+// to the static node list of the data directory.
 func (api *PrivateAdminAPI) AddPeer(url string) (bool, error) {
 	// Make sure the server is running, fail otherwise
 	server := api.node.Server()
@@ -56,10 +57,14 @@ func (api *PrivateAdminAPI) AddPeer(url string) (bool, error) {
 		return false, fmt.Errorf("invalid enode: %v", err)
 	}
 	server.AddPeer(node)
+	if err := api.node.updatePersistentNodes(datadirStaticNodes, node, true); err != nil {
+		return true, fmt.Errorf("can't update static node list: %v", err)
+	}
 	return true, nil
 }
 
-// RemovePeer disconnects from a a remote node if the connection exists
+// RemovePeer disconnects from a a remote node if the connection exists and
+// removes it from the static node list of the data directory.
 func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
 	// Make sure the server is running, fail otherwise
 	server := api.node.Server()
@@ -72,6 +77,75 @@ func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
 		return false, fmt.Errorf("invalid enode: %v", err)
 	}
 	server.RemovePeer(node)
+	if err := api.node.updatePersistentNodes(datadirStaticNodes, node, false); err != nil {
+		return true, fmt.Errorf("can't update static node list: %v", err)
+	}
+	return true, nil
+}
+
+// AddTrustedPeer allows a remote node to always connect, even if slots are full.
+// The node is added to the trusted node list of the data directory.
+func (api *PrivateAdminAPI) AddTrustedPeer(url string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	server.AddTrustedPeer(node)
+	if err := api.node.updatePersistentNodes(datadirTrustedNodes, node, true); err != nil {
+		return true, fmt.Errorf("can't update trusted node list: %v", err)
+	}
+	return true, nil
+}
+
+// RemoveTrustedPeer removes a remote node from the trusted peer set, but it
+// does not disconnect it automatically. The node is removed from the trusted
+// node list of the data directory.
+func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	server.RemoveTrustedPeer(node)
+	if err := api.node.updatePersistentNodes(datadirTrustedNodes, node, false); err != nil {
+		return true, fmt.Errorf("can't update trusted node list: %v", err)
+	}
+	return true, nil
+}
+
+// SetMaxPeers changes the maximum number of connected peers.
+func (api *PrivateAdminAPI) SetMaxPeers(max int) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if max <= 0 {
+		return false, fmt.Errorf("invalid peer limit %d", max)
+	}
+	server.SetMaxPeers(max)
+	return true, nil
+}
+
+// SetProtocolMaxPeers changes the maximum number of peers running the given
+// sub-protocol. A limit of zero removes the restriction.
+func (api *PrivateAdminAPI) SetProtocolMaxPeers(proto string, max int) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if max < 0 {
+		return false, fmt.Errorf("invalid peer limit %d", max)
+	}
+	server.SetProtocolMaxPeers(proto, max)
 	return true, nil
 }
 
@@ -261,6 +335,16 @@ func (api *PublicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
 	return server.NodeInfo(), nil
 }
 
+// Traffic retrieves the network traffic of the node, broken down by protocol,
+// message code and peer.
+func (api *PublicAdminAPI) Traffic() (*p2p.TrafficInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.TrafficInfo(), nil
+}
+
 // Datadir retrieves the current data directory the node is using.
 func (api *PublicAdminAPI) Datadir() string {
 	return api.node.DataDir()
@@ -18,6 +18,7 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -41,6 +42,7 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirNodeDatabaseV5  = "nodes.v5"           // Path within the datadir to store the discovery v5 node infos
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -182,6 +184,14 @@ func (c *Config) NodeDB() string {
 	return c.resolvePath(datadirNodeDatabase)
 }
 
+// NodeDBV5 returns the path to the discovery v5 node database.
+func (c *Config) NodeDBV5() string {
+	if c.DataDir == "" {
+		return "" // ephemeral
+	}
+	return c.resolvePath(datadirNodeDatabaseV5)
+}
+
 // DefaultIPCEndpoint returns the IPC path used by default.
 func DefaultIPCEndpoint(clientIdentifier string) string {
 	if clientIdentifier == "" {
@@ -372,6 +382,43 @@ func (c *Config) parsePersistentNodes(path string) []*discover.Node {
 	return nodes
 }
 
+// updatePersistentNodes adds the node to or removes it from a node list file
+// within the data directory. Entries of other nodes are preserved as they are.
+func (c *Config) updatePersistentNodes(file string, node *discover.Node, add bool) error {
+	if c.DataDir == "" {
+		return nil
+	}
+	path := c.resolvePath(file)
+	var nodelist []string
+	if _, err := os.Stat(path); err == nil {
+		if err := common.LoadJSON(path, &nodelist); err != nil {
+			return err
+		}
+	}
+	// Drop any previous entry of the node, then add the new one.
+	var urls []string
+	for _, url := range nodelist {
+		if n, err := discover.ParseNode(url); err == nil && n.ID == node.ID {
+			continue
+		}
+		urls = append(urls, url)
+	}
+	if add {
+		urls = append(urls, node.String())
+	}
+	if urls == nil {
+		urls = []string{}
+	}
+	blob, err := json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(blob, '\n'), 0644)
+}
+
 // AccountConfig determines the settings for scrypt and keydirectory
 func (c *Config) AccountConfig() (int, int, string, error) {
 	scryptN := keystore.StandardScryptN
@@ -19,6 +19,7 @@ package node
 import (
 	"bytes"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/discover"
 )
 
 // Tests that datadirs can be successfully created, be them manually configured
@@ -148,3 +150,52 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that runtime changes of the static and trusted nodes are persisted to
+// the node list files and loaded on the next start.
+func TestPersistentNodesUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	newNode := func() *discover.Node {
+		key, _ := crypto.GenerateKey()
+		return discover.NewNode(discover.PubkeyID(&key.PublicKey), net.IP{127, 0, 0, 1}, 30303, 30303)
+	}
+	config := &Config{Name: "unit-test", DataDir: dir}
+	n1, n2 := newNode(), newNode()
+
+	if err := config.updatePersistentNodes(datadirStaticNodes, n1, true); err != nil {
+		t.Fatalf("failed to add node: %v", err)
+	}
+	if err := config.updatePersistentNodes(datadirStaticNodes, n2, true); err != nil {
+		t.Fatalf("failed to add node: %v", err)
+	}
+	if nodes := config.StaticNodes(); len(nodes) != 2 || nodes[0].ID != n1.ID || nodes[1].ID != n2.ID {
+		t.Fatalf("wrong static nodes after adding: %v", nodes)
+	}
+	// Adding a node again replaces its entry.
+	if err := config.updatePersistentNodes(datadirStaticNodes, n1, true); err != nil {
+		t.Fatalf("failed to add node: %v", err)
+	}
+	if err := config.updatePersistentNodes(datadirStaticNodes, n2, false); err != nil {
+		t.Fatalf("failed to remove node: %v", err)
+	}
+	if nodes := config.StaticNodes(); len(nodes) != 1 || nodes[0].ID != n1.ID {
+		t.Fatalf("wrong static nodes after removal: %v", nodes)
+	}
+	if nodes := config.TrustedNodes(); len(nodes) != 0 {
+		t.Fatalf("trusted nodes changed: %v", nodes)
+	}
+
+	// Ephemeral nodes don't persist anything.
+	config = &Config{Name: "unit-test", DataDir: ""}
+	if err := config.updatePersistentNodes(datadirTrustedNodes, n1, true); err != nil {
+		t.Fatalf("failed to add node: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(".", "unit-test", datadirTrustedNodes)); err == nil {
+		t.Fatalf("ephemeral node list persisted to disk")
+	}
+}
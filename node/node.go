@@ -32,6 +32,7 @@ import (
 	"github.com/watchain/go-watchain/internal/debug"
 	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/discover"
 	"github.com/watchain/go-watchain/rpc"
 	"github.com/prometheus/prometheus/util/flock"
 )
@@ -70,6 +71,8 @@ type Node struct {
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
 
+	nodesLock sync.Mutex // Serializes updates of the static and trusted node files
+
 	log log.Logger
 }
 
@@ -162,6 +165,9 @@ func (n *Node) Start() error {
 	if n.serverConfig.NodeDatabase == "" {
 		n.serverConfig.NodeDatabase = n.config.NodeDB()
 	}
+	if n.serverConfig.NodeDatabaseV5 == "" {
+		n.serverConfig.NodeDatabaseV5 = n.config.NodeDBV5()
+	}
 	running := &p2p.Server{Config: n.serverConfig}
 	n.log.Info("Starting peer-to-peer node", "instance", n.serverConfig.Name)
 
@@ -583,6 +589,15 @@ func (n *Node) Server() *p2p.Server {
 	return n.server
 }
 
+// updatePersistentNodes records the addition or removal of a static or trusted
+// node in the corresponding file of the data directory.
+func (n *Node) updatePersistentNodes(file string, node *discover.Node, add bool) error {
+	n.nodesLock.Lock()
+	defer n.nodesLock.Unlock()
+
+	return n.config.updatePersistentNodes(file, node, add)
+}
+
 // Service retrieves a currently running service registered of a specific type.
 func (n *Node) Service(service interface{}) error {
 	n.lock.RLock()
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"time"
 
 	"github.com/watchain/go-watchain/log"
@@ -71,17 +72,25 @@ func (t TCPDialer) Dial(dest *discover.Node) (net.Conn, error) {
 type dialstate struct {
 	maxDynDials int
 	ntab        discoverTable
+	dns         nodeReader // DNS node lists (nil = unused)
+	topics      nodeReader // discovery v5 topic searches (nil = unused)
 	netrestrict *netutil.Netlist
 
 	lookupRunning bool
 	dialing       map[discover.NodeID]connFlag
-	lookupBuf     []*discover.Node // current discovery lookup results
-	randomNodes   []*discover.Node // filled from Table
+	dialingIPs    map[discover.NodeID]net.IP // addresses of running dynamic dials
+	lookupBuf     []*discover.Node           // current discovery lookup results
+	randomNodes   []*discover.Node           // filled from Table
+	dnsNodes      []*discover.Node           // filled from DNS node lists
+	topicNodes    []*discover.Node           // filled from topic searches
 	static        map[discover.NodeID]*dialTask
 	hist          *dialHistory
 
 	start     time.Time        // time when the dialer was first used
 	bootnodes []*discover.Node // default dials when there are no peers
+
+	score  func(discover.NodeID) float64 // reputation of dial candidates (nil = unscored)
+	filter func(*discover.Node) bool     // acceptance of dynamic dial candidates (nil = all)
 }
 
 type discoverTable interface {
@@ -92,6 +101,11 @@ type discoverTable interface {
 	ReadRandomNodes([]*discover.Node) int
 }
 
+// nodeReader is a source of random dial candidates.
+type nodeReader interface {
+	ReadRandomNodes([]*discover.Node) int
+}
+
 // the dial history remembers recent dials.
 type dialHistory []pastDial
 
@@ -134,8 +148,11 @@ func newDialState(static []*discover.Node, bootnodes []*discover.Node, ntab disc
 		netrestrict: netrestrict,
 		static:      make(map[discover.NodeID]*dialTask),
 		dialing:     make(map[discover.NodeID]connFlag),
+		dialingIPs:  make(map[discover.NodeID]net.IP),
 		bootnodes:   make([]*discover.Node, len(bootnodes)),
 		randomNodes: make([]*discover.Node, maxdyn/2),
+		dnsNodes:    make([]*discover.Node, maxdyn/2),
+		topicNodes:  make([]*discover.Node, maxdyn/2),
 		hist:        new(dialHistory),
 	}
 	copy(s.bootnodes, bootnodes)
@@ -159,18 +176,61 @@ func (s *dialstate) removeStatic(n *discover.Node) {
 	s.hist.remove(n.ID)
 }
 
+// setMaxDynDials changes the number of dynamically dialed peers. The candidate
+// buffers are resized to match, dropping surplus lookup results if lowered.
+func (s *dialstate) setMaxDynDials(max int) {
+	s.maxDynDials = max
+	if len(s.randomNodes) != max/2 {
+		s.randomNodes = make([]*discover.Node, max/2)
+	}
+	if len(s.dnsNodes) != max/2 {
+		s.dnsNodes = make([]*discover.Node, max/2)
+	}
+	if len(s.topicNodes) != max/2 {
+		s.topicNodes = make([]*discover.Node, max/2)
+	}
+	if len(s.lookupBuf) > max {
+		s.lookupBuf = s.lookupBuf[:max]
+	}
+}
+
 func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now time.Time) []task {
 	if s.start.IsZero() {
 		s.start = now
 	}
 
+	// Count the subnets of dynamic peers to keep them diverse.
+	subnets := newIPLimiter(dialSubnetLimit, dialSubnetLimit)
+	for _, p := range peers {
+		if p.rw.is(dynDialedConn) {
+			subnets.add(p.rw.remoteIP())
+		}
+	}
+	for _, ip := range s.dialingIPs {
+		subnets.add(ip)
+	}
+
 	var newtasks []task
 	addDial := func(flag connFlag, n *discover.Node) bool {
-		if err := s.checkDial(n, peers); err != nil {
+		err := s.checkDial(n, peers)
+		if err == nil && s.score != nil && s.score(n.ID) < 0 {
+			err = errBadReputation
+		}
+		if err == nil && flag == dynDialedConn && s.filter != nil && !s.filter(n) {
+			err = errFiltered
+		}
+		if err == nil && flag == dynDialedConn && !subnets.allowed(n.IP) {
+			err = errSubnetLimit
+		}
+		if err != nil {
 			log.Trace("Skipping dial candidate", "id", n.ID, "addr", &net.TCPAddr{IP: n.IP, Port: int(n.TCP)}, "err", err)
 			return false
 		}
 		s.dialing[n.ID] = flag
+		if flag == dynDialedConn {
+			s.dialingIPs[n.ID] = n.IP
+			subnets.add(n.IP)
+		}
 		newtasks = append(newtasks, &dialTask{flags: flag, dest: n})
 		return true
 	}
@@ -215,19 +275,43 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 			needDynDials--
 		}
 	}
+	// Use nodes advertising the topics of our protocols for half of the
+	// necessary dynamic dials.
+	if topicCandidates := needDynDials / 2; s.topics != nil && topicCandidates > 0 {
+		n := s.topics.ReadRandomNodes(s.topicNodes)
+		s.sortByScore(s.topicNodes[:n])
+		for i := 0; i < topicCandidates && i < n; i++ {
+			if addDial(dynDialedConn, s.topicNodes[i]) {
+				needDynDials--
+			}
+		}
+	}
 	// Use random nodes from the table for half of the necessary
 	// dynamic dials.
 	randomCandidates := needDynDials / 2
-	if randomCandidates > 0 {
+	if randomCandidates > 0 && s.ntab != nil {
 		n := s.ntab.ReadRandomNodes(s.randomNodes)
+		s.sortByScore(s.randomNodes[:n])
 		for i := 0; i < randomCandidates && i < n; i++ {
 			if addDial(dynDialedConn, s.randomNodes[i]) {
 				needDynDials--
 			}
 		}
 	}
+	// Use random nodes from the DNS node lists for half of the remaining
+	// dynamic dials.
+	if dnsCandidates := needDynDials / 2; s.dns != nil && dnsCandidates > 0 {
+		n := s.dns.ReadRandomNodes(s.dnsNodes)
+		s.sortByScore(s.dnsNodes[:n])
+		for i := 0; i < dnsCandidates && i < n; i++ {
+			if addDial(dynDialedConn, s.dnsNodes[i]) {
+				needDynDials--
+			}
+		}
+	}
 	// Create dynamic dials from random lookup results, removing tried
 	// items from the result buffer.
+	s.sortByScore(s.lookupBuf)
 	i := 0
 	for ; i < len(s.lookupBuf) && needDynDials > 0; i++ {
 		if addDial(dynDialedConn, s.lookupBuf[i]) {
@@ -236,7 +320,7 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 	}
 	s.lookupBuf = s.lookupBuf[:copy(s.lookupBuf, s.lookupBuf[i:])]
 	// Launch a discovery lookup if more candidates are needed.
-	if len(s.lookupBuf) < needDynDials && !s.lookupRunning {
+	if len(s.lookupBuf) < needDynDials && !s.lookupRunning && s.ntab != nil {
 		s.lookupRunning = true
 		newtasks = append(newtasks, &discoverTask{})
 	}
@@ -258,6 +342,9 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errBadReputation    = errors.New("bad reputation")
+	errFiltered         = errors.New("rejected by protocol filter")
+	errSubnetLimit      = errors.New("too many peers in subnet")
 )
 
 func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer) error {
@@ -277,11 +364,27 @@ func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer)
 	return nil
 }
 
+// sortByScore orders dial candidates by their reputation, best first, retaining
+// the original order of equally scored nodes.
+func (s *dialstate) sortByScore(nodes []*discover.Node) {
+	if s.score == nil {
+		return
+	}
+	scores := make(map[discover.NodeID]float64, len(nodes))
+	for _, n := range nodes {
+		scores[n.ID] = s.score(n.ID)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return scores[nodes[i].ID] > scores[nodes[j].ID]
+	})
+}
+
 func (s *dialstate) taskDone(t task, now time.Time) {
 	switch t := t.(type) {
 	case *dialTask:
 		s.hist.add(t.dest.ID, now.Add(dialHistoryExpiration))
 		delete(s.dialing, t.dest.ID)
+		delete(s.dialingIPs, t.dest.ID)
 	case *discoverTask:
 		s.lookupRunning = false
 		s.lookupBuf = append(s.lookupBuf, t.results...)
@@ -432,6 +432,174 @@ func TestDialStateNetRestrict(t *testing.T) {
 	})
 }
 
+// This test checks that at most dialSubnetLimit dynamic dials go to the same
+// subnet.
+func TestDialStateSubnetLimit(t *testing.T) {
+	table := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("1.2.3.1")},
+		{ID: uintID(2), IP: net.ParseIP("1.2.3.2")},
+		{ID: uintID(3), IP: net.ParseIP("1.2.3.3")},
+		{ID: uintID(4), IP: net.ParseIP("1.2.4.1")},
+		{ID: uintID(5), IP: net.ParseIP("2001:db8::1")},
+		{ID: uintID(6), IP: net.ParseIP("2001:db8::2")},
+		{ID: uintID(7), IP: net.ParseIP("2001:db8::3")},
+	}
+
+	runDialTest(t, dialtest{
+		init: newDialState(nil, nil, table, 14, nil),
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: table[0]},
+					&dialTask{flags: dynDialedConn, dest: table[1]},
+					&dialTask{flags: dynDialedConn, dest: table[3]},
+					&dialTask{flags: dynDialedConn, dest: table[4]},
+					&dialTask{flags: dynDialedConn, dest: table[5]},
+					&discoverTask{},
+				},
+			},
+			// Completed dials free their subnet slots.
+			{
+				done: []task{
+					&dialTask{flags: dynDialedConn, dest: table[0]},
+				},
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: table[2]},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that nodes from DNS node lists are used as dial candidates.
+func TestDialStateDNS(t *testing.T) {
+	dns := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+	}
+	state := newDialState(nil, nil, fakeTable{}, 4, nil)
+	state.dns = dns
+
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: dns[0]},
+					&dialTask{flags: dynDialedConn, dest: dns[1]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that nodes found by topic searches are preferred over
+// random nodes from the table.
+func TestDialStateTopics(t *testing.T) {
+	table := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+	}
+	topics := fakeTable{
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+		{ID: uintID(4), IP: net.ParseIP("127.0.0.4")},
+		{ID: uintID(5), IP: net.ParseIP("127.0.0.5")},
+	}
+	state := newDialState(nil, nil, table, 4, nil)
+	state.topics = topics
+
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: topics[0]},
+					&dialTask{flags: dynDialedConn, dest: topics[1]},
+					&dialTask{flags: dynDialedConn, dest: table[0]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that dynamic dial candidates rejected by the protocol filter
+// are not dialed, but static nodes are dialed regardless.
+func TestDialStateFilter(t *testing.T) {
+	table := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+		{ID: uintID(4), IP: net.ParseIP("127.0.0.4")},
+	}
+	rejected := map[discover.NodeID]bool{uintID(2): true, uintID(4): true, uintID(5): true}
+	state := newDialState([]*discover.Node{{ID: uintID(5)}}, nil, table, 10, nil)
+	state.filter = func(n *discover.Node) bool { return !rejected[n.ID] }
+
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: staticDialedConn, dest: &discover.Node{ID: uintID(5)}},
+					&dialTask{flags: dynDialedConn, dest: table[0]},
+					&dialTask{flags: dynDialedConn, dest: table[2]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that dynamic dial candidates are tried in the order of their
+// reputation, skipping the ones with a bad reputation, but static nodes are
+// dialed regardless.
+func TestDialStateReputation(t *testing.T) {
+	scores := map[discover.NodeID]float64{
+		uintID(1): -1,
+		uintID(4): 0.5,
+		uintID(5): 0.9,
+		uintID(6): 0.1,
+		uintID(7): -1,
+	}
+	state := newDialState([]*discover.Node{{ID: uintID(7)}}, nil, fakeTable{}, 4, nil)
+	state.score = func(id discover.NodeID) float64 { return scores[id] }
+
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			// The static node is dialed and a discovery query is launched.
+			{
+				new: []task{
+					&dialTask{flags: staticDialedConn, dest: &discover.Node{ID: uintID(7)}},
+					&discoverTask{},
+				},
+			},
+			// The best scored discovery results are dialed when it completes.
+			{
+				done: []task{
+					&discoverTask{results: []*discover.Node{
+						{ID: uintID(1)}, // this one has a bad reputation and is not dialed
+						{ID: uintID(2)},
+						{ID: uintID(3)}, // this one is not tried because it was found after the equally scored 2
+						{ID: uintID(4)},
+						{ID: uintID(5)},
+						{ID: uintID(6)},
+					}},
+				},
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(2)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(4)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(5)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(6)}},
+				},
+			},
+		},
+	})
+}
+
 // This test checks that static dials are launched.
 func TestDialStateStaticDial(t *testing.T) {
 	wanwatatic := []*discover.Node{
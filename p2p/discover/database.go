@@ -29,6 +29,7 @@ import (
 
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/enr"
 	"github.com/watchain/go-watchain/rlp"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
@@ -61,6 +62,7 @@ var (
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
 	nodeDBDiscoverPong      = nodeDBDiscoverRoot + ":lastpong"
 	nodeDBDiscoverFindFails = nodeDBDiscoverRoot + ":findfail"
+	nodeDBDiscoverRecord    = nodeDBDiscoverRoot + ":enr"
 )
 
 // newNodeDB creates a new node database for storing and retrieving infos about
@@ -187,6 +189,7 @@ func (db *nodeDB) node(id NodeID) *Node {
 		return nil
 	}
 	node.sha = crypto.Keccak256Hash(node.ID[:])
+	node.record = db.record(id)
 	return node
 }
 
@@ -199,6 +202,31 @@ func (db *nodeDB) updateNode(node *Node) error {
 	return db.lvl.Put(makeKey(node.ID, nodeDBDiscoverRoot), blob, nil)
 }
 
+// record retrieves the signed record of a node from the database, nil if the
+// node didn't advertise one.
+func (db *nodeDB) record(id NodeID) *enr.Record {
+	blob, err := db.lvl.Get(makeKey(id, nodeDBDiscoverRecord), nil)
+	if err != nil {
+		return nil
+	}
+	record := new(enr.Record)
+	if err := rlp.DecodeBytes(blob, record); err != nil {
+		log.Error("Failed to decode node record", "id", id, "err", err)
+		return nil
+	}
+	return record
+}
+
+// updateRecord inserts - potentially overwriting - the signed record of a node
+// into the database.
+func (db *nodeDB) updateRecord(id NodeID, record *enr.Record) error {
+	blob, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		return err
+	}
+	return db.lvl.Put(makeKey(id, nodeDBDiscoverRecord), blob, nil)
+}
+
 // deleteNode deletes all information/keys associated with a node.
 func (db *nodeDB) deleteNode(id NodeID) error {
 	deleter := db.lvl.NewIterator(util.BytesPrefix(makeKey(id, "")), nil)
@@ -340,6 +368,7 @@ seek:
 				continue seek // duplicate
 			}
 		}
+		n.record = db.record(n.ID)
 		nodes = append(nodes, n)
 	}
 	return nodes
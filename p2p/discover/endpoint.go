@@ -0,0 +1,192 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/watchain/go-watchain/log"
+)
+
+const (
+	endpointWindow        = 10 * time.Minute // statements older than this are ignored
+	endpointMinStatements = 10               // statements required for a prediction
+)
+
+// EndpointStats summarizes the endpoints of the local node as seen by
+// remote nodes.
+type EndpointStats struct {
+	Statements int            `json:"statements"` // number of remote IPs which recently reported an endpoint
+	Endpoints  map[string]int `json:"endpoints"`  // statements per reported endpoint
+	Predicted  string         `json:"predicted"`  // endpoint reported by the majority, empty if undecided
+	Static     bool           `json:"static"`     // whwater the announced IP is fixed
+}
+
+// EndpointStats returns statistics of the endpoints of the local node reported
+// by remote nodes.
+func (tab *Table) EndpointStats() EndpointStats {
+	st := tab.endpoints.stats(time.Now())
+	tab.selfMu.Lock()
+	st.Static = tab.staticIP
+	tab.selfMu.Unlock()
+	return st
+}
+
+// SetStaticIP sets the IP address announced by the local node, e.g. after the
+// NAT gateway reported a new external address. From then on, the IP is no
+// longer learned from the endpoints reported by remote nodes.
+func (tab *Table) SetStaticIP(ip net.IP) {
+	tab.selfMu.Lock()
+	defer tab.selfMu.Unlock()
+
+	tab.staticIP = true
+	tab.setEndpoint(makeEndpoint(&net.UDPAddr{IP: ip, Port: int(tab.self.UDP)}, tab.self.TCP))
+}
+
+// ourEndpoint returns the endpoint announced by the local node.
+func (tab *Table) ourEndpoint() rpcEndpoint {
+	self := tab.Self()
+	return makeEndpoint(&net.UDPAddr{IP: self.IP, Port: int(self.UDP)}, self.TCP)
+}
+
+// setEndpoint changes the endpoint announced by the local node. The caller
+// must hold tab.selfMu.
+func (tab *Table) setEndpoint(ep rpcEndpoint) {
+	tab.self = NewNode(tab.self.ID, ep.IP, ep.UDP, ep.TCP)
+	tab.local.setEndpoint(ep)
+}
+
+// addEndpointStatement records the endpoint of the local node reported by
+// the node at from and updates the announced endpoint if the majority of
+// remote nodes agree on a different one.
+func (tab *Table) addEndpointStatement(from net.IP, ep rpcEndpoint, now time.Time) {
+	tab.endpoints.addStatement(from, ep, now)
+	predicted, ok := tab.endpoints.predict(now)
+	if !ok {
+		return
+	}
+	tab.selfMu.Lock()
+	defer tab.selfMu.Unlock()
+
+	self := tab.self
+	if tab.staticIP || (predicted.IP.Equal(self.IP) && predicted.UDP == self.UDP) {
+		return
+	}
+	log.Info("Updating external endpoint", "old", &net.UDPAddr{IP: self.IP, Port: int(self.UDP)}, "new", endpointString(predicted))
+	tab.setEndpoint(rpcEndpoint{IP: predicted.IP, UDP: predicted.UDP, TCP: self.TCP})
+}
+
+// endpointTracker predicts the external endpoint of the local node from the
+// endpoints reported by remote nodes in pong packets. Only the latest statement
+// of every remote IP counts, so a single host can't outvote the others.
+type endpointTracker struct {
+	window        time.Duration
+	minStatements int
+
+	mu         sync.Mutex
+	statements map[string]endpointStatement // keyed by remote IP
+}
+
+type endpointStatement struct {
+	endpoint rpcEndpoint
+	time     time.Time
+}
+
+func newEndpointTracker(window time.Duration, minStatements int) *endpointTracker {
+	return &endpointTracker{
+		window:        window,
+		minStatements: minStatements,
+		statements:    make(map[string]endpointStatement),
+	}
+}
+
+// addStatement records that the node at from sees the local node at ep.
+func (et *endpointTracker) addStatement(from net.IP, ep rpcEndpoint, now time.Time) {
+	if ep.IP == nil || ep.IP.IsUnspecified() || ep.UDP == 0 {
+		return
+	}
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	et.statements[from.String()] = endpointStatement{endpoint: ep, time: now}
+}
+
+// predict returns the endpoint reported by the majority of the recent
+// statements. ok is false if there are too few statements or no majority.
+func (et *endpointTracker) predict(now time.Time) (ep rpcEndpoint, ok bool) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	counts, best := et.count(now)
+	if !et.isMajority(counts[best]) {
+		return rpcEndpoint{}, false
+	}
+	for _, s := range et.statements {
+		if endpointString(s.endpoint) == best {
+			return s.endpoint, true
+		}
+	}
+	return rpcEndpoint{}, false
+}
+
+// stats returns statistics of the recent statements.
+func (et *endpointTracker) stats(now time.Time) EndpointStats {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	counts, best := et.count(now)
+	st := EndpointStats{Statements: len(et.statements), Endpoints: counts}
+	if et.isMajority(counts[best]) {
+		st.Predicted = best
+	}
+	return st
+}
+
+// count drops expired statements and counts the remaining ones per endpoint. It
+// also returns the most reported endpoint. The caller must hold et.mu.
+func (et *endpointTracker) count(now time.Time) (map[string]int, string) {
+	var (
+		counts = make(map[string]int)
+		best   string
+	)
+	for ip, s := range et.statements {
+		if now.Sub(s.time) > et.window {
+			delete(et.statements, ip)
+			continue
+		}
+		key := endpointString(s.endpoint)
+		counts[key]++
+		if c := counts[key]; c > counts[best] || (c == counts[best] && key < best) {
+			best = key
+		}
+	}
+	return counts, best
+}
+
+// isMajority reports whwater n statements are enough for a prediction. The
+// caller must hold et.mu.
+func (et *endpointTracker) isMajority(n int) bool {
+	return n > 0 && n >= et.minStatements && n*2 > len(et.statements)
+}
+
+// endpointString formats the UDP endpoint of ep. The TCP port isn't included
+// because remote nodes can't observe it.
+func endpointString(ep rpcEndpoint) string {
+	return net.JoinHostPort(ep.IP.String(), strconv.Itoa(int(ep.UDP)))
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/p2p/enr"
+)
+
+func TestEndpointTrackerPredict(t *testing.T) {
+	var (
+		et    = newEndpointTracker(10*time.Minute, 3)
+		now   = time.Now()
+		epA   = rpcEndpoint{IP: net.IP{1, 2, 3, 4}, UDP: 30303}
+		epB   = rpcEndpoint{IP: net.IP{5, 6, 7, 8}, UDP: 30303}
+		nodes = func(i int) net.IP { return net.IP{10, 0, 0, byte(i)} }
+	)
+	if _, ok := et.predict(now); ok {
+		t.Fatal("prediction without statements")
+	}
+	// Too few statements.
+	et.addStatement(nodes(1), epA, now)
+	et.addStatement(nodes(2), epA, now)
+	if _, ok := et.predict(now); ok {
+		t.Fatal("prediction with too few statements")
+	}
+	// Repeated statements of one node count once.
+	et.addStatement(nodes(2), epA, now)
+	if _, ok := et.predict(now); ok {
+		t.Fatal("repeated statement was counted")
+	}
+	et.addStatement(nodes(3), epA, now)
+	if ep, ok := et.predict(now); !ok || endpointString(ep) != "1.2.3.4:30303" {
+		t.Fatalf("wrong prediction: %v, %t", ep, ok)
+	}
+	// No majority.
+	for i := 4; i <= 6; i++ {
+		et.addStatement(nodes(i), epB, now)
+	}
+	if _, ok := et.predict(now); ok {
+		t.Fatal("prediction without majority")
+	}
+	st := et.stats(now)
+	if st.Statements != 6 || st.Endpoints["1.2.3.4:30303"] != 3 || st.Endpoints["5.6.7.8:30303"] != 3 || st.Predicted != "" {
+		t.Fatalf("wrong stats: %+v", st)
+	}
+	// The old statements expire.
+	later := now.Add(5 * time.Minute)
+	for i := 7; i <= 9; i++ {
+		et.addStatement(nodes(i), epB, later)
+	}
+	if ep, ok := et.predict(now.Add(11 * time.Minute)); !ok || endpointString(ep) != "5.6.7.8:30303" {
+		t.Fatalf("wrong prediction after expiry: %v, %t", ep, ok)
+	}
+	if st := et.stats(now.Add(11 * time.Minute)); st.Statements != 3 {
+		t.Fatalf("expired statements were kept: %+v", st)
+	}
+}
+
+func TestTableEndpointUpdate(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	var (
+		tab  = test.table
+		now  = time.Now()
+		ext  = rpcEndpoint{IP: net.IP{1, 2, 3, 4}, UDP: 40404, TCP: 1}
+		tcp  = tab.Self().TCP
+		seq  = tab.LocalRecord().Seq()
+		from = func(i int) net.IP { return net.IP{10, 0, 1, byte(i)} }
+	)
+	for i := 0; i < endpointMinStatements; i++ {
+		tab.addEndpointStatement(from(i), ext, now)
+	}
+	self := tab.Self()
+	if !self.IP.Equal(ext.IP) || self.UDP != ext.UDP || self.TCP != tcp {
+		t.Fatalf("self not updated: %v", self)
+	}
+	var ip enr.IP4
+	if err := tab.LocalRecord().Load(&ip); err != nil || !net.IP(ip).Equal(ext.IP) {
+		t.Fatalf("record not updated: ip %v, err %v", net.IP(ip), err)
+	}
+	if tab.LocalRecord().Seq() <= seq {
+		t.Fatalf("record seq not increased")
+	}
+	if st := tab.EndpointStats(); st.Predicted != "1.2.3.4:40404" || st.Static {
+		t.Fatalf("wrong stats: %+v", st)
+	}
+
+	// After setting a static IP, statements no longer change it.
+	static := net.IP{7, 7, 7, 7}
+	tab.SetStaticIP(static)
+	other := rpcEndpoint{IP: net.IP{9, 9, 9, 9}, UDP: 40404}
+	for i := 0; i < 3*endpointMinStatements; i++ {
+		tab.addEndpointStatement(from(100+i), other, now)
+	}
+	if self := tab.Self(); !self.IP.Equal(static) || self.UDP != ext.UDP {
+		t.Fatalf("static IP not kept: %v", self)
+	}
+	if st := tab.EndpointStats(); st.Predicted != "9.9.9.9:40404" || !st.Static {
+		t.Fatalf("wrong stats: %+v", st)
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/watchain/go-watchain/common"
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/crypto/secp256k1"
+	"github.com/watchain/go-watchain/p2p/enr"
 )
 
 const NodeIDBits = 512
@@ -54,6 +55,9 @@ type Node struct {
 
 	// Time when the node was added to the table.
 	addedAt time.Time
+
+	// Signed node record, nil if the node didn't advertise one yet.
+	record *enr.Record
 }
 
 // NewNode creates a new node. It is mostly meant to be used for
@@ -71,6 +75,52 @@ func NewNode(id NodeID, ip net.IP, udpPort, tcpPort uint16) *Node {
 	}
 }
 
+// NodeFromRecord creates a node from its signed record. The record must
+// contain the public key and the endpoint of the node.
+func NodeFromRecord(r *enr.Record) (*Node, error) {
+	var (
+		pub enr.Secp256k1
+		ip4 enr.IP4
+		ip6 enr.IP6
+		tcp enr.TCP
+		udp enr.UDP
+		ip  net.IP
+	)
+	if err := r.Load(&pub); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&ip4); err == nil {
+		ip = net.IP(ip4)
+	} else if err := r.Load(&ip6); err == nil {
+		ip = net.IP(ip6)
+	} else {
+		return nil, errors.New("missing IP address")
+	}
+	if err := r.Load(&tcp); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&udp); err != nil {
+		udp = enr.UDP(tcp)
+	}
+	n := NewNode(PubkeyID((*ecdsa.PublicKey)(&pub)), ip, uint16(udp), uint16(tcp))
+	n.record = r
+	return n, nil
+}
+
+// Record returns the signed record advertised by the node, or nil if it is not
+// known. The returned record should not be modified by the caller.
+func (n *Node) Record() *enr.Record {
+	return n.record
+}
+
+// Seq returns the sequence number of the node's record, zero if not known.
+func (n *Node) Seq() uint64 {
+	if n.record == nil {
+		return 0
+	}
+	return n.record.Seq()
+}
+
 func (n *Node) addr() *net.UDPAddr {
 	return &net.UDPAddr{IP: n.IP, Port: int(n.UDP)}
 }
@@ -0,0 +1,164 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/enr"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+var errRecordMismatch = errors.New("record doesn't belong to node")
+
+// localRecord maintains the signed record of the local node. The record is
+// re-signed with an increased sequence number whenever its entries change,
+// e.g. when the endpoint of the node changes. The latest record is persisted
+// in the node database, so the sequence number keeps increasing across restarts.
+type localRecord struct {
+	priv *ecdsa.PrivateKey
+	db   *nodeDB
+
+	mu      sync.Mutex
+	entries map[string]enr.Entry // Entries of the record, keyed by their names
+	record  *enr.Record          // Latest signed record, nil if it needs signing
+	last    *enr.Record          // Previously signed record, used for sequencing
+}
+
+// newLocalRecord creates the local record manager, loading the last signed
+// record from the database.
+func newLocalRecord(priv *ecdsa.PrivateKey, db *nodeDB) *localRecord {
+	return &localRecord{
+		priv:    priv,
+		db:      db,
+		entries: make(map[string]enr.Entry),
+		last:    db.record(db.self),
+	}
+}
+
+// set adds or updates an entry of the record.
+func (lr *localRecord) set(e enr.Entry) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.entries[e.ENRKey()] = e
+	lr.record = nil
+}
+
+// setEndpoint updates the address entries of the record.
+func (lr *localRecord) setEndpoint(ep rpcEndpoint) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	delete(lr.entries, enr.IP4{}.ENRKey())
+	delete(lr.entries, enr.IP6{}.ENRKey())
+	if ip := ep.IP.To4(); ip != nil {
+		lr.entries[enr.IP4{}.ENRKey()] = enr.IP4(ip)
+	} else if len(ep.IP) > 0 {
+		lr.entries[enr.IP6{}.ENRKey()] = enr.IP6(ep.IP)
+	}
+	lr.entries[enr.UDP(0).ENRKey()] = enr.UDP(ep.UDP)
+	lr.entries[enr.TCP(0).ENRKey()] = enr.TCP(ep.TCP)
+	lr.record = nil
+}
+
+// get returns the current signed record, signing it if the entries changed. It
+// returns nil if no record could be signed.
+func (lr *localRecord) get() *enr.Record {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if lr.record == nil {
+		lr.sign()
+	}
+	return lr.record
+}
+
+// seq returns the sequence number of the current record.
+func (lr *localRecord) seq() uint64 {
+	if r := lr.get(); r != nil {
+		return r.Seq()
+	}
+	return 0
+}
+
+// sign creates a new signed record from the current entries. The sequence number
+// of the previous record is only increased if the content of the record changed.
+// The caller must hold lr.mu.
+func (lr *localRecord) sign() {
+	keys := make([]string, 0, len(lr.entries))
+	for key := range lr.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	build := func(seq uint64) (*enr.Record, []byte, error) {
+		r := new(enr.Record)
+		r.SetSeq(seq)
+		for _, key := range keys {
+			r.Set(lr.entries[key])
+		}
+		if err := r.Sign(lr.priv); err != nil {
+			return nil, nil, err
+		}
+		blob, err := rlp.EncodeToBytes(r)
+		return r, blob, err
+	}
+	// Reuse the previous record if nothing changed, signing is deterministic
+	if lr.last != nil && lr.last.Seq() > 0 {
+		if blob, err := rlp.EncodeToBytes(lr.last); err == nil {
+			if r, same, err := build(lr.last.Seq() - 1); err == nil && bytes.Equal(blob, same) {
+				lr.record = r
+				return
+			}
+		}
+	}
+	var seq uint64
+	if lr.last != nil {
+		seq = lr.last.Seq()
+	}
+	r, _, err := build(seq)
+	if err != nil {
+		// Keep serving the previous record, it's still valid.
+		log.Error("Failed to sign local node record", "err", err)
+		lr.record = lr.last
+		return
+	}
+	if err := lr.db.updateRecord(lr.db.self, r); err != nil {
+		log.Warn("Failed to store local node record", "err", err)
+	}
+	log.Debug("Signed local node record", "seq", r.Seq())
+	lr.record, lr.last = r, r
+}
+
+// checkRecord verifies that a record received from the network was signed by
+// the given node.
+func checkRecord(id NodeID, r *enr.Record) error {
+	var pub enr.Secp256k1
+	if err := r.Load(&pub); err != nil {
+		return err
+	}
+	if PubkeyID((*ecdsa.PublicKey)(&pub)) != id {
+		return errRecordMismatch
+	}
+	return nil
+}
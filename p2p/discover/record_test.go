@@ -0,0 +1,72 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"net"
+	"testing"
+
+	"github.com/watchain/go-watchain/p2p/enr"
+)
+
+// Tests that the local record is only re-signed with a new sequence number if
+// its content changes, and that the sequence number survives restarts.
+func TestLocalRecordSeq(t *testing.T) {
+	key := newkey()
+	db, _ := newNodeDB("", Version, PubkeyID(&key.PublicKey))
+	defer db.close()
+
+	ep := rpcEndpoint{IP: net.ParseIP("1.2.3.4").To4(), UDP: 30303, TCP: 30303}
+	lr := newLocalRecord(key, db)
+	lr.setEndpoint(ep)
+	if seq := lr.seq(); seq != 1 {
+		t.Fatalf("initial seq mismatch: have %d, want 1", seq)
+	}
+	if err := checkRecord(db.self, lr.get()); err != nil {
+		t.Fatalf("invalid local record: %v", err)
+	}
+	// Setting the same endpoint again must not bump the sequence number
+	lr.setEndpoint(ep)
+	if seq := lr.seq(); seq != 1 {
+		t.Errorf("seq bumped without change: have %d, want 1", seq)
+	}
+	// Changing the endpoint or adding an entry must bump it
+	ep.UDP = 30304
+	lr.setEndpoint(ep)
+	if seq := lr.seq(); seq != 2 {
+		t.Errorf("seq mismatch after endpoint change: have %d, want 2", seq)
+	}
+	lr.set(enr.TCP(30305))
+	if seq := lr.seq(); seq != 3 {
+		t.Errorf("seq mismatch after entry change: have %d, want 3", seq)
+	}
+	var tcp enr.TCP
+	if err := lr.get().Load(&tcp); err != nil || tcp != 30305 {
+		t.Errorf("entry mismatch: have %d (err %v), want 30305", tcp, err)
+	}
+	// A restarted node must continue from the stored sequence number
+	lr = newLocalRecord(key, db)
+	lr.setEndpoint(ep)
+	lr.set(enr.TCP(30305))
+	if seq := lr.seq(); seq != 3 {
+		t.Errorf("seq mismatch after restart: have %d, want 3", seq)
+	}
+	lr.set(enr.TCP(30306))
+	if seq := lr.seq(); seq != 4 {
+		t.Errorf("seq mismatch after restart and change: have %d, want 4", seq)
+	}
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/watchain/go-watchain/common"
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/enr"
 	"github.com/watchain/go-watchain/p2p/netutil"
 )
 
@@ -84,8 +85,13 @@ type Table struct {
 
 	nodeAddedHook func(*Node) // for testing
 
-	net  transport
-	self *Node // metadata of the local node
+	net       transport
+	local     *localRecord     // signed record of the local node
+	endpoints *endpointTracker // external endpoint reported by other nodes
+
+	selfMu   sync.Mutex // protects self, staticIP
+	self     *Node      // metadata of the local node
+	staticIP bool       // if set, the IP of self isn't predicted from endpoints
 }
 
 type bondproc struct {
@@ -98,8 +104,9 @@ type bondproc struct {
 // it is an interface so we can test without opening lots of UDP
 // sockets and without generating a private key.
 type transport interface {
-	ping(NodeID, *net.UDPAddr) error
+	ping(NodeID, *net.UDPAddr) (uint64, error)
 	waitping(NodeID) error
+	requestENR(NodeID, *net.UDPAddr) (*enr.Record, error)
 	findnode(toid NodeID, addr *net.UDPAddr, target NodeID) ([]*Node, error)
 	close()
 }
@@ -122,6 +129,7 @@ func newTable(t transport, ourID NodeID, ourAddr *net.UDPAddr, nodeDBPath string
 		net:        t,
 		db:         db,
 		self:       NewNode(ourID, ourAddr.IP, uint16(ourAddr.Port), uint16(ourAddr.Port)),
+		endpoints:  newEndpointTracker(endpointWindow, endpointMinStatements),
 		bonding:    make(map[NodeID]*bondproc),
 		bondslots:  make(chan struct{}, maxBondingPingPongs),
 		refreshReq: make(chan chan struct{}),
@@ -164,9 +172,28 @@ func (tab *Table) seedRand() {
 // Self returns the local node.
 // The returned node should not be modified by the caller.
 func (tab *Table) Self() *Node {
+	tab.selfMu.Lock()
+	defer tab.selfMu.Unlock()
 	return tab.self
 }
 
+// LocalRecord returns the signed record of the local node.
+// The returned record should not be modified by the caller.
+func (tab *Table) LocalRecord() *enr.Record {
+	if tab.local == nil {
+		return nil
+	}
+	return tab.local.get()
+}
+
+// SetLocalEntry adds or updates an entry of the local node record. The record
+// is re-signed with an increased sequence number when it is next requested.
+func (tab *Table) SetLocalEntry(e enr.Entry) {
+	if tab.local != nil {
+		tab.local.set(e)
+	}
+}
+
 // ReadRandomNodes fills the given slice with random nodes from the
 // table. It will not write the same node more than once. The nodes in
 // the slice are copies and can be modified by the caller.
@@ -290,7 +317,7 @@ func (tab *Table) lookup(targetID NodeID, refreshIfEmpty bool) []*Node {
 	)
 	// don't query further if we hit ourself.
 	// unlikely to happen often in practice.
-	asked[tab.self.ID] = true
+	asked[tab.Self().ID] = true
 
 	for {
 		tab.mutex.Lock()
@@ -432,7 +459,7 @@ func (tab *Table) doRefresh(done chan struct{}) {
 	tab.loadSeedNodes(true)
 
 	// Run self lookup to discover new neighbor nodes.
-	tab.lookup(tab.self.ID, false)
+	tab.lookup(tab.Self().ID, false)
 
 	// The Kademlia paper specifies that the bucket refresh should
 	// perform a lookup in the least recently used bucket. We cannot
@@ -473,7 +500,13 @@ func (tab *Table) doRevalidate(done chan<- struct{}) {
 	}
 
 	// Ping the selected node and wait for a pong.
-	err := tab.ping(last.ID, last.addr())
+	seq, err := tab.ping(last.ID, last.addr())
+
+	// Fetch the record of the node if it advertises a newer one.
+	var record *enr.Record
+	if err == nil && seq > last.Seq() {
+		record = tab.fetchRecord(last.ID, last.addr())
+	}
 
 	tab.mutex.Lock()
 	defer tab.mutex.Unlock()
@@ -481,6 +514,12 @@ func (tab *Table) doRevalidate(done chan<- struct{}) {
 	if err == nil {
 		// The node responded, move it to the front.
 		log.Debug("Revalidated node", "b", bi, "id", last.ID)
+		if record != nil {
+			// Nodes handed out may be in use, replace the entry with a copy.
+			cpy := *last
+			cpy.record = record
+			last = &cpy
+		}
 		b.bump(last)
 		return
 	}
@@ -588,7 +627,7 @@ func (tab *Table) bondall(nodes []*Node) (result []*Node) {
 // If pinged is true, the remote node has just pinged us and one half
 // of the process can be skipped.
 func (tab *Table) bond(pinged bool, id NodeID, addr *net.UDPAddr, tcpPort uint16) (*Node, error) {
-	if id == tab.self.ID {
+	if id == tab.Self().ID {
 		return nil, errors.New("is self")
 	}
 	if pinged && !tab.isInitDone() {
@@ -641,7 +680,8 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeID, addr *net.UDPAdd
 	defer func() { tab.bondslots <- struct{}{} }()
 
 	// Ping the remote side and wait for a pong.
-	if w.err = tab.ping(id, addr); w.err != nil {
+	seq, err := tab.ping(id, addr)
+	if w.err = err; w.err != nil {
 		close(w.done)
 		return
 	}
@@ -653,23 +693,45 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeID, addr *net.UDPAdd
 	}
 	// Bonding succeeded, update the node database.
 	w.n = NewNode(id, addr.IP, uint16(addr.Port), tcpPort)
+
+	// Attach the record of the node, fetching it if a newer one is advertised.
+	w.n.record = tab.db.record(id)
+	if seq > w.n.Seq() {
+		if record := tab.fetchRecord(id, addr); record != nil {
+			w.n.record = record
+		}
+	}
 	close(w.done)
 }
 
 // ping a remote endpoint and wait for a reply, also updating the node
-// database accordingly.
-func (tab *Table) ping(id NodeID, addr *net.UDPAddr) error {
+// database accordingly. The returned number is the sequence number of
+// the record advertised by the remote node.
+func (tab *Table) ping(id NodeID, addr *net.UDPAddr) (uint64, error) {
 	tab.db.updateLastPing(id, time.Now())
-	if err := tab.net.ping(id, addr); err != nil {
-		return err
+	seq, err := tab.net.ping(id, addr)
+	if err != nil {
+		return 0, err
 	}
 	tab.db.updateBondTime(id, time.Now())
-	return nil
+	return seq, nil
+}
+
+// fetchRecord requests the signed record of a remote node, storing it in the
+// node database. It returns nil if the record couldn't be retrieved.
+func (tab *Table) fetchRecord(id NodeID, addr *net.UDPAddr) *enr.Record {
+	record, err := tab.net.requestENR(id, addr)
+	if err != nil {
+		log.Trace("Failed to fetch node record", "id", id, "addr", addr, "err", err)
+		return nil
+	}
+	tab.db.updateRecord(id, record)
+	return record
 }
 
 // bucket returns the bucket for the given node ID hash.
 func (tab *Table) bucket(sha common.Hash) *bucket {
-	d := logdist(tab.self.sha, sha)
+	d := logdist(tab.Self().sha, sha)
 	if d <= bucketMinDistance {
 		return tab.buckets[0]
 	}
@@ -696,11 +758,12 @@ func (tab *Table) add(new *Node) {
 // stuff adds nodes the table to the end of their corresponding bucket
 // if the bucket is not full. The caller must not hold tab.mutex.
 func (tab *Table) stuff(nodes []*Node) {
+	self := tab.Self().ID
 	tab.mutex.Lock()
 	defer tab.mutex.Unlock()
 
 	for _, n := range nodes {
-		if n.ID == tab.self.ID {
+		if n.ID == self {
 			continue // don't add self
 		}
 		b := tab.bucket(n.sha)
@@ -27,6 +27,7 @@ import (
 
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/enr"
 	"github.com/watchain/go-watchain/p2p/nat"
 	"github.com/watchain/go-watchain/p2p/netutil"
 	"github.com/watchain/go-watchain/rlp"
@@ -41,6 +42,7 @@ var (
 	errExpired          = errors.New("expired")
 	errUnsolicitedReply = errors.New("unsolicited reply")
 	errUnknownNode      = errors.New("unknown node")
+	errNoRecord         = errors.New("no local node record")
 	errTimeout          = errors.New("RPC timeout")
 	errClockWarp        = errors.New("reply deadline too far in the future")
 	errClosed           = errors.New("socket closed")
@@ -63,6 +65,8 @@ const (
 	pongPacket
 	findnodePacket
 	neighborsPacket
+	enrRequestPacket
+	enrResponsePacket
 )
 
 // RPC request structures
@@ -104,6 +108,21 @@ type (
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
+	// enrRequest is a query for the current node record of the recipient.
+	enrRequest struct {
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// enrResponse is the reply to enrRequest.
+	enrResponse struct {
+		ReplyTok []byte // Hash of the enrRequest packet.
+		Record   enr.Record
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
 	rpcNode struct {
 		IP  net.IP // len 4 for IPv4 or 16 for IPv6
 		UDP uint16 // for discovery protocol
@@ -162,7 +181,7 @@ type udp struct {
 	conn        conn
 	netrestrict *netutil.Netlist
 	priv        *ecdsa.PrivateKey
-	ourEndpoint rpcEndpoint
+	local       *localRecord
 
 	addpending chan *pending
 	gotreply   chan reply
@@ -223,6 +242,7 @@ type Config struct {
 
 	// These settings are optional:
 	AnnounceAddr *net.UDPAddr      // local address announced in the DHT
+	StaticIP     bool              // if set, the announced IP isn't learned from other nodes
 	NodeDBPath   string            // if set, the node database is stored at this filesystem location
 	NetRestrict  *netutil.Netlist  // network whitelist
 	Bootnodes    []*Node           // list of boowatrap nodes
@@ -235,7 +255,7 @@ func ListenUDP(c conn, cfg Config) (*Table, error) {
 	if err != nil {
 		return nil, err
 	}
-	log.Info("UDP listener up", "self", tab.self)
+	log.Info("UDP listener up", "self", tab.Self())
 	return tab, nil
 }
 
@@ -253,12 +273,15 @@ func newUDP(c conn, cfg Config) (*Table, *udp, error) {
 		realaddr = cfg.AnnounceAddr
 	}
 	// TODO: separate TCP port
-	udp.ourEndpoint = makeEndpoint(realaddr, uint16(realaddr.Port))
 	tab, err := newTable(udp, PubkeyID(&cfg.PrivateKey.PublicKey), realaddr, cfg.NodeDBPath, cfg.Bootnodes)
 	if err != nil {
 		return nil, nil, err
 	}
+	tab.staticIP = cfg.StaticIP
 	udp.Table = tab
+	udp.local = newLocalRecord(cfg.PrivateKey, tab.db)
+	udp.local.setEndpoint(tab.ourEndpoint())
+	tab.local = udp.local
 
 	go udp.loop()
 	go udp.readLoop(cfg.Unhandled)
@@ -271,23 +294,81 @@ func (t *udp) close() {
 	// TODO: wait for the loops to end.
 }
 
-// ping sends a ping message to the given node and waits for a reply.
-func (t *udp) ping(toid NodeID, toaddr *net.UDPAddr) error {
+// ping sends a ping message to the given node and waits for a reply. The
+// returned number is the sequence number of the remote node's record, or
+// zero if the remote node didn't advertise one.
+func (t *udp) ping(toid NodeID, toaddr *net.UDPAddr) (uint64, error) {
 	req := &ping{
 		Version:    Version,
-		From:       t.ourEndpoint,
+		From:       t.ourEndpoint(),
 		To:         makeEndpoint(toaddr, 0), // TODO: maybe use known TCP port from DB
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Rest:       t.seqTail(),
 	}
 	packet, hash, err := encodePacket(t.priv, pingPacket, req)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	var seq uint64
 	errc := t.pending(toid, pongPacket, func(p interface{}) bool {
-		return bytes.Equal(p.(*pong).ReplyTok, hash)
+		reply := p.(*pong)
+		if !bytes.Equal(reply.ReplyTok, hash) {
+			return false
+		}
+		seq = tailSeq(reply.Rest)
+		return true
 	})
 	t.write(toaddr, req.name(), packet)
-	return <-errc
+	err = <-errc
+	return seq, err
+}
+
+// requestENR sends an enrRequest to the given node and waits for its record.
+func (t *udp) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	req := &enrRequest{
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	}
+	packet, hash, err := encodePacket(t.priv, enrRequestPacket, req)
+	if err != nil {
+		return nil, err
+	}
+	var record *enr.Record
+	errc := t.pending(toid, enrResponsePacket, func(r interface{}) bool {
+		reply := r.(*enrResponse)
+		if !bytes.Equal(reply.ReplyTok, hash) {
+			return false
+		}
+		record = &reply.Record
+		return true
+	})
+	t.write(toaddr, req.name(), packet)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	if err := checkRecord(toid, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// seqTail returns the additional ping/pong fields advertising the sequence
+// number of the local record.
+func (t *udp) seqTail() []rlp.RawValue {
+	if t.local == nil {
+		return nil
+	}
+	enc, _ := rlp.EncodeToBytes(t.local.seq())
+	return []rlp.RawValue{enc}
+}
+
+// tailSeq extracts the record sequence number from the additional fields of a
+// ping or pong packet. Nodes not supporting records don't send it.
+func tailSeq(rest []rlp.RawValue) uint64 {
+	var seq uint64
+	if len(rest) > 0 {
+		rlp.DecodeBytes(rest[0], &seq)
+	}
+	return seq
 }
 
 func (t *udp) waitping(from NodeID) error {
@@ -571,6 +652,10 @@ func decodePacket(buf []byte) (packet, NodeID, []byte, error) {
 		req = new(findnode)
 	case neighborsPacket:
 		req = new(neighbors)
+	case enrRequestPacket:
+		req = new(enrRequest)
+	case enrResponsePacket:
+		req = new(enrResponse)
 	default:
 		return nil, fromID, hash, fmt.Errorf("unknown type: %d", ptype)
 	}
@@ -587,6 +672,7 @@ func (req *ping) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) er
 		To:         makeEndpoint(from, req.From.TCP),
 		ReplyTok:   mac,
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Rest:       t.seqTail(),
 	})
 	if !t.handleReply(fromID, pingPacket, req) {
 		// Note: we're ignoring the provided IP address right now
@@ -604,6 +690,7 @@ func (req *pong) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) er
 	if !t.handleReply(fromID, pongPacket, req) {
 		return errUnsolicitedReply
 	}
+	t.addEndpointStatement(from.IP, req.To, time.Now())
 	return nil
 }
 
@@ -662,6 +749,37 @@ func (req *neighbors) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byt
 
 func (req *neighbors) name() string { return "NEIGHBORS/v4" }
 
+func (req *enrRequest) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if !t.db.hasBond(fromID) {
+		// No bond exists, we don't process the packet for the same
+		// reasons as findnode.
+		return errUnknownNode
+	}
+	record := t.local.get()
+	if record == nil {
+		return errNoRecord
+	}
+	t.send(from, enrResponsePacket, &enrResponse{
+		ReplyTok: mac,
+		Record:   *record,
+	})
+	return nil
+}
+
+func (req *enrRequest) name() string { return "ENRREQUEST/v4" }
+
+func (req *enrResponse) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if !t.handleReply(fromID, enrResponsePacket, req) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
+
+func (req *enrResponse) name() string { return "ENRRESPONSE/v4" }
+
 func expired(ts uint64) bool {
 	return time.Unix(int64(ts), 0).Before(time.Now())
 }
@@ -36,6 +36,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/watchain/go-watchain/common"
 	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/p2p/enr"
 	"github.com/watchain/go-watchain/rlp"
 )
 
@@ -128,6 +129,7 @@ func TestUDP_packetErrors(t *testing.T) {
 	test.packetIn(errUnsolicitedReply, pongPacket, &pong{ReplyTok: []byte{}, Expiration: futureExp})
 	test.packetIn(errUnknownNode, findnodePacket, &findnode{Expiration: futureExp})
 	test.packetIn(errUnsolicitedReply, neighborsPacket, &neighbors{Expiration: futureExp})
+	test.packetIn(errUnknownNode, enrRequestPacket, &enrRequest{Expiration: futureExp})
 }
 
 func TestUDP_pingTimeout(t *testing.T) {
@@ -137,7 +139,7 @@ func TestUDP_pingTimeout(t *testing.T) {
 
 	toaddr := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 2222}
 	toid := NodeID{1, 2, 3, 4}
-	if err := test.udp.ping(toid, toaddr); err != errTimeout {
+	if _, err := test.udp.ping(toid, toaddr); err != errTimeout {
 		t.Error("expected timeout error, got", err)
 	}
 }
@@ -349,8 +351,8 @@ func TestUDP_successfulPing(t *testing.T) {
 
 	// remote is unknown, the table pings back.
 	hash, _ := test.waitPacketOut(func(p *ping) error {
-		if !reflect.DeepEqual(p.From, test.udp.ourEndpoint) {
-			t.Errorf("got ping.From %v, want %v", p.From, test.udp.ourEndpoint)
+		if !reflect.DeepEqual(p.From, test.udp.ourEndpoint()) {
+			t.Errorf("got ping.From %v, want %v", p.From, test.udp.ourEndpoint())
 		}
 		wantTo := rpcEndpoint{
 			// The mirrored UDP address is the UDP packet sender.
@@ -386,6 +388,76 @@ func TestUDP_successfulPing(t *testing.T) {
 	}
 }
 
+func TestUDP_enrRequest(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	// Bond with the remote side, requests are not answered otherwise.
+	test.table.db.updateBondTime(PubkeyID(&test.remotekey.PublicKey), time.Now())
+
+	test.packetIn(errExpired, enrRequestPacket, &enrRequest{})
+	test.packetIn(nil, enrRequestPacket, &enrRequest{Expiration: futureExp})
+	test.waitPacketOut(func(p *enrResponse) {
+		reqhash := test.sent[1][:macSize]
+		if !bytes.Equal(p.ReplyTok, reqhash) {
+			t.Errorf("got enrResponse.ReplyTok %x, want %x", p.ReplyTok, reqhash)
+		}
+		if err := checkRecord(test.table.self.ID, &p.Record); err != nil {
+			t.Errorf("invalid record: %v", err)
+		}
+		if p.Record.Seq() != test.table.LocalRecord().Seq() {
+			t.Errorf("got record seq %d, want %d", p.Record.Seq(), test.table.LocalRecord().Seq())
+		}
+		var udp enr.UDP
+		if err := p.Record.Load(&udp); err != nil || uint16(udp) != test.udp.ourEndpoint().UDP {
+			t.Errorf("got record UDP port %d (err %v), want %d", udp, err, test.udp.ourEndpoint().UDP)
+		}
+	})
+}
+
+func TestUDP_requestENR(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	remote := new(enr.Record)
+	remote.Set(enr.UDP(30303))
+	if err := remote.Sign(test.remotekey); err != nil {
+		t.Fatalf("can't sign record: %v", err)
+	}
+	forged := new(enr.Record)
+	if err := forged.Sign(newkey()); err != nil {
+		t.Fatalf("can't sign record: %v", err)
+	}
+	tests := []struct {
+		record  *enr.Record
+		wantErr error
+	}{
+		{record: remote},
+		{record: forged, wantErr: errRecordMismatch},
+	}
+	for i, tt := range tests {
+		type result struct {
+			record *enr.Record
+			err    error
+		}
+		resc := make(chan result, 1)
+		go func() {
+			record, err := test.udp.requestENR(PubkeyID(&test.remotekey.PublicKey), test.remoteaddr)
+			resc <- result{record, err}
+		}()
+		hash, _ := test.waitPacketOut(func(p *enrRequest) {})
+		test.packetIn(nil, enrResponsePacket, &enrResponse{ReplyTok: hash, Record: *tt.record})
+
+		res := <-resc
+		if res.err != tt.wantErr {
+			t.Errorf("test %d: error mismatch: got %v, want %v", i, res.err, tt.wantErr)
+		}
+		if tt.wantErr == nil && res.record.Seq() != tt.record.Seq() {
+			t.Errorf("test %d: got record seq %d, want %d", i, res.record.Seq(), tt.record.Seq())
+		}
+	}
+}
+
 var testPackets = []struct {
 	input      string
 	wantPacket interface{}
@@ -24,6 +24,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"net"
 	"os"
 	"sync"
 	"time"
@@ -64,6 +65,7 @@ var (
 	nodeDBDiscoverFindFails     = nodeDBDiscoverRoot + ":findfail"
 	nodeDBDiscoverLocalEndpoint = nodeDBDiscoverRoot + ":localendpoint"
 	nodeDBTopicRegTickets       = ":tickets"
+	nodeDBTopicTicket           = ":regticket"
 )
 
 // newNodeDB creates a new node database for storing and retrieving infos about
@@ -386,6 +388,51 @@ func (db *nodeDB) updateTopicRegTickets(id NodeID, issued, used uint32) error {
 	return db.lvl.Put(key, blob, nil)
 }
 
+// storedTicket is the database representation of a registration ticket
+// obtained from a remote node. Times are wall clock times in unix nanoseconds
+// because local monotonic time doesn't survive restarts.
+type storedTicket struct {
+	IP        net.IP
+	UDP, TCP  uint16
+	Topics    []Topic
+	RegTimes  []uint64
+	IssueTime uint64
+	Pong      []byte
+}
+
+// storedTickets retrieves all stored registration tickets, keyed by the
+// issuing node.
+func (db *nodeDB) storedTickets() map[NodeID]*storedTicket {
+	it := db.lvl.NewIterator(util.BytesPrefix(nodeDBItemPrefix), nil)
+	defer it.Release()
+
+	tickets := make(map[NodeID]*storedTicket)
+	for it.Next() {
+		id, field := splitKey(it.Key())
+		if field != nodeDBTopicTicket {
+			continue
+		}
+		var t storedTicket
+		if err := rlp.DecodeBytes(it.Value(), &t); err != nil {
+			log.Warn(fmt.Sprintf("invalid ticket %x: %v", id, err))
+			continue
+		}
+		tickets[id] = &t
+	}
+	return tickets
+}
+
+// updateTopicTicket stores the registration ticket issued by a remote node,
+// replacing the previous one.
+func (db *nodeDB) updateTopicTicket(id NodeID, t *storedTicket) error {
+	return db.storeRLP(makeKey(id, nodeDBTopicTicket), t)
+}
+
+// deleteTopicTicket removes the registration ticket issued by a remote node.
+func (db *nodeDB) deleteTopicTicket(id NodeID) error {
+	return db.lvl.Delete(makeKey(id, nodeDBTopicTicket), nil)
+}
+
 // reads the next node record from the iterator, skipping over other
 // database entries.
 func nextNode(it iterator.Iterator) *Node {
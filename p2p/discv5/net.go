@@ -151,7 +151,7 @@ func newNetwork(conn transport, ourPubkey ecdsa.PublicKey, dbPath string, netres
 		netrestrict:      netrestrict,
 		tab:              tab,
 		topictab:         newTopicTable(db, tab.self),
-		tickewatore:      newTickewatore(),
+		tickewatore:      newTickewatore(db),
 		refreshReq:       make(chan []*Node),
 		refreshResp:      make(chan (<-chan struct{})),
 		closed:           make(chan struct{}),
@@ -473,6 +473,7 @@ loop:
 				continue
 			}
 			net.tickewatore.addTopic(req.topic, true)
+			net.tickewatore.restoreTickets(req.topic, net.internNodeFromDB)
 			// If we're currently waiting idle (nothing to look up), give the ticket store a
 			// chance to start it sooner. This should speed up convergence of the radius
 			// determination for new topics.
@@ -539,6 +540,18 @@ loop:
 					net.tickewatore.addSearchTopic(req.topic, req.found)
 					topicSearch <- req.topic
 				}
+			} else if req.delay == time.Duration(0) {
+				// Stop requests are handled right away, the lookup channel
+				// of the search must not be used after SearchTopic returns.
+				delete(searchInfo, req.topic)
+				net.tickewatore.removeSearchTopic(req.topic)
+				pending := searchReqWhenRefreshDone[:0]
+				for _, r := range searchReqWhenRefreshDone {
+					if r.topic != req.topic {
+						pending = append(pending, r)
+					}
+				}
+				searchReqWhenRefreshDone = pending
 			} else {
 				searchReqWhenRefreshDone = append(searchReqWhenRefreshDone, req)
 			}
@@ -567,7 +580,7 @@ loop:
 			}
 			net.tickewatore.searchLookupDone(res.target, res.nodes, func(n *Node, topic Topic) []byte {
 				if n.state != nil && n.state.canQuery {
-					return net.conn.send(n, topicQueryPacket, topicQuery{Topic: topic}) // TODO: set expiration
+					return net.conn.send(n, topicQueryPacket, &topicQuery{Topic: topic}) // TODO: set expiration
 				} else {
 					if n.state == unknown {
 						net.ping(n, n.addr())
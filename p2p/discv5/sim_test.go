@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"runtime"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -131,6 +132,96 @@ func TestSimTopics(t *testing.T) {
 	//printNet.log.printLogs()
 }
 
+// In this test, nodes register a topic while nodes keep joining and leaving the
+// network. Topic searches must find nodes which registered the topic, among them
+// ones which are still alive.
+//
+// Topic registrations take minutes of waiting for tickets, so the simulation only
+// runs in playground time and is skipped by a plain go test without the NaCl SDK.
+func TestSimTopicChurn(t *testing.T) {
+	if _, err := getnacl(); err != nil && runtime.GOOS != "nacl" {
+		t.Skip("topic churn simulation requires the NaCl SDK for playground time:", err)
+	}
+	if runWithPlaygroundTime(t) {
+		return
+	}
+	var (
+		sim        = newSimulation()
+		bootnode   = sim.launchNode(false)
+		mu         sync.Mutex
+		registered = make(map[NodeID]bool) // nodes which registered the topic
+		churning   = make(map[NodeID]bool) // nodes which may leave
+	)
+	launch := func() *Network {
+		net := sim.launchNode(false)
+		if err := net.SetFallbackNodes([]*Node{bootnode.Self()}); err != nil {
+			panic(err)
+		}
+		return net
+	}
+	join := func() {
+		net := launch()
+		mu.Lock()
+		defer mu.Unlock()
+		churning[net.Self().ID] = true
+		if rand.Intn(4) == 0 {
+			registered[net.Self().ID] = true
+			go net.RegisterTopic(testTopic, nil)
+		}
+	}
+	for i := 0; i < 64; i++ {
+		join()
+		time.Sleep(time.Second)
+	}
+	searches := make([]*TopicSearch, 4)
+	for i := range searches {
+		searches[i] = launch().NewTopicSearch(testTopic)
+	}
+
+	// Every 10s, a random node leaves and a new one joins.
+	churn := time.NewTicker(10 * time.Second)
+	go func() {
+		for range churn.C {
+			mu.Lock()
+			var leaving NodeID
+			for id := range churning {
+				leaving = id
+				break
+			}
+			delete(churning, leaving)
+			mu.Unlock()
+
+			sim.dropNode(leaving)
+			join()
+		}
+	}()
+
+	time.Sleep(30 * time.Minute)
+	churn.Stop()
+
+	mu.Lock()
+	sim.mu.RLock()
+	for i, search := range searches {
+		buf := make([]*Node, 64)
+		n := search.ReadRandomNodes(buf)
+		alive := 0
+		for _, node := range buf[:n] {
+			if !registered[node.ID] {
+				t.Errorf("search %d found node %x which didn't register the topic", i, node.ID[:8])
+			}
+			if sim.nodes[node.ID] != nil {
+				alive++
+			}
+		}
+		if alive == 0 {
+			t.Errorf("search %d found no live nodes (%d found)", i, n)
+		}
+	}
+	sim.mu.RUnlock()
+	mu.Unlock()
+	sim.shutdown()
+}
+
 /*func testHierarchicalTopics(i int) []Topic {
 	digits := strconv.FormatInt(int64(256+i/4), 4)
 	res := make([]Topic, 5)
@@ -448,6 +539,9 @@ func (st *simTransport) sendPacket(remote NodeID, p ingressPacket) {
 		st.sim.mu.RLock()
 		recipient := st.sim.nodes[remote]
 		st.sim.mu.RUnlock()
+		if recipient == nil {
+			return // node has left the simulation
+		}
 
 		time.AfterFunc(200*time.Millisecond, func() {
 			recipient.reqReadPacket(p)
@@ -144,6 +144,8 @@ type tickewatore struct {
 	searchTopicMap        map[Topic]searchTopic
 	nextTopicQueryCleanup mclock.AbsTime
 	queriesSent           map[*Node]map[common.Hash]sentQuery
+
+	db *nodeDB // keeps collected tickets across restarts (nil = not persisted)
 }
 
 type searchTopic struct {
@@ -161,8 +163,9 @@ type topicTickets struct {
 	nextReg    mclock.AbsTime
 }
 
-func newTickewatore() *tickewatore {
+func newTickewatore(db *nodeDB) *tickewatore {
 	return &tickewatore{
+		db:             db,
 		radius:         make(map[Topic]*topicRadius),
 		tickets:        make(map[Topic]*topicTickets),
 		regSet:         make(map[Topic]struct{}),
@@ -452,6 +455,9 @@ func (s *tickewatore) removeTicketRef(ref ticketRef) {
 	if ref.t.refCnt == 0 {
 		delete(s.nodes, ref.t.node)
 		delete(s.nodeLastReq, ref.t.node)
+		if s.db != nil {
+			s.db.deleteTopicTicket(ref.t.node.ID)
+		}
 	}
 }
 
@@ -562,9 +568,108 @@ func (s *tickewatore) addTicket(localTime mclock.AbsTime, pingHash []byte, ticke
 	if ticket.refCnt > 0 {
 		s.nextTicketCached = nil
 		s.nodes[ticket.node] = ticket
+		s.storeTicket(ticket)
+	}
+}
+
+// storeTicket saves a ticket in the database so it can still be used for
+// registration if the node is restarted before its registration time.
+func (s *tickewatore) storeTicket(t *ticket) {
+	if s.db == nil {
+		return
+	}
+	st := &storedTicket{
+		IP:        t.node.IP,
+		UDP:       t.node.UDP,
+		TCP:       t.node.TCP,
+		Topics:    t.topics,
+		RegTimes:  make([]uint64, len(t.regTime)),
+		IssueTime: uint64(wallTime(t.issueTime).UnixNano()),
+		Pong:      t.pong,
+	}
+	for i, regTime := range t.regTime {
+		st.RegTimes[i] = uint64(wallTime(regTime).UnixNano())
+	}
+	if err := s.db.updateTopicTicket(t.node.ID, st); err != nil {
+		log.Debug("Failed to store discovery ticket", "node", t.node.ID, "err", err)
+	}
+}
+
+// restoreTickets adds the stored tickets which can still be used to register
+// the topic. Tickets which have expired for all their topics are deleted. The
+// intern function returns the canonical instance of the issuing node.
+func (s *tickewatore) restoreTickets(topic Topic, intern func(*Node) *Node) {
+	if s.db == nil || s.tickets[topic] == nil {
+		return
+	}
+	now := mclock.Now()
+	for id, st := range s.db.storedTickets() {
+		if len(st.RegTimes) != len(st.Topics) {
+			s.db.deleteTopicTicket(id)
+			continue
+		}
+		t := &ticket{
+			topics:    st.Topics,
+			regTime:   make([]mclock.AbsTime, len(st.RegTimes)),
+			issueTime: localTime(time.Unix(0, int64(st.IssueTime))),
+			pong:      st.Pong,
+		}
+		usable := false
+		for i, regTime := range st.RegTimes {
+			t.regTime[i] = localTime(time.Unix(0, int64(regTime)))
+			if t.regTime[i] > now-regTimeWindow*mclock.AbsTime(time.Second) {
+				usable = true
+			}
+		}
+		if !usable {
+			s.db.deleteTopicTicket(id)
+			continue
+		}
+		idx := t.findIdx(topic)
+		if idx == -1 || t.regTime[idx] <= now-regTimeWindow*mclock.AbsTime(time.Second) {
+			continue
+		}
+		t.node = intern(NewNode(id, st.IP, st.UDP, st.TCP))
+		if cur := s.nodes[t.node]; cur != nil {
+			// A ticket of the node is already held. It's the same ticket if
+			// it was restored for another topic, otherwise it's more recent.
+			if !bytes.Equal(cur.pong, t.pong) || s.hasTicketRef(cur, idx) {
+				continue
+			}
+			t = cur
+		}
+		bucket := timeBucket(t.regTime[idx] / mclock.AbsTime(ticketTimeBucketLen))
+		if s.lastBucketFetched == 0 || bucket < s.lastBucketFetched {
+			s.lastBucketFetched = bucket
+		}
+		log.Trace("Restoring discovery ticket", "node", id, "topic", topic)
+		s.addTicketRef(ticketRef{t, idx})
+		s.nextTicketCached = nil
+		s.nodes[t.node] = t
 	}
 }
 
+// hasTicketRef reports whwater the ticket is queued for the topic at idx.
+func (s *tickewatore) hasTicketRef(t *ticket, idx int) bool {
+	bucket := timeBucket(t.regTime[idx] / mclock.AbsTime(ticketTimeBucketLen))
+	for _, ref := range s.tickets[t.topics[idx]].buckets[bucket] {
+		if ref.t == t && ref.idx == idx {
+			return true
+		}
+	}
+	return false
+}
+
+// wallTime converts local monotonic time to wall clock time.
+func wallTime(t mclock.AbsTime) time.Time {
+	return time.Now().Add(time.Duration(t - mclock.Now()))
+}
+
+// localTime converts wall clock time to local monotonic time.
+func localTime(t time.Time) mclock.AbsTime {
+	return mclock.Now() + mclock.AbsTime(time.Until(t))
+}
+
 func (s *tickewatore) getNodeTicket(node *Node) *ticket {
 	if s.nodes[node] == nil {
 		log.Trace("Retrieving node ticket", "node", node.ID, "serial", nil)
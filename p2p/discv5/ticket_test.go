@@ -0,0 +1,97 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discv5
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/common/mclock"
+)
+
+func TestTicketRestore(t *testing.T) {
+	db, _ := newNodeDB("", Version, NodeID{})
+	defer db.close()
+
+	now := mclock.Now()
+	valid := &ticket{
+		topics:    []Topic{"foo", "bar"},
+		regTime:   []mclock.AbsTime{now + mclock.AbsTime(time.Minute), now + mclock.AbsTime(2*time.Minute)},
+		issueTime: now,
+		node:      NewNode(NodeID{1}, net.IP{10, 0, 0, 1}, 30303, 30303),
+		pong:      []byte{1},
+	}
+	expired := &ticket{
+		topics:    []Topic{"foo"},
+		regTime:   []mclock.AbsTime{now - mclock.AbsTime(time.Minute)},
+		issueTime: now - mclock.AbsTime(2*time.Minute),
+		node:      NewNode(NodeID{2}, net.IP{10, 0, 0, 2}, 30303, 30303),
+		pong:      []byte{2},
+	}
+	store := newTickewatore(db)
+	store.storeTicket(valid)
+	store.storeTicket(expired)
+
+	// Load the tickets into a new store, as after a restart.
+	nodes := make(map[NodeID]*Node)
+	intern := func(n *Node) *Node {
+		if nodes[n.ID] == nil {
+			nodes[n.ID] = n
+		}
+		return nodes[n.ID]
+	}
+	store = newTickewatore(db)
+	store.addTopic("foo", true)
+	store.restoreTickets("foo", intern)
+	store.addTopic("bar", true)
+	store.restoreTickets("bar", intern)
+	store.restoreTickets("bar", intern)
+
+	if len(store.nodes) != 1 {
+		t.Fatalf("wrong number of restored tickets: %d", len(store.nodes))
+	}
+	restored := store.nodes[nodes[valid.node.ID]]
+	if restored == nil {
+		t.Fatal("valid ticket not restored")
+	}
+	if restored.refCnt != 2 {
+		t.Errorf("wrong ticket reference count: %d", restored.refCnt)
+	}
+	if !bytes.Equal(restored.pong, valid.pong) {
+		t.Errorf("wrong pong: %x", restored.pong)
+	}
+	for i := range valid.regTime {
+		if d := time.Duration(restored.regTime[i] - valid.regTime[i]); d < -time.Second || d > time.Second {
+			t.Errorf("registration time %d off by %v", i, d)
+		}
+	}
+	if ref, _ := store.nextRegisterableTicket(); ref == nil || ref.t != restored || ref.idx != 0 {
+		t.Errorf("restored ticket not used for registration: %v", ref)
+	}
+	if stored := db.storedTickets(); len(stored) != 1 || stored[valid.node.ID] == nil {
+		t.Errorf("expired ticket not deleted from database")
+	}
+
+	// Using the ticket for all topics deletes it.
+	store.ticketRegistered(ticketRef{restored, 0})
+	store.ticketRegistered(ticketRef{restored, 1})
+	if stored := db.storedTickets(); len(stored) != 0 {
+		t.Errorf("used ticket not deleted from database")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discv5
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/watchain/go-watchain/common/mclock"
+)
+
+const (
+	// The search looks up the topic quickly until the topic radius has
+	// converged for topicSearchFastLookups lookups or topicSearchFastTime,
+	// then slows down.
+	topicSearchFastPeriod  = 100 * time.Millisecond
+	topicSearchSlowPeriod  = time.Minute
+	topicSearchFastLookups = 50
+	topicSearchFastTime    = time.Minute
+
+	topicSearchMaxNodes = 200              // number of found nodes kept
+	topicSearchNodeTTL  = 30 * time.Minute // time after which found nodes are dropped
+)
+
+// TopicSearch continuously searches for nodes advertising a topic and keeps
+// the ones recently found.
+type TopicSearch struct {
+	net       *Network
+	topic     Topic
+	found     chan *Node
+	lookup    chan bool
+	setPeriod chan time.Duration
+	quit      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	mu    sync.Mutex
+	nodes []foundNode // ordered by time found
+}
+
+type foundNode struct {
+	node *Node
+	time mclock.AbsTime
+}
+
+// NewTopicSearch starts searching for nodes advertising the topic. The search
+// runs until Close is called or the network is closed.
+func (net *Network) NewTopicSearch(topic Topic) *TopicSearch {
+	s := &TopicSearch{
+		net:       net,
+		topic:     topic,
+		found:     make(chan *Node, 100),
+		lookup:    make(chan bool, 100),
+		setPeriod: make(chan time.Duration, 1),
+		quit:      make(chan struct{}),
+	}
+	s.setPeriod <- topicSearchFastPeriod
+	s.wg.Add(1)
+	go s.loop()
+	return s
+}
+
+func (s *TopicSearch) loop() {
+	defer s.wg.Done()
+
+	searchDone := make(chan struct{})
+	go func() {
+		s.net.SearchTopic(s.topic, s.setPeriod, s.found, s.lookup)
+		close(searchDone)
+	}()
+
+	var (
+		fast      = true
+		converged int
+		convTime  mclock.AbsTime
+		quit      = s.quit
+		stopping  bool
+	)
+	for {
+		select {
+		case n := <-s.found:
+			s.add(n, mclock.Now())
+		case conv := <-s.lookup:
+			if stopping || !conv || !fast {
+				continue
+			}
+			if converged == 0 {
+				convTime = mclock.Now()
+			}
+			converged++
+			if converged == topicSearchFastLookups || time.Duration(mclock.Now()-convTime) > topicSearchFastTime {
+				fast = false
+				s.setPeriod <- topicSearchSlowPeriod
+			}
+		case <-quit:
+			// Stop the search, but keep draining the channels until the
+			// network has acknowledged it.
+			close(s.setPeriod)
+			quit, stopping = nil, true
+		case <-searchDone:
+			return
+		}
+	}
+}
+
+// add inserts or refreshes a found node.
+func (s *TopicSearch) add(n *Node, now mclock.AbsTime) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.nodes {
+		if f.node.ID == n.ID {
+			s.nodes = append(s.nodes[:i], s.nodes[i+1:]...)
+			break
+		}
+	}
+	if len(s.nodes) >= topicSearchMaxNodes {
+		s.nodes = s.nodes[:copy(s.nodes, s.nodes[1:])]
+	}
+	s.nodes = append(s.nodes, foundNode{node: n, time: now})
+}
+
+// ReadRandomNodes fills the given slice with random nodes recently found by
+// the search. It returns the number of nodes written.
+func (s *TopicSearch) ReadRandomNodes(buf []*Node) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(mclock.Now())
+	n := 0
+	for _, i := range rand.Perm(len(s.nodes)) {
+		if n == len(buf) {
+			break
+		}
+		buf[n] = s.nodes[i].node
+		n++
+	}
+	return n
+}
+
+// Len returns the number of nodes recently found.
+func (s *TopicSearch) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(mclock.Now())
+	return len(s.nodes)
+}
+
+// expire drops the nodes which were found too long ago.
+func (s *TopicSearch) expire(now mclock.AbsTime) {
+	i := 0
+	for ; i < len(s.nodes); i++ {
+		if time.Duration(now-s.nodes[i].time) < topicSearchNodeTTL {
+			break
+		}
+	}
+	s.nodes = s.nodes[:copy(s.nodes, s.nodes[i:])]
+}
+
+// Close stops the search.
+func (s *TopicSearch) Close() {
+	s.closeOnce.Do(func() { close(s.quit) })
+	s.wg.Wait()
+}
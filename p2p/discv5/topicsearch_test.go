@@ -0,0 +1,61 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discv5
+
+import (
+	"testing"
+
+	"github.com/watchain/go-watchain/common/mclock"
+)
+
+func TestTopicSearchNodes(t *testing.T) {
+	var (
+		s   = new(TopicSearch)
+		now = mclock.Now()
+		old = now - mclock.AbsTime(topicSearchNodeTTL) - 1
+	)
+	s.add(&Node{ID: NodeID{1}}, old)
+	s.add(&Node{ID: NodeID{2}}, old)
+	s.add(&Node{ID: NodeID{2}}, now) // found again
+	for i := 0; i < topicSearchMaxNodes-1; i++ {
+		s.add(&Node{ID: NodeID{3, byte(i)}}, now)
+	}
+	// The oldest node was dropped to stay within the limit.
+	if len(s.nodes) != topicSearchMaxNodes {
+		t.Fatalf("wrong number of nodes: %d", len(s.nodes))
+	}
+	if s.nodes[0].node.ID != (NodeID{2}) {
+		t.Errorf("refreshed node dropped")
+	}
+
+	s = new(TopicSearch)
+	s.add(&Node{ID: NodeID{1}}, old)
+	s.add(&Node{ID: NodeID{2}}, now)
+	s.add(&Node{ID: NodeID{3}}, now)
+	buf := make([]*Node, 5)
+	if n := s.ReadRandomNodes(buf); n != 2 {
+		t.Fatalf("wrong number of nodes read: %d", n)
+	}
+	for _, n := range buf[:2] {
+		if n.ID == (NodeID{1}) {
+			t.Errorf("expired node read")
+		}
+	}
+	if n := s.ReadRandomNodes(buf[:1]); n != 1 {
+		t.Errorf("wrong number of nodes read into short buffer: %d", n)
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"context"
+	"fmt"
+	mrand "math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/enr"
+)
+
+// Resolver is a DNS resolver that can query TXT records.
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+// Config holds the settings of a Client.
+type Config struct {
+	Timeout         time.Duration // timeout used for DNS lookups (default 5s)
+	RecheckInterval time.Duration // time between tree root update checks (default 30min)
+	CacheLimit      int           // maximum number of cached entries (default 1000)
+	Resolver        Resolver      // the DNS resolver to use (defaults to system DNS)
+	Logger          log.Logger    // destination of client log messages (defaults to root logger)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.RecheckInterval == 0 {
+		cfg.RecheckInterval = 30 * time.Minute
+	}
+	if cfg.CacheLimit == 0 {
+		cfg.CacheLimit = 1000
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = new(net.Resolver)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Root()
+	}
+	return cfg
+}
+
+// Client discovers nodes by querying DNS servers. Once started, it periodically
+// synchronizes the configured trees and all trees linked from them, providing
+// the contained nodes as dial candidates.
+type Client struct {
+	cfg     Config
+	entries *lru.Cache // entries of all trees, keyed by their hashes
+
+	mu    sync.Mutex
+	trees map[string]*clientTree // synchronized trees, keyed by their domains
+	nodes []*discover.Node       // nodes contained in all trees
+	rand  *mrand.Rand
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewClient creates a client synchronizing the trees at the given URLs.
+func NewClient(cfg Config, urls ...string) (*Client, error) {
+	cfg = cfg.withDefaults()
+	cache, err := lru.New(cfg.CacheLimit)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		cfg:     cfg,
+		entries: cache,
+		trees:   make(map[string]*clientTree),
+		rand:    mrand.New(mrand.NewSource(time.Now().UnixNano())),
+		closing: make(chan struct{}),
+	}
+	for _, url := range urls {
+		loc, err := parseLink(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enrtree URL %q: %v", url, err)
+		}
+		c.trees[loc.domain] = newClientTree(c, loc)
+	}
+	return c, nil
+}
+
+// Start launches the background synchronization of the trees.
+func (c *Client) Start() {
+	c.wg.Add(1)
+	go c.loop()
+}
+
+// Stop terminates the background synchronization.
+func (c *Client) Stop() {
+	close(c.closing)
+	c.wg.Wait()
+}
+
+// SyncTree downloads the complete tree at the given URL, verifying its signature.
+func (c *Client) SyncTree(url string) (*Tree, error) {
+	loc, err := parseLink(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrtree URL: %v", err)
+	}
+	ct := newClientTree(c, loc)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := ct.sync(ctx); err != nil {
+		return nil, err
+	}
+	t := &Tree{root: ct.root, entries: ct.entries}
+	return t, nil
+}
+
+// ReadRandomNodes fills the given slice with random nodes from the synchronized
+// trees. The nodes in the slice are copies and can be modified by the caller.
+func (c *Client) ReadRandomNodes(buf []*discover.Node) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, i := range c.rand.Perm(len(c.nodes)) {
+		if n == len(buf) {
+			break
+		}
+		cpy := *c.nodes[i]
+		buf[n] = &cpy
+		n++
+	}
+	return n
+}
+
+// loop periodically synchronizes all trees.
+func (c *Client) loop() {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-c.closing
+		cancel()
+	}()
+	for {
+		c.syncAll(ctx)
+
+		select {
+		case <-time.After(c.cfg.RecheckInterval):
+		case <-c.closing:
+			return
+		}
+	}
+}
+
+// syncAll synchronizes all known trees, following the links between them, and
+// updates the set of dial candidates.
+func (c *Client) syncAll(ctx context.Context) {
+	synced := make(map[string]bool)
+	for {
+		// Pick the next tree, new ones may be discovered via links
+		c.mu.Lock()
+		var next *clientTree
+		for domain, ct := range c.trees {
+			if !synced[domain] {
+				next = ct
+				break
+			}
+		}
+		c.mu.Unlock()
+		if next == nil {
+			break
+		}
+		synced[next.loc.domain] = true
+		if err := next.sync(ctx); err != nil {
+			c.cfg.Logger.Debug("DNS discovery sync failed", "tree", next.loc.domain, "err", err)
+		}
+		c.mu.Lock()
+		for _, link := range next.links {
+			if _, ok := c.trees[link.domain]; !ok {
+				c.trees[link.domain] = newClientTree(c, link)
+			}
+		}
+		c.mu.Unlock()
+	}
+	// Collect the nodes of all trees
+	var nodes []*discover.Node
+	seen := make(map[discover.NodeID]bool)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ct := range c.trees {
+		for _, r := range ct.records() {
+			n, err := discover.NodeFromRecord(r)
+			if err != nil {
+				c.cfg.Logger.Trace("Skipping invalid DNS discovery record", "tree", ct.loc.domain, "err", err)
+				continue
+			}
+			if !seen[n.ID] {
+				seen[n.ID] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	c.nodes = nodes
+	c.cfg.Logger.Debug("DNS discovery trees synced", "trees", len(c.trees), "nodes", len(nodes))
+}
+
+// resolveRoot retrieves and verifies the root entry of a tree.
+func (c *Client) resolveRoot(ctx context.Context, loc *linkEntry) (rootEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, loc.domain)
+	if err != nil {
+		return rootEntry{}, err
+	}
+	for _, txt := range txts {
+		if strings.HasPrefix(txt, rootPrefix) {
+			e, err := parseRoot(txt)
+			if err != nil {
+				return e, err
+			}
+			if !e.verifySignature(loc.pubkey) {
+				return e, entryError{"root", errInvalidSig}
+			}
+			return e, nil
+		}
+	}
+	return rootEntry{}, nameError{loc.domain, errNoRoot}
+}
+
+// resolveEntry retrieves an entry of a tree, from the cache if possible. Cached
+// entries are checked to be valid in the requested subtree, the same as fresh
+// ones are during parsing.
+func (c *Client) resolveEntry(ctx context.Context, domain, hash string, links bool) (entry, error) {
+	name := hash + "." + domain
+	if e, ok := c.entries.Get(hash); ok {
+		if err := checkEntryType(e.(entry), links); err != nil {
+			return nil, nameError{name, err}
+		}
+		return e.(entry), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		e, err := parseEntry(txt, links)
+		if err == errUnknownEntry {
+			continue
+		}
+		if err != nil {
+			return nil, nameError{name, err}
+		}
+		if subdomain(e) != hash {
+			return nil, nameError{name, errHashMismatch}
+		}
+		c.entries.Add(hash, e)
+		return e, nil
+	}
+	return nil, nameError{name, errNoEntry}
+}
+
+// clientTree is the synchronization state of a single tree.
+type clientTree struct {
+	c   *Client
+	loc *linkEntry
+
+	root    *rootEntry
+	entries map[string]entry // entries of the last synced version, keyed by hash
+	links   []*linkEntry     // links of the last synced version
+}
+
+func newClientTree(c *Client, loc *linkEntry) *clientTree {
+	return &clientTree{c: c, loc: loc}
+}
+
+// sync updates the tree if the root changed. Only the entries missing from the
+// client cache are downloaded.
+func (ct *clientTree) sync(ctx context.Context) error {
+	root, err := ct.c.resolveRoot(ctx, ct.loc)
+	if err != nil {
+		return err
+	}
+	if ct.root != nil && ct.root.seq == root.seq && ct.root.eroot == root.eroot && ct.root.lroot == root.lroot {
+		return nil // tree unchanged
+	}
+	if ct.root != nil && root.seq < ct.root.seq {
+		return nameError{ct.loc.domain, errOldRoot}
+	}
+	// Sync the subtrees separately, so links are only taken from the link subtree
+	enrs, linked := make(map[string]entry), make(map[string]entry)
+	if err := ct.syncSubtree(ctx, root.eroot, false, enrs); err != nil {
+		return err
+	}
+	if err := ct.syncSubtree(ctx, root.lroot, true, linked); err != nil {
+		return err
+	}
+	entries := make(map[string]entry, len(enrs)+len(linked))
+	for hash, e := range enrs {
+		entries[hash] = e
+	}
+	var links []*linkEntry
+	for hash, e := range linked {
+		entries[hash] = e
+		if le, ok := e.(*linkEntry); ok {
+			links = append(links, le)
+		}
+	}
+	ct.root, ct.entries, ct.links = &root, entries, links
+	return nil
+}
+
+// syncSubtree downloads the entries reachable from the given hash.
+func (ct *clientTree) syncSubtree(ctx context.Context, hash string, links bool, entries map[string]entry) error {
+	if _, ok := entries[hash]; ok {
+		return nil
+	}
+	e, err := ct.c.resolveEntry(ctx, ct.loc.domain, hash, links)
+	if err != nil {
+		return err
+	}
+	entries[hash] = e
+	if branch, ok := e.(*branchEntry); ok {
+		for _, child := range branch.children {
+			if err := ct.syncSubtree(ctx, child, links, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// records returns the node records of the last synced version of the tree.
+func (ct *clientTree) records() []*enr.Record {
+	var records []*enr.Record
+	for _, e := range ct.entries {
+		if ee, ok := e.(*enrEntry); ok {
+			records = append(records, ee.node)
+		}
+	}
+	return records
+}
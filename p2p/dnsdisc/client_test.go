@@ -0,0 +1,220 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/enr"
+)
+
+// mapResolver is an in-memory DNS zone.
+type mapResolver map[string]string
+
+func (mr mapResolver) add(m map[string]string) {
+	for k, v := range m {
+		mr[k] = v
+	}
+}
+
+func (mr mapResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if record, ok := mr[name]; ok {
+		return []string{record}, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// testNodes creates signed records of n nodes with distinct keys and addresses.
+func testNodes(t *testing.T, n int) []*enr.Record {
+	records := make([]*enr.Record, n)
+	for i := range records {
+		key, _ := crypto.GenerateKey()
+		r := new(enr.Record)
+		r.Set(enr.IP4(net.IP{127, 0, byte(i >> 8), byte(i)}))
+		r.Set(enr.TCP(30303))
+		r.Set(enr.UDP(30303))
+		if err := r.Sign(key); err != nil {
+			t.Fatalf("failed to sign record: %v", err)
+		}
+		records[i] = r
+	}
+	return records
+}
+
+// publish signs a tree and adds its records to the zone, returning its URL.
+func publish(t *testing.T, zone mapResolver, tree *Tree, key *ecdsa.PrivateKey, domain string) string {
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		t.Fatalf("failed to sign tree: %v", err)
+	}
+	zone.add(tree.ToTXT(domain))
+	return url
+}
+
+func nodeIDs(records []*enr.Record) []string {
+	var ids []string
+	for _, r := range records {
+		n, err := discover.NodeFromRecord(r)
+		if err != nil {
+			panic(err)
+		}
+		ids = append(ids, n.ID.String())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Tests that a complete tree can be downloaded and verified.
+func TestClientSyncTree(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	nodes := testNodes(t, 40)
+	tree, _ := MakeTree(1, nodes, []string{"enrtree://AM5FCQLWIZX2QFPNJAP7VUERCCRNGRHWZG3YYHIUV7BVDQ5FDPRT2@morenodes.example.org"})
+
+	zone := make(mapResolver)
+	url := publish(t, zone, tree, key, "n.example.org")
+
+	c, _ := NewClient(Config{Resolver: zone})
+	synced, err := c.SyncTree(url)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if !reflect.DeepEqual(nodeIDs(synced.Nodes()), nodeIDs(nodes)) {
+		t.Errorf("synced nodes mismatch")
+	}
+	if !reflect.DeepEqual(synced.Links(), tree.Links()) {
+		t.Errorf("synced links mismatch: have %v, want %v", synced.Links(), tree.Links())
+	}
+	if synced.Seq() != 1 {
+		t.Errorf("synced seq mismatch: have %d, want 1", synced.Seq())
+	}
+	// A tree signed by a different key must be rejected
+	other, _ := crypto.GenerateKey()
+	forged := (&linkEntry{domain: "n.example.org", pubkey: &other.PublicKey}).String()
+	if _, err := c.SyncTree(forged); err == nil {
+		t.Errorf("tree with invalid signature accepted")
+	}
+}
+
+// Tests that entries whose content doesn't match their name are rejected.
+func TestClientSyncTreeBadEntry(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	tree, _ := MakeTree(1, testNodes(t, 3), nil)
+
+	zone := make(mapResolver)
+	url := publish(t, zone, tree, key, "n.example.org")
+
+	// Swap the content of two node records
+	var names []string
+	for name, txt := range zone {
+		if len(txt) > len(enrPrefix) && txt[:len(enrPrefix)] == enrPrefix {
+			names = append(names, name)
+		}
+	}
+	zone[names[0]], zone[names[1]] = zone[names[1]], zone[names[0]]
+
+	c, _ := NewClient(Config{Resolver: zone, CacheLimit: 10})
+	_, err := c.SyncTree(url)
+	if nerr, ok := err.(nameError); !ok || nerr.err != errHashMismatch {
+		t.Errorf("error mismatch: have %v, want %v", err, errHashMismatch)
+	}
+}
+
+// Tests that cached entries are only accepted in the subtree type they belong to,
+// so a link can't be smuggled into the ENR subtree of another tree and the other
+// way around.
+func TestClientSyncTreeCachedEntryType(t *testing.T) {
+	var (
+		key1, _ = crypto.GenerateKey()
+		key2, _ = crypto.GenerateKey()
+		nodes   = testNodes(t, 3)
+		zone    = make(mapResolver)
+		link    = "enrtree://AM5FCQLWIZX2QFPNJAP7VUERCCRNGRHWZG3YYHIUV7BVDQ5FDPRT2@morenodes.example.org"
+	)
+	tree1, _ := MakeTree(1, nodes, []string{link})
+	url1 := publish(t, zone, tree1, key1, "a.example.org")
+
+	c, _ := NewClient(Config{Resolver: zone})
+	if _, err := c.SyncTree(url1); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	// Publish a tree with the subtrees swapped, all of its entries are cached
+	tree2, _ := MakeTree(1, nodes, []string{link})
+	tree2.root.eroot, tree2.root.lroot = tree2.root.lroot, tree2.root.eroot
+	url2 := publish(t, zone, tree2, key2, "b.example.org")
+
+	_, err := c.SyncTree(url2)
+	if nerr, ok := err.(nameError); !ok || nerr.err != errLinkInENRTree {
+		t.Errorf("error mismatch: have %v, want %v", err, errLinkInENRTree)
+	}
+}
+
+// Tests that the client follows links between trees, only downloads changed
+// entries on updates and provides the nodes of all trees as dial candidates.
+func TestClientSyncAll(t *testing.T) {
+	var (
+		key1, _ = crypto.GenerateKey()
+		key2, _ = crypto.GenerateKey()
+		nodes   = testNodes(t, 20)
+		zone    = make(mapResolver)
+	)
+	tree2, _ := MakeTree(1, nodes[10:], nil)
+	url2 := publish(t, zone, tree2, key2, "b.example.org")
+	tree1, _ := MakeTree(1, nodes[:10], []string{url2})
+	url1 := publish(t, zone, tree1, key1, "a.example.org")
+
+	counting := &countingResolver{r: zone}
+	c, _ := NewClient(Config{Resolver: counting}, url1)
+	c.syncAll(context.Background())
+
+	buf := make([]*discover.Node, 30)
+	if n := c.ReadRandomNodes(buf); n != len(nodes) {
+		t.Fatalf("dial candidate count mismatch: have %d, want %d", n, len(nodes))
+	}
+	// Update the first tree with one more node, only the changes are fetched
+	nodes = append(nodes, testNodes(t, 1)...)
+	tree1, _ = MakeTree(2, append(nodes[:10:10], nodes[20]), []string{url2})
+	publish(t, zone, tree1, key1, "a.example.org")
+
+	counting.queries = 0
+	c.syncAll(context.Background())
+	if n := c.ReadRandomNodes(buf); n != len(nodes) {
+		t.Fatalf("dial candidate count mismatch after update: have %d, want %d", n, len(nodes))
+	}
+	// Two roots, the new branch and the new record
+	if counting.queries != 4 {
+		t.Errorf("query count mismatch: have %d, want 4", counting.queries)
+	}
+}
+
+// countingResolver counts the queries made to a resolver.
+type countingResolver struct {
+	r       Resolver
+	queries int
+}
+
+func (cr *countingResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	cr.queries++
+	return cr.r.LookupTXT(ctx, name)
+}
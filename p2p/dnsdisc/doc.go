@@ -0,0 +1,34 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnsdisc implements node discovery via DNS.
+//
+// A list of node records is published as a Merkle tree in DNS TXT records. The
+// root of the tree lives at the apex of a domain and is signed by the publisher,
+// all other entries are stored at subdomains named after the hash of their
+// content:
+//
+//	enrtree-root:v1 e=<enr-root> l=<link-root> seq=<sequence-number> sig=<signature>
+//	enrtree-branch:<h1>,<h2>,...,<hN>
+//	enr:<node-record>
+//	enrtree://<key>@<fqdn>
+//
+// The node records are reachable from the enr-root hash, links to the trees of
+// other publishers from the link-root hash. Trees are referenced by URLs of the
+// form enrtree://<key>@<fqdn>, where key is the base32 encoded compressed public
+// key of the publisher. Clients only download the entries which changed since
+// the last synchronization of a tree.
+package dnsdisc
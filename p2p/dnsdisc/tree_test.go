@@ -0,0 +1,89 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/watchain/go-watchain/crypto"
+)
+
+// Tests that the entries of a tree can be parsed back from their text format.
+func TestParseEntries(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	tree, err := MakeTree(3, testNodes(t, 30), []string{"enrtree://AM5FCQLWIZX2QFPNJAP7VUERCCRNGRHWZG3YYHIUV7BVDQ5FDPRT2@morenodes.example.org"})
+	if err != nil {
+		t.Fatalf("failed to make tree: %v", err)
+	}
+	if _, err := tree.Sign(key, "n"); err != nil {
+		t.Fatalf("failed to sign tree: %v", err)
+	}
+	for name, txt := range tree.ToTXT("") {
+		if name == "" {
+			root, err := parseRoot(txt)
+			if err != nil {
+				t.Fatalf("failed to parse root: %v", err)
+			}
+			if !root.verifySignature(&key.PublicKey) {
+				t.Errorf("root signature invalid")
+			}
+			if !reflect.DeepEqual(&root, tree.root) {
+				t.Errorf("root mismatch: have %v, want %v", root, tree.root)
+			}
+			continue
+		}
+		e, err := parseEntry(txt, txt[:len(linkPrefix)] == linkPrefix)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", txt, err)
+		}
+		if subdomain(e) != name || e.String() != txt {
+			t.Errorf("entry %s changed by parsing", name)
+		}
+	}
+	// The signature can be transferred to an identical tree
+	cpy, _ := MakeTree(3, tree.Nodes(), tree.Links())
+	if err := cpy.SetSignature(&key.PublicKey, tree.Signature()); err != nil {
+		t.Errorf("failed to set signature: %v", err)
+	}
+	other, _ := crypto.GenerateKey()
+	if err := cpy.SetSignature(&other.PublicKey, tree.Signature()); err != errInvalidSig {
+		t.Errorf("signature of other key accepted: %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		links bool
+		err   error
+	}{
+		{input: "enrtree-branch:AAAA", err: entryError{"branch", errInvalidChild}},
+		{input: "enrtree-branch:2XS2367YHAXJFGLZHVAWLQD4ZY,x", err: entryError{"branch", errInvalidChild}},
+		{input: "enr:-----", err: entryError{"enr", errInvalidENR}},
+		{input: "enrtree://@n", links: true, err: entryError{"link", errBadPubkey}},
+		{input: "enrtree://nokey", links: true, err: entryError{"link", errNoPubkey}},
+		{input: "enrtree://AM5FCQLWIZX2QFPNJAP7VUERCCRNGRHWZG3YYHIUV7BVDQ5FDPRT2@n", err: errLinkInENRTree},
+		{input: "enr:-HW4QES8QIeXTYlDzbfr1WEzE-XKY4f8gJFJzjJL-9D7TC9lJb4Z3JPRRz1lP4pL_N_QpT6rGQjAU9Apnc-C1iMP36OAgmlkgnY0iXNlY3AyNTZrMaED5IdwfMxdmR8W37HqSFdQLjDkIwBd4Q_MjxgZifgKSdM", links: true, err: errENRInLinkTree},
+		{input: "foo", err: errUnknownEntry},
+	}
+	for i, test := range tests {
+		if _, err := parseEntry(test.input, test.links); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"time"
+
+	"github.com/watchain/go-watchain/p2p/netutil"
+)
+
+const (
+	// Addresses sharing these prefixes are considered to be in the same subnet.
+	ipv4SubnetBits = 24
+	ipv6SubnetBits = 64
+
+	defaultMaxInboundPerIP     = 2
+	defaultMaxInboundPerSubnet = 4
+
+	// dialSubnetLimit is the maximum number of dynamically dialed peers
+	// in the same subnet.
+	dialSubnetLimit = 2
+
+	// inboundThrottleTime is the time an IP address must wait before it may
+	// connect again.
+	inboundThrottleTime = 30 * time.Second
+)
+
+// ipLimiter counts the connections of IP addresses and subnets. LAN addresses
+// are not counted and always within the limits.
+type ipLimiter struct {
+	perIP, perSubnet int
+	ips, subnets     map[string]int
+}
+
+func newIPLimiter(perIP, perSubnet int) *ipLimiter {
+	return &ipLimiter{
+		perIP:     perIP,
+		perSubnet: perSubnet,
+		ips:       make(map[string]int),
+		subnets:   make(map[string]int),
+	}
+}
+
+// allowed reports whwater another connection from ip stays within the limits.
+func (l *ipLimiter) allowed(ip net.IP) bool {
+	if exemptIP(ip) {
+		return true
+	}
+	return l.ips[ip.String()] < l.perIP && l.subnets[subnetKey(ip)] < l.perSubnet
+}
+
+// add counts a connection from ip. It does not check the limits, so connections
+// which are exempt from them are still accounted.
+func (l *ipLimiter) add(ip net.IP) {
+	if exemptIP(ip) {
+		return
+	}
+	l.ips[ip.String()]++
+	l.subnets[subnetKey(ip)]++
+}
+
+// remove uncounts a connection previously added.
+func (l *ipLimiter) remove(ip net.IP) {
+	if exemptIP(ip) {
+		return
+	}
+	decrement(l.ips, ip.String())
+	decrement(l.subnets, subnetKey(ip))
+}
+
+func decrement(m map[string]int, key string) {
+	if m[key] <= 1 {
+		delete(m, key)
+	} else {
+		m[key]--
+	}
+}
+
+func exemptIP(ip net.IP) bool {
+	return ip == nil || netutil.IsLAN(ip)
+}
+
+// subnetKey returns the network prefix of ip.
+func subnetKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(ipv4SubnetBits, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(ipv6SubnetBits, 128)).String()
+}
+
+// ipThrottle remembers the IP addresses which recently connected.
+type ipThrottle struct {
+	expiry     map[string]time.Time
+	lastExpire time.Time
+}
+
+func newIPThrottle() *ipThrottle {
+	return &ipThrottle{expiry: make(map[string]time.Time)}
+}
+
+// check reports whwater ip may connect now. If so, it is throttled until
+// inboundThrottleTime has passed.
+func (t *ipThrottle) check(ip net.IP, now time.Time) bool {
+	if exemptIP(ip) {
+		return true
+	}
+	if now.Sub(t.lastExpire) > inboundThrottleTime {
+		for key, exp := range t.expiry {
+			if !now.Before(exp) {
+				delete(t.expiry, key)
+			}
+		}
+		t.lastExpire = now
+	}
+	key := ip.String()
+	if exp, ok := t.expiry[key]; ok && now.Before(exp) {
+		return false
+	}
+	t.expiry[key] = now.Add(inboundThrottleTime)
+	return true
+}
+
+// remoteIP returns the IP address of the remote end of the connection,
+// or nil if it is unknown.
+func (c *conn) remoteIP() net.IP {
+	if c.fd == nil {
+		return nil
+	}
+	if tcp, ok := c.fd.RemoteAddr().(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+	return nil
+}
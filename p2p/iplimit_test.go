@@ -0,0 +1,93 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIPLimiter(t *testing.T) {
+	l := newIPLimiter(2, 3)
+	for _, ip := range []string{"1.2.3.4", "1.2.3.4", "1.2.3.5"} {
+		if !l.allowed(net.ParseIP(ip)) {
+			t.Fatalf("%s not allowed", ip)
+		}
+		l.add(net.ParseIP(ip))
+	}
+	// The address and its subnet are full.
+	if l.allowed(net.ParseIP("1.2.3.4")) {
+		t.Error("address above per-IP limit allowed")
+	}
+	if l.allowed(net.ParseIP("1.2.3.6")) {
+		t.Error("address above subnet limit allowed")
+	}
+	if !l.allowed(net.ParseIP("1.2.4.1")) {
+		t.Error("address of other subnet not allowed")
+	}
+	// LAN addresses are not limited.
+	for i := 0; i < 5; i++ {
+		l.add(net.ParseIP("127.0.0.1"))
+	}
+	if !l.allowed(net.ParseIP("127.0.0.1")) {
+		t.Error("LAN address not allowed")
+	}
+	// Removing a connection frees its slots.
+	l.remove(net.ParseIP("1.2.3.5"))
+	if !l.allowed(net.ParseIP("1.2.3.6")) {
+		t.Error("address not allowed after removal")
+	}
+
+	// IPv6 addresses are grouped by /64.
+	l = newIPLimiter(1, 1)
+	l.add(net.ParseIP("2001:db8::1"))
+	if l.allowed(net.ParseIP("2001:db8::ffff:1")) {
+		t.Error("address in same /64 allowed")
+	}
+	if !l.allowed(net.ParseIP("2001:db8:0:1::1")) {
+		t.Error("address in other /64 not allowed")
+	}
+}
+
+func TestIPThrottle(t *testing.T) {
+	var (
+		throttle = newIPThrottle()
+		ip       = net.ParseIP("1.2.3.4")
+		now      = time.Unix(1000, 0)
+	)
+	if !throttle.check(ip, now) {
+		t.Fatal("first connection throttled")
+	}
+	if throttle.check(ip, now.Add(inboundThrottleTime/2)) {
+		t.Fatal("reconnect not throttled")
+	}
+	if !throttle.check(net.ParseIP("1.2.3.5"), now) {
+		t.Fatal("other address throttled")
+	}
+	if !throttle.check(ip, now.Add(inboundThrottleTime)) {
+		t.Fatal("reconnect throttled after timeout")
+	}
+	if !throttle.check(net.ParseIP("127.0.0.1"), now) || !throttle.check(net.ParseIP("127.0.0.1"), now) {
+		t.Fatal("LAN address throttled")
+	}
+	// Expired entries are dropped.
+	throttle.check(ip, now.Add(10*inboundThrottleTime))
+	if len(throttle.expiry) != 1 {
+		t.Fatalf("expired entries not removed: %v", throttle.expiry)
+	}
+}
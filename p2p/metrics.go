@@ -29,6 +29,13 @@ var (
 	ingressTrafficMeter = metrics.NewRegisteredMeter("p2p/InboundTraffic", nil)
 	egressConnectMeter  = metrics.NewRegisteredMeter("p2p/OutboundConnects", nil)
 	egressTrafficMeter  = metrics.NewRegisteredMeter("p2p/OutboundTraffic", nil)
+
+	// Payload sizes of messages exchanged with Snappy capable peers, before and
+	// after compression. Their ratio is the saved bandwidth.
+	ingressCompressedMeter = metrics.NewRegisteredMeter("p2p/InboundCompressed", nil)
+	ingressPlainMeter      = metrics.NewRegisteredMeter("p2p/InboundPlain", nil)
+	egressCompressedMeter  = metrics.NewRegisteredMeter("p2p/OutboundCompressed", nil)
+	egressPlainMeter       = metrics.NewRegisteredMeter("p2p/OutboundPlain", nil)
 )
 
 // meteredConn is a wrapper around a network TCP connection that meters both the
@@ -93,23 +93,117 @@ func Parse(spec string) (Interface, error) {
 const (
 	mapTimeout        = 20 * time.Minute
 	mapUpdateInterval = 15 * time.Minute
+	mapRetryInterval  = time.Minute
 )
 
+// EventType is the kind of a port mapping event.
+type EventType int
+
+const (
+	MappingAdded      EventType = iota // the mapping was created
+	MappingRefreshed                   // the lifetime of the mapping was renewed
+	MappingFailed                      // the mapping couldn't be created or renewed
+	MappingDeleted                     // the mapping was removed
+	ExternalIPChanged                  // the gateway reported a new external IP
+)
+
+var eventTypeNames = [...]string{
+	MappingAdded:      "added",
+	MappingRefreshed:  "refreshed",
+	MappingFailed:     "failed",
+	MappingDeleted:    "deleted",
+	ExternalIPChanged: "external IP changed",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Event describes a change of a port mapping maintained by MapNotify.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     EventType `json:"type"`
+	Protocol string    `json:"protocol"`
+	ExtPort  int       `json:"extPort"`
+	IntPort  int       `json:"intPort"`
+	ExtIP    net.IP    `json:"extIP,omitempty"` // external IP of the gateway, if known
+	Err      string    `json:"error,omitempty"` // set for MappingFailed
+}
+
 // Map adds a port mapping on m and keeps it alive until c is closed.
 // This function is typically invoked in its own goroutine.
 func Map(m Interface, c chan struct{}, protocol string, extport, intport int, name string) {
-	log := log.New("proto", protocol, "extport", extport, "intport", intport, "interface", m)
-	refresh := time.NewTimer(mapUpdateInterval)
+	MapNotify(m, c, protocol, extport, intport, name, nil)
+}
+
+// MapNotify is like Map, but also reports the changes of the mapping and of
+// the external IP address to notify. The mapping is renewed periodically and
+// recreated quickly if the gateway lost it. notify may be nil.
+func MapNotify(m Interface, c chan struct{}, protocol string, extport, intport int, name string, notify func(Event)) {
+	mapPort(m, c, protocol, extport, intport, name, notify, mapUpdateInterval, mapRetryInterval)
+}
+
+func mapPort(m Interface, c chan struct{}, protocol string, extport, intport int, name string, notify func(Event), update, retry time.Duration) {
+	var (
+		log    = log.New("proto", protocol, "extport", extport, "intport", intport, "interface", m)
+		mapped bool
+		extip  net.IP
+	)
+	emit := func(typ EventType, err error) {
+		if notify == nil {
+			return
+		}
+		ev := Event{Time: time.Now(), Type: typ, Protocol: protocol, ExtPort: extport, IntPort: intport, ExtIP: extip}
+		if err != nil {
+			ev.Err = err.Error()
+		}
+		notify(ev)
+	}
+	// add creates or renews the mapping and returns the time until the next attempt.
+	add := func() time.Duration {
+		if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
+			log.Debug("Couldn't add port mapping", "err", err)
+			mapped = false
+			emit(MappingFailed, err)
+			return retry
+		}
+		ip, err := m.ExternalIP()
+		switch {
+		case err != nil:
+			log.Debug("Couldn't get external IP", "err", err)
+		case extip != nil && !ip.Equal(extip):
+			log.Info("External IP changed", "old", extip, "new", ip)
+			extip = ip
+			emit(ExternalIPChanged, nil)
+		default:
+			extip = ip
+		}
+		if mapped {
+			log.Trace("Refreshed port mapping")
+			emit(MappingRefreshed, nil)
+		} else {
+			log.Info("Mapped network port")
+			mapped = true
+			emit(MappingAdded, nil)
+		}
+		return update
+	}
+
+	refresh := time.NewTimer(add())
 	defer func() {
 		refresh.Stop()
 		log.Debug("Deleting port mapping")
 		m.DeleteMapping(protocol, extport, intport)
+		emit(MappingDeleted, nil)
 	}()
-	if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
-		log.Debug("Couldn't add port mapping", "err", err)
-	} else {
-		log.Info("Mapped network port")
-	}
 	for {
 		select {
 		case _, ok := <-c:
@@ -118,10 +212,7 @@ func Map(m Interface, c chan struct{}, protocol string, extport, intport int, na
 			}
 		case <-refresh.C:
 			log.Trace("Refreshing port mapping")
-			if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
-				log.Debug("Couldn't add port mapping", "err", err)
-			}
-			refresh.Reset(mapUpdateInterval)
+			refresh.Reset(add())
 		}
 	}
 }
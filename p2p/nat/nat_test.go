@@ -17,7 +17,9 @@
 package nat
 
 import (
+	"errors"
 	"net"
+	"sync"
 	"testing"
 	"time"
 )
@@ -61,3 +63,101 @@ func TestAutoDiscRace(t *testing.T) {
 		}
 	}
 }
+
+// fakeNAT is a NAT gateway which can be made to fail and change its IP.
+type fakeNAT struct {
+	mu       sync.Mutex
+	ip       net.IP
+	fail     bool
+	mappings map[int]bool
+}
+
+func (n *fakeNAT) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail {
+		return errors.New("gateway unavailable")
+	}
+	n.mappings[extport] = true
+	return nil
+}
+
+func (n *fakeNAT) DeleteMapping(protocol string, extport, intport int) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.mappings, extport)
+	return nil
+}
+
+func (n *fakeNAT) ExternalIP() (net.IP, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ip, nil
+}
+
+func (n *fakeNAT) String() string { return "fake" }
+
+func (n *fakeNAT) set(ip net.IP, fail bool) {
+	n.mu.Lock()
+	n.ip, n.fail = ip, fail
+	n.mu.Unlock()
+}
+
+// This test checks that mapPort refreshes the mapping, recreates it after
+// failures and reports changes of the external IP.
+func TestMapPortEvents(t *testing.T) {
+	var (
+		gw     = &fakeNAT{ip: net.IP{33, 44, 55, 66}, mappings: make(map[int]bool)}
+		events = make(chan Event, 10)
+		quit   = make(chan struct{})
+		done   = make(chan struct{})
+	)
+	go func() {
+		mapPort(gw, quit, "udp", 30303, 30303, "test", func(ev Event) { events <- ev }, 10*time.Millisecond, 10*time.Millisecond)
+		close(done)
+	}()
+	// next waits for an event of the wanted type. Repeated events of the
+	// skipped type, caused by further refresh attempts, are ignored.
+	next := func(want, skip EventType) Event {
+		t.Helper()
+		for {
+			select {
+			case ev := <-events:
+				if ev.Protocol != "udp" || ev.ExtPort != 30303 || ev.IntPort != 30303 {
+					t.Fatalf("wrong mapping in event: %+v", ev)
+				}
+				if ev.Type == want {
+					return ev
+				}
+				if ev.Type != skip {
+					t.Fatalf("got event %q, want %q", ev.Type, want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timed out waiting for event %q", want)
+			}
+		}
+	}
+
+	if ev := next(MappingAdded, -1); !ev.ExtIP.Equal(gw.ip) {
+		t.Errorf("got external IP %v, want %v", ev.ExtIP, gw.ip)
+	}
+	next(MappingRefreshed, -1)
+
+	gw.set(net.IP{33, 44, 55, 66}, true)
+	if ev := next(MappingFailed, MappingRefreshed); ev.Err == "" {
+		t.Error("failure event has no error")
+	}
+	newIP := net.IP{77, 88, 99, 11}
+	gw.set(newIP, false)
+	if ev := next(ExternalIPChanged, MappingFailed); !ev.ExtIP.Equal(newIP) {
+		t.Errorf("got external IP %v, want %v", ev.ExtIP, newIP)
+	}
+	next(MappingAdded, -1)
+
+	close(quit)
+	<-done
+	next(MappingDeleted, MappingRefreshed)
+	if len(gw.mappings) != 0 {
+		t.Errorf("mapping not deleted: %v", gw.mappings)
+	}
+}
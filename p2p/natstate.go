@@ -0,0 +1,119 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"sync"
+
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/nat"
+)
+
+// natEventLimit is the number of recent port mapping events kept.
+const natEventLimit = 20
+
+// NATInfo describes how the server makes itself reachable from the Internet.
+type NATInfo struct {
+	Mechanism  string                  `json:"mechanism,omitempty"`  // Port mapping mechanism, empty if none is configured
+	ExternalIP string                  `json:"externalIP,omitempty"` // External IP reported by the mechanism
+	Endpoints  *discover.EndpointStats `json:"endpoints,omitempty"`  // Endpoints of the node reported by discovery pongs
+	Events     []nat.Event             `json:"events"`               // Recent port mapping events, oldest first
+}
+
+// natState keeps track of the port mappings of the server. When the gateway
+// reports a new external IP, the announced endpoint is updated.
+type natState struct {
+	mech nat.Interface // nil if no port mapping is configured
+
+	mu     sync.Mutex
+	tab    *discover.Table // discovery table announcing the endpoint, nil if off
+	extIP  net.IP          // last external IP reported by mech
+	events []nat.Event     // recent events, oldest first
+}
+
+func newNATState(mech nat.Interface) *natState {
+	return &natState{mech: mech}
+}
+
+// mapPort maintains a port mapping until the server is stopped.
+func (st *natState) mapPort(quit chan struct{}, protocol string, port int, name string) {
+	nat.MapNotify(st.mech, quit, protocol, port, port, name, st.handleEvent)
+}
+
+// setExternalIP records the external IP found at startup, unless the port
+// mapping already reported one.
+func (st *natState) setExternalIP(ip net.IP) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.extIP == nil {
+		st.extIP = ip
+	}
+}
+
+// setTable sets the discovery table and announces the external IP if it
+// changed in the meantime.
+func (st *natState) setTable(tab *discover.Table) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.tab = tab
+	if st.extIP != nil && !st.extIP.Equal(tab.Self().IP) {
+		tab.SetStaticIP(st.extIP)
+	}
+}
+
+// handleEvent records a port mapping event. A new external IP is announced
+// in discovery.
+func (st *natState) handleEvent(ev nat.Event) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.events) == natEventLimit {
+		st.events = st.events[:copy(st.events, st.events[1:])]
+	}
+	st.events = append(st.events, ev)
+
+	if ev.ExtIP == nil || ev.ExtIP.Equal(st.extIP) {
+		return
+	}
+	st.extIP = ev.ExtIP
+	if st.tab != nil {
+		st.tab.SetStaticIP(ev.ExtIP)
+	}
+}
+
+// info returns the current NAT state.
+func (st *natState) info() *NATInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	info := &NATInfo{Events: make([]nat.Event, len(st.events))}
+	copy(info.Events, st.events)
+	if st.mech != nil {
+		info.Mechanism = st.mech.String()
+	}
+	if st.extIP != nil {
+		info.ExternalIP = st.extIP.String()
+	}
+	if st.tab != nil {
+		stats := st.tab.EndpointStats()
+		info.Endpoints = &stats
+	}
+	return info
+}
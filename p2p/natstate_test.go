@@ -0,0 +1,76 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/nat"
+)
+
+func TestNATStateExternalIP(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := discover.ListenUDP(conn, discover.Config{PrivateKey: newkey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tab.Close()
+
+	var (
+		ip1 = net.IP{33, 44, 55, 66}
+		ip2 = net.IP{77, 88, 99, 11}
+		st  = newNATState(nat.ExtIP(ip1))
+		ev  = func(typ nat.EventType, ip net.IP) nat.Event {
+			return nat.Event{Time: time.Now(), Type: typ, Protocol: "udp", ExtPort: 30303, IntPort: 30303, ExtIP: ip}
+		}
+	)
+	st.setTable(tab)
+	if st.handleEvent(ev(nat.MappingAdded, ip1)); !tab.Self().IP.Equal(ip1) {
+		t.Fatalf("external IP not announced: %v", tab.Self())
+	}
+	if st.handleEvent(ev(nat.ExternalIPChanged, ip2)); !tab.Self().IP.Equal(ip2) {
+		t.Fatalf("changed IP not announced: %v", tab.Self())
+	}
+	if st.handleEvent(ev(nat.MappingFailed, nil)); !tab.Self().IP.Equal(ip2) {
+		t.Fatalf("IP changed by failure: %v", tab.Self())
+	}
+
+	info := st.info()
+	if info.Mechanism != "ExtIP(33.44.55.66)" || info.ExternalIP != ip2.String() {
+		t.Errorf("wrong info: %+v", info)
+	}
+	if info.Endpoints == nil || !info.Endpoints.Static {
+		t.Errorf("wrong endpoint stats: %+v", info.Endpoints)
+	}
+	if len(info.Events) != 3 || info.Events[1].Type != nat.ExternalIPChanged {
+		t.Errorf("wrong events: %+v", info.Events)
+	}
+
+	// Only the recent events are kept.
+	for i := 0; i < 2*natEventLimit; i++ {
+		st.handleEvent(ev(nat.MappingRefreshed, ip2))
+	}
+	if info := st.info(); len(info.Events) != natEventLimit || info.Events[0].Type != nat.MappingRefreshed {
+		t.Errorf("wrong events after overflow: %d", len(info.Events))
+	}
+}
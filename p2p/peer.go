@@ -22,6 +22,7 @@ import (
 	"net"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/watchain/go-watchain/common/mclock"
@@ -162,7 +163,7 @@ func (p *Peer) String() string {
 
 // Inbound returns true if the peer is an inbound connection
 func (p *Peer) Inbound() bool {
-	return p.rw.flags&inboundConn != 0
+	return p.rw.is(inboundConn)
 }
 
 func newPeer(conn *conn, protocols []Protocol) *Peer {
@@ -371,6 +372,8 @@ func (p *Peer) getProto(code uint64) (*protoRW, error) {
 }
 
 type protoRW struct {
+	ingress, egress uint64 // payload bytes exchanged (atomic)
+
 	Protocol
 	in     chan Msg        // receices read messages
 	closed <-chan struct{} // receives when peer is shutting down
@@ -378,16 +381,27 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *protoTraffic // message counters, nil if not accounted
+	limit   *tokenBucket  // egress cap of the protocol, nil if unlimited
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	if msg.Code >= rw.Length {
 		return newPeerError(errInvalidMsgCode, "not handled")
 	}
+	if rw.limit != nil {
+		rw.limit.wait(int(msg.Size), rw.closed)
+	}
+	code, size := msg.Code, msg.Size
 	msg.Code += rw.offset
 	select {
 	case <-rw.wstart:
 		err = rw.w.WriteMsg(msg)
+		if err == nil {
+			rw.traffic.sent(code, size)
+			atomic.AddUint64(&rw.egress, uint64(size))
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
@@ -403,6 +417,8 @@ func (rw *protoRW) ReadMsg() (Msg, error) {
 	select {
 	case msg := <-rw.in:
 		msg.Code -= rw.offset
+		rw.traffic.received(msg.Code, msg.Size)
+		atomic.AddUint64(&rw.ingress, uint64(msg.Size))
 		return msg, nil
 	case <-rw.closed:
 		return Msg{}, io.EOF
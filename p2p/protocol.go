@@ -20,6 +20,8 @@ import (
 	"fmt"
 
 	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/discv5"
+	"github.com/watchain/go-watchain/p2p/enr"
 )
 
 // Protocol represents a P2P subprotocol implementation.
@@ -52,6 +54,25 @@ type Protocol struct {
 	// about a certain peer in the network. If an info retrieval function is set,
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id discover.NodeID) interface{}
+
+	// DialScore is an optional helper method to retrieve the protocol specific
+	// reputation of a node in the [-1, 1] range. Nodes with a negative score are
+	// not dialed dynamically, the rest are dialed in the order of their scores.
+	DialScore func(id discover.NodeID) float64
+
+	// Attributes contains protocol specific entries advertised in the signed
+	// record of the local node.
+	Attributes []enr.Entry
+
+	// DialFilter is an optional helper method to decide whwater a discovered node
+	// is worth dialing, e.g. based on the entries of its record. Nodes rejected
+	// by all protocols having a filter are not dialed dynamically.
+	DialFilter func(n *discover.Node) bool
+
+	// DiscoveryTopic is the topic under which the protocol is advertised and
+	// searched when discovery v5 is enabled. Nodes found by the search are
+	// preferred dial candidates. Leave it empty to opt out.
+	DiscoveryTopic discv5.Topic
 }
 
 func (p Protocol) cap() Cap {
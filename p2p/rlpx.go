@@ -91,6 +91,11 @@ func newRLPX(fd net.Conn) transport {
 func (t *rlpx) ReadMsg() (Msg, error) {
 	t.rmu.Lock()
 	defer t.rmu.Unlock()
+	// Wait for the bandwidth limits before the deadline, throttling the peer
+	// without making its messages time out.
+	if c, ok := t.fd.(*trafficConn); ok {
+		c.waitRead()
+	}
 	t.fd.SetReadDeadline(time.Now().Add(frameReadTimeout))
 	return t.rw.ReadMsg()
 }
@@ -98,6 +103,9 @@ func (t *rlpx) ReadMsg() (Msg, error) {
 func (t *rlpx) WriteMsg(msg Msg) error {
 	t.wmu.Lock()
 	defer t.wmu.Unlock()
+	if c, ok := t.fd.(*trafficConn); ok {
+		c.waitWrite()
+	}
 	t.fd.SetWriteDeadline(time.Now().Add(frameWriteTimeout))
 	return t.rw.WriteMsg(msg)
 }
@@ -606,7 +614,9 @@ func (rw *rlpxFrameRW) WriteMsg(msg Msg) error {
 			return errPlainMessageTooLarge
 		}
 		payload, _ := ioutil.ReadAll(msg.Payload)
+		egressPlainMeter.Mark(int64(len(payload)))
 		payload = snappy.Encode(nil, payload)
+		egressCompressedMeter.Mark(int64(len(payload)))
 
 		msg.Payload = bytes.NewReader(payload)
 		msg.Size = uint32(len(payload))
@@ -710,10 +720,12 @@ func (rw *rlpxFrameRW) ReadMsg() (msg Msg, err error) {
 		if size > int(maxUint24) {
 			return msg, errPlainMessageTooLarge
 		}
+		ingressCompressedMeter.Mark(int64(len(payload)))
 		payload, err = snappy.Decode(nil, payload)
 		if err != nil {
 			return msg, err
 		}
+		ingressPlainMeter.Mark(int64(size))
 		msg.Size, msg.Payload = uint32(size), bytes.NewReader(payload)
 	}
 	return msg, nil
@@ -31,9 +31,11 @@ import (
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/golang/snappy"
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/crypto/ecies"
 	"github.com/watchain/go-watchain/crypto/sha3"
+	"github.com/watchain/go-watchain/metrics"
 	"github.com/watchain/go-watchain/p2p/discover"
 	"github.com/watchain/go-watchain/rlp"
 )
@@ -322,6 +324,99 @@ func (h fakeHash) Size() int           { return len(h) }
 func (h fakeHash) Sum(b []byte) []byte { return append(b, h...) }
 
 func TestRLPXFrameRW(t *testing.T) {
+	conn := new(bytes.Buffer)
+	rw1, rw2 := newTestFrameRWs(conn)
+
+	// send some messages
+	for i := 0; i < 10; i++ {
+		// write message into conn buffer
+		wmsg := []interface{}{"foo", "bar", strings.Repeat("test", i)}
+		err := Send(rw1, uint64(i), wmsg)
+		if err != nil {
+			t.Fatalf("WriteMsg error (i=%d): %v", i, err)
+		}
+
+		// read message that rw1 just wrote
+		msg, err := rw2.ReadMsg()
+		if err != nil {
+			t.Fatalf("ReadMsg error (i=%d): %v", i, err)
+		}
+		if msg.Code != uint64(i) {
+			t.Fatalf("msg code mismatch: got %d, want %d", msg.Code, i)
+		}
+		payload, _ := ioutil.ReadAll(msg.Payload)
+		wantPayload, _ := rlp.EncodeToBytes(wmsg)
+		if !bytes.Equal(payload, wantPayload) {
+			t.Fatalf("msg payload mismatch:\ngot  %x\nwant %x", payload, wantPayload)
+		}
+	}
+}
+
+func TestRLPXFrameRWSnappy(t *testing.T) {
+	conn := new(bytes.Buffer)
+	rw1, rw2 := newTestFrameRWs(conn)
+	rw1.snappy, rw2.snappy = true, true
+
+	// Replace the snappy meters with live ones, even if metrics are disabled
+	defer func(enabled bool, meters []metrics.Meter) {
+		metrics.Enabled = enabled
+		egressPlainMeter, egressCompressedMeter, ingressCompressedMeter, ingressPlainMeter = meters[0], meters[1], meters[2], meters[3]
+	}(metrics.Enabled, []metrics.Meter{egressPlainMeter, egressCompressedMeter, ingressCompressedMeter, ingressPlainMeter})
+
+	metrics.Enabled = true
+	meters := []metrics.Meter{metrics.NewMeter(), metrics.NewMeter(), metrics.NewMeter(), metrics.NewMeter()}
+	egressPlainMeter, egressCompressedMeter, ingressCompressedMeter, ingressPlainMeter = meters[0], meters[1], meters[2], meters[3]
+
+	// A compressible message should shrink on the wire
+	wmsg := []interface{}{strings.Repeat("test", 1024)}
+	if err := Send(rw1, 8, wmsg); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	plain, _ := rlp.EncodeToBytes(wmsg)
+	if conn.Len() >= len(plain) {
+		t.Errorf("message not compressed: %d bytes on the wire, %d bytes plain", conn.Len(), len(plain))
+	}
+	msg, err := rw2.ReadMsg()
+	if err != nil {
+		t.Fatalf("ReadMsg error: %v", err)
+	}
+	payload, _ := ioutil.ReadAll(msg.Payload)
+	if msg.Code != 8 || msg.Size != uint32(len(plain)) || !bytes.Equal(payload, plain) {
+		t.Fatalf("msg mismatch: code %d, size %d, payload %x", msg.Code, msg.Size, payload)
+	}
+	// Both ends should have metered the payload sizes before and after compression
+	var (
+		compressed = len(snappy.Encode(nil, plain))
+		names      = []string{"outbound plain", "outbound compressed", "inbound compressed", "inbound plain"}
+	)
+	for i, want := range []int{len(plain), compressed, compressed, len(plain)} {
+		if have := meters[i].Count(); have != int64(want) {
+			t.Errorf("%s meter mismatch: have %d bytes, want %d", names[i], have, want)
+		}
+	}
+
+	// Payloads announcing a decompressed size beyond the limit must be rejected
+	// before they are decompressed.
+	rw1.snappy = false
+	bomb := []byte{0x80, 0x80, 0x80, 0x08} // varint length prefix of 16MB
+	if err := rw1.WriteMsg(Msg{Code: 8, Size: uint32(len(bomb)), Payload: bytes.NewReader(bomb)}); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	if _, err := rw2.ReadMsg(); err != errPlainMessageTooLarge {
+		t.Fatalf("wrong error for oversized message: got %v, want %v", err, errPlainMessageTooLarge)
+	}
+
+	// Messages too large to be compressed are refused when writing.
+	rw1.snappy = true
+	err = rw1.WriteMsg(Msg{Code: 8, Size: maxUint24 + 1, Payload: bytes.NewReader(nil)})
+	if err != errPlainMessageTooLarge {
+		t.Fatalf("wrong error for writing oversized message: got %v, want %v", err, errPlainMessageTooLarge)
+	}
+}
+
+// newTestFrameRWs creates two frame readers/writers with matching secrets on
+// top of the given connection.
+func newTestFrameRWs(conn io.ReadWriter) (*rlpxFrameRW, *rlpxFrameRW) {
 	var (
 		aesSecret      = make([]byte, 16)
 		macSecret      = make([]byte, 16)
@@ -331,8 +426,6 @@ func TestRLPXFrameRW(t *testing.T) {
 	for _, s := range [][]byte{aesSecret, macSecret, egressMACinit, ingressMACinit} {
 		rand.Read(s)
 	}
-	conn := new(bytes.Buffer)
-
 	s1 := secrets{
 		AES:        aesSecret,
 		MAC:        macSecret,
@@ -341,7 +434,6 @@ func TestRLPXFrameRW(t *testing.T) {
 	}
 	s1.EgressMAC.Write(egressMACinit)
 	s1.IngressMAC.Write(ingressMACinit)
-	rw1 := newRLPXFrameRW(conn, s1)
 
 	s2 := secrets{
 		AES:        aesSecret,
@@ -351,31 +443,8 @@ func TestRLPXFrameRW(t *testing.T) {
 	}
 	s2.EgressMAC.Write(ingressMACinit)
 	s2.IngressMAC.Write(egressMACinit)
-	rw2 := newRLPXFrameRW(conn, s2)
-
-	// send some messages
-	for i := 0; i < 10; i++ {
-		// write message into conn buffer
-		wmsg := []interface{}{"foo", "bar", strings.Repeat("test", i)}
-		err := Send(rw1, uint64(i), wmsg)
-		if err != nil {
-			t.Fatalf("WriteMsg error (i=%d): %v", i, err)
-		}
 
-		// read message that rw1 just wrote
-		msg, err := rw2.ReadMsg()
-		if err != nil {
-			t.Fatalf("ReadMsg error (i=%d): %v", i, err)
-		}
-		if msg.Code != uint64(i) {
-			t.Fatalf("msg code mismatch: got %d, want %d", msg.Code, i)
-		}
-		payload, _ := ioutil.ReadAll(msg.Payload)
-		wantPayload, _ := rlp.EncodeToBytes(wmsg)
-		if !bytes.Equal(payload, wantPayload) {
-			t.Fatalf("msg payload mismatch:\ngot  %x\nwant %x", payload, wantPayload)
-		}
-	}
+	return newRLPXFrameRW(conn, s1), newRLPXFrameRW(conn, s2)
 }
 
 type handshakeAuthTest struct {
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/watchain/go-watchain/common"
@@ -31,6 +32,7 @@ import (
 	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/p2p/discover"
 	"github.com/watchain/go-watchain/p2p/discv5"
+	"github.com/watchain/go-watchain/p2p/dnsdisc"
 	"github.com/watchain/go-watchain/p2p/nat"
 	"github.com/watchain/go-watchain/p2p/netutil"
 )
@@ -42,7 +44,9 @@ const (
 	maxActiveDialTasks     = 16
 	defaultMaxPendingPeers = 50
 	defaultDialRatio       = 3
+)
 
+var (
 	// Maximum time allowed for reading a complete message.
 	// This is effectively the amount of time a connection can be idle.
 	frameReadTimeout = 30 * time.Second
@@ -59,14 +63,32 @@ type Config struct {
 	PrivateKey *ecdsa.PrivateKey `toml:"-"`
 
 	// MaxPeers is the maximum number of peers that can be
-	// connected. It must be greater than zero.
+	// connected. It must be greater than zero. The limit can
+	// be changed while the server is running using SetMaxPeers.
 	MaxPeers int
 
+	// ProtocolMaxPeers limits the number of peers running a sub-protocol, keyed
+	// by protocol name. A peer is only accepted if all of its protocols have a
+	// free slot, as it runs every protocol it shares with the local node, so a
+	// limit on one protocol reserves the remaining slots for peers not running
+	// it. Trusted and static peers are not counted against the limits.
+	ProtocolMaxPeers map[string]int `toml:",omitempty"`
+
 	// MaxPendingPeers is the maximum number of peers that can be pending in the
 	// handshake phase, counted separately for inbound and outbound connections.
 	// Zero defaults to preset values.
 	MaxPendingPeers int `toml:",omitempty"`
 
+	// MaxInboundPerIP and MaxInboundPerSubnet limit the number of inbound
+	// connections from a single IP address and from a single /24 (IPv4) or
+	// /64 (IPv6) network. Zero defaults to preset values. Connections from LAN
+	// addresses and trusted nodes are not limited. Inbound connections from
+	// Internet hosts reconnecting within 30 seconds are rejected before the
+	// handshake, when the remote identity is not yet known, so that throttle
+	// applies to trusted nodes as well.
+	MaxInboundPerIP     int `toml:",omitempty"`
+	MaxInboundPerSubnet int `toml:",omitempty"`
+
 	// DialRatio controls the ratio of inbound to dialed connections.
 	// Example: a DialRatio of 2 allows 1/2 of connections to be dialed.
 	// Setting DialRatio to zero defaults it to 3.
@@ -77,7 +99,8 @@ type Config struct {
 	NoDiscovery bool
 
 	// DiscoveryV5 specifies whwater the the new topic-discovery based V5 discovery
-	// protocol should be started or not.
+	// protocol should be started or not. Protocols with a discovery topic are
+	// advertised and searched through it, even if NoDiscovery is set.
 	DiscoveryV5 bool `toml:",omitempty"`
 
 	// Name sets the node name of this server.
@@ -93,12 +116,17 @@ type Config struct {
 	// protocol.
 	BoowatrapNodesV5 []*discv5.Node `toml:",omitempty"`
 
+	// DiscoveryDNS contains the enrtree:// URLs of DNS node lists, whose nodes
+	// are used as dial candidates next to the ones found via discovery.
+	DiscoveryDNS []string `toml:",omitempty"`
+
 	// Static nodes are used as pre-configured connections which are always
 	// maintained and re-connected on disconnects.
 	StaticNodes []*discover.Node
 
 	// Trusted nodes are used as pre-configured connections which are always
-	// allowed to connect, even above the peer limit.
+	// allowed to connect, even above the peer limit. More trusted nodes can
+	// be added while the server is running using AddTrustedPeer.
 	TrustedNodes []*discover.Node
 
 	// Connectivity can be restricted to certain IP networks.
@@ -110,6 +138,11 @@ type Config struct {
 	// live nodes in the network.
 	NodeDatabase string `toml:",omitempty"`
 
+	// NodeDatabaseV5 is the path to the database of the V5 discovery protocol.
+	// Next to the seen nodes, it keeps the topic registration tickets across
+	// restarts.
+	NodeDatabaseV5 string `toml:",omitempty"`
+
 	// Protocols should contain the protocols supported
 	// by the server. Matching protocols are launched for
 	// each peer.
@@ -135,10 +168,30 @@ type Config struct {
 	// If NoDial is true, the server will not dial any peers.
 	NoDial bool `toml:",omitempty"`
 
+	// MaxIngressRate and MaxEgressRate limit the total bandwidth of all peer
+	// connections in bytes per second. Zero means unlimited.
+	MaxIngressRate int `toml:",omitempty"`
+	MaxEgressRate  int `toml:",omitempty"`
+
+	// MaxPeerIngressRate and MaxPeerEgressRate limit the bandwidth of each
+	// peer connection in bytes per second. Zero means unlimited.
+	MaxPeerIngressRate int `toml:",omitempty"`
+	MaxPeerEgressRate  int `toml:",omitempty"`
+
+	// ProtocolEgressRates limits the bandwidth used for sending the messages of
+	// sub-protocols, keyed by protocol name, in bytes per second. The limit is
+	// shared by all peers and keeps a busy protocol from crowding out the others.
+	ProtocolEgressRates map[string]int `toml:",omitempty"`
+
 	// If EnableMsgEvents is set then the server will emit PeerEvents
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
 
+	// If AcceptUselessPeers is set, peers sharing no protocol with the server
+	// are not dropped after the protocol handshake. Crawlers use this to learn
+	// the client information of nodes running other protocols.
+	AcceptUselessPeers bool `toml:"-"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 }
@@ -157,10 +210,14 @@ type Server struct {
 	running bool
 
 	ntab         discoverTable
+	dnsdisc      *dnsdisc.Client
 	listener     net.Listener
 	ourHandshake *protoHandshake
 	lastLookup   time.Time
 	DiscV5       *discv5.Network
+	topics       *topicSearches
+	traffic      *trafficStats
+	nat          *natState
 
 	// These are for Peers, PeerCount (and nothing else).
 	peerOp     chan peerOpFunc
@@ -169,11 +226,15 @@ type Server struct {
 	quit          chan struct{}
 	addstatic     chan *discover.Node
 	removestatic  chan *discover.Node
+	addtrusted    chan *discover.Node
+	removetrusted chan *discover.Node
+	setlimit      chan peerLimit
 	posthandshake chan *conn
 	addpeer       chan *conn
 	delpeer       chan peerDrop
 	loopWG        sync.WaitGroup // loop, listenLoop
 	peerFeed      event.Feed
+	limitFeed     event.Feed
 	log           log.Logger
 }
 
@@ -185,7 +246,14 @@ type peerDrop struct {
 	requested bool // true if signaled by the peer
 }
 
-type connFlag int
+// peerLimit is a change of the maximum peer count, for all peers if proto is
+// empty or else for the peers running the named protocol.
+type peerLimit struct {
+	proto string
+	max   int
+}
+
+type connFlag int32
 
 const (
 	dynDialedConn connFlag = 1 << iota
@@ -221,7 +289,7 @@ type transport interface {
 }
 
 func (c *conn) String() string {
-	s := c.flags.String()
+	s := connFlag(atomic.LoadInt32((*int32)(&c.flags))).String()
 	if (c.id != discover.NodeID{}) {
 		s += " " + c.id.String()
 	}
@@ -250,7 +318,23 @@ func (f connFlag) String() string {
 }
 
 func (c *conn) is(f connFlag) bool {
-	return c.flags&f != 0
+	flags := connFlag(atomic.LoadInt32((*int32)(&c.flags)))
+	return flags&f != 0
+}
+
+func (c *conn) set(f connFlag, val bool) {
+	for {
+		oldFlags := connFlag(atomic.LoadInt32((*int32)(&c.flags)))
+		flags := oldFlags
+		if val {
+			flags |= f
+		} else {
+			flags &= ^f
+		}
+		if atomic.CompareAndSwapInt32((*int32)(&c.flags), int32(oldFlags), int32(flags)) {
+			return
+		}
+	}
 }
 
 // Peers returns all connected peers.
@@ -300,6 +384,49 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// AddTrustedPeer adds the given node to a reserved whitelist which allows the
+// node to always connect, even if the peer slots are full.
+func (srv *Server) AddTrustedPeer(node *discover.Node) {
+	select {
+	case srv.addtrusted <- node:
+	case <-srv.quit:
+	}
+}
+
+// RemoveTrustedPeer removes the given node from the trusted peer set.
+func (srv *Server) RemoveTrustedPeer(node *discover.Node) {
+	select {
+	case srv.removetrusted <- node:
+	case <-srv.quit:
+	}
+}
+
+// SetMaxPeers changes the maximum number of connected peers. Peers above the new
+// limit are not disconnected, but no new peers are accepted until the peer count
+// has dropped below it. The new limit is sent to the SubscribeMaxPeers subscribers.
+func (srv *Server) SetMaxPeers(max int) {
+	select {
+	case srv.setlimit <- peerLimit{max: max}:
+		srv.limitFeed.Send(max)
+	case <-srv.quit:
+	}
+}
+
+// SubscribeMaxPeers subscribes the given channel to changes of the maximum number
+// of connected peers made by SetMaxPeers.
+func (srv *Server) SubscribeMaxPeers(ch chan<- int) event.Subscription {
+	return srv.limitFeed.Subscribe(ch)
+}
+
+// SetProtocolMaxPeers changes the maximum number of peers running the given
+// protocol. A limit of zero removes the restriction.
+func (srv *Server) SetProtocolMaxPeers(proto string, max int) {
+	select {
+	case srv.setlimit <- peerLimit{proto: proto, max: max}:
+	case <-srv.quit:
+	}
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -410,13 +537,19 @@ func (srv *Server) Start() (err error) {
 	srv.posthandshake = make(chan *conn)
 	srv.addstatic = make(chan *discover.Node)
 	srv.removestatic = make(chan *discover.Node)
+	srv.addtrusted = make(chan *discover.Node)
+	srv.removetrusted = make(chan *discover.Node)
+	srv.setlimit = make(chan peerLimit)
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
+	srv.traffic = newTrafficStats(&srv.Config)
+	srv.nat = newNATState(srv.NAT)
 
 	var (
 		conn      *net.UDPConn
 		sconn     *sharedUDPConn
 		realaddr  *net.UDPAddr
+		staticIP  bool
 		unhandled chan discover.ReadPacket
 	)
 
@@ -431,12 +564,15 @@ func (srv *Server) Start() (err error) {
 		}
 		realaddr = conn.LocalAddr().(*net.UDPAddr)
 		if srv.NAT != nil {
+			// The mapping reports changes of the external IP, which are
+			// announced through discovery.
 			if !realaddr.IP.IsLoopback() {
-				go nat.Map(srv.NAT, srv.quit, "udp", realaddr.Port, realaddr.Port, "watereum discovery")
+				go srv.nat.mapPort(srv.quit, "udp", realaddr.Port, "watereum discovery")
 			}
-			// TODO: react to external IP changes over time.
 			if ext, err := srv.NAT.ExternalIP(); err == nil {
 				realaddr = &net.UDPAddr{IP: ext, Port: realaddr.Port}
+				srv.nat.setExternalIP(ext)
+				staticIP = true
 			}
 		}
 	}
@@ -451,6 +587,7 @@ func (srv *Server) Start() (err error) {
 		cfg := discover.Config{
 			PrivateKey:   srv.PrivateKey,
 			AnnounceAddr: realaddr,
+			StaticIP:     staticIP,
 			NodeDBPath:   srv.NodeDatabase,
 			NetRestrict:  srv.NetRestrict,
 			Bootnodes:    srv.BoowatrapNodes,
@@ -460,6 +597,12 @@ func (srv *Server) Start() (err error) {
 		if err != nil {
 			return err
 		}
+		for _, p := range srv.Protocols {
+			for _, e := range p.Attributes {
+				ntab.SetLocalEntry(e)
+			}
+		}
+		srv.nat.setTable(ntab)
 		srv.ntab = ntab
 	}
 
@@ -469,9 +612,9 @@ func (srv *Server) Start() (err error) {
 			err  error
 		)
 		if sconn != nil {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, sconn, realaddr, "", srv.NetRestrict) //srv.NodeDatabase)
+			ntab, err = discv5.ListenUDP(srv.PrivateKey, sconn, realaddr, srv.NodeDatabaseV5, srv.NetRestrict)
 		} else {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, conn, realaddr, "", srv.NetRestrict) //srv.NodeDatabase)
+			ntab, err = discv5.ListenUDP(srv.PrivateKey, conn, realaddr, srv.NodeDatabaseV5, srv.NetRestrict)
 		}
 		if err != nil {
 			return err
@@ -480,10 +623,31 @@ func (srv *Server) Start() (err error) {
 			return err
 		}
 		srv.DiscV5 = ntab
+		if !srv.NoDial {
+			srv.topics = srv.searchTopics()
+		}
+	}
+
+	// DNS node lists
+	if !srv.NoDiscovery && len(srv.DiscoveryDNS) > 0 {
+		client, err := dnsdisc.NewClient(dnsdisc.Config{Logger: srv.log}, srv.DiscoveryDNS...)
+		if err != nil {
+			return err
+		}
+		client.Start()
+		srv.dnsdisc = client
 	}
 
 	dynPeers := srv.maxDialedConns()
 	dialer := newDialState(srv.StaticNodes, srv.BoowatrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	if srv.dnsdisc != nil {
+		dialer.dns = srv.dnsdisc
+	}
+	if srv.topics != nil {
+		dialer.topics = srv.topics
+	}
+	dialer.score = srv.dialScore()
+	dialer.filter = srv.dialFilter()
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -495,6 +659,9 @@ func (srv *Server) Start() (err error) {
 		if err := srv.startListening(); err != nil {
 			return err
 		}
+		if srv.DiscV5 != nil {
+			srv.registerTopics()
+		}
 	}
 	if srv.NoDial && srv.ListenAddr == "" {
 		srv.log.Warn("P2P server will be useless, neither dialing nor listening")
@@ -521,7 +688,7 @@ func (srv *Server) startListening() error {
 	if !laddr.IP.IsLoopback() && srv.NAT != nil {
 		srv.loopWG.Add(1)
 		go func() {
-			nat.Map(srv.NAT, srv.quit, "tcp", laddr.Port, laddr.Port, "watereum p2p")
+			srv.nat.mapPort(srv.quit, "tcp", laddr.Port, "watereum p2p")
 			srv.loopWG.Done()
 		}()
 	}
@@ -533,6 +700,7 @@ type dialer interface {
 	taskDone(task, time.Time)
 	addStatic(*discover.Node)
 	removeStatic(*discover.Node)
+	setMaxDynDials(int)
 }
 
 func (srv *Server) run(dialstate dialer) {
@@ -541,16 +709,22 @@ func (srv *Server) run(dialstate dialer) {
 		peers        = make(map[discover.NodeID]*Peer)
 		inboundCount = 0
 		trusted      = make(map[discover.NodeID]bool, len(srv.TrustedNodes))
+		protoLimits  = make(map[string]int, len(srv.ProtocolMaxPeers))
+		inboundIPs   = newIPLimiter(srv.maxInboundPerIP(), srv.maxInboundPerSubnet())
 		taskdone     = make(chan task, maxActiveDialTasks)
 		runningTasks []task
 		queuedTasks  []task // tasks that can't run yet
 	)
 	// Put trusted nodes into a map to speed up checks.
-	// Trusted peers are loaded on startup and cannot be
-	// modified while the server is running.
+	// Trusted peers are loaded on startup or added via AddTrustedPeer RPC.
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID] = true
 	}
+	for name, max := range srv.ProtocolMaxPeers {
+		if max > 0 {
+			protoLimits[name] = max
+		}
+	}
 
 	// removes t from runningTasks
 	delTask := func(t task) {
@@ -605,6 +779,38 @@ running:
 			if p, ok := peers[n.ID]; ok {
 				p.Disconnect(DiscRequested)
 			}
+		case n := <-srv.addtrusted:
+			// This channel is used by AddTrustedPeer to add an enode
+			// to the trusted node set.
+			srv.log.Trace("Adding trusted node", "node", n)
+			trusted[n.ID] = true
+			// Mark any already-connected peer as trusted
+			if p, ok := peers[n.ID]; ok {
+				p.rw.set(trustedConn, true)
+			}
+		case n := <-srv.removetrusted:
+			// This channel is used by RemoveTrustedPeer to remove an enode
+			// from the trusted node set.
+			srv.log.Trace("Removing trusted node", "node", n)
+			delete(trusted, n.ID)
+			// Unmark any already-connected peer as trusted
+			if p, ok := peers[n.ID]; ok {
+				p.rw.set(trustedConn, false)
+			}
+		case l := <-srv.setlimit:
+			// This channel is used by SetMaxPeers and SetProtocolMaxPeers.
+			switch {
+			case l.proto == "":
+				srv.log.Debug("Changing peer limit", "max", l.max)
+				srv.MaxPeers = l.max
+				dialstate.setMaxDynDials(srv.maxDialedConns())
+			case l.max > 0:
+				srv.log.Debug("Changing protocol peer limit", "proto", l.proto, "max", l.max)
+				protoLimits[l.proto] = l.max
+			default:
+				srv.log.Debug("Removing protocol peer limit", "proto", l.proto)
+				delete(protoLimits, l.proto)
+			}
 		case op := <-srv.peerOp:
 			// This channel is used by Peers and PeerCount.
 			op(peers)
@@ -621,21 +827,22 @@ running:
 			// the remote identity is known (but hasn't been verified yet).
 			if trusted[c.id] {
 				// Ensure that the trusted flag is set before checking against MaxPeers.
-				c.flags |= trustedConn
+				c.set(trustedConn, true)
 			}
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
 			select {
-			case c.cont <- srv.encHandshakeChecks(peers, inboundCount, c):
+			case c.cont <- srv.encHandshakeChecks(peers, inboundCount, inboundIPs, c):
 			case <-srv.quit:
 				break running
 			}
 		case c := <-srv.addpeer:
 			// At this point the connection is past the protocol handshake.
 			// Its capabilities are known and the remote identity is verified.
-			err := srv.protoHandshakeChecks(peers, inboundCount, c)
+			err := srv.protoHandshakeChecks(peers, inboundCount, inboundIPs, protoLimits, c)
 			if err == nil {
 				// The handshakes are done and it passed all checks.
 				p := newPeer(c, srv.Protocols)
+				srv.traffic.attach(p)
 				// If message events are enabled, pass the peerFeed
 				// to the peer
 				if srv.EnableMsgEvents {
@@ -647,6 +854,7 @@ running:
 				peers[c.id] = p
 				if p.Inbound() {
 					inboundCount++
+					inboundIPs.add(c.remoteIP())
 				}
 			}
 			// The dialer logic relies on the assumption that
@@ -664,6 +872,7 @@ running:
 			delete(peers, pd.ID())
 			if pd.Inbound() {
 				inboundCount--
+				inboundIPs.remove(pd.rw.remoteIP())
 			}
 		}
 	}
@@ -674,9 +883,15 @@ running:
 	if srv.ntab != nil {
 		srv.ntab.Close()
 	}
+	if srv.topics != nil {
+		srv.topics.close()
+	}
 	if srv.DiscV5 != nil {
 		srv.DiscV5.Close()
 	}
+	if srv.dnsdisc != nil {
+		srv.dnsdisc.Stop()
+	}
 	// Disconnect all peers.
 	for _, p := range peers {
 		p.Disconnect(DiscQuitting)
@@ -691,22 +906,28 @@ running:
 	}
 }
 
-func (srv *Server) protoHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCount int, c *conn) error {
+func (srv *Server) protoHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCount int, inboundIPs *ipLimiter, protoLimits map[string]int, c *conn) error {
 	// Drop connections with no matching protocols.
-	if len(srv.Protocols) > 0 && countMatchingProtocols(srv.Protocols, c.caps) == 0 {
+	if !srv.AcceptUselessPeers && len(srv.Protocols) > 0 && countMatchingProtocols(srv.Protocols, c.caps) == 0 {
 		return DiscUselessPeer
 	}
+	// Drop connections running any protocol at its limit.
+	if !c.is(trustedConn|staticDialedConn) && !srv.hasProtocolSlots(peers, protoLimits, c) {
+		return DiscTooManyPeers
+	}
 	// Repeat the encryption handshake checks because the
 	// peer set might have changed between the handshakes.
-	return srv.encHandshakeChecks(peers, inboundCount, c)
+	return srv.encHandshakeChecks(peers, inboundCount, inboundIPs, c)
 }
 
-func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCount int, c *conn) error {
+func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCount int, inboundIPs *ipLimiter, c *conn) error {
 	switch {
 	case !c.is(trustedConn|staticDialedConn) && len(peers) >= srv.MaxPeers:
 		return DiscTooManyPeers
 	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
 		return DiscTooManyPeers
+	case !c.is(trustedConn) && c.is(inboundConn) && !inboundIPs.allowed(c.remoteIP()):
+		return DiscTooManyPeers
 	case peers[c.id] != nil:
 		return DiscAlreadyConnected
 	case c.id == srv.Self().ID:
@@ -716,12 +937,56 @@ func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCo
 	}
 }
 
+// hasProtocolSlots reports whwater all the protocols the connection would run
+// are below their peer limits.
+func (srv *Server) hasProtocolSlots(peers map[discover.NodeID]*Peer, protoLimits map[string]int, c *conn) bool {
+	for _, proto := range srv.Protocols {
+		max, limited := protoLimits[proto.Name]
+		if !limited || !hasCap(c.caps, proto.cap()) {
+			continue
+		}
+		count := 0
+		for _, p := range peers {
+			if _, ok := p.running[proto.Name]; ok && !p.rw.is(trustedConn|staticDialedConn) {
+				count++
+			}
+		}
+		if count >= max {
+			return false
+		}
+	}
+	return true
+}
+
+func hasCap(caps []Cap, cap Cap) bool {
+	for _, c := range caps {
+		if c == cap {
+			return true
+		}
+	}
+	return false
+}
+
 func (srv *Server) maxInboundConns() int {
 	return srv.MaxPeers - srv.maxDialedConns()
 }
 
+func (srv *Server) maxInboundPerIP() int {
+	if srv.MaxInboundPerIP > 0 {
+		return srv.MaxInboundPerIP
+	}
+	return defaultMaxInboundPerIP
+}
+
+func (srv *Server) maxInboundPerSubnet() int {
+	if srv.MaxInboundPerSubnet > 0 {
+		return srv.MaxInboundPerSubnet
+	}
+	return defaultMaxInboundPerSubnet
+}
+
 func (srv *Server) maxDialedConns() int {
-	if srv.NoDiscovery || srv.NoDial {
+	if srv.NoDial || (srv.NoDiscovery && srv.topics == nil) {
 		return 0
 	}
 	r := srv.DialRatio
@@ -749,6 +1014,7 @@ func (srv *Server) listenLoop() {
 	for i := 0; i < tokens; i++ {
 		slots <- struct{}{}
 	}
+	throttle := newIPThrottle()
 
 	for {
 		// Wait for a handshake slot before accepting.
@@ -779,6 +1045,13 @@ func (srv *Server) listenLoop() {
 				continue
 			}
 		}
+		// Reject Internet hosts which reconnect too often.
+		if tcp, ok := fd.RemoteAddr().(*net.TCPAddr); ok && !throttle.check(tcp.IP, time.Now()) {
+			srv.log.Debug("Rejected conn (reconnecting too often)", "addr", fd.RemoteAddr())
+			fd.Close()
+			slots <- struct{}{}
+			continue
+		}
 
 		fd = newMeteredConn(fd, true)
 		srv.log.Trace("Accepted connection", "addr", fd.RemoteAddr())
@@ -797,6 +1070,9 @@ func (srv *Server) SetupConn(fd net.Conn, flags connFlag, dialDest *discover.Nod
 	if self == nil {
 		return errors.New("shutdown")
 	}
+	if srv.traffic != nil {
+		fd = srv.traffic.wrap(fd)
+	}
 	c := &conn{fd: fd, transport: srv.newTransport(fd), flags: flags, cont: make(chan error)}
 	err := srv.setupConn(c, flags, dialDest)
 	if err != nil {
@@ -905,6 +1181,58 @@ func (srv *Server) runPeer(p *Peer) {
 	srv.delpeer <- peerDrop{p, err, remoteRequested}
 }
 
+// dialScore aggregates the reputation of nodes tracked by the protocols into a
+// single score, the worst of all protocols. It returns nil if no protocol does
+// track reputation.
+func (srv *Server) dialScore() func(discover.NodeID) float64 {
+	var (
+		scorers []func(discover.NodeID) float64
+		seen    = make(map[string]bool)
+	)
+	for _, proto := range srv.Protocols {
+		// Only query once per protocol type, the versions share the reputation
+		if proto.DialScore != nil && !seen[proto.Name] {
+			scorers = append(scorers, proto.DialScore)
+			seen[proto.Name] = true
+		}
+	}
+	if len(scorers) == 0 {
+		return nil
+	}
+	return func(id discover.NodeID) float64 {
+		score := scorers[0](id)
+		for _, scorer := range scorers[1:] {
+			if s := scorer(id); s < score {
+				score = s
+			}
+		}
+		return score
+	}
+}
+
+// dialFilter combines the dial filters of the protocols, accepting a node if any
+// of the protocols having a filter accepts it. It returns nil if no protocol
+// filters its dial candidates.
+func (srv *Server) dialFilter() func(*discover.Node) bool {
+	var filters []func(*discover.Node) bool
+	for _, proto := range srv.Protocols {
+		if proto.DialFilter != nil {
+			filters = append(filters, proto.DialFilter)
+		}
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return func(n *discover.Node) bool {
+		for _, filter := range filters {
+			if filter(n) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // NodeInfo represents a short summary of the information known about the host.
 type NodeInfo struct {
 	ID    string `json:"id"`    // Unique node identifier (also the encryption key)
@@ -916,6 +1244,7 @@ type NodeInfo struct {
 		Listener  int `json:"listener"`  // TCP listening port for RLPx
 	} `json:"ports"`
 	ListenAddr string                 `json:"listenAddr"`
+	NAT        *NATInfo               `json:"nat,omitempty"` // Port mappings and external endpoint, nil if not running
 	Protocols  map[string]interface{} `json:"protocols"`
 }
 
@@ -935,6 +1264,12 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	info.Ports.Discovery = int(node.UDP)
 	info.Ports.Listener = int(node.TCP)
 
+	srv.lock.Lock()
+	if srv.running {
+		info.NAT = srv.nat.info()
+	}
+	srv.lock.Unlock()
+
 	// Gather all the running protocol infos (only once per protocol type)
 	for _, proto := range srv.Protocols {
 		if _, ok := info.Protocols[proto.Name]; !ok {
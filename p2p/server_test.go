@@ -29,6 +29,7 @@ import (
 	"github.com/watchain/go-watchain/crypto/sha3"
 	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/discv5"
 )
 
 func init() {
@@ -309,6 +310,8 @@ func (tg taskgen) addStatic(*discover.Node) {
 }
 func (tg taskgen) removeStatic(*discover.Node) {
 }
+func (tg taskgen) setMaxDynDials(int) {
+}
 
 type testTask struct {
 	index  int
@@ -366,6 +369,270 @@ func TestServerAtCap(t *testing.T) {
 
 }
 
+func TestServerPeerLimits(t *testing.T) {
+	var (
+		watProto = Protocol{Name: "wat", Version: 1, Length: 1, Run: runUntilClosed}
+		lesProto = Protocol{Name: "les", Version: 1, Length: 1, Run: runUntilClosed}
+	)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:       newkey(),
+			MaxPeers:         4,
+			NoDial:           true,
+			Protocols:        []Protocol{watProto, lesProto},
+			ProtocolMaxPeers: map[string]int{"les": 1},
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(caps ...Cap) *conn {
+		fd, _ := net.Pipe()
+		id := randomID()
+		tx := newTestTransport(id, fd)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, id: id, caps: caps, cont: make(chan error)}
+	}
+
+	// The first les-only peer takes the single les slot.
+	if err := srv.checkpoint(newconn(lesProto.cap()), srv.addpeer); err != nil {
+		t.Fatalf("could not add les peer: %v", err)
+	}
+	if err := srv.checkpoint(newconn(lesProto.cap()), srv.addpeer); err != DiscTooManyPeers {
+		t.Fatalf("wrong error for les peer above limit: %v", err)
+	}
+	// Peers also running wat are rejected, as they would run the full les too,
+	// while peers running wat alone are still accepted.
+	if err := srv.checkpoint(newconn(watProto.cap(), lesProto.cap()), srv.addpeer); err != DiscTooManyPeers {
+		t.Fatalf("wrong error for wat and les peer above limit: %v", err)
+	}
+	if err := srv.checkpoint(newconn(watProto.cap()), srv.addpeer); err != nil {
+		t.Fatalf("could not add wat peer: %v", err)
+	}
+	// Raising the protocol limit frees a slot.
+	srv.SetProtocolMaxPeers("les", 3)
+	if err := srv.checkpoint(newconn(lesProto.cap()), srv.addpeer); err != nil {
+		t.Fatalf("could not add les peer after raising limit: %v", err)
+	}
+	if err := srv.checkpoint(newconn(watProto.cap(), lesProto.cap()), srv.addpeer); err != nil {
+		t.Fatalf("could not add wat and les peer after raising limit: %v", err)
+	}
+	// Lowering the total limit rejects further peers.
+	srv.SetMaxPeers(4)
+	if err := srv.checkpoint(newconn(watProto.cap()), srv.addpeer); err != DiscTooManyPeers {
+		t.Fatalf("wrong error for peer above total limit: %v", err)
+	}
+	srv.SetMaxPeers(10)
+	if err := srv.checkpoint(newconn(watProto.cap()), srv.addpeer); err != nil {
+		t.Fatalf("could not add peer after raising total limit: %v", err)
+	}
+}
+
+// This test checks that lowering MaxPeers at runtime keeps the connected peers,
+// rejects new inbound peers above the limit and lowers the dynamic dial count.
+func TestServerSetMaxPeers(t *testing.T) {
+	srv := &Server{
+		Config:        Config{PrivateKey: newkey(), MaxPeers: 30},
+		ntab:          fakeTable{},
+		running:       true,
+		log:           log.New(),
+		quit:          make(chan struct{}),
+		addpeer:       make(chan *conn),
+		delpeer:       make(chan peerDrop),
+		posthandshake: make(chan *conn),
+		setlimit:      make(chan peerLimit),
+		peerOp:        make(chan peerOpFunc),
+		peerOpDone:    make(chan struct{}),
+	}
+	dialer := newDialState(nil, nil, fakeTable{}, srv.maxDialedConns(), nil)
+	srv.loopWG.Add(1)
+	go srv.run(dialer)
+	defer srv.Stop()
+
+	newconn := func() *conn {
+		fd, _ := net.Pipe()
+		id := randomID()
+		tx := newTestTransport(id, fd)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, id: id, cont: make(chan error)}
+	}
+	for i := 0; i < 12; i++ {
+		if err := srv.checkpoint(newconn(), srv.addpeer); err != nil {
+			t.Fatalf("could not add conn %d: %v", i, err)
+		}
+	}
+	// Lower the limit to the current peer count, inbound peers are rejected
+	// while the connected ones are kept.
+	srv.SetMaxPeers(12)
+	if err := srv.checkpoint(newconn(), srv.posthandshake); err != DiscTooManyPeers {
+		t.Fatalf("wrong error for inbound conn above lowered limit: %v", err)
+	}
+	if n := srv.PeerCount(); n != 12 {
+		t.Fatalf("peer count mismatch after lowering limit: have %d, want 12", n)
+	}
+	// Stop the server to access the dialer without racing the run loop and
+	// check that it only creates dials for the lowered limit: half of the 4
+	// dynamic dials are taken from the table, instead of half of the initial 10.
+	srv.Stop()
+
+	table := make(fakeTable, 20)
+	for i := range table {
+		table[i] = &discover.Node{ID: uintID(uint32(i + 1))}
+	}
+	dialer.ntab = table
+
+	var dials int
+	for _, task := range dialer.newTasks(0, nil, time.Now()) {
+		if dt, ok := task.(*dialTask); ok && dt.flags&dynDialedConn != 0 {
+			dials++
+		}
+	}
+	if dials != 2 {
+		t.Fatalf("dynamic dial count mismatch: have %d, want 2", dials)
+	}
+}
+
+func TestServerTrustedPeerRuntime(t *testing.T) {
+	srv := &Server{
+		Config: Config{
+			PrivateKey: newkey(),
+			MaxPeers:   1,
+			NoDial:     true,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id discover.NodeID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(id, fd)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, id: id, cont: make(chan error)}
+	}
+	// Fill the peer set.
+	if err := srv.checkpoint(newconn(randomID()), srv.addpeer); err != nil {
+		t.Fatalf("could not add conn: %v", err)
+	}
+	// The server rejects the node until it is trusted.
+	trustedID := randomID()
+	c := newconn(trustedID)
+	if err := srv.checkpoint(c, srv.posthandshake); err != DiscTooManyPeers {
+		t.Error("wrong error for insert:", err)
+	}
+	srv.AddTrustedPeer(&discover.Node{ID: trustedID})
+	c = newconn(trustedID)
+	if err := srv.checkpoint(c, srv.posthandshake); err != nil {
+		t.Fatal("unexpected error for trusted conn @posthandshake:", err)
+	}
+	if err := srv.checkpoint(c, srv.addpeer); err != nil {
+		t.Fatal("unexpected error for trusted conn @addpeer:", err)
+	}
+	if !c.is(trustedConn) {
+		t.Error("Server did not set trusted flag")
+	}
+	// Removing the node unmarks the connected peer.
+	srv.RemoveTrustedPeer(&discover.Node{ID: trustedID})
+	srv.PeerCount() // wait for the removal to be processed
+	if c.is(trustedConn) {
+		t.Error("Server did not unset trusted flag")
+	}
+}
+
+// This test checks that the server limits inbound connections per IP address,
+// except for trusted nodes.
+func TestServerInboundIPLimit(t *testing.T) {
+	trustedID := randomID()
+	srv := &Server{
+		Config: Config{
+			PrivateKey:      newkey(),
+			MaxPeers:        10,
+			MaxInboundPerIP: 1,
+			NoDial:          true,
+			TrustedNodes:    []*discover.Node{{ID: trustedID}},
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id discover.NodeID, ip string) *conn {
+		fd, _ := net.Pipe()
+		fd = &remoteAddrConn{fd, &net.TCPAddr{IP: net.ParseIP(ip), Port: 30303}}
+		tx := newTestTransport(id, fd)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, id: id, cont: make(chan error)}
+	}
+	if err := srv.checkpoint(newconn(randomID(), "1.2.3.4"), srv.addpeer); err != nil {
+		t.Fatalf("could not add conn: %v", err)
+	}
+	if err := srv.checkpoint(newconn(randomID(), "1.2.3.4"), srv.posthandshake); err != DiscTooManyPeers {
+		t.Error("wrong error for second conn from same IP:", err)
+	}
+	if err := srv.checkpoint(newconn(randomID(), "1.2.4.4"), srv.posthandshake); err != nil {
+		t.Error("unexpected error for conn from other IP:", err)
+	}
+	if err := srv.checkpoint(newconn(trustedID, "1.2.3.4"), srv.posthandshake); err != nil {
+		t.Error("unexpected error for trusted conn:", err)
+	}
+}
+
+// This test checks that servers find and dial each other through the discovery
+// topic of their protocol.
+func TestServerDiscoveryTopics(t *testing.T) {
+	proto := Protocol{Name: "a", Version: 1, Length: 1, Run: runUntilClosed, DiscoveryTopic: "a@1"}
+	start := func(boowatrap []*discv5.Node) *Server {
+		// Discovery v5 advertises the UDP port as TCP port, so both must match.
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := l.Addr().String()
+		l.Close()
+		srv := &Server{
+			Config: Config{
+				PrivateKey:       newkey(),
+				MaxPeers:         10,
+				ListenAddr:       addr,
+				NoDiscovery:      true,
+				DiscoveryV5:      true,
+				BoowatrapNodesV5: boowatrap,
+				Protocols:        []Protocol{proto},
+			},
+		}
+		if err := srv.Start(); err != nil {
+			t.Fatalf("could not start: %v", err)
+		}
+		return srv
+	}
+	boot := start(nil)
+	defer boot.Stop()
+	srv1 := start([]*discv5.Node{boot.DiscV5.Self()})
+	defer srv1.Stop()
+	srv2 := start([]*discv5.Node{boot.DiscV5.Self()})
+	defer srv2.Stop()
+
+	for deadline := time.Now().Add(20 * time.Second); time.Now().Before(deadline); {
+		if srv1.PeerCount() == 2 && srv2.PeerCount() == 2 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("servers not connected: %d and %d peers", srv1.PeerCount(), srv2.PeerCount())
+}
+
+type remoteAddrConn struct {
+	net.Conn
+	addr *net.TCPAddr
+}
+
+func (c *remoteAddrConn) RemoteAddr() net.Addr { return c.addr }
+
+func runUntilClosed(p *Peer, rw MsgReadWriter) error {
+	_, err := rw.ReadMsg()
+	return err
+}
+
 func TestServerSetupConn(t *testing.T) {
 	id := randomID()
 	srvkey := newkey()
@@ -453,6 +720,22 @@ func TestServerSetupConn(t *testing.T) {
 	}
 }
 
+// Tests that peers sharing no protocol are only kept if the server accepts
+// useless peers.
+func TestServerAcceptUselessPeers(t *testing.T) {
+	srv := &Server{Config: Config{PrivateKey: newkey(), MaxPeers: 10, Protocols: []Protocol{discard}}}
+	c := &conn{id: randomID(), flags: staticDialedConn, caps: []Cap{{Name: "other", Version: 1}}}
+	peers := make(map[discover.NodeID]*Peer)
+
+	if err := srv.protoHandshakeChecks(peers, 0, nil, nil, c); err != DiscUselessPeer {
+		t.Fatalf("check error mismatch: got %v, want %v", err, DiscUselessPeer)
+	}
+	srv.AcceptUselessPeers = true
+	if err := srv.protoHandshakeChecks(peers, 0, nil, nil, c); err != nil {
+		t.Fatalf("useless peer rejected: %v", err)
+	}
+}
+
 type setupTransport struct {
 	id              discover.NodeID
 	encHandshakeErr error
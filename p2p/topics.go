@@ -0,0 +1,96 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/discv5"
+)
+
+// topicSearches provides the nodes found by the discovery v5 topic searches
+// of the protocols as dial candidates.
+type topicSearches struct {
+	searches []*discv5.TopicSearch
+	buf      []*discv5.Node
+}
+
+// registerTopics advertises the discovery topics of the protocols until the
+// server is stopped.
+func (srv *Server) registerTopics() {
+	for _, topic := range srv.discoveryTopics() {
+		topic := topic
+		srv.loopWG.Add(1)
+		go func() {
+			srv.DiscV5.RegisterTopic(topic, srv.quit)
+			srv.loopWG.Done()
+		}()
+	}
+}
+
+// searchTopics starts searching for the discovery topics of the protocols. It
+// returns nil if there is nothing to search for.
+func (srv *Server) searchTopics() *topicSearches {
+	topics := srv.discoveryTopics()
+	if len(topics) == 0 {
+		return nil
+	}
+	searches := new(topicSearches)
+	for _, topic := range topics {
+		searches.searches = append(searches.searches, srv.DiscV5.NewTopicSearch(topic))
+	}
+	return searches
+}
+
+// discoveryTopics returns the distinct discovery topics of the protocols.
+func (srv *Server) discoveryTopics() []discv5.Topic {
+	var (
+		topics []discv5.Topic
+		seen   = make(map[discv5.Topic]bool)
+	)
+	for _, proto := range srv.Protocols {
+		if topic := proto.DiscoveryTopic; topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// ReadRandomNodes fills buf with random nodes found by the searches, sharing
+// the space evenly among them.
+func (t *topicSearches) ReadRandomNodes(buf []*discover.Node) int {
+	if len(t.buf) < len(buf) {
+		t.buf = make([]*discv5.Node, len(buf))
+	}
+	n := 0
+	for i, s := range t.searches {
+		share := (len(buf) - n) / (len(t.searches) - i)
+		found := s.ReadRandomNodes(t.buf[:share])
+		for _, node := range t.buf[:found] {
+			buf[n] = discover.NewNode(discover.NodeID(node.ID), node.IP, node.UDP, node.TCP)
+			n++
+		}
+	}
+	return n
+}
+
+// close stops the searches.
+func (t *topicSearches) close() {
+	for _, s := range t.searches {
+		s.Close()
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/watchain/go-watchain/metrics"
+)
+
+// TrafficInfo is a breakdown of the network traffic of the server.
+type TrafficInfo struct {
+	Ingress   uint64                                `json:"ingress"`   // Bytes received over all connections
+	Egress    uint64                                `json:"egress"`    // Bytes sent over all connections
+	Protocols map[string]map[string]*MsgTrafficInfo `json:"protocols"` // Message statistics, keyed by protocol and message code
+	Peers     []*PeerTrafficInfo                    `json:"peers"`     // Traffic of the connected peers
+}
+
+// MsgTrafficInfo counts the messages of a single message code.
+type MsgTrafficInfo struct {
+	InPackets  uint64 `json:"inPackets"`
+	InBytes    uint64 `json:"inBytes"`
+	OutPackets uint64 `json:"outPackets"`
+	OutBytes   uint64 `json:"outBytes"`
+}
+
+// PeerTrafficInfo is the traffic exchanged with a connected peer.
+type PeerTrafficInfo struct {
+	ID        string                       `json:"id"`
+	Name      string                       `json:"name"`
+	Ingress   uint64                       `json:"ingress"`   // Bytes received over the connection
+	Egress    uint64                       `json:"egress"`    // Bytes sent over the connection
+	Protocols map[string]*ProtoTrafficInfo `json:"protocols"` // Payload bytes, keyed by protocol name
+}
+
+// ProtoTrafficInfo is the payload size of the messages of a protocol.
+type ProtoTrafficInfo struct {
+	Ingress uint64 `json:"ingress"`
+	Egress  uint64 `json:"egress"`
+}
+
+// trafficStats accounts the traffic of a server and holds its bandwidth limits.
+type trafficStats struct {
+	ingress, egress uint64 // bytes transferred over all connections (atomic)
+
+	protocols map[Cap]*protoTraffic // message counters of the protocols
+
+	ingressLimit, egressLimit *tokenBucket            // global caps, nil if unlimited
+	peerIngress, peerEgress   int                     // per connection caps, zero if unlimited
+	protoLimits               map[string]*tokenBucket // egress caps of protocols, keyed by name
+}
+
+func newTrafficStats(cfg *Config) *trafficStats {
+	s := &trafficStats{
+		protocols:    make(map[Cap]*protoTraffic),
+		ingressLimit: newTokenBucket(cfg.MaxIngressRate),
+		egressLimit:  newTokenBucket(cfg.MaxEgressRate),
+		peerIngress:  cfg.MaxPeerIngressRate,
+		peerEgress:   cfg.MaxPeerEgressRate,
+		protoLimits:  make(map[string]*tokenBucket),
+	}
+	for _, proto := range cfg.Protocols {
+		s.protocols[proto.cap()] = newProtoTraffic(proto)
+	}
+	for name, rate := range cfg.ProtocolEgressRates {
+		if limit := newTokenBucket(rate); limit != nil {
+			s.protoLimits[name] = limit
+		}
+	}
+	return s
+}
+
+// wrap returns the connection counting its traffic and enforcing the limits.
+func (s *trafficStats) wrap(fd net.Conn) *trafficConn {
+	c := &trafficConn{Conn: fd, stats: s, closed: make(chan struct{})}
+	for _, limit := range []*tokenBucket{s.ingressLimit, newTokenBucket(s.peerIngress)} {
+		if limit != nil {
+			c.readLimits = append(c.readLimits, limit)
+		}
+	}
+	for _, limit := range []*tokenBucket{s.egressLimit, newTokenBucket(s.peerEgress)} {
+		if limit != nil {
+			c.writeLimits = append(c.writeLimits, limit)
+		}
+	}
+	return c
+}
+
+// attach sets up the message accounting of the peer's protocols.
+func (s *trafficStats) attach(p *Peer) {
+	for _, rw := range p.running {
+		rw.traffic = s.protocols[rw.cap()]
+		rw.limit = s.protoLimits[rw.Name]
+	}
+}
+
+// info returns the message counters of all protocols.
+func (s *trafficStats) info() *TrafficInfo {
+	info := &TrafficInfo{
+		Ingress:   atomic.LoadUint64(&s.ingress),
+		Egress:    atomic.LoadUint64(&s.egress),
+		Protocols: make(map[string]map[string]*MsgTrafficInfo),
+	}
+	for cap, proto := range s.protocols {
+		msgs := make(map[string]*MsgTrafficInfo)
+		for code, m := range proto.codes {
+			if m := m.info(); m.InPackets > 0 || m.OutPackets > 0 {
+				msgs[fmt.Sprintf("%#x", code)] = m
+			}
+		}
+		info.Protocols[cap.String()] = msgs
+	}
+	return info
+}
+
+// protoTraffic counts the messages of a protocol, per message code.
+type protoTraffic struct {
+	cap   Cap
+	codes []*msgTraffic // indexed by message code
+}
+
+func newProtoTraffic(proto Protocol) *protoTraffic {
+	t := &protoTraffic{cap: proto.cap(), codes: make([]*msgTraffic, proto.Length)}
+	for i := range t.codes {
+		t.codes[i] = new(msgTraffic)
+	}
+	return t
+}
+
+// received accounts an incoming message.
+func (t *protoTraffic) received(code uint64, size uint32) {
+	if t == nil || code >= uint64(len(t.codes)) {
+		return
+	}
+	m := t.codes[code]
+	atomic.AddUint64(&m.inPackets, 1)
+	atomic.AddUint64(&m.inBytes, uint64(size))
+	if metrics.Enabled {
+		m.registerMeters(t.cap, code)
+		m.inPacketMeter.Mark(1)
+		m.inByteMeter.Mark(int64(size))
+	}
+}
+
+// sent accounts an outgoing message.
+func (t *protoTraffic) sent(code uint64, size uint32) {
+	if t == nil || code >= uint64(len(t.codes)) {
+		return
+	}
+	m := t.codes[code]
+	atomic.AddUint64(&m.outPackets, 1)
+	atomic.AddUint64(&m.outBytes, uint64(size))
+	if metrics.Enabled {
+		m.registerMeters(t.cap, code)
+		m.outPacketMeter.Mark(1)
+		m.outByteMeter.Mark(int64(size))
+	}
+}
+
+// msgTraffic counts the messages of a single code.
+type msgTraffic struct {
+	inPackets, inBytes, outPackets, outBytes uint64 // atomic
+
+	// Meters registered on first use if metrics are enabled.
+	register                     sync.Once
+	inPacketMeter, inByteMeter   metrics.Meter
+	outPacketMeter, outByteMeter metrics.Meter
+}
+
+func (m *msgTraffic) registerMeters(cap Cap, code uint64) {
+	m.register.Do(func() {
+		prefix := fmt.Sprintf("p2p/msg/%s/%d/%d", cap.Name, cap.Version, code)
+		m.inPacketMeter = metrics.NewRegisteredMeter(prefix+"/in/packets", nil)
+		m.inByteMeter = metrics.NewRegisteredMeter(prefix+"/in/bytes", nil)
+		m.outPacketMeter = metrics.NewRegisteredMeter(prefix+"/out/packets", nil)
+		m.outByteMeter = metrics.NewRegisteredMeter(prefix+"/out/bytes", nil)
+	})
+}
+
+func (m *msgTraffic) info() *MsgTrafficInfo {
+	return &MsgTrafficInfo{
+		InPackets:  atomic.LoadUint64(&m.inPackets),
+		InBytes:    atomic.LoadUint64(&m.inBytes),
+		OutPackets: atomic.LoadUint64(&m.outPackets),
+		OutBytes:   atomic.LoadUint64(&m.outBytes),
+	}
+}
+
+// trafficConn is a network connection counting the transferred bytes and
+// limiting its bandwidth.
+type trafficConn struct {
+	ingress, egress uint64 // bytes transferred over this connection (atomic)
+
+	net.Conn
+	stats *trafficStats
+
+	readLimits, writeLimits []*tokenBucket
+
+	lock                  sync.Mutex
+	readUntil, writeUntil time.Time // end of the waits paying off the transferred bytes
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Read reads from the connection, taking the received bytes from the ingress
+// limits. The wait paying them off is done by waitRead.
+func (c *trafficConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.ingress, uint64(n))
+	atomic.AddUint64(&c.stats.ingress, uint64(n))
+	c.reserve(c.readLimits, n, &c.readUntil)
+	return n, err
+}
+
+// Write writes to the connection, taking the sent bytes from the egress limits.
+// The wait paying them off is done by waitWrite.
+func (c *trafficConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.egress, uint64(n))
+	atomic.AddUint64(&c.stats.egress, uint64(n))
+	c.reserve(c.writeLimits, n, &c.writeUntil)
+	return n, err
+}
+
+// waitRead blocks until the bytes received so far are paid off, which throttles
+// the remote side. It must be called before setting the deadline of the next
+// read, so the wait doesn't count against the time allowed for a message.
+func (c *trafficConn) waitRead() {
+	c.wait(&c.readUntil)
+}
+
+// waitWrite blocks until the bytes sent so far are paid off. It must be called
+// before setting the deadline of the next write.
+func (c *trafficConn) waitWrite() {
+	c.wait(&c.writeUntil)
+}
+
+// reserve takes n bytes from the limits, extending the wait paying them off.
+func (c *trafficConn) reserve(limits []*tokenBucket, n int, until *time.Time) {
+	if len(limits) == 0 || n == 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	for _, limit := range limits {
+		if end := now.Add(limit.reserve(n)); end.After(*until) {
+			*until = end
+		}
+	}
+}
+
+// wait blocks until the given time or until the connection is closed.
+func (c *trafficConn) wait(until *time.Time) {
+	c.lock.Lock()
+	delay := time.Until(*until)
+	c.lock.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.closed:
+		}
+	}
+}
+
+// Close closes the connection, aborting pending waits for bandwidth.
+func (c *trafficConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// tokenBucket limits the throughput of a byte stream. Taking more tokens than
+// available puts the bucket into debt, which is paid off by waiting. This lets
+// messages larger than the burst size pass at the configured rate.
+type tokenBucket struct {
+	rate  float64 // tokens added per second
+	burst float64 // maximum number of accumulated tokens
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time // replaceable for testing
+}
+
+// newTokenBucket creates a bucket allowing the given number of bytes per second,
+// with bursts of up to one second worth of data. It returns nil if the rate is
+// not positive, meaning unlimited.
+func newTokenBucket(rate int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), burst: float64(rate), tokens: float64(rate), last: time.Now(), now: time.Now}
+}
+
+// reserve takes n tokens and returns the time to wait until they are paid off.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait takes n tokens, blocking until they are paid off or abort is closed.
+func (b *tokenBucket) wait(n int, abort <-chan struct{}) {
+	if delay := b.reserve(n); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-abort:
+		}
+	}
+}
+
+// trafficInfo returns the traffic exchanged with the peer.
+func (p *Peer) trafficInfo() *PeerTrafficInfo {
+	info := &PeerTrafficInfo{
+		ID:        p.ID().String(),
+		Name:      p.Name(),
+		Protocols: make(map[string]*ProtoTrafficInfo),
+	}
+	if c, ok := p.rw.fd.(*trafficConn); ok {
+		info.Ingress = atomic.LoadUint64(&c.ingress)
+		info.Egress = atomic.LoadUint64(&c.egress)
+	}
+	for _, rw := range p.running {
+		info.Protocols[rw.Name] = &ProtoTrafficInfo{
+			Ingress: atomic.LoadUint64(&rw.ingress),
+			Egress:  atomic.LoadUint64(&rw.egress),
+		}
+	}
+	return info
+}
+
+// TrafficInfo returns a breakdown of the network traffic by protocol, message
+// code and peer.
+func (srv *Server) TrafficInfo() *TrafficInfo {
+	srv.lock.Lock()
+	stats := srv.traffic
+	srv.lock.Unlock()
+	if stats == nil {
+		return &TrafficInfo{}
+	}
+	info := stats.info()
+	for _, peer := range srv.Peers() {
+		info.Peers = append(info.Peers, peer.trafficInfo())
+	}
+	sort.Slice(info.Peers, func(i, j int) bool { return info.Peers[i].ID < info.Peers[j].ID })
+	return info
+}
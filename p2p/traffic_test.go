@@ -0,0 +1,239 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(1000)
+	b.last, b.now = now, func() time.Time { return now }
+
+	// The initial burst is available immediately.
+	if d := b.reserve(1000); d != 0 {
+		t.Fatalf("burst delayed by %v", d)
+	}
+	// Taking more puts the bucket into debt.
+	if d := b.reserve(500); d != 500*time.Millisecond {
+		t.Fatalf("wrong delay %v, want 500ms", d)
+	}
+	// Waiting refills the bucket at the configured rate.
+	now = now.Add(time.Second)
+	if d := b.reserve(500); d != 0 {
+		t.Fatalf("refilled bucket delayed by %v", d)
+	}
+	// Tokens don't accumulate above the burst size.
+	now = now.Add(time.Hour)
+	if d := b.reserve(1500); d != 500*time.Millisecond {
+		t.Fatalf("wrong delay %v after idle time, want 500ms", d)
+	}
+
+	if newTokenBucket(0) != nil {
+		t.Fatal("zero rate bucket isn't nil")
+	}
+}
+
+func TestTrafficConn(t *testing.T) {
+	stats := newTrafficStats(&Config{MaxPeerEgressRate: 1000})
+	fd1, fd2 := net.Pipe()
+	c1, c2 := stats.wrap(fd1), stats.wrap(fd2)
+	defer c1.Close()
+	defer c2.Close()
+
+	// The second write exceeds the burst, the next one must be delayed.
+	start := time.Now()
+	written := make(chan struct{})
+	go func() {
+		c1.Write(make([]byte, 1000))
+		c1.Write(make([]byte, 500))
+		c1.waitWrite()
+		close(written)
+	}()
+	if _, err := io.ReadFull(c2, make([]byte, 1500)); err != nil {
+		t.Fatal("read error:", err)
+	}
+	<-written
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("write wasn't limited, took %v", elapsed)
+	}
+	if c1.egress != 1500 || c2.ingress != 1500 {
+		t.Errorf("wrong connection counters: egress %d, ingress %d", c1.egress, c2.ingress)
+	}
+	if stats.egress != 1500 || stats.ingress != 1500 {
+		t.Errorf("wrong total counters: egress %d, ingress %d", stats.egress, stats.ingress)
+	}
+
+	// Closing the connection aborts the wait for bandwidth.
+	aborted := make(chan struct{})
+	go func() {
+		go io.Copy(ioutil.Discard, c2)
+		c1.Write(make([]byte, 10000))
+		c1.waitWrite()
+		close(aborted)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c1.Close()
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("write not aborted by close")
+	}
+}
+
+func TestPeerTraffic(t *testing.T) {
+	proto := Protocol{
+		Name:    "a",
+		Version: 1,
+		Length:  5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				return err
+			}
+			return SendItems(rw, 3, "foo")
+		},
+	}
+	stats := newTrafficStats(&Config{Protocols: []Protocol{proto}})
+
+	fd1, fd2 := net.Pipe()
+	c1 := &conn{fd: fd1, transport: newTestTransport(randomID(), fd1), caps: []Cap{proto.cap()}}
+	c2 := &conn{fd: fd2, transport: newTestTransport(randomID(), fd2), caps: []Cap{proto.cap()}}
+	defer c2.close(errors.New("test done"))
+	peer := newPeer(c1, []Protocol{proto})
+	stats.attach(peer)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := peer.run()
+		errc <- err
+	}()
+
+	if err := Send(c2, baseProtocolLength+2, []uint{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExpectMsg(c2, baseProtocolLength+3, []string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != errProtocolReturned {
+			t.Fatalf("peer returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("protocol timeout")
+	}
+
+	msgs := stats.info().Protocols["a/1"]
+	if m := msgs["0x2"]; m == nil || m.InPackets != 1 || m.InBytes != 2 {
+		t.Errorf("wrong counters for received message: %+v", m)
+	}
+	if m := msgs["0x3"]; m == nil || m.OutPackets != 1 || m.OutBytes != 5 {
+		t.Errorf("wrong counters for sent message: %+v", m)
+	}
+	if len(msgs) != 2 {
+		t.Errorf("wrong number of message codes: %d", len(msgs))
+	}
+	info := peer.trafficInfo()
+	if p := info.Protocols["a"]; p == nil || p.Ingress != 2 || p.Egress != 5 {
+		t.Errorf("wrong peer protocol traffic: %+v", p)
+	}
+}
+
+// Tests that peers throttled by a global egress limit are slowed down but not
+// disconnected, even if the wait for bandwidth exceeds the write timeout.
+func TestTrafficLimitNoDisconnect(t *testing.T) {
+	defer func(timeout time.Duration) { frameWriteTimeout = timeout }(frameWriteTimeout)
+	frameWriteTimeout = 100 * time.Millisecond
+
+	const (
+		peers    = 4
+		messages = 8
+		size     = 1000
+	)
+	proto := Protocol{
+		Name:    "a",
+		Version: 1,
+		Length:  1,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			for i := 0; i < messages; i++ {
+				if err := Send(rw, 0, make([]byte, size)); err != nil {
+					return err
+				}
+			}
+			return runUntilClosed(peer, rw)
+		},
+	}
+	srv := &Server{
+		Config: Config{
+			PrivateKey:    newkey(),
+			MaxPeers:      peers,
+			NoDial:        true,
+			Protocols:     []Protocol{proto},
+			MaxEgressRate: 20000,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	// Sending all messages takes more than a second, far beyond the write timeout
+	start := time.Now()
+	errc := make(chan error, peers)
+	for i := 0; i < peers; i++ {
+		fd, remote := net.Pipe()
+		defer remote.Close()
+
+		id := randomID()
+		fd = srv.traffic.wrap(fd)
+		c := &conn{fd: fd, transport: newTestTransport(id, fd), flags: inboundConn, id: id, caps: []Cap{proto.cap()}, cont: make(chan error)}
+		if err := srv.checkpoint(c, srv.addpeer); err != nil {
+			t.Fatalf("could not add peer %d: %v", i, err)
+		}
+		go func() {
+			rw := newTestTransport(randomID(), remote)
+			for received := 0; received < messages; {
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					errc <- err
+					return
+				}
+				if msg.Code == baseProtocolLength {
+					received++
+				}
+				msg.Discard()
+			}
+			errc <- nil
+		}()
+	}
+	for i := 0; i < peers; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("peer disconnected: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Second/2 {
+		t.Errorf("egress wasn't limited, took %v", elapsed)
+	}
+	if n := srv.PeerCount(); n != peers {
+		t.Errorf("peer count mismatch: have %d, want %d", n, peers)
+	}
+}
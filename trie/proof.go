@@ -18,6 +18,7 @@ package trie
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/watchain/go-watchain/common"
@@ -114,7 +115,7 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 		if err != nil {
 			return nil, fmt.Errorf("bad proof node %d: %v", i, err), i
 		}
-		keyrest, cld := get(n, key)
+		keyrest, cld := get(n, key, true)
 		switch cld := cld.(type) {
 		case nil:
 			// The trie doesn't contain the key.
@@ -128,7 +129,10 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 	}
 }
 
-func get(tn node, key []byte) ([]byte, node) {
+// get returns the child of the given node at the key path. If skipResolved is
+// set, already resolved nodes are traversed until a hash, value or missing node
+// is found, otherwise only a single level is stepped.
+func get(tn node, key []byte, skipResolved bool) ([]byte, node) {
 	for {
 		switch n := tn.(type) {
 		case *shortNode:
@@ -137,9 +141,15 @@ func get(tn node, key []byte) ([]byte, node) {
 			}
 			tn = n.Val
 			key = key[len(n.Key):]
+			if !skipResolved {
+				return key, tn
+			}
 		case *fullNode:
 			tn = n.Children[key[0]]
 			key = key[1:]
+			if !skipResolved {
+				return key, tn
+			}
 		case hashNode:
 			return key, n
 		case nil:
@@ -151,3 +161,383 @@ func get(tn node, key []byte) ([]byte, node) {
 		}
 	}
 }
+
+// proofToPath converts a merkle proof to a trie node path, merging it into the
+// given root if one is provided. The path starts at the root and ends with the
+// node proving the key (or its absence, if allowed). All nodes off the path are
+// left as unresolved hash nodes.
+func proofToPath(rootHash common.Hash, root node, key []byte, proofDb DatabaseReader, allowNonExistent bool) (node, []byte, error) {
+	// resolveNode retrieves and decodes a trie node from the proof. The hash is
+	// not cached in the node as the path will be modified afterwards.
+	resolveNode := func(hash common.Hash) (node, error) {
+		buf, _ := proofDb.Get(hash[:])
+		if buf == nil {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", hash)
+		}
+		n, err := decodeNode(nil, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %v", err)
+		}
+		return n, nil
+	}
+	// The root node must always be included in the proof
+	if root == nil {
+		n, err := resolveNode(rootHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		root = n
+	}
+	var (
+		err           error
+		child, parent node
+		keyrest       []byte
+		valnode       []byte
+	)
+	key, parent = keybytesToHex(key), root
+	for {
+		keyrest, child = get(parent, key, false)
+		switch cld := child.(type) {
+		case nil:
+			// The trie doesn't contain the key. This is fine for non-existence
+			// proofs as all the resolved nodes on the path are still proven.
+			if allowNonExistent {
+				return root, nil, nil
+			}
+			return nil, nil, errors.New("the node is not contained in trie")
+		case *shortNode, *fullNode:
+			// Already resolved by a previous path
+			key, parent = keyrest, child
+			continue
+		case hashNode:
+			child, err = resolveNode(common.BytesToHash(cld))
+			if err != nil {
+				return nil, nil, err
+			}
+		case valueNode:
+			valnode = cld
+		}
+		// Link the resolved child into its parent
+		switch pnode := parent.(type) {
+		case *shortNode:
+			pnode.Val = child
+		case *fullNode:
+			pnode.Children[key[0]] = child
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", pnode, pnode))
+		}
+		if len(valnode) > 0 {
+			return root, valnode, nil // The whole path is resolved
+		}
+		key, parent = keyrest, child
+	}
+}
+
+// unsetInternal removes all the internal node references between the two edge
+// paths of a trie constructed by proofToPath. The removed parts are expected to
+// be refilled by the leaves of the proven range. It returns whwater the entire
+// trie was removed.
+//
+// The two boundary keys must be the ones used to construct the edge paths and
+// left must be smaller than right.
+func unsetInternal(n node, left []byte, right []byte) (bool, error) {
+	left, right = keybytesToHex(left), keybytesToHex(right)
+
+	// Step down to the fork point. The fork point is either a short node whose
+	// key doesn't match one of the edge paths, or a full node where the paths
+	// diverge (or one of them ends).
+	var (
+		pos    = 0
+		parent node
+
+		// Fork indicators: 0 means no fork, -1 means the path is smaller than the
+		// short node key, 1 means the path is larger.
+		shortForkLeft, shortForkRight int
+	)
+findFork:
+	for {
+		switch rn := (n).(type) {
+		case *shortNode:
+			if len(left)-pos < len(rn.Key) {
+				shortForkLeft = bytes.Compare(left[pos:], rn.Key)
+			} else {
+				shortForkLeft = bytes.Compare(left[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if len(right)-pos < len(rn.Key) {
+				shortForkRight = bytes.Compare(right[pos:], rn.Key)
+			} else {
+				shortForkRight = bytes.Compare(right[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if shortForkLeft != 0 || shortForkRight != 0 {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Val, pos+len(rn.Key)
+
+		case *fullNode:
+			leftnode, rightnode := rn.Children[left[pos]], rn.Children[right[pos]]
+			if leftnode == nil || rightnode == nil || leftnode != rightnode {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Children[left[pos]], pos+1
+
+		default:
+			return false, fmt.Errorf("%T: invalid node: %v", n, n)
+		}
+	}
+	switch rn := n.(type) {
+	case *shortNode:
+		// If both edge paths are on the same side of the short node, the range
+		// is empty, otherwise (some of) the short node is covered by the range.
+		if shortForkLeft == shortForkRight {
+			return false, errors.New("empty range")
+		}
+		if shortForkLeft != 0 && shortForkRight != 0 {
+			// The short node is entirely covered, drop it
+			if parent == nil {
+				return true, nil
+			}
+			parent.(*fullNode).Children[left[pos-1]] = nil
+			return false, nil
+		}
+		// Only one edge path points into the short node
+		if shortForkRight != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				parent.(*fullNode).Children[left[pos-1]] = nil
+				return false, nil
+			}
+			return false, unset(rn, rn.Val, left[pos:], len(rn.Key), false)
+		}
+		if _, ok := rn.Val.(valueNode); ok {
+			if parent == nil {
+				return true, nil
+			}
+			parent.(*fullNode).Children[right[pos-1]] = nil
+			return false, nil
+		}
+		return false, unset(rn, rn.Val, right[pos:], len(rn.Key), true)
+
+	case *fullNode:
+		// Drop all the children between the two edge paths, then everything
+		// right of the left path and left of the right path.
+		for i := left[pos] + 1; i < right[pos]; i++ {
+			rn.Children[i] = nil
+		}
+		if err := unset(rn, rn.Children[left[pos]], left[pos:], 1, false); err != nil {
+			return false, err
+		}
+		if err := unset(rn, rn.Children[right[pos]], right[pos:], 1, true); err != nil {
+			return false, err
+		}
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("%T: invalid node: %v", n, n)
+	}
+}
+
+// unset removes all the internal node references on one side of an edge path,
+// either the left side (for the right edge) or the right side (for the left
+// edge). The path itself might not exist in the trie, in which case the branch
+// at the fork point is either kept or dropped depending on whwater it belongs
+// to the range.
+func unset(parent node, child node, key []byte, pos int, removeLeft bool) error {
+	switch cld := child.(type) {
+	case *fullNode:
+		if removeLeft {
+			for i := 0; i < int(key[pos]); i++ {
+				cld.Children[i] = nil
+			}
+		} else {
+			for i := key[pos] + 1; i < 16; i++ {
+				cld.Children[i] = nil
+			}
+		}
+		return unset(cld, cld.Children[key[pos]], key, pos+1, removeLeft)
+
+	case *shortNode:
+		if len(key[pos:]) < len(cld.Key) || !bytes.Equal(cld.Key, key[pos:pos+len(cld.Key)]) {
+			// The path forks off here. If the short node is inside the range,
+			// drop the entire branch, otherwise keep it as is.
+			cmp := bytes.Compare(cld.Key, key[pos:])
+			if (removeLeft && cmp < 0) || (!removeLeft && cmp > 0) {
+				parent.(*fullNode).Children[key[pos-1]] = nil
+			}
+			return nil
+		}
+		if _, ok := cld.Val.(valueNode); ok {
+			// The edge leaf itself is part of the range and will be reinserted
+			parent.(*fullNode).Children[key[pos-1]] = nil
+			return nil
+		}
+		return unset(cld, cld.Val, key, pos+len(cld.Key), removeLeft)
+
+	case nil:
+		// The path points to a missing child of a full node, nothing to do
+		return nil
+
+	default:
+		return fmt.Errorf("%T: invalid node: %v", child, child)
+	}
+}
+
+// hasRightElement reports whwater there are more elements in the trie on the
+// right side of the given path. The whole path must already be resolved, an
+// unresolved or unknown node on it is reported as an error.
+func hasRightElement(node node, key []byte) (bool, error) {
+	pos, key := 0, keybytesToHex(key)
+	for node != nil {
+		switch rn := node.(type) {
+		case *fullNode:
+			for i := key[pos] + 1; i < 16; i++ {
+				if rn.Children[i] != nil {
+					return true, nil
+				}
+			}
+			node, pos = rn.Children[key[pos]], pos+1
+		case *shortNode:
+			if len(key)-pos < len(rn.Key) || !bytes.Equal(rn.Key, key[pos:pos+len(rn.Key)]) {
+				return bytes.Compare(rn.Key, key[pos:]) > 0, nil
+			}
+			node, pos = rn.Val, pos+len(rn.Key)
+		case valueNode:
+			return false, nil // The whole path is resolved
+		default:
+			return false, fmt.Errorf("%T: invalid node: %v", node, node)
+		}
+	}
+	return false, nil
+}
+
+// VerifyRangeProof checks whwater the given leaves are exactly the contiguous
+// range of a trie with the given root, starting at firstKey (which might not be
+// in the trie) and ending at lastKey. The proof must contain the merkle proofs
+// of both edge keys, or be nil if the leaves are expected to be the entire trie.
+// The returned flag reports whwater the trie contains more leaves after the
+// proven range.
+func VerifyRangeProof(rootHash common.Hash, firstKey []byte, lastKey []byte, keys [][]byte, values [][]byte, proof DatabaseReader) (bool, error) {
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
+	}
+	// Ensure the leaves are strictly increasing, of the same length and contain
+	// no deletions
+	for i := 0; i < len(keys)-1; i++ {
+		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
+			return false, errors.New("range is not monotonically increasing")
+		}
+	}
+	for _, key := range keys {
+		if len(key) != len(keys[0]) {
+			return false, errors.New("inconsistent key length")
+		}
+	}
+	for _, value := range values {
+		if len(value) == 0 {
+			return false, errors.New("range contains deletion")
+		}
+	}
+	// Without edge proofs the leaves must make up the entire trie
+	if proof == nil {
+		tr := new(Trie)
+		for i, key := range keys {
+			tr.Update(key, values[i])
+		}
+		if have := tr.Hash(); have != rootHash {
+			return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+		}
+		return false, nil
+	}
+	// With an edge proof but no leaves, there must be nothing after firstKey
+	if len(keys) == 0 {
+		root, val, err := proofToPath(rootHash, nil, firstKey, proof, true)
+		if err != nil {
+			return false, err
+		}
+		if val != nil {
+			return false, errors.New("more entries available")
+		}
+		more, err := hasRightElement(root, firstKey)
+		if err != nil {
+			return false, err
+		}
+		if more {
+			return false, errors.New("more entries available")
+		}
+		return false, nil
+	}
+	if bytes.Compare(firstKey, keys[0]) > 0 || bytes.Compare(keys[len(keys)-1], lastKey) > 0 {
+		return false, errors.New("leaves outside of the proven range")
+	}
+	// With a single leaf and identical edges, one path proves the whole range
+	if bytes.Equal(firstKey, lastKey) {
+		root, val, err := proofToPath(rootHash, nil, firstKey, proof, false)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(firstKey, keys[0]) {
+			return false, errors.New("correct proof but invalid key")
+		}
+		if !bytes.Equal(val, values[0]) {
+			return false, errors.New("correct proof but invalid data")
+		}
+		return hasRightElement(root, firstKey)
+	}
+	if len(firstKey) != len(lastKey) || len(firstKey) != len(keys[0]) {
+		return false, errors.New("inconsistent edge keys")
+	}
+	// Convert the edge proofs into edge paths of a partial trie, the first one
+	// potentially proving a non-existent key. The nodes used by the paths back
+	// the trie, so an unresolved node fails the refill instead of crashing it.
+	nodes, _ := watdb.NewMemDatabase()
+	proof = &proofRecorder{proof: proof, nodes: nodes}
+	root, _, err := proofToPath(rootHash, nil, firstKey, proof, true)
+	if err != nil {
+		return false, err
+	}
+	root, _, err = proofToPath(rootHash, root, lastKey, proof, false)
+	if err != nil {
+		return false, err
+	}
+	// Remove everything between the edges and refill it from the leaves. If the
+	// resulting root matches, the leaves are exactly the range between the edges.
+	empty, err := unsetInternal(root, firstKey, lastKey)
+	if err != nil {
+		return false, err
+	}
+	tr := &Trie{db: NewDatabase(nodes), root: root}
+	if empty {
+		tr.root = nil
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return false, err
+		}
+	}
+	if have := tr.Hash(); have != rootHash {
+		return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+	}
+	return hasRightElement(tr.root, keys[len(keys)-1])
+}
+
+// proofRecorder is a proof database which copies the nodes read from it into
+// another database.
+type proofRecorder struct {
+	proof DatabaseReader
+	nodes watdb.Putter
+}
+
+func (r *proofRecorder) Get(key []byte) ([]byte, error) {
+	value, err := r.proof.Get(key)
+	if err == nil && value != nil {
+		r.nodes.Put(key, value)
+	}
+	return value, err
+}
+
+func (r *proofRecorder) Has(key []byte) (bool, error) {
+	return r.proof.Has(key)
+}
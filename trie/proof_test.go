@@ -20,6 +20,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -88,6 +89,242 @@ func TestVerifyBadProof(t *testing.T) {
 	}
 }
 
+// Tests that contiguous ranges of a trie can be proven with the merkle proofs
+// of their edge keys.
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		proof := proveRange(t, trie, entries[start].k, entries[end-1].k)
+		keys, values := rangeData(entries[start:end])
+
+		more, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, values, proof)
+		if err != nil {
+			t.Fatalf("range %d-%d: failed to verify proof: %v", start, end-1, err)
+		}
+		if more != (end != len(entries)) {
+			t.Fatalf("range %d-%d: continuation flag mismatch: have %v, want %v", start, end-1, more, end != len(entries))
+		}
+	}
+}
+
+// Tests that ranges can be proven starting from a key not present in the trie.
+func TestRangeProofWithNonExistentOrigin(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries)-1) + 1
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		origin := decrementKey(entries[start].k)
+		if bytes.Equal(origin, entries[start-1].k) {
+			continue
+		}
+		proof := proveRange(t, trie, origin, entries[end-1].k)
+		keys, values := rangeData(entries[start:end])
+
+		if _, err := VerifyRangeProof(root, origin, keys[len(keys)-1], keys, values, proof); err != nil {
+			t.Fatalf("range %d-%d: failed to verify proof: %v", start, end-1, err)
+		}
+	}
+}
+
+// Tests that an empty range is accepted only after the last key of the trie.
+func TestEmptyRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	origin := incrementKey(entries[len(entries)-1].k)
+	proof, _ := watdb.NewMemDatabase()
+	if err := trie.Prove(origin, 0, proof); err != nil {
+		t.Fatalf("failed to prove origin: %v", err)
+	}
+	if _, err := VerifyRangeProof(root, origin, nil, nil, nil, proof); err != nil {
+		t.Fatalf("failed to verify empty tail range: %v", err)
+	}
+	origin = decrementKey(entries[len(entries)/2].k)
+	proof, _ = watdb.NewMemDatabase()
+	if err := trie.Prove(origin, 0, proof); err != nil {
+		t.Fatalf("failed to prove origin: %v", err)
+	}
+	if _, err := VerifyRangeProof(root, origin, nil, nil, nil, proof); err == nil {
+		t.Fatalf("empty range with remaining entries accepted")
+	}
+}
+
+// Tests that the entire trie can be delivered without any edge proofs.
+func TestAllElementsRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	keys, values := rangeData(entries)
+
+	more, err := VerifyRangeProof(trie.Hash(), nil, nil, keys, values, nil)
+	if err != nil {
+		t.Fatalf("failed to verify whole trie: %v", err)
+	}
+	if more {
+		t.Fatalf("continuation reported for whole trie")
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), nil, nil, keys[1:], values[1:], nil); err == nil {
+		t.Fatalf("partial trie accepted without proofs")
+	}
+}
+
+// Tests that tampered, missing or reordered range data is rejected.
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries) - 3)
+		end := mrand.Intn(len(entries)-start-2) + start + 3
+
+		proof := proveRange(t, trie, entries[start].k, entries[end-1].k)
+		keys, values := rangeData(entries[start:end])
+		first, last := keys[0], keys[len(keys)-1]
+
+		switch mrand.Intn(4) {
+		case 0:
+			// Modify a random value
+			index := mrand.Intn(len(values))
+			values[index] = append(common.CopyBytes(values[index]), 0x01)
+		case 1:
+			// Drop an inner entry
+			index := mrand.Intn(len(keys)-2) + 1
+			keys = append(keys[:index], keys[index+1:]...)
+			values = append(values[:index], values[index+1:]...)
+		case 2:
+			// Swap two consecutive entries
+			index := mrand.Intn(len(keys) - 1)
+			keys[index], keys[index+1] = keys[index+1], keys[index]
+			values[index], values[index+1] = values[index+1], values[index]
+		case 3:
+			// Replace a value with a deletion
+			values[mrand.Intn(len(values))] = nil
+		}
+		if _, err := VerifyRangeProof(root, first, last, keys, values, proof); err == nil {
+			t.Fatalf("range %d-%d: bad range proof accepted", start, end-1)
+		}
+	}
+}
+
+// Tests that incomplete or tampered edge proofs and keys of a different length
+// are rejected with an error instead of crashing the verifier.
+func TestIncompleteRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries) - 3)
+		end := mrand.Intn(len(entries)-start-2) + start + 3
+
+		proof := proveRange(t, trie, entries[start].k, entries[end-1].k)
+		keys, values := rangeData(entries[start:end])
+		first, last := keys[0], keys[len(keys)-1]
+
+		nodes := proof.Keys()
+		node := nodes[mrand.Intn(len(nodes))]
+		switch mrand.Intn(3) {
+		case 0:
+			// Drop a proof node
+			proof.Delete(node)
+		case 1:
+			// Replace a proof node with garbage
+			blob, _ := proof.Get(node)
+			proof.Put(node, randBytes(len(blob)))
+		case 2:
+			// Extend an inner key
+			index := mrand.Intn(len(keys)-2) + 1
+			keys[index] = append(common.CopyBytes(keys[index]), 0x01)
+		}
+		if _, err := VerifyRangeProof(root, first, last, keys, values, proof); err == nil {
+			t.Fatalf("range %d-%d: bad range proof accepted", start, end-1)
+		}
+	}
+}
+
+// Tests that an unresolved node on the path checked for right side elements is
+// reported as an error instead of crashing the verification.
+func TestHasRightElementUnresolved(t *testing.T) {
+	key := []byte{0x12}
+	path := &shortNode{Key: []byte{1}, Val: hashNode(common.Hash{1}.Bytes())}
+	if _, err := hasRightElement(path, key); err == nil {
+		t.Fatalf("unresolved node accepted")
+	}
+	full := &fullNode{}
+	full.Children[1] = &shortNode{Key: []byte{2, 16}, Val: valueNode{1}}
+	full.Children[3] = valueNode{2}
+	if more, err := hasRightElement(full, key); err != nil || !more {
+		t.Fatalf("right element mismatch: have %v, %v, want true, nil", more, err)
+	}
+}
+
+// sortedEntries returns the trie entries ordered by key.
+func sortedEntries(vals map[string]*kv) []*kv {
+	entries := make([]*kv, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+	return entries
+}
+
+// rangeData splits a list of trie entries into separate key and value lists.
+func rangeData(entries []*kv) ([][]byte, [][]byte) {
+	keys := make([][]byte, len(entries))
+	values := make([][]byte, len(entries))
+	for i, kv := range entries {
+		keys[i], values[i] = kv.k, kv.v
+	}
+	return keys, values
+}
+
+// proveRange creates a proof database containing the proofs of both edge keys.
+func proveRange(t *testing.T, trie *Trie, first, last []byte) *watdb.MemDatabase {
+	proof, _ := watdb.NewMemDatabase()
+	if err := trie.Prove(first, 0, proof); err != nil {
+		t.Fatalf("failed to prove first key %x: %v", first, err)
+	}
+	if err := trie.Prove(last, 0, proof); err != nil {
+		t.Fatalf("failed to prove last key %x: %v", last, err)
+	}
+	return proof
+}
+
+// incrementKey returns the key immediately following the given one.
+func incrementKey(key []byte) []byte {
+	next := common.CopyBytes(key)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// decrementKey returns the key immediately preceding the given one.
+func decrementKey(key []byte) []byte {
+	prev := common.CopyBytes(key)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
+
 // mutateByte changes one byte in b.
 func mutateByte(b []byte) {
 	for r := mrand.Intn(len(b)); ; {
@@ -46,6 +46,16 @@ type request struct {
 	callback LeafCallback // Callback to invoke if a leaf node it reached on this branch
 }
 
+// entry returns the persistable description of the request.
+func (req *request) entry() SyncEntry {
+	return SyncEntry{
+		Hash:  req.hash,
+		Depth: uint64(req.depth),
+		Raw:   req.raw,
+		Leaf:  req.callback != nil,
+	}
+}
+
 // SyncResult is a simple list to return missing nodes along with their request
 // hashes.
 type SyncResult struct {
@@ -53,6 +63,15 @@ type SyncResult struct {
 	Data []byte      // Data content of the retrieved node
 }
 
+// SyncEntry is a retrieval still pending in a trie sync, allowing an interrupted
+// sync to be persisted and rescheduled after a restart.
+type SyncEntry struct {
+	Hash  common.Hash // Hash of the node data content to retrieve
+	Depth uint64      // Depth level within the trie the node is located at
+	Raw   bool        // Whwater this is a raw entry (code) or a trie node
+	Leaf  bool        // Whwater leaves reached on this branch invoke the leaf callback
+}
+
 // syncMemBatch is an in-memory buffer of successfully downloaded but not yet
 // persisted data items.
 type syncMemBatch struct {
@@ -76,6 +95,7 @@ type TrieSync struct {
 	membatch *syncMemBatch            // Memory buffer to avoid frequest database writes
 	requests map[common.Hash]*request // Pending requests pertaining to a key hash
 	queue    *prque.Prque             // Priority queue with the pending requests
+	changed  map[common.Hash]struct{} // Requests scheduled or retrieved since the last EntryChanges (nil if not tracked)
 }
 
 // NewTrieSync creates a new trie data download scheduler.
@@ -182,6 +202,7 @@ func (s *TrieSync) Process(results []SyncResult) (bool, int, error) {
 		// If the item is a raw entry request, commit directly
 		if request.raw {
 			request.data = item.Data
+			s.markChanged(item.Hash)
 			s.commit(request)
 			committed = true
 			continue
@@ -192,6 +213,7 @@ func (s *TrieSync) Process(results []SyncResult) (bool, int, error) {
 			return committed, i, err
 		}
 		request.data = item.Data
+		s.markChanged(item.Hash)
 
 		// Create and schedule a request for all the children nodes
 		requests, err := s.children(request, node)
@@ -232,6 +254,48 @@ func (s *TrieSync) Pending() int {
 	return len(s.requests)
 }
 
+// Entries retrieves all the retrievals still pending for download. Items already
+// retrieved but waiting for their children to complete are not included, as they
+// are rediscovered anyway when rescheduling the sync from its root.
+func (s *TrieSync) Entries() []SyncEntry {
+	entries := make([]SyncEntry, 0, len(s.requests))
+	for _, req := range s.requests {
+		if req.data != nil {
+			continue
+		}
+		entries = append(entries, req.entry())
+	}
+	return entries
+}
+
+// TrackEntryChanges starts recording the changes of the pending retrievals, to be
+// retrieved via EntryChanges. The retrievals already pending are reported as added.
+func (s *TrieSync) TrackEntryChanges() {
+	s.changed = make(map[common.Hash]struct{})
+	for hash := range s.requests {
+		s.changed[hash] = struct{}{}
+	}
+}
+
+// EntryChanges retrieves the changes of the pending retrievals since the last
+// call: the entries newly scheduled for download and the hashes of the ones which
+// were retrieved since. This allows persisting the pending retrievals without
+// rewriting all of them on every commit. Changes are only recorded after calling
+// TrackEntryChanges.
+func (s *TrieSync) EntryChanges() (added []SyncEntry, done []common.Hash) {
+	for hash := range s.changed {
+		if req := s.requests[hash]; req != nil && req.data == nil {
+			added = append(added, req.entry())
+		} else {
+			done = append(done, hash)
+		}
+	}
+	if s.changed != nil {
+		s.changed = make(map[common.Hash]struct{})
+	}
+	return added, done
+}
+
 // schedule inserts a new state retrieval request into the fetch queue. If there
 // is already a pending request for this node, the new request will be discarded
 // and only a parent reference added to the old one.
@@ -244,6 +308,14 @@ func (s *TrieSync) schedule(req *request) {
 	// Schedule the request for future retrieval
 	s.queue.Push(req.hash, float32(req.depth))
 	s.requests[req.hash] = req
+	s.markChanged(req.hash)
+}
+
+// markChanged records a change of a pending retrieval if changes are tracked.
+func (s *TrieSync) markChanged(hash common.Hash) {
+	if s.changed != nil {
+		s.changed[hash] = struct{}{}
+	}
 }
 
 // children retrieves all the missing children of a state trie entry for future
@@ -17,12 +17,16 @@
 package wat
 
 import (
+	"bufio"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"os"
+	"runtime"
 	"strings"
 
 	"github.com/watchain/go-watchain/common"
@@ -198,6 +202,16 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 	return uint64(api.e.miner.HashRate())
 }
 
+// GetBuildReport returns the trace of the most recently assembled block,
+// listing the included and skipped transactions along with skip reasons.
+func (api *PrivateMinerAPI) GetBuildReport() (*miner.BuildReport, error) {
+	report := api.e.miner.BuildReport()
+	if report == nil {
+		return nil, errors.New("no block built yet")
+	}
+	return report, nil
+}
+
 // PrivateAdminAPI is the collection of watchain full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -232,6 +246,26 @@ func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// ExportArchive exports the given block range into an indexed chain archive,
+// optionally including the block receipts.
+func (api *PrivateAdminAPI) ExportArchive(file string, first hexutil.Uint64, last hexutil.Uint64, receipts bool) (bool, error) {
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	config := core.ArchiveConfig{Receipts: receipts}
+	if err := api.wat.BlockChain().ExportArchive(writer, uint64(first), uint64(last), config); err != nil {
+		return false, err
+	}
+	if err := writer.Flush(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func hasAllBlocks(chain *core.BlockChain, bs []*types.Block) bool {
 	for _, b := range bs {
 		if !chain.HasBlock(b.Hash(), b.NumberU64()) {
@@ -251,6 +285,9 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	}
 	defer in.Close()
 
+	if core.IsArchive(in) {
+		return api.importArchive(in, 0, math.MaxUint64)
+	}
 	var reader io.Reader = in
 	if strings.HasSuffix(file, ".gz") {
 		if reader, err = gzip.NewReader(reader); err != nil {
@@ -291,6 +328,57 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// ImportArchive imports the given block range from an indexed chain archive.
+// Segments already present locally are skipped.
+func (api *PrivateAdminAPI) ImportArchive(file string, first hexutil.Uint64, last hexutil.Uint64) (bool, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	return api.importArchive(in, uint64(first), uint64(last))
+}
+
+// importArchive imports a block range from an opened chain archive, verifying
+// the segments in parallel.
+func (api *PrivateAdminAPI) importArchive(in *os.File, first uint64, last uint64) (bool, error) {
+	stat, err := in.Stat()
+	if err != nil {
+		return false, err
+	}
+	archive, err := core.OpenArchive(in, stat.Size())
+	if err != nil {
+		return false, err
+	}
+	if err := api.wat.BlockChain().ImportArchive(archive, first, last, runtime.NumCPU(), false, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddCheckpoint registers a trusted checkpoint the canonical chain must contain.
+// Chains contradicting it are refused from then on. The checkpoint is not
+// persisted, add it to the node configuration to enforce it across restarts.
+func (api *PrivateAdminAPI) AddCheckpoint(number hexutil.Uint64, hash common.Hash) (bool, error) {
+	if err := api.wat.BlockChain().AddCheckpoint(core.Checkpoint{Number: uint64(number), Hash: hash}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Checkpoints returns the trusted checkpoints currently enforced by the chain.
+func (api *PrivateAdminAPI) Checkpoints() []core.Checkpoint {
+	return api.wat.BlockChain().Checkpoints()
+}
+
+// SetMaxReorgDepth sets the maximum number of canonical blocks a chain reorg
+// may drop. Zero disables the limit.
+func (api *PrivateAdminAPI) SetMaxReorgDepth(depth hexutil.Uint64) bool {
+	api.wat.BlockChain().SetMaxReorgDepth(uint64(depth))
+	return true
+}
+
 // PublicDebugAPI is the collection of watchain full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
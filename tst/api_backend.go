@@ -132,6 +132,10 @@ func (b *watApiBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEven
 	return b.wat.BlockChain().SubscribeRemovedLogsEvent(ch)
 }
 
+func (b *watApiBackend) SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription {
+	return b.wat.BlockChain().SubscribeChainReorgEvent(ch)
+}
+
 func (b *watApiBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return b.wat.BlockChain().SubscribeChainEvent(ch)
 }
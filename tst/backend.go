@@ -54,6 +54,7 @@ type LesServer interface {
 	Start(srvr *p2p.Server)
 	Stop()
 	Protocols() []p2p.Protocol
+	APIs() []rpc.API
 	SetBloomBitsIndexer(bbIndexer *core.ChainIndexer)
 }
 
@@ -90,6 +91,7 @@ type watchain struct {
 
 	networkId     uint64
 	netRPCService *ethapi.PublicNetAPI
+	limitSub      event.Subscription // Subscription to runtime changes of the server's peer limit
 
 	lock sync.RWMutex // Protects the variadic fields (e.g. gas price and waterbase)
 }
@@ -146,7 +148,7 @@ func New(ctx *node.ServiceContext, config *Config) (*watchain, error) {
 	}
 	var (
 		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, NoPrefetch: config.NoPrefetch}
 	)
 	wat.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, wat.chainConfig, wat.engine, vmConfig)
 	if err != nil {
@@ -158,6 +160,19 @@ func New(ctx *node.ServiceContext, config *Config) (*watchain, error) {
 		wat.blockchain.SetHead(compat.RewindTo)
 		core.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
+	// Configure the operator imposed finality rules
+	wat.blockchain.SetMaxReorgDepth(config.MaxReorgDepth)
+	for _, cp := range config.Checkpoints {
+		if err := wat.blockchain.AddCheckpoint(cp); err != nil {
+			return nil, err
+		}
+	}
+	// A sync checkpoint is trusted just the same, the chain may never drop it
+	if cp := config.SyncCheckpoint; cp != nil {
+		if err := wat.blockchain.AddCheckpoint(core.Checkpoint{Number: cp.Number, Hash: cp.Hash}); err != nil {
+			return nil, err
+		}
+	}
 	wat.bloomIndexer.Start(wat.blockchain)
 
 	if config.TxPool.Journal != "" {
@@ -165,7 +180,7 @@ func New(ctx *node.ServiceContext, config *Config) (*watchain, error) {
 	}
 	wat.txPool = core.NewTxPool(config.TxPool, wat.chainConfig, wat.blockchain)
 
-	if wat.protocolManager, err = NewProtocolManager(wat.chainConfig, config.SyncMode, config.NetworkId, wat.eventMux, wat.txPool, wat.engine, wat.blockchain, chainDb); err != nil {
+	if wat.protocolManager, err = NewProtocolManager(wat.chainConfig, config.SyncMode, config.SyncCheckpoint, config.NetworkId, wat.eventMux, wat.txPool, wat.engine, wat.blockchain, chainDb); err != nil {
 		return nil, err
 	}
 	wat.miner = miner.New(wat, wat.chainConfig, wat.EventMux(), wat.engine)
@@ -249,6 +264,11 @@ func (s *watchain) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	// Append the LES server APIs if light clients are served
+	if s.lesServer != nil {
+		apis = append(apis, s.lesServer.APIs()...)
+	}
+
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -393,27 +413,58 @@ func (s *watchain) Start(srvr *p2p.Server) error {
 	s.netRPCService = ethapi.NewPublicNetAPI(srvr, s.NetVersion())
 
 	// Figure out a max peers count based on the server limits
-	maxPeers := srvr.MaxPeers
-	if s.config.LightServ > 0 {
-		if s.config.LightPeers >= srvr.MaxPeers {
-			return fmt.Errorf("invalid peer config: light peer count (%d) >= total peer count (%d)", s.config.LightPeers, srvr.MaxPeers)
-		}
-		maxPeers -= s.config.LightPeers
+	if s.config.LightServ > 0 && s.config.LightPeers >= srvr.MaxPeers {
+		return fmt.Errorf("invalid peer config: light peer count (%d) >= total peer count (%d)", s.config.LightPeers, srvr.MaxPeers)
 	}
+	// Follow runtime changes of the server limits
+	limitCh := make(chan int, 1)
+	s.limitSub = srvr.SubscribeMaxPeers(limitCh)
+	go s.peerLimitLoop(limitCh, s.limitSub)
+
 	// Start the networking layer and the light server if requested
-	s.protocolManager.Start(maxPeers)
+	s.protocolManager.Start(s.watPeerLimit(srvr.MaxPeers))
 	if s.lesServer != nil {
 		s.lesServer.Start(srvr)
 	}
 	return nil
 }
 
+// watPeerLimit returns the maximum number of watchain peers for the given total
+// peer limit of the server, leaving room for the light clients if serving them.
+func (s *watchain) watPeerLimit(maxPeers int) int {
+	if s.config.LightServ > 0 {
+		maxPeers -= s.config.LightPeers
+	}
+	if maxPeers < 0 {
+		maxPeers = 0
+	}
+	return maxPeers
+}
+
+// peerLimitLoop applies the changes of the server's peer limit to the watchain
+// peers until the subscription is terminated.
+func (s *watchain) peerLimitLoop(limitCh <-chan int, sub event.Subscription) {
+	for {
+		select {
+		case maxPeers := <-limitCh:
+			maxPeers = s.watPeerLimit(maxPeers)
+			log.Debug("Changing watchain peer limit", "max", maxPeers)
+			s.protocolManager.SetMaxPeers(maxPeers)
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
 // Stop implements node.Service, terminating all internal goroutines used by the
 // watchain protocol.
 func (s *watchain) Stop() error {
 	if s.stopDbUpgrade != nil {
 		s.stopDbUpgrade()
 	}
+	if s.limitSub != nil {
+		s.limitSub.Unsubscribe()
+	}
 	s.bloomIndexer.Close()
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
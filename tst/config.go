@@ -83,16 +83,27 @@ type Config struct {
 	SyncMode  downloader.SyncMode
 	NoPruning bool
 
+	// Trusted checkpoint to start syncing an empty chain from instead of the genesis
+	SyncCheckpoint *downloader.Checkpoint `toml:",omitempty"`
+
+	// Finality options
+	MaxReorgDepth uint64            `toml:",omitempty"` // Maximum number of canonical blocks a reorg may drop (0 = unlimited)
+	Checkpoints   []core.Checkpoint `toml:",omitempty"` // Trusted checkpoints the canonical chain must contain
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
 
+	// Ultra light client options
+	ULC *ULCConfig `toml:",omitempty"`
+
 	// Database options
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
 	TrieCache          int
 	TrieTimeout        time.Duration
+	NoPrefetch         bool // Whwater to disable speculative pre-execution of the next block during import
 
 	// Mining-related options
 	waterbase    common.Address `toml:",omitempty"`
@@ -116,6 +127,14 @@ type Config struct {
 	DocRoot string `toml:"-"`
 }
 
+// ULCConfig is the configuration of the ultra light client mode, in which only
+// the chain heads announced and signed by a quorum of trusted LES servers are
+// followed, without verifying their proof-of-work.
+type ULCConfig struct {
+	TrustedServers     []string `toml:",omitempty"` // Enode URLs of the trusted LES servers
+	MinTrustedFraction int      `toml:",omitempty"` // Minimum percentage of trusted servers announcing a head to follow it
+}
+
 type configMarshaling struct {
 	ExtraData hexutil.Bytes
 }
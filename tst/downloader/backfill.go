@@ -0,0 +1,305 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/log"
+)
+
+var (
+	backfillBatches = 16 // Number of block batches to backfill below a checkpoint per round
+)
+
+// anchorCheckpoint anchors an empty chain at the configured trusted checkpoint
+// before a fast sync, retrieving the checkpoint block along with its receipts
+// from the origin peer. If the checkpoint's total difficulty isn't trusted, it's
+// derived from the peer's head. The ancestors are left to be backfilled.
+func (d *Downloader) anchorCheckpoint(p *peerConnection, latest *types.Header, head common.Hash, td *big.Int) error {
+	chain, ok := d.blockchain.(checkpointer)
+	if !ok || d.checkpoint == nil || d.mode != FastSync {
+		return nil
+	}
+	if d.lightchain.CurrentHeader().Number.Uint64() != 0 {
+		return nil // Already anchored or synced from the genesis
+	}
+	cp := d.checkpoint
+
+	// The pivot must be above the checkpoint, its state can't be synced otherwise
+	if latest.Number.Uint64() <= cp.Number+uint64(fsMinFullBlocks) {
+		p.log.Debug("Remote chain too short for checkpoint", "checkpoint", cp.Number, "remote", latest.Number)
+		return errCheckpointUnreached
+	}
+	p.log.Debug("Anchoring chain at checkpoint", "number", cp.Number, "hash", cp.Hash)
+
+	packet, err := d.requestPacket(p, d.headerCh, errCancelHeaderFetch, func() error {
+		return p.peer.RequestHeadersByHash(cp.Hash, 1, 0, false)
+	})
+	if err != nil {
+		return err
+	}
+	headers := packet.(*headerPack).headers
+	if len(headers) != 1 || headers[0].Hash() != cp.Hash || headers[0].Number.Uint64() != cp.Number {
+		p.log.Warn("Remote chain doesn't contain checkpoint", "number", cp.Number, "hash", cp.Hash)
+		return errInvalidChain
+	}
+	header := headers[0]
+
+	checkpointTd := cp.TD
+	if checkpointTd == nil {
+		if checkpointTd, err = d.deriveCheckpointTd(p, header, head, td); err != nil {
+			return err
+		}
+	}
+	blocks, receipts, err := d.fetchBlocks(p, []*types.Header{header})
+	if err != nil {
+		return err
+	}
+	return chain.InsertCheckpoint(blocks[0], receipts[0], checkpointTd)
+}
+
+// deriveCheckpointTd derives the total difficulty of the checkpoint header from
+// the total difficulty of the remote head by subtracting the difficulties of the
+// headers linking the two. The result is verified once the backfill reaches the
+// genesis block.
+func (d *Downloader) deriveCheckpointTd(p *peerConnection, checkpoint *types.Header, head common.Hash, td *big.Int) (*big.Int, error) {
+	var (
+		parent = checkpoint
+		sum    = new(big.Int)
+	)
+	for {
+		from := parent.Number.Uint64() + 1
+		packet, err := d.requestPacket(p, d.headerCh, errCancelHeaderFetch, func() error {
+			return p.peer.RequestHeadersByNumber(from, MaxHeaderFetch, 0, false)
+		})
+		if err != nil {
+			return nil, err
+		}
+		headers := packet.(*headerPack).headers
+		if len(headers) == 0 {
+			p.log.Debug("Remote head not found above checkpoint", "head", head)
+			return nil, errCheckpointNoTd
+		}
+		for _, header := range headers {
+			if header.ParentHash != parent.Hash() || header.Number.Uint64() != parent.Number.Uint64()+1 {
+				p.log.Warn("Checkpoint descendants broke chain ordering", "number", header.Number, "hash", header.Hash(), "parent", parent.Number)
+				return nil, errInvalidChain
+			}
+			sum.Add(sum, header.Difficulty)
+			parent = header
+
+			if header.Hash() == head {
+				checkpointTd := new(big.Int).Sub(td, sum)
+				if checkpointTd.Cmp(checkpoint.Difficulty) < 0 {
+					p.log.Warn("Remote total difficulty too low", "td", td, "descendants", sum)
+					return nil, errBadPeer
+				}
+				p.log.Debug("Derived checkpoint total difficulty", "number", checkpoint.Number, "td", checkpointTd)
+				return checkpointTd, nil
+			}
+		}
+	}
+}
+
+// Backfill retrieves a few batches of the blocks missing below a chain that was
+// anchored at a trusted checkpoint from the given peer, linked to the chain by
+// their hashes. It is meant to be called periodically and returns errBusy while
+// a sync cycle is running.
+func (d *Downloader) Backfill(id string) error {
+	chain, ok := d.blockchain.(checkpointer)
+	if !ok || chain.ChainTail() == nil {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&d.synchronising, 0, 1) {
+		return errBusy
+	}
+	defer atomic.StoreInt32(&d.synchronising, 0)
+
+	d.drainDeliveries()
+
+	d.cancelLock.Lock()
+	d.cancelCh = make(chan struct{})
+	d.cancelPeer = id
+	d.cancelLock.Unlock()
+
+	defer d.Cancel() // No matter what, we can't leave the cancel channel open
+
+	p := d.peers.Peer(id)
+	if p == nil {
+		return errUnknownPeer
+	}
+	if p.version < 63 {
+		return errTooOld
+	}
+	for i := 0; i < backfillBatches; i++ {
+		tail := chain.ChainTail()
+		if tail == nil {
+			return nil
+		}
+		if err := d.backfillBatch(p, chain, tail); err != nil {
+			switch err {
+			case errBadPeer, errInvalidChain, errInvalidBody, errInvalidReceipt:
+				log.Warn("Backfill failed, dropping peer", "peer", id, "err", err)
+				d.peerInvalid(id)
+				if d.dropPeer != nil {
+					d.dropPeer(id)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillBatch retrieves the batch of blocks directly below the tail of the
+// chain, verifying that they link to it and inserting them.
+func (d *Downloader) backfillBatch(p *peerConnection, chain checkpointer, tail *types.Header) error {
+	count := tail.Number.Uint64() - 1
+	if count > uint64(MaxBlockFetch) {
+		count = uint64(MaxBlockFetch)
+	}
+	packet, err := d.requestPacket(p, d.headerCh, errCancelHeaderFetch, func() error {
+		return p.peer.RequestHeadersByHash(tail.ParentHash, int(count), 0, true)
+	})
+	if err != nil {
+		return err
+	}
+	headers := packet.(*headerPack).headers
+	if len(headers) == 0 {
+		return errEmptyHeaderSet
+	}
+	if uint64(len(headers)) > count {
+		return errBadPeer
+	}
+	// Ensure the headers link to the tail, reordering them upwards
+	var (
+		ordered = make([]*types.Header, len(headers))
+		parent  = tail
+	)
+	for i, header := range headers {
+		if header.Hash() != parent.ParentHash || header.Number.Uint64()+1 != parent.Number.Uint64() {
+			p.log.Warn("Backfilled headers broke chain ancestry", "number", header.Number, "hash", header.Hash(), "child", parent.Number)
+			return errInvalidChain
+		}
+		ordered[len(headers)-1-i] = header
+		parent = header
+	}
+	blocks, receipts, err := d.fetchBlocks(p, ordered)
+	if err != nil {
+		return err
+	}
+	if _, err := chain.BackfillChain(blocks, receipts); err != nil {
+		return err
+	}
+	p.log.Debug("Backfilled chain segment", "count", len(blocks), "number", blocks[0].Number(), "hash", blocks[0].Hash())
+	return nil
+}
+
+// fetchBlocks retrieves the bodies and receipts of a batch of headers from the
+// peer, verifying them against the headers.
+func (d *Downloader) fetchBlocks(p *peerConnection, headers []*types.Header) (types.Blocks, []types.Receipts, error) {
+	hashes := make([]common.Hash, len(headers))
+	for i, header := range headers {
+		hashes[i] = header.Hash()
+	}
+	blocks := make(types.Blocks, 0, len(headers))
+	for len(blocks) < len(headers) {
+		request := hashes[len(blocks):]
+		if len(request) > MaxBodyFetch {
+			request = request[:MaxBodyFetch]
+		}
+		packet, err := d.requestPacket(p, d.bodyCh, errCancelBodyFetch, func() error {
+			return p.peer.RequestBodies(request)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		bodies := packet.(*bodyPack)
+		if len(bodies.transactions) == 0 {
+			return nil, nil, errStallingPeer
+		}
+		if len(bodies.transactions) > len(request) || len(bodies.transactions) != len(bodies.uncles) {
+			return nil, nil, errBadPeer
+		}
+		for i, txs := range bodies.transactions {
+			header := headers[len(blocks)]
+			if types.DeriveSha(types.Transactions(txs)) != header.TxHash || types.CalcUncleHash(bodies.uncles[i]) != header.UncleHash {
+				return nil, nil, errInvalidBody
+			}
+			blocks = append(blocks, types.NewBlockWithHeader(header).WithBody(txs, bodies.uncles[i]))
+		}
+	}
+	receipts := make([]types.Receipts, 0, len(headers))
+	for len(receipts) < len(headers) {
+		request := hashes[len(receipts):]
+		if len(request) > MaxReceiptFetch {
+			request = request[:MaxReceiptFetch]
+		}
+		packet, err := d.requestPacket(p, d.receiptCh, errCancelReceiptFetch, func() error {
+			return p.peer.RequestReceipts(request)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		results := packet.(*receiptPack).receipts
+		if len(results) == 0 {
+			return nil, nil, errStallingPeer
+		}
+		if len(results) > len(request) {
+			return nil, nil, errBadPeer
+		}
+		for _, result := range results {
+			if types.DeriveSha(types.Receipts(result)) != headers[len(receipts)].ReceiptHash {
+				return nil, nil, errInvalidReceipt
+			}
+			receipts = append(receipts, result)
+		}
+	}
+	return blocks, receipts, nil
+}
+
+// requestPacket issues a request to the peer and waits for its response on the
+// given delivery channel, discarding anything not from the peer.
+func (d *Downloader) requestPacket(p *peerConnection, deliveryCh chan dataPack, errCancel error, request func() error) (dataPack, error) {
+	go request()
+
+	ttl := d.requestTTL()
+	timeout := time.After(ttl)
+	for {
+		select {
+		case <-d.cancelCh:
+			return nil, errCancel
+
+		case packet := <-deliveryCh:
+			// Discard anything not from the origin peer
+			if packet.PeerId() != p.id {
+				log.Debug("Received data from incorrect peer", "peer", packet.PeerId())
+				break
+			}
+			return packet, nil
+
+		case <-timeout:
+			p.log.Debug("Waiting for response timed out", "elapsed", ttl)
+			return nil, errTimeout
+		}
+	}
+}
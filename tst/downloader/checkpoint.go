@@ -0,0 +1,144 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/common/hexutil"
+	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+var (
+	errCheckpointNoTd     = errors.New("checkpoint total difficulty missing")
+	errCheckpointNoSigner = errors.New("no trusted checkpoint signers configured")
+)
+
+// Checkpoint is a trusted block the sync of an empty chain may start from instead
+// of the genesis block, weak subjectivity style. Its ancestors are neither
+// downloaded nor verified during the sync, rather backfilled in the background
+// afterwards, linked by hash.
+type Checkpoint struct {
+	Number uint64      // Number of the checkpoint block
+	Hash   common.Hash // Hash of the checkpoint block
+	TD     *big.Int    `toml:",omitempty"` // Total difficulty of the checkpoint block (nil = derive from the sync peer)
+}
+
+// checkpointJSON is the file format of a signed checkpoint.
+type checkpointJSON struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Hash      common.Hash    `json:"hash"`
+	TD        *hexutil.Big   `json:"td"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// ParseCheckpoint parses a checkpoint in the "number:hash" format. Its total
+// difficulty is not known and will be derived from the peer synced with.
+func ParseCheckpoint(s string) (*Checkpoint, error) {
+	cp, err := core.ParseCheckpoint(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{Number: cp.Number, Hash: cp.Hash}, nil
+}
+
+// String implements fmt.Stringer, returning the "number:hash" form.
+func (c *Checkpoint) String() string {
+	return fmt.Sprintf("%d:%s", c.Number, c.Hash.Hex())
+}
+
+// SigHash returns the hash of the checkpoint's contents to be signed.
+func (c *Checkpoint) SigHash() common.Hash {
+	blob, _ := rlp.EncodeToBytes([]interface{}{c.Number, c.Hash, c.TD})
+	return crypto.Keccak256Hash(blob)
+}
+
+// Sign signs the checkpoint with the given key. Only checkpoints including their
+// total difficulty can be signed.
+func (c *Checkpoint) Sign(key *ecdsa.PrivateKey) ([]byte, error) {
+	if c.TD == nil {
+		return nil, errCheckpointNoTd
+	}
+	return crypto.Sign(c.SigHash().Bytes(), key)
+}
+
+// Signer recovers the address of the account that signed the checkpoint.
+func (c *Checkpoint) Signer(sig []byte) (common.Address, error) {
+	pubkey, err := crypto.SigToPub(c.SigHash().Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// WriteCheckpointFile signs the checkpoint with the given key and saves it into
+// a file, which can be loaded by nodes trusting the signer.
+func WriteCheckpointFile(file string, c *Checkpoint, key *ecdsa.PrivateKey) error {
+	sig, err := c.Sign(key)
+	if err != nil {
+		return err
+	}
+	blob, err := json.MarshalIndent(&checkpointJSON{
+		Number:    hexutil.Uint64(c.Number),
+		Hash:      c.Hash,
+		TD:        (*hexutil.Big)(c.TD),
+		Signature: sig,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, blob, 0644)
+}
+
+// LoadCheckpointFile loads a signed checkpoint from a file, ensuring it was
+// signed by one of the trusted signers.
+func LoadCheckpointFile(file string, signers []common.Address) (*Checkpoint, error) {
+	if len(signers) == 0 {
+		return nil, errCheckpointNoSigner
+	}
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var enc checkpointJSON
+	if err := json.Unmarshal(blob, &enc); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file: %v", err)
+	}
+	if enc.TD == nil {
+		return nil, errCheckpointNoTd
+	}
+	cp := &Checkpoint{Number: uint64(enc.Number), Hash: enc.Hash, TD: (*big.Int)(enc.TD)}
+
+	signer, err := cp.Signer(enc.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint signature: %v", err)
+	}
+	for _, trusted := range signers {
+		if signer == trusted {
+			return cp, nil
+		}
+	}
+	return nil, fmt.Errorf("checkpoint signed by untrusted account %x", signer)
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/metrics"
 	"github.com/watchain/go-watchain/params"
+	"github.com/watchain/go-watchain/wat/snap"
 )
 
 var (
@@ -90,16 +91,22 @@ var (
 	errCancelContentProcessing = errors.New("content processing canceled (requested)")
 	errNoSyncActive            = errors.New("no sync active")
 	errTooOld                  = errors.New("peer doesn't speak recent enough protocol version (need version >= 62)")
+	errCheckpointUnreached     = errors.New("remote chain too short for the sync checkpoint")
 )
 
 type Downloader struct {
-	mode SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
-	mux  *event.TypeMux // Event multiplexer to announce sync operation events
+	mode     SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
+	snapSync bool           // Whwater the state is retrieved via snap sync (per sync cycle)
+	mux      *event.TypeMux // Event multiplexer to announce sync operation events
+
+	checkpoint *Checkpoint // Trusted checkpoint to anchor an empty chain at (nil = sync from the genesis)
 
 	queue   *queue   // Scheduler for selecting the hashes to download
 	peers   *peerSet // Set of active peers from which download can proceed
 	stateDB watdb.Database
 
+	snapSyncer *snap.Syncer // Snap state syncer retrieving the state as proven ranges
+
 	rttEstimate   uint64 // Round trip time to target for download requests
 	rttConfidence uint64 // Confidence in the estimated RTT (unit: millionths to allow atomic ops)
 
@@ -109,11 +116,15 @@ type Downloader struct {
 	syncStatsState       stateSyncStats
 	syncStatsLock        sync.RWMutex // Lock protecting the sync stats fields
 
+	progress     syncProgress // Fast sync progress persisted to resume after restarts
+	progressLock sync.Mutex   // Lock protecting the fast sync progress
+
 	lightchain LightChain
 	blockchain BlockChain
 
 	// Callbacks
 	dropPeer peerDropFn // Drops a peer for misbehaving
+	scorer   PeerScorer // Tracks the reputation of the peers (may be nil)
 
 	// Status
 	synchroniseMock func(id string, hash common.Hash) error // Replacement for synchronise during testing
@@ -157,6 +168,9 @@ type LightChain interface {
 	// GetHeaderByHash retrieves a header from the local chain.
 	GetHeaderByHash(common.Hash) *types.Header
 
+	// GetHeaderByNumber retrieves a header from the local canonical chain.
+	GetHeaderByNumber(uint64) *types.Header
+
 	// CurrentHeader retrieves the head header from the local chain.
 	CurrentHeader() *types.Header
 
@@ -170,6 +184,26 @@ type LightChain interface {
 	Rollback([]common.Hash)
 }
 
+// finalizer is implemented by chains enforcing operator configured finality
+// rules, below which no common ancestor with a remote peer is acceptable.
+type finalizer interface {
+	// FinalizedNumber returns the highest local block that may not be reorged away.
+	FinalizedNumber() uint64
+}
+
+// checkpointer is implemented by chains able to start from a trusted checkpoint
+// instead of the genesis block, backfilling its ancestors afterwards.
+type checkpointer interface {
+	// InsertCheckpoint anchors an empty chain at a trusted checkpoint block.
+	InsertCheckpoint(*types.Block, types.Receipts, *big.Int) error
+
+	// ChainTail retrieves the oldest block header whose ancestors are missing.
+	ChainTail() *types.Header
+
+	// BackfillChain inserts a batch of blocks directly below the chain tail.
+	BackfillChain(types.Blocks, []types.Receipts) (int, error)
+}
+
 // BlockChain encapsulates functions required to sync a (full or fast) blockchain.
 type BlockChain interface {
 	LightChain
@@ -196,15 +230,18 @@ type BlockChain interface {
 	InsertReceiptChain(types.Blocks, []types.Receipts) (int, error)
 }
 
-// New creates a new downloader to fetch hashes and blocks from remote peers.
-func New(mode SyncMode, stateDb watdb.Database, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn) *Downloader {
+// New creates a new downloader to fetch hashes and blocks from remote peers. If
+// a checkpoint is given, fast syncing an empty chain starts from it.
+func New(mode SyncMode, checkpoint *Checkpoint, stateDb watdb.Database, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn, scorer PeerScorer) *Downloader {
 	if lightchain == nil {
 		lightchain = chain
 	}
 
 	dl := &Downloader{
 		mode:           mode,
+		checkpoint:     checkpoint,
 		stateDB:        stateDb,
+		snapSyncer:     snap.NewSyncer(stateDb),
 		mux:            mux,
 		queue:          newQueue(),
 		peers:          newPeerSet(),
@@ -213,6 +250,7 @@ func New(mode SyncMode, stateDb watdb.Database, mux *event.TypeMux, chain BlockC
 		blockchain:     chain,
 		lightchain:     lightchain,
 		dropPeer:       dropPeer,
+		scorer:         scorer,
 		headerCh:       make(chan dataPack, 1),
 		bodyCh:         make(chan dataPack, 1),
 		receiptCh:      make(chan dataPack, 1),
@@ -225,6 +263,7 @@ func New(mode SyncMode, stateDb watdb.Database, mux *event.TypeMux, chain BlockC
 		syncStatsState: stateSyncStats{
 			processed: core.GetTrieSyncProgress(stateDb),
 		},
+		progress:      loadSyncProgress(stateDb),
 		trackStateReq: make(chan *stateReq),
 	}
 	go dl.qosTuner()
@@ -237,13 +276,18 @@ func New(mode SyncMode, stateDb watdb.Database, mux *event.TypeMux, chain BlockC
 // or header sync is currently at; and the latest known block which the sync targets.
 //
 // In addition, during the state download phase of fast synchronisation the number
-// of processed and the total number of known states are also returned. Otherwise
-// these are zero.
+// of processed and the total number of known states are also returned, along with
+// the pivot block (persisted across restarts) and the header chain's head block.
+// Otherwise these are zero.
 func (d *Downloader) Progress() watereum.SyncProgress {
 	// Lock the current stats and return the progress
 	d.syncStatsLock.RLock()
 	defer d.syncStatsLock.RUnlock()
 
+	d.progressLock.Lock()
+	pivot := d.progress.Pivot
+	d.progressLock.Unlock()
+
 	current := uint64(0)
 	switch d.mode {
 	case FullSync:
@@ -259,6 +303,8 @@ func (d *Downloader) Progress() watereum.SyncProgress {
 		HighestBlock:  d.syncStatsChainHeight,
 		PulledStates:  d.syncStatsState.processed,
 		KnownStates:   d.syncStatsState.processed + d.syncStatsState.pending,
+		PivotBlock:    pivot,
+		HeaderBlock:   d.lightchain.CurrentHeader().Number.Uint64(),
 	}
 }
 
@@ -267,12 +313,18 @@ func (d *Downloader) Synchronising() bool {
 	return atomic.LoadInt32(&d.synchronising) > 0
 }
 
+// SnapSyncer retrieves the snap state syncer, which the snap protocol handlers
+// register their peers into and deliver their responses to.
+func (d *Downloader) SnapSyncer() *snap.Syncer {
+	return d.snapSyncer
+}
+
 // RegisterPeer injects a new download peer into the set of block source to be
 // used for fetching hashes and blocks from.
 func (d *Downloader) RegisterPeer(id string, version int, peer Peer) error {
 	logger := log.New("peer", id)
 	logger.Trace("Registering sync peer")
-	if err := d.peers.Register(newPeerConnection(id, version, peer, logger)); err != nil {
+	if err := d.peers.Register(newPeerConnection(id, version, peer, d.scorer, logger)); err != nil {
 		logger.Error("Failed to register sync peer", "err", err)
 		return err
 	}
@@ -310,6 +362,22 @@ func (d *Downloader) UnregisterPeer(id string) error {
 	return nil
 }
 
+// peerTimeout reports a peer having failed to deliver requested data in time to
+// the reputation tracker, if any.
+func (d *Downloader) peerTimeout(id string) {
+	if d.scorer != nil {
+		d.scorer.Timeout(id)
+	}
+}
+
+// peerInvalid reports a peer having delivered invalid data to the reputation
+// tracker, if any.
+func (d *Downloader) peerInvalid(id string) {
+	if d.scorer != nil {
+		d.scorer.Invalid(id)
+	}
+}
+
 // Synchronise tries to sync up our local block chain with a remote peer, both
 // adding various sanity checks as well as wrapping it with various log entries.
 func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode SyncMode) error {
@@ -322,6 +390,13 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 		errEmptyHeaderSet, errPeersUnavailable, errTooOld,
 		errInvalidAncestor, errInvalidChain:
 		log.Warn("Synchronisation failed, dropping peer", "peer", id, "err", err)
+		// Timed out requests are reported where they expire, only the stalling is left
+		switch err {
+		case errStallingPeer:
+			d.peerTimeout(id)
+		case errBadPeer, errEmptyHeaderSet, errInvalidAncestor, errInvalidChain:
+			d.peerInvalid(id)
+		}
 		if d.dropPeer == nil {
 			// The dropPeer method is nil when `--copydb` is used for a local copy.
 			// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
@@ -363,15 +438,7 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 		default:
 		}
 	}
-	for _, ch := range []chan dataPack{d.headerCh, d.bodyCh, d.receiptCh} {
-		for empty := false; !empty; {
-			select {
-			case <-ch:
-			default:
-				empty = true
-			}
-		}
-	}
+	d.drainDeliveries()
 	for empty := false; !empty; {
 		select {
 		case <-d.headerProcCh:
@@ -387,8 +454,12 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 
 	defer d.Cancel() // No matter what, we can't leave the cancel channel open
 
-	// Set the requested sync mode, unless it's forbidden
-	d.mode = mode
+	// Set the requested sync mode, unless it's forbidden. Snap sync retrieves the
+	// chain the same way as fast sync, only the state download differs.
+	d.mode, d.snapSync = mode, mode == SnapSync
+	if d.snapSync {
+		d.mode = FastSync
+	}
 
 	// Retrieve the origin peer and initiate the downloading process
 	p := d.peers.Peer(id)
@@ -398,6 +469,20 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 	return d.syncWithPeer(p, hash, td)
 }
 
+// drainDeliveries discards any leftover data packets delivered by peers after a
+// previous sync cycle was finished.
+func (d *Downloader) drainDeliveries() {
+	for _, ch := range []chan dataPack{d.headerCh, d.bodyCh, d.receiptCh} {
+		for empty := false; !empty; {
+			select {
+			case <-ch:
+			default:
+				empty = true
+			}
+		}
+	}
+}
+
 // syncWithPeer starts a block synchronization based on the hash chain from the
 // specified peer and head hash.
 func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.Int) (err error) {
@@ -426,10 +511,22 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	}
 	height := latest.Number.Uint64()
 
+	// Anchor an empty chain at the trusted checkpoint before looking for the ancestor
+	if err := d.anchorCheckpoint(p, latest, hash, td); err != nil {
+		return err
+	}
 	origin, err := d.findAncestor(p, height)
 	if err != nil {
 		return err
 	}
+	// If an interrupted fast sync left headers above the fast block that are also
+	// on the remote chain, replay them locally instead of downloading them again
+	replay := origin
+	if d.mode == FastSync {
+		if fast := d.blockchain.CurrentFastBlock().NumberU64(); origin > fast {
+			origin = fast
+		}
+	}
 	d.syncStatsLock.Lock()
 	if d.syncStatsChainHeight <= origin || d.syncStatsChainOrigin > origin {
 		d.syncStatsChainOrigin = origin
@@ -443,7 +540,10 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		if height <= uint64(fsMinFullBlocks) {
 			origin = 0
 		} else {
-			pivot = height - uint64(fsMinFullBlocks)
+			// Reuse the pivot of an interrupted sync unless it became stale meanwhile
+			if pivot = d.resumablePivot(height); pivot == 0 {
+				pivot = height - uint64(fsMinFullBlocks)
+			}
 			if pivot <= origin {
 				origin = pivot - 1
 			}
@@ -452,6 +552,19 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	d.committed = 1
 	if d.mode == FastSync && pivot != 0 {
 		d.committed = 0
+
+		// Persist the sync progress to allow resuming it after a restart
+		d.updateProgress(func(progress *syncProgress) {
+			if progress.Pivot != pivot {
+				progress.reset(pivot)
+			}
+			d.trackProgress(progress)
+		})
+		defer func() {
+			if atomic.LoadInt32(&d.committed) == 0 {
+				d.updateProgress(d.trackProgress)
+			}
+		}()
 	}
 	// Initiate the sync using a concurrent header and content retrieval algorithm
 	d.queue.Prepare(origin+1, d.mode)
@@ -460,13 +573,13 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	}
 
 	fetchers := []func() error{
-		func() error { return d.fetchHeaders(p, origin+1, pivot) }, // Headers are always retrieved
-		func() error { return d.fetchBodies(origin + 1) },          // Bodies are retrieved during normal and fast sync
-		func() error { return d.fetchReceipts(origin + 1) },        // Receipts are retrieved during fast sync
+		func() error { return d.fetchHeaders(p, origin+1, replay, pivot) }, // Headers are always retrieved
+		func() error { return d.fetchBodies(origin + 1) },                  // Bodies are retrieved during normal and fast sync
+		func() error { return d.fetchReceipts(origin + 1) },                // Receipts are retrieved during fast sync
 		func() error { return d.processHeaders(origin+1, pivot, td) },
 	}
 	if d.mode == FastSync {
-		fetchers = append(fetchers, func() error { return d.processFastSyncContent(latest) })
+		fetchers = append(fetchers, func() error { return d.processFastSyncContent(latest, pivot) })
 	} else if d.mode == FullSync {
 		fetchers = append(fetchers, d.processFullSyncContent)
 	}
@@ -568,6 +681,7 @@ func (d *Downloader) fetchHeight(p *peerConnection) (*types.Header, error) {
 
 		case <-timeout:
 			p.log.Debug("Waiting for head header timed out", "elapsed", ttl)
+			d.peerTimeout(p.id)
 			return nil, errTimeout
 
 		case <-d.bodyCh:
@@ -582,6 +696,9 @@ func (d *Downloader) fetchHeight(p *peerConnection) (*types.Header, error) {
 // on the correct chain, checking the top N links should already get us a match.
 // In the rare scenario when we ended up on a long reorganisation (i.e. none of
 // the head links match), we do a binary search to find the common ancestor.
+//
+// During fast sync, the ancestor may also be located among the canonical headers
+// retained above the fast block by an interrupted sync, which are then reused.
 func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, error) {
 	// Figure out the valid ancestor range to prevent rewrite attacks
 	floor, ceil := int64(-1), d.lightchain.CurrentHeader().Number.Uint64()
@@ -594,6 +711,31 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 	if ceil >= MaxForkAncestry {
 		floor = int64(ceil - MaxForkAncestry)
 	}
+	if f, ok := d.lightchain.(finalizer); ok {
+		if final := int64(f.FinalizedNumber()) - 1; final > floor {
+			floor = final
+		}
+	}
+	// Headers above the fast block are only accepted if canonical, as the local
+	// header chain will be replayed up to the ancestor
+	fast := ceil
+	if d.mode == FastSync {
+		if headers := d.resumableHeaders(); headers > ceil {
+			ceil = headers
+		}
+	}
+	known := func(header *types.Header) bool {
+		number := header.Number.Uint64()
+		switch {
+		case d.mode == FullSync:
+			return d.blockchain.HasBlock(header.Hash(), number)
+		case number > fast:
+			local := d.lightchain.GetHeaderByNumber(number)
+			return local != nil && local.Hash() == header.Hash()
+		default:
+			return d.lightchain.HasHeader(header.Hash(), number)
+		}
+	}
 	p.log.Debug("Looking for common ancestor", "local", ceil, "remote", height)
 
 	// Request the topmost blocks to short circuit binary ancestor lookup
@@ -651,7 +793,7 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 					continue
 				}
 				// Otherwise check if we already know the header or not
-				if (d.mode == FullSync && d.blockchain.HasBlock(headers[i].Hash(), headers[i].Number.Uint64())) || (d.mode != FullSync && d.lightchain.HasHeader(headers[i].Hash(), headers[i].Number.Uint64())) {
+				if known(headers[i]) {
 					number, hash = headers[i].Number.Uint64(), headers[i].Hash()
 
 					// If every header is known, even future ones, the peer straight out lied about its head
@@ -665,6 +807,7 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 
 		case <-timeout:
 			p.log.Debug("Waiting for head header timed out", "elapsed", ttl)
+			d.peerTimeout(p.id)
 			return 0, errTimeout
 
 		case <-d.bodyCh:
@@ -716,7 +859,7 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 				arrived = true
 
 				// Modify the search interval based on the response
-				if (d.mode == FullSync && !d.blockchain.HasBlock(headers[0].Hash(), headers[0].Number.Uint64())) || (d.mode != FullSync && !d.lightchain.HasHeader(headers[0].Hash(), headers[0].Number.Uint64())) {
+				if !known(headers[0]) {
 					end = check
 					break
 				}
@@ -729,6 +872,7 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 
 			case <-timeout:
 				p.log.Debug("Waiting for search header timed out", "elapsed", ttl)
+				d.peerTimeout(p.id)
 				return 0, errTimeout
 
 			case <-d.bodyCh:
@@ -754,10 +898,21 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 // other peers are only accepted if they map cleanly to the skeleton. If no one
 // can fill in the skeleton - not even the origin peer - it's assumed invalid and
 // the origin is dropped.
-func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, pivot uint64) error {
+//
+// Headers up to replay, retained locally from an interrupted fast sync and known
+// to be part of the origin peer's chain, are not downloaded again but fed to the
+// header processor straight from the local chain.
+func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, replay uint64, pivot uint64) error {
 	p.log.Debug("Directing header downloads", "origin", from)
 	defer p.log.Debug("Header download terminated")
 
+	if replay >= from {
+		if err := d.replayHeaders(from, replay); err != nil {
+			return err
+		}
+		from = replay + 1
+	}
+
 	// Create a timeout timer, and the associated header fetcher
 	skeleton := true            // Skeleton assembly phase or finishing up
 	request := time.Now()       // time of the last skeleton fetch request
@@ -850,6 +1005,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, pivot uint64)
 			getHeaders(from)
 
 		case <-timeout.C:
+			d.peerTimeout(p.id)
 			if d.dropPeer == nil {
 				// The dropPeer method is nil when `--copydb` is used for a local copy.
 				// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
@@ -877,6 +1033,29 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, pivot uint64)
 	}
 }
 
+// replayHeaders feeds the local canonical headers in the range [from, to] to the
+// header processor in batches, as if they were downloaded from the network.
+func (d *Downloader) replayHeaders(from uint64, to uint64) error {
+	log.Debug("Replaying local headers", "from", from, "to", to)
+
+	for from <= to {
+		headers := make([]*types.Header, 0, MaxHeaderFetch)
+		for ; from <= to && len(headers) < MaxHeaderFetch; from++ {
+			header := d.lightchain.GetHeaderByNumber(from)
+			if header == nil {
+				return fmt.Errorf("missing local header #%d", from)
+			}
+			headers = append(headers, header)
+		}
+		select {
+		case d.headerProcCh <- headers:
+		case <-d.cancelCh:
+			return errCancelHeaderFetch
+		}
+	}
+	return nil
+}
+
 // fillHeaderSkeleton concurrently retrieves headers from all our available peers
 // and maps them to the provided skeleton header chain.
 //
@@ -1062,6 +1241,8 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 			// Check for fetch request timeouts and demote the responsible peers
 			for pid, fails := range expire() {
 				if peer := d.peers.Peer(pid); peer != nil {
+					d.peerTimeout(pid)
+
 					// If a lot of retrieval elements expired, we might have overestimated the remote peer or perhaps
 					// ourselves. Only reset to minimal throughput but don't drop just yet. If even the minimal times
 					// out that sync wise we need to get rid of the peer.
@@ -1351,23 +1532,28 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 }
 
 // processFastSyncContent takes fetch results from the queue and writes them to the
-// database. It also controls the synchronisation of state nodes of the pivot block.
-func (d *Downloader) processFastSyncContent(latest *types.Header) error {
+// database. It also controls the synchronisation of state nodes of the pivot block,
+// the initial choice of which is made by the caller. Note, that this goalpost may
+// move if the sync takes long enough for the chain head to move significantly.
+func (d *Downloader) processFastSyncContent(latest *types.Header, pivot uint64) error {
 	// Start syncing state of the reported head block. This should get us most of
-	// the state of the pivot block.
-	stateSync := d.syncState(latest.Root)
+	// the state of the pivot block. If resuming an interrupted sync, continue with
+	// the state it was retrieving instead.
+	root := latest.Root
+
+	d.progressLock.Lock()
+	if d.progress.Pivot == pivot && d.progress.Root != (common.Hash{}) {
+		root = d.progress.Root
+	}
+	d.progressLock.Unlock()
+
+	stateSync := d.syncState(root)
 	defer stateSync.Cancel()
 	go func() {
 		if err := stateSync.Wait(); err != nil && err != errCancelStateFetch {
 			d.queue.Close() // wake up WaitResults
 		}
 	}()
-	// Figure out the ideal pivot block. Note, that this goalpost may move if the
-	// sync takes long enough for the chain head to move significantly.
-	pivot := uint64(0)
-	if height := latest.Number.Uint64(); height > uint64(fsMinFullBlocks) {
-		pivot = height - uint64(fsMinFullBlocks)
-	}
 	// To cater for moving pivot points, track the pivot block and subsequently
 	// accumulated download results separatey.
 	var (
@@ -1402,6 +1588,11 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 			if height := latest.Number.Uint64(); height > pivot+2*uint64(fsMinFullBlocks) {
 				log.Warn("Pivot became stale, moving", "old", pivot, "new", height-uint64(fsMinFullBlocks))
 				pivot = height - uint64(fsMinFullBlocks)
+
+				d.updateProgress(func(progress *syncProgress) {
+					progress.reset(pivot)
+					d.trackProgress(progress)
+				})
 			}
 		}
 		P, beforeP, afterP := splitAroundPivot(pivot, results)
@@ -1503,6 +1694,7 @@ func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 		return err
 	}
 	atomic.StoreInt32(&d.committed, 1)
+	d.clearProgress()
 	return nil
 }
 
@@ -19,7 +19,10 @@ package downloader
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/big"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -32,8 +35,10 @@ import (
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/event"
+	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/params"
 	"github.com/watchain/go-watchain/trie"
+	"github.com/watchain/go-watchain/wat/snap"
 )
 
 var (
@@ -61,6 +66,7 @@ type downloadTester struct {
 	ownBlocks   map[common.Hash]*types.Block   // Blocks belonging to the tester
 	ownReceipts map[common.Hash]types.Receipts // Receipts belonging to the tester
 	ownChainTd  map[common.Hash]*big.Int       // Total difficulties of the blocks in the local chain
+	ownTail     *types.Header                  // Oldest header of a checkpoint anchored chain missing its ancestors
 
 	peerHashes   map[string][]common.Hash                  // Hash chain belonging to different test peers
 	peerHeaders  map[string]map[common.Hash]*types.Header  // Headers belonging to different test peers
@@ -96,7 +102,7 @@ func newTester() *downloadTester {
 	tester.stateDb, _ = watdb.NewMemDatabase()
 	tester.stateDb.Put(genesis.Root().Bytes(), []byte{0x00})
 
-	tester.downloader = New(FullSync, tester.stateDb, new(event.TypeMux), tester, nil, tester.dropPeer)
+	tester.downloader = New(FullSync, nil, tester.stateDb, new(event.TypeMux), tester, nil, tester.dropPeer, nil)
 
 	return tester
 }
@@ -234,6 +240,22 @@ func (dl *downloadTester) GetHeaderByHash(hash common.Hash) *types.Header {
 	return dl.ownHeaders[hash]
 }
 
+// GetHeaderByNumber retrieves a header from the testers canonical chain.
+func (dl *downloadTester) GetHeaderByNumber(number uint64) *types.Header {
+	header := dl.CurrentHeader()
+
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	for header != nil && header.Number.Uint64() > number {
+		header = dl.ownHeaders[header.ParentHash]
+	}
+	if header == nil || header.Number.Uint64() != number {
+		return nil
+	}
+	return header
+}
+
 // GetBlock retrieves a block from the testers canonical chain.
 func (dl *downloadTester) GetBlockByHash(hash common.Hash) *types.Block {
 	dl.lock.RLock()
@@ -370,6 +392,65 @@ func (dl *downloadTester) InsertReceiptChain(blocks types.Blocks, receipts []typ
 	return len(blocks), nil
 }
 
+// InsertCheckpoint anchors the empty simulated chain at a trusted checkpoint.
+func (dl *downloadTester) InsertCheckpoint(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if len(dl.ownHashes) > 1 {
+		return errors.New("chain not empty")
+	}
+	dl.ownHashes = append(dl.ownHashes, block.Hash())
+	dl.ownHeaders[block.Hash()] = block.Header()
+	dl.ownBlocks[block.Hash()] = block
+	dl.ownReceipts[block.Hash()] = receipts
+	dl.ownChainTd[block.Hash()] = td
+	dl.ownTail = block.Header()
+
+	return nil
+}
+
+// ChainTail retrieves the oldest header of the simulated chain missing its ancestors.
+func (dl *downloadTester) ChainTail() *types.Header {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.ownTail
+}
+
+// BackfillChain injects a batch of blocks below the tail of the simulated chain.
+func (dl *downloadTester) BackfillChain(blocks types.Blocks, receipts []types.Receipts) (int, error) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if dl.ownTail == nil {
+		return 0, errors.New("chain complete")
+	}
+	if blocks[len(blocks)-1].Hash() != dl.ownTail.ParentHash {
+		return 0, errors.New("unknown child")
+	}
+	hashes := make([]common.Hash, len(blocks))
+	td := new(big.Int).Sub(dl.ownChainTd[dl.ownTail.Hash()], dl.ownTail.Difficulty)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		hashes[i] = blocks[i].Hash()
+		dl.ownHeaders[hashes[i]] = blocks[i].Header()
+		dl.ownBlocks[hashes[i]] = blocks[i]
+		dl.ownReceipts[hashes[i]] = receipts[i]
+		dl.ownChainTd[hashes[i]] = td
+		td = new(big.Int).Sub(td, blocks[i].Difficulty())
+	}
+	dl.ownHashes = append(append([]common.Hash{dl.ownHashes[0]}, hashes...), dl.ownHashes[1:]...)
+
+	dl.ownTail = blocks[0].Header()
+	if blocks[0].ParentHash() == dl.genesis.Hash() {
+		if td.Cmp(dl.genesis.Difficulty()) != 0 {
+			return 0, fmt.Errorf("genesis td mismatch: have %v, want %v", td, dl.genesis.Difficulty())
+		}
+		dl.ownTail = nil
+	}
+	return 0, nil
+}
+
 // Rollback removes some recently added elements from the chain.
 func (dl *downloadTester) Rollback(hashes []common.Hash) {
 	dl.lock.Lock()
@@ -398,7 +479,12 @@ func (dl *downloadTester) newSlowPeer(id string, version int, hashes []common.Ha
 	dl.lock.Lock()
 	defer dl.lock.Unlock()
 
-	var err = dl.downloader.RegisterPeer(id, version, &downloadTesterPeer{dl: dl, id: id, delay: delay})
+	peer := &downloadTesterPeer{dl: dl, id: id, delay: delay}
+
+	var err = dl.downloader.RegisterPeer(id, version, peer)
+	if err == nil {
+		err = dl.downloader.SnapSyncer().Register(peer)
+	}
 	if err == nil {
 		// Assign the owned hashes, headers and blocks to the peer (deep copy)
 		dl.peerHashes[id] = make([]common.Hash, len(hashes))
@@ -454,6 +540,7 @@ func (dl *downloadTester) dropPeer(id string) {
 	delete(dl.peerChainTds, id)
 
 	dl.downloader.UnregisterPeer(id)
+	dl.downloader.SnapSyncer().Unregister(id)
 }
 
 type downloadTesterPeer struct {
@@ -480,6 +567,11 @@ func (dlp *downloadTesterPeer) waitDelay() {
 	time.Sleep(delay)
 }
 
+// ID retrieves the identifier of the peer in the download tester.
+func (dlp *downloadTesterPeer) ID() string {
+	return dlp.id
+}
+
 // Head constructs a function to retrieve a peer's current head hash
 // and total difficulty.
 func (dlp *downloadTesterPeer) Head() (common.Hash, *big.Int) {
@@ -521,8 +613,15 @@ func (dlp *downloadTesterPeer) RequestHeadersByNumber(origin uint64, amount int,
 	hashes := dlp.dl.peerHashes[dlp.id]
 	headers := dlp.dl.peerHeaders[dlp.id]
 	result := make([]*types.Header, 0, amount)
-	for i := 0; i < amount && len(hashes)-int(origin)-1-i*(skip+1) >= 0; i++ {
-		if header, ok := headers[hashes[len(hashes)-int(origin)-1-i*(skip+1)]]; ok {
+	for i := 0; i < amount; i++ {
+		index := len(hashes) - int(origin) - 1 - i*(skip+1)
+		if reverse {
+			index = len(hashes) - int(origin) - 1 + i*(skip+1)
+		}
+		if index < 0 || index >= len(hashes) {
+			break
+		}
+		if header, ok := headers[hashes[index]]; ok {
 			result = append(result, header)
 		}
 	}
@@ -603,6 +702,42 @@ func (dlp *downloadTesterPeer) RequestNodeData(hashes []common.Hash) error {
 	return nil
 }
 
+// RequestAccountRange constructs a getAccountRange method associated with a
+// particular peer in the download tester. The returned function can be used to
+// retrieve proven ranges of accounts from the particularly requested peer.
+func (dlp *downloadTesterPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	dlp.waitDelay()
+
+	hashes, accounts, proof := snap.ServiceAccountRange(trie.NewDatabase(dlp.dl.peerDb), root, origin, limit, bytes)
+	go dlp.dl.downloader.SnapSyncer().OnAccounts(dlp, id, hashes, accounts, proof)
+
+	return nil
+}
+
+// RequestStorageRanges constructs a getStorageRanges method associated with a
+// particular peer in the download tester. The returned function can be used to
+// retrieve the slots of storage tries from the particularly requested peer.
+func (dlp *downloadTesterPeer) RequestStorageRanges(id uint64, roots []common.Hash, origin []byte, bytes uint64) error {
+	dlp.waitDelay()
+
+	hashes, slots, proof := snap.ServiceStorageRanges(trie.NewDatabase(dlp.dl.peerDb), roots, origin, bytes)
+	go dlp.dl.downloader.SnapSyncer().OnStorage(dlp, id, hashes, slots, proof)
+
+	return nil
+}
+
+// RequestByteCodes constructs a getByteCodes method associated with a particular
+// peer in the download tester. The returned function can be used to retrieve
+// contract codes from the particularly requested peer.
+func (dlp *downloadTesterPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	dlp.waitDelay()
+
+	codes := snap.ServiceByteCodes(trie.NewDatabase(dlp.dl.peerDb), hashes, bytes)
+	go dlp.dl.downloader.SnapSyncer().OnByteCodes(dlp, id, codes)
+
+	return nil
+}
+
 // assertOwnChain checks if the local chain contains the correct number of items
 // of the various chain components.
 func assertOwnChain(t *testing.T, tester *downloadTester, length int) {
@@ -665,6 +800,9 @@ func TestCanonicalSynchronisation63Fast(t *testing.T)  { testCanonicalSynchronis
 func TestCanonicalSynchronisation64Full(t *testing.T)  { testCanonicalSynchronisation(t, 64, FullSync) }
 func TestCanonicalSynchronisation64Fast(t *testing.T)  { testCanonicalSynchronisation(t, 64, FastSync) }
 func TestCanonicalSynchronisation64Light(t *testing.T) { testCanonicalSynchronisation(t, 64, LightSync) }
+func TestCanonicalSynchronisation64Snap(t *testing.T)  { testCanonicalSynchronisation(t, 64, SnapSync) }
+func TestCanonicalSynchronisation65Full(t *testing.T)  { testCanonicalSynchronisation(t, 65, FullSync) }
+func TestCanonicalSynchronisation65Fast(t *testing.T)  { testCanonicalSynchronisation(t, 65, FastSync) }
 
 func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -692,6 +830,7 @@ func TestThrottling63Full(t *testing.T) { testThrottling(t, 63, FullSync) }
 func TestThrottling63Fast(t *testing.T) { testThrottling(t, 63, FastSync) }
 func TestThrottling64Full(t *testing.T) { testThrottling(t, 64, FullSync) }
 func TestThrottling64Fast(t *testing.T) { testThrottling(t, 64, FastSync) }
+func TestThrottling64Snap(t *testing.T) { testThrottling(t, 64, SnapSync) }
 
 func testThrottling(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -779,6 +918,7 @@ func TestForkedSync63Fast(t *testing.T)  { testForkedSync(t, 63, FastSync) }
 func TestForkedSync64Full(t *testing.T)  { testForkedSync(t, 64, FullSync) }
 func TestForkedSync64Fast(t *testing.T)  { testForkedSync(t, 64, FastSync) }
 func TestForkedSync64Light(t *testing.T) { testForkedSync(t, 64, LightSync) }
+func TestForkedSync64Snap(t *testing.T)  { testForkedSync(t, 64, SnapSync) }
 
 func testForkedSync(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -955,6 +1095,7 @@ func TestCancel63Fast(t *testing.T)  { testCancel(t, 63, FastSync) }
 func TestCancel64Full(t *testing.T)  { testCancel(t, 64, FullSync) }
 func TestCancel64Fast(t *testing.T)  { testCancel(t, 64, FastSync) }
 func TestCancel64Light(t *testing.T) { testCancel(t, 64, LightSync) }
+func TestCancel64Snap(t *testing.T)  { testCancel(t, 64, SnapSync) }
 
 func testCancel(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1657,6 +1798,282 @@ func testFakedSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 	}
 }
 
+// Tests that a fast sync interrupted by a restart resumes with the same pivot, and
+// that the header chain retrieved before the restart is not downloaded again.
+func TestResumedFastSync63(t *testing.T) { testResumedFastSync(t, 63) }
+func TestResumedFastSync64(t *testing.T) { testResumedFastSync(t, 64) }
+
+func testResumedFastSync(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a small enough block chain to download
+	targetBlocks := blockCacheItems - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	// Simulate a sync interrupted after retrieving half the header chain, with its
+	// progress persisted before the node was restarted
+	retained := targetBlocks / 2
+
+	chain := make([]*types.Header, 0, retained)
+	for i := 1; i <= retained; i++ {
+		chain = append(chain, headers[hashes[len(hashes)-1-i]])
+	}
+	if _, err := tester.InsertHeaderChain(chain, 1); err != nil {
+		t.Fatalf("failed to insert retained headers: %v", err)
+	}
+	pivot := uint64(targetBlocks - fsMinFullBlocks - 32)
+	tester.downloader.updateProgress(func(progress *syncProgress) {
+		progress.Pivot, progress.Headers = pivot, uint64(retained)
+	})
+	tester.downloader.Terminate()
+	tester.downloader = New(FullSync, nil, tester.stateDb, new(event.TypeMux), tester, nil, tester.dropPeer, nil)
+
+	if progress := tester.downloader.Progress(); progress.PivotBlock != pivot || progress.HeaderBlock != uint64(retained) {
+		t.Fatalf("Restarted progress mismatch: have %v/%v, want %v/%v", progress.PivotBlock, progress.HeaderBlock, pivot, retained)
+	}
+	// Withhold the retained headers from the peer, apart from those needed to find
+	// the common ancestor, so the sync can only succeed by replaying them locally
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+	from := retained - MaxHeaderFetch
+	for number := 1; number <= retained; number++ {
+		if number < from || (number-from)%16 != 0 {
+			delete(tester.peerHeaders["peer"], hashes[len(hashes)-1-number])
+		}
+	}
+	tester.downloader.syncInitHook = func(origin, latest uint64) {
+		if progress := tester.downloader.Progress(); progress.PivotBlock != pivot {
+			t.Errorf("Pivot mismatch: have %v, want %v", progress.PivotBlock, pivot)
+		}
+	}
+	if err := tester.sync("peer", nil, FastSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	// Check that the chain was fast synced up to the resumed pivot
+	if hs := len(tester.ownHeaders); hs != targetBlocks+1 {
+		t.Fatalf("synchronised headers mismatch: have %v, want %v", hs, targetBlocks+1)
+	}
+	if bs := len(tester.ownBlocks); bs != targetBlocks+1 {
+		t.Fatalf("synchronised blocks mismatch: have %v, want %v", bs, targetBlocks+1)
+	}
+	if rs := len(tester.ownReceipts); rs != int(pivot)+1 {
+		t.Fatalf("synchronised receipts mismatch: have %v, want %v", rs, pivot+1)
+	}
+	// Check that the progress is dropped after the pivot is committed
+	if progress := loadSyncProgress(tester.stateDb); progress.Pivot != 0 {
+		t.Fatalf("Sync progress not cleared: have pivot %v", progress.Pivot)
+	}
+	if progress := tester.downloader.Progress(); progress.PivotBlock != 0 {
+		t.Fatalf("Pivot not cleared: have %v", progress.PivotBlock)
+	}
+}
+
+// countingPutter counts the database writes of a state sync commit.
+type countingPutter struct {
+	db     watdb.Putter
+	writes int
+}
+
+func (p *countingPutter) Put(key []byte, value []byte) error {
+	p.writes++
+	return p.db.Put(key, value)
+}
+
+// Tests that the pending trie retrievals of a state sync are persisted one entry
+// at a time, so a commit writes only the entries that changed, and that they are
+// resumed only by a sync of the same state root.
+func TestPersistedStateEntries(t *testing.T) {
+	tester := newTester()
+	defer tester.terminate()
+
+	root := common.HexToHash("0x01")
+	entries, pending := tester.downloader.loadStateEntries(root)
+	if len(pending) != 0 {
+		t.Fatalf("pristine pending retrievals mismatch: have %d, want 0", len(pending))
+	}
+	// Persist a batch of retrievals, then replace a single one of them
+	var added []trie.SyncEntry
+	for i := 0; i < 100; i++ {
+		added = append(added, trie.SyncEntry{Hash: common.BytesToHash([]byte{byte(i + 1)}), Depth: uint64(i)})
+	}
+	writes := &countingPutter{db: tester.stateDb}
+	states := entries.update(writes, added, nil)
+	if states != 100 || writes.writes != 100 {
+		t.Fatalf("initial commit mismatch: have %d slots/%d writes, want 100/100", states, writes.writes)
+	}
+	replaced := trie.SyncEntry{Hash: common.HexToHash("0xff"), Depth: 7, Leaf: true}
+
+	writes = &countingPutter{db: tester.stateDb}
+	states = entries.update(writes, []trie.SyncEntry{replaced}, []common.Hash{added[0].Hash})
+	if states != 100 || writes.writes != 2 {
+		t.Fatalf("delta commit mismatch: have %d slots/%d writes, want 100/2", states, writes.writes)
+	}
+	tester.downloader.updateProgress(func(progress *syncProgress) {
+		progress.Pivot, progress.Root, progress.States = 1, root, states
+	})
+	// Restart the sync of the same root and check the retrievals are resumed
+	tester.downloader.Terminate()
+	tester.downloader = New(FullSync, nil, tester.stateDb, new(event.TypeMux), tester, nil, tester.dropPeer, nil)
+
+	entries, pending = tester.downloader.loadStateEntries(root)
+	if len(pending) != 100 {
+		t.Fatalf("resumed pending retrievals mismatch: have %d, want 100", len(pending))
+	}
+	resumed := make(map[common.Hash]trie.SyncEntry)
+	for _, entry := range pending {
+		resumed[entry.Hash] = entry
+	}
+	if _, ok := resumed[added[0].Hash]; ok {
+		t.Fatalf("completed retrieval resumed")
+	}
+	if entry := resumed[replaced.Hash]; entry != replaced {
+		t.Fatalf("replaced retrieval mismatch: have %+v, want %+v", entry, replaced)
+	}
+	// A sync of another root must not resume the retrievals but reuse their slots
+	entries, pending = tester.downloader.loadStateEntries(common.HexToHash("0x02"))
+	if len(pending) != 0 {
+		t.Fatalf("foreign pending retrievals mismatch: have %d, want 0", len(pending))
+	}
+	if states := entries.update(tester.stateDb, added[:1], nil); states != 100 {
+		t.Fatalf("reused slots mismatch: have %d, want 100", states)
+	}
+	blobs := 0
+	for slot := uint64(0); slot < 100; slot++ {
+		if len(core.GetSyncEntry(tester.stateDb, slot)) > 0 {
+			blobs++
+		}
+	}
+	if blobs != 1 {
+		t.Fatalf("stale retrievals mismatch: have %d persisted, want 1", blobs)
+	}
+}
+
+// Tests that an empty chain can be fast synced starting from a trusted checkpoint
+// without retrieving its ancestors, which can be backfilled afterwards.
+func TestCheckpointSync63(t *testing.T)        { testCheckpointSync(t, 63, false) }
+func TestCheckpointSync64(t *testing.T)        { testCheckpointSync(t, 64, false) }
+func TestCheckpointSyncTrusted63(t *testing.T) { testCheckpointSync(t, 63, true) }
+func TestCheckpointSyncTrusted64(t *testing.T) { testCheckpointSync(t, 64, true) }
+
+func testCheckpointSync(t *testing.T, protocol int, trustTd bool) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a small enough block chain to download and pick a checkpoint in it
+	targetBlocks := blockCacheItems - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+	number := uint64(targetBlocks / 2)
+	hash := hashes[len(hashes)-1-int(number)]
+
+	tester.downloader.checkpoint = &Checkpoint{Number: number, Hash: hash}
+	if trustTd {
+		tester.downloader.checkpoint.TD = tester.peerChainTds["peer"][hash]
+	}
+	// Synchronise with the peer and make sure nothing below the checkpoint was retrieved
+	if err := tester.sync("peer", nil, FastSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	if head := tester.CurrentHeader().Number.Uint64(); head != uint64(targetBlocks) {
+		t.Fatalf("head header mismatch: have %v, want %v", head, targetBlocks)
+	}
+	if hs := len(tester.ownHeaders); hs != targetBlocks-int(number)+2 {
+		t.Fatalf("synchronised headers mismatch: have %v, want %v", hs, targetBlocks-int(number)+2)
+	}
+	if tail := tester.ChainTail(); tail == nil || tail.Hash() != hash {
+		t.Fatalf("chain tail mismatch: have %v, want #%d", tail, number)
+	}
+	head := hashes[0]
+	if have, want := tester.GetTd(head, uint64(targetBlocks)), tester.peerChainTds["peer"][head]; have.Cmp(want) != 0 {
+		t.Fatalf("head td mismatch: have %v, want %v", have, want)
+	}
+	// Backfill the ancestors of the checkpoint and check the chain is complete
+	for i := 0; tester.ChainTail() != nil; i++ {
+		if i > int(number)/MaxBlockFetch {
+			t.Fatalf("backfill not finished after %d rounds", i)
+		}
+		if err := tester.downloader.Backfill("peer"); err != nil {
+			t.Fatalf("failed to backfill blocks: %v", err)
+		}
+	}
+	assertOwnChain(t, tester, targetBlocks+1)
+	for _, hash := range hashes {
+		if have, want := tester.ownChainTd[hash], tester.peerChainTds["peer"][hash]; have.Cmp(want) != 0 {
+			t.Fatalf("td mismatch for %x: have %v, want %v", hash, have, want)
+		}
+	}
+}
+
+// Tests that a checkpoint not contained in the remote chain is refused, as well
+// as one too close to the remote head to fast sync from.
+func TestCheckpointSyncInvalid63(t *testing.T) { testCheckpointSyncInvalid(t, 63) }
+func TestCheckpointSyncInvalid64(t *testing.T) { testCheckpointSyncInvalid(t, 64) }
+
+func testCheckpointSyncInvalid(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := 3 * fsMinFullBlocks
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+	tester.downloader.checkpoint = &Checkpoint{Number: uint64(fsMinFullBlocks), Hash: common.HexToHash("0xdeadbeef")}
+	if err := tester.sync("peer", nil, FastSync); err != errInvalidChain {
+		t.Fatalf("unknown checkpoint error mismatch: have %v, want %v", err, errInvalidChain)
+	}
+	number := uint64(targetBlocks - fsMinFullBlocks)
+	tester.downloader.checkpoint = &Checkpoint{Number: number, Hash: hashes[len(hashes)-1-int(number)]}
+	if err := tester.sync("peer", nil, FastSync); err != errCheckpointUnreached {
+		t.Fatalf("recent checkpoint error mismatch: have %v, want %v", err, errCheckpointUnreached)
+	}
+	if head := tester.CurrentHeader().Number.Uint64(); head != 0 {
+		t.Fatalf("chain anchored at invalid checkpoint: head #%d", head)
+	}
+}
+
+// Tests that signed checkpoint files are only accepted from trusted signers.
+func TestCheckpointFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	cp := &Checkpoint{Number: 4096, Hash: common.HexToHash("0xdeadbeef")}
+	if err := WriteCheckpointFile(file, cp, key); err != errCheckpointNoTd {
+		t.Fatalf("unknown td signing error mismatch: have %v, want %v", err, errCheckpointNoTd)
+	}
+	cp.TD = big.NewInt(123456789)
+	if err := WriteCheckpointFile(file, cp, key); err != nil {
+		t.Fatalf("failed to write checkpoint: %v", err)
+	}
+	loaded, err := LoadCheckpointFile(file, []common.Address{testAddress, signer})
+	if err != nil {
+		t.Fatalf("failed to load checkpoint: %v", err)
+	}
+	if loaded.Number != cp.Number || loaded.Hash != cp.Hash || loaded.TD.Cmp(cp.TD) != 0 {
+		t.Fatalf("checkpoint mismatch: have %v/%v, want %v/%v", loaded, loaded.TD, cp, cp.TD)
+	}
+	if _, err := LoadCheckpointFile(file, []common.Address{testAddress}); err == nil {
+		t.Fatalf("checkpoint from untrusted signer accepted")
+	}
+	if _, err := LoadCheckpointFile(file, nil); err != errCheckpointNoSigner {
+		t.Fatalf("no signer error mismatch: have %v, want %v", err, errCheckpointNoSigner)
+	}
+}
+
 // This test reproduces an issue where unexpected deliveries would
 // block indefinitely if they arrived at the right time.
 // We use data driven subtests to manage this so that it will be parallel on its own
@@ -1753,3 +2170,140 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 		tester.downloader.peers.peers["peer"].peer.(*floodingTestPeer).pend.Wait()
 	}
 }
+
+// testPeerScorer is a reputation tracker recording the behaviour reported by the
+// downloader, ranking the peers by preset scores.
+type testPeerScorer struct {
+	useful   map[string]int
+	invalid  map[string]int
+	timeouts map[string]int
+	scores   map[string]float64
+	lock     sync.Mutex
+}
+
+func newTestPeerScorer() *testPeerScorer {
+	return &testPeerScorer{
+		useful:   make(map[string]int),
+		invalid:  make(map[string]int),
+		timeouts: make(map[string]int),
+		scores:   make(map[string]float64),
+	}
+}
+
+func (s *testPeerScorer) Useful(id string, latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.useful[id]++
+}
+
+func (s *testPeerScorer) Invalid(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.invalid[id]++
+}
+
+func (s *testPeerScorer) Timeout(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.timeouts[id]++
+}
+
+func (s *testPeerScorer) Score(id string) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.scores[id]
+}
+
+// reports retrieves the number of useful, invalid and timed out deliveries
+// reported about a peer.
+func (s *testPeerScorer) reports(id string) (int, int, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.useful[id], s.invalid[id], s.timeouts[id]
+}
+
+// Tests that the outcomes of synchronisations are reported to the reputation
+// tracker, separating timeouts from invalid data.
+func TestPeerScoreReports62(t *testing.T)      { testPeerScoreReports(t, 62, FullSync) }
+func TestPeerScoreReports63Full(t *testing.T)  { testPeerScoreReports(t, 63, FullSync) }
+func TestPeerScoreReports63Fast(t *testing.T)  { testPeerScoreReports(t, 63, FastSync) }
+func TestPeerScoreReports64Full(t *testing.T)  { testPeerScoreReports(t, 64, FullSync) }
+func TestPeerScoreReports64Fast(t *testing.T)  { testPeerScoreReports(t, 64, FastSync) }
+func TestPeerScoreReports64Light(t *testing.T) { testPeerScoreReports(t, 64, LightSync) }
+
+func testPeerScoreReports(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	scorer := newTestPeerScorer()
+	tester.downloader.scorer = scorer
+
+	// Synchronise with a healthy peer and ensure its deliveries are counted useful
+	targetBlocks := blockCacheItems - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	if err := tester.sync("peer", nil, mode); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	if useful, invalid, timeouts := scorer.reports("peer"); useful == 0 || invalid != 0 || timeouts != 0 {
+		t.Fatalf("healthy peer reports mismatch: useful %d, invalid %d, timeouts %d", useful, invalid, timeouts)
+	}
+	// Simulate various failed synchronisations and check the reported behaviour
+	tests := []struct {
+		result  error
+		invalid bool
+		timeout bool
+	}{
+		{nil, false, false},                 // Sync succeeded, nothing to report
+		{errTimeout, false, false},          // No data received in due time, reported where the request expired
+		{errStallingPeer, false, true},      // Peer was detected to be stalling
+		{errPeersUnavailable, false, false}, // Nobody had the advertised blocks, not necessarily the advertiser's fault
+		{errBadPeer, true, false},           // Peer was deemed bad
+		{errInvalidChain, true, false},      // Hash chain was detected as invalid
+		{errCancelBlockFetch, false, false}, // Synchronisation was canceled, origin may be innocent
+	}
+	for i, tt := range tests {
+		id := fmt.Sprintf("test %d", i)
+		if err := tester.newPeer(id, protocol, []common.Hash{tester.genesis.Hash()}, nil, nil, nil); err != nil {
+			t.Fatalf("test %d: failed to register new peer: %v", i, err)
+		}
+		tester.downloader.synchroniseMock = func(string, common.Hash) error { return tt.result }
+		tester.downloader.Synchronise(id, tester.genesis.Hash(), big.NewInt(1000), mode)
+
+		_, invalid, timeouts := scorer.reports(id)
+		if (invalid > 0) != tt.invalid {
+			t.Errorf("test %d: invalid report mismatch for %v: have %v, want %v", i, tt.result, invalid > 0, tt.invalid)
+		}
+		if (timeouts > 0) != tt.timeout {
+			t.Errorf("test %d: timeout report mismatch for %v: have %v, want %v", i, tt.result, timeouts > 0, tt.timeout)
+		}
+	}
+}
+
+// Tests that idle peers are ranked by their throughput weighted by reputation.
+func TestPeerScoreRanking(t *testing.T) {
+	scorer := newTestPeerScorer()
+	scorer.scores["bad"] = -0.5
+	scorer.scores["ugly"] = -1
+
+	ps := newPeerSet()
+	for id, throughput := range map[string]float64{"good": 10, "bad": 15, "ugly": 1000} {
+		p := newPeerConnection(id, 63, nil, scorer, log.New("peer", id))
+		if err := ps.Register(p); err != nil {
+			t.Fatalf("failed to register peer %s: %v", id, err)
+		}
+		p.headerThroughput = throughput
+	}
+	idle, total := ps.HeaderIdlePeers()
+	if total != 3 || len(idle) != 3 {
+		t.Fatalf("idle peer count mismatch: have %d/%d, want 3/3", len(idle), total)
+	}
+	for i, id := range []string{"good", "bad", "ugly"} {
+		if idle[i].id != id {
+			t.Errorf("rank %d: peer mismatch: have %s, want %s", i, idle[i].id, id)
+		}
+	}
+}
@@ -22,7 +22,9 @@ import (
 	"github.com/watchain/go-watchain/common"
 	"github.com/watchain/go-watchain/core"
 	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/trie"
 	"github.com/watchain/go-watchain/watdb"
+	"github.com/watchain/go-watchain/wat/snap"
 )
 
 // FakePeer is a mock downloader peer that operates on a local database instance
@@ -40,6 +42,11 @@ func NewFakePeer(id string, db watdb.Database, hc *core.HeaderChain, dl *Downloa
 	return &FakePeer{id: id, db: db, hc: hc, dl: dl}
 }
 
+// ID implements snap.SyncPeer, returning the identifier of the mock peer.
+func (p *FakePeer) ID() string {
+	return p.id
+}
+
 // Head implements downloader.Peer, returning the current head hash and number
 // of the best known header.
 func (p *FakePeer) Head() (common.Hash, *big.Int) {
@@ -158,3 +165,26 @@ func (p *FakePeer) RequestNodeData(hashes []common.Hash) error {
 	p.dl.DeliverNodeData(p.id, data)
 	return nil
 }
+
+// RequestAccountRange implements snap.SyncPeer, returning a proven range of
+// accounts from the state trie with the given root.
+func (p *FakePeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	hashes, accounts, proof := snap.ServiceAccountRange(trie.NewDatabase(p.db), root, origin, limit, bytes)
+	p.dl.SnapSyncer().OnAccounts(p, id, hashes, accounts, proof)
+	return nil
+}
+
+// RequestStorageRanges implements snap.SyncPeer, returning the slots of the
+// storage tries with the given roots.
+func (p *FakePeer) RequestStorageRanges(id uint64, roots []common.Hash, origin []byte, bytes uint64) error {
+	hashes, slots, proof := snap.ServiceStorageRanges(trie.NewDatabase(p.db), roots, origin, bytes)
+	p.dl.SnapSyncer().OnStorage(p, id, hashes, slots, proof)
+	return nil
+}
+
+// RequestByteCodes implements snap.SyncPeer, returning the contract codes
+// corresponding to the specified hashes.
+func (p *FakePeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	p.dl.SnapSyncer().OnByteCodes(p, id, snap.ServiceByteCodes(trie.NewDatabase(p.db), hashes, bytes))
+	return nil
+}
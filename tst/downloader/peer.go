@@ -68,7 +68,8 @@ type peerConnection struct {
 
 	lacking map[common.Hash]struct{} // Set of hashes not to request (didn't have previously)
 
-	peer Peer
+	peer   Peer
+	scorer PeerScorer // Reputation tracker to report the data deliveries to (may be nil)
 
 	version int        // wat protocol version number to switch strategies
 	log     log.Logger // Contextual logger to add extra infos to peer logs
@@ -90,6 +91,15 @@ type Peer interface {
 	RequestNodeData([]common.Hash) error
 }
 
+// PeerScorer tracks the reputation of the remote peers based on the quality of
+// their data deliveries, ranking them for future retrievals.
+type PeerScorer interface {
+	Useful(id string, latency time.Duration) // Peer delivered requested data
+	Invalid(id string)                       // Peer delivered invalid data
+	Timeout(id string)                       // Peer failed to deliver requested data in time
+	Score(id string) float64                 // Reputation of the peer in the [-1, 1] range
+}
+
 // lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
 type lightPeerWrapper struct {
 	peer LightPeer
@@ -113,12 +123,13 @@ func (w *lightPeerWrapper) RequestNodeData([]common.Hash) error {
 }
 
 // newPeerConnection creates a new downloader peer.
-func newPeerConnection(id string, version int, peer Peer, logger log.Logger) *peerConnection {
+func newPeerConnection(id string, version int, peer Peer, scorer PeerScorer, logger log.Logger) *peerConnection {
 	return &peerConnection{
 		id:      id,
 		lacking: make(map[common.Hash]struct{}),
 
-		peer: peer,
+		peer:   peer,
+		scorer: scorer,
 
 		version: version,
 		log:     logger,
@@ -278,12 +289,25 @@ func (p *peerConnection) setIdle(started time.Time, delivered int, throughput *f
 	*throughput = (1-measurementImpact)*(*throughput) + measurementImpact*measured
 	p.rtt = time.Duration((1-measurementImpact)*float64(p.rtt) + measurementImpact*float64(elapsed))
 
+	if p.scorer != nil {
+		p.scorer.Useful(p.id, elapsed)
+	}
+
 	p.log.Trace("Peer throughput measurements updated",
 		"hps", p.headerThroughput, "bps", p.blockThroughput,
 		"rps", p.receiptThroughput, "sps", p.stateThroughput,
 		"miss", len(p.lacking), "rtt", p.rtt)
 }
 
+// Score retrieves the reputation of the peer in the [-1, 1] range, or a neutral
+// zero if no reputation is tracked.
+func (p *peerConnection) Score() float64 {
+	if p.scorer == nil {
+		return 0
+	}
+	return p.scorer.Score(p.id)
+}
+
 // HeaderCapacity retrieves the peers header download allowance based on its
 // previously discovered throughput.
 func (p *peerConnection) HeaderCapacity(targetRTT time.Duration) int {
@@ -477,7 +501,7 @@ func (ps *peerSet) HeaderIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.headerThroughput
 	}
-	return ps.idlePeers(62, 64, idle, throughput)
+	return ps.idlePeers(62, 65, idle, throughput)
 }
 
 // BodyIdlePeers retrieves a flat list of all the currently body-idle peers within
@@ -491,7 +515,7 @@ func (ps *peerSet) BodyIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.blockThroughput
 	}
-	return ps.idlePeers(62, 64, idle, throughput)
+	return ps.idlePeers(62, 65, idle, throughput)
 }
 
 // ReceiptIdlePeers retrieves a flat list of all the currently receipt-idle peers
@@ -505,7 +529,7 @@ func (ps *peerSet) ReceiptIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.receiptThroughput
 	}
-	return ps.idlePeers(63, 64, idle, throughput)
+	return ps.idlePeers(63, 65, idle, throughput)
 }
 
 // NodeDataIdlePeers retrieves a flat list of all the currently node-data-idle
@@ -519,12 +543,13 @@ func (ps *peerSet) NodeDataIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.stateThroughput
 	}
-	return ps.idlePeers(63, 64, idle, throughput)
+	return ps.idlePeers(63, 65, idle, throughput)
 }
 
 // idlePeers retrieves a flat list of all currently idle peers satisfying the
 // protocol version constraints, using the provided function to check idleness.
-// The resulting set of peers are sorted by their measure throughput.
+// The resulting set of peers are sorted by their measure throughput, weighted
+// by their reputation.
 func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peerConnection) bool, throughput func(*peerConnection) float64) ([]*peerConnection, int) {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
@@ -538,9 +563,14 @@ func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peerC
 			total++
 		}
 	}
+	// Scale the throughputs by the reputations, ranking the worst peers last
+	weights := make(map[*peerConnection]float64, len(idle))
+	for _, p := range idle {
+		weights[p] = throughput(p) * (1 + p.Score())
+	}
 	for i := 0; i < len(idle); i++ {
 		for j := i + 1; j < len(idle); j++ {
-			if throughput(idle[i]) < throughput(idle[j]) {
+			if weights[idle[i]] < weights[idle[j]] {
 				idle[i], idle[j] = idle[j], idle[i]
 			}
 		}
@@ -0,0 +1,205 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/trie"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// syncProgress is the progress of a fast sync persisted into the database, so an
+// interrupted sync can be resumed after a restart without selecting a new pivot,
+// downloading the header chain again or restarting the pivot state retrieval.
+type syncProgress struct {
+	Pivot   uint64 // Number of the fast sync pivot block (0 if none selected)
+	Headers uint64 // Number of the last header filled into the header chain
+	Blocks  uint64 // Number of the last block whose body and receipts were stored
+
+	Root   common.Hash // State root the pending trie retrievals belong to
+	States uint64      // Number of database slots holding pending trie retrievals
+}
+
+// reset restarts the progress for a new pivot block. The number of state slots
+// is kept, so the slots left by the previous state root are cleaned up.
+func (p *syncProgress) reset(pivot uint64) {
+	*p = syncProgress{Pivot: pivot, States: p.States}
+}
+
+// loadSyncProgress retrieves the fast sync progress persisted by a previous run,
+// or an empty progress if none (or a corrupted one) was found.
+func loadSyncProgress(db watdb.Database) syncProgress {
+	var progress syncProgress
+
+	if blob := core.GetSyncProgress(db); len(blob) > 0 {
+		if err := rlp.DecodeBytes(blob, &progress); err != nil {
+			log.Warn("Failed to decode fast sync progress", "err", err)
+			return syncProgress{}
+		}
+	}
+	return progress
+}
+
+// updateProgress modifies the fast sync progress and persists it to allow the
+// sync to resume across restarts.
+func (d *Downloader) updateProgress(update func(progress *syncProgress)) {
+	d.updateProgressTo(d.stateDB, update)
+}
+
+// updateProgressTo modifies the fast sync progress and writes it into the given
+// database or batch.
+func (d *Downloader) updateProgressTo(db watdb.Putter, update func(progress *syncProgress)) {
+	d.progressLock.Lock()
+	defer d.progressLock.Unlock()
+
+	update(&d.progress)
+	if d.progress.Pivot == 0 {
+		return // No pivot selected (e.g. short chain), nothing to resume
+	}
+	blob, err := rlp.EncodeToBytes(&d.progress)
+	if err != nil {
+		log.Error("Failed to encode fast sync progress", "err", err)
+		return
+	}
+	core.WriteSyncProgress(db, blob)
+}
+
+// clearProgress drops the fast sync progress after the pivot block was committed,
+// at which point there's nothing left to resume.
+func (d *Downloader) clearProgress() {
+	d.progressLock.Lock()
+	defer d.progressLock.Unlock()
+
+	for slot := uint64(0); slot < d.progress.States; slot++ {
+		core.DeleteSyncEntry(d.stateDB, slot)
+	}
+	d.progress = syncProgress{}
+	core.DeleteSyncProgress(d.stateDB)
+}
+
+// resumablePivot returns the pivot block persisted by an interrupted fast sync if
+// it's still recent enough compared to the current chain height, or 0 otherwise.
+func (d *Downloader) resumablePivot(height uint64) uint64 {
+	d.progressLock.Lock()
+	defer d.progressLock.Unlock()
+
+	pivot := d.progress.Pivot
+	if pivot == 0 || pivot >= height || height > pivot+2*uint64(fsMinFullBlocks) {
+		return 0
+	}
+	return pivot
+}
+
+// resumableHeaders returns the number of the last header of an interrupted fast
+// sync that is still present in the local header chain, or 0 if none.
+func (d *Downloader) resumableHeaders() uint64 {
+	d.progressLock.Lock()
+	headers := d.progress.Headers
+	if d.progress.Pivot == 0 {
+		headers = 0
+	}
+	d.progressLock.Unlock()
+
+	if head := d.lightchain.CurrentHeader().Number.Uint64(); headers > head {
+		headers = head
+	}
+	return headers
+}
+
+// stateEntries tracks the pending trie retrievals of a state sync persisted in
+// numbered database slots, one entry per slot, so that committing the sync only
+// writes the entries which changed instead of the entire pending set.
+type stateEntries struct {
+	slots map[common.Hash]uint64 // Slots of the persisted retrievals
+	free  []uint64               // Unused slots below count
+	stale []uint64               // Slots still holding retrievals of another state root
+	count uint64                 // Number of slots allocated in the database
+}
+
+// loadStateEntries loads the trie retrievals left pending by an interrupted sync
+// of the given state root. The slots of a sync of another root are reused.
+func (d *Downloader) loadStateEntries(root common.Hash) (*stateEntries, []trie.SyncEntry) {
+	d.progressLock.Lock()
+	resume, count := d.progress.Root == root, d.progress.States
+	d.progressLock.Unlock()
+
+	var (
+		entries = &stateEntries{slots: make(map[common.Hash]uint64), count: count}
+		pending []trie.SyncEntry
+	)
+	for slot := uint64(0); slot < count; slot++ {
+		if !resume {
+			entries.free = append(entries.free, slot)
+			entries.stale = append(entries.stale, slot)
+			continue
+		}
+		var entry trie.SyncEntry
+		if blob := core.GetSyncEntry(d.stateDB, slot); len(blob) == 0 || rlp.DecodeBytes(blob, &entry) != nil {
+			entries.free = append(entries.free, slot)
+			continue
+		}
+		entries.slots[entry.Hash] = slot
+		pending = append(pending, entry)
+	}
+	return entries, pending
+}
+
+// update writes the changes of the pending retrievals into the batch and returns
+// the number of slots allocated.
+func (e *stateEntries) update(batch watdb.Putter, added []trie.SyncEntry, done []common.Hash) uint64 {
+	for _, slot := range e.stale {
+		core.WriteSyncEntry(batch, slot, nil)
+	}
+	e.stale = nil
+
+	for _, hash := range done {
+		if slot, ok := e.slots[hash]; ok {
+			core.WriteSyncEntry(batch, slot, nil)
+			delete(e.slots, hash)
+			e.free = append(e.free, slot)
+		}
+	}
+	for _, entry := range added {
+		if _, ok := e.slots[entry.Hash]; ok {
+			continue
+		}
+		blob, err := rlp.EncodeToBytes(&entry)
+		if err != nil {
+			log.Error("Failed to encode pending state retrieval", "err", err)
+			continue
+		}
+		var slot uint64
+		if n := len(e.free); n > 0 {
+			slot, e.free = e.free[n-1], e.free[:n-1]
+		} else {
+			slot, e.count = e.count, e.count+1
+		}
+		core.WriteSyncEntry(batch, slot, blob)
+		e.slots[entry.Hash] = slot
+	}
+	return e.count
+}
+
+// trackProgress updates the chain segments of the fast sync progress from the
+// current state of the local chain.
+func (d *Downloader) trackProgress(progress *syncProgress) {
+	progress.Headers = d.lightchain.CurrentHeader().Number.Uint64()
+	progress.Blocks = d.blockchain.CurrentFastBlock().NumberU64()
+}
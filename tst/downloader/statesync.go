@@ -29,6 +29,7 @@ import (
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/trie"
+	"github.com/watchain/go-watchain/wat/snap"
 )
 
 // stateReq represents a batch of state fetch requests groupped togwater into
@@ -175,6 +176,7 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 				continue
 			}
 			// Move the timed out data back into the download queue
+			d.peerTimeout(req.peer.id)
 			finished = append(finished, req)
 			delete(active, req.peer.id)
 
@@ -212,7 +214,11 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 // stateSync schedules requests for downloading a particular state trie defined
 // by a given state root.
 type stateSync struct {
-	d *Downloader // Downloader instance to access and manage current peerset
+	d       *Downloader   // Downloader instance to access and manage current peerset
+	root    common.Hash   // State root currently being synced
+	snap    bool          // Whwater the bulk of the state is retrieved via snap sync
+	resumed bool          // Whwater the sync continues the trie retrievals of a previous run
+	entries *stateEntries // Database slots of the persisted pending retrievals
 
 	sched  *trie.TrieSync             // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
@@ -234,12 +240,27 @@ type stateTask struct {
 	attempts map[string]struct{}
 }
 
-// newStateSync creates a new state trie download scheduler. This method does not
-// yet start the sync. The user needs to call run to initiate.
+// newStateSync creates a new state trie download scheduler, rescheduling any trie
+// retrievals persisted by an interrupted sync of the same root. This method does
+// not yet start the sync. The user needs to call run to initiate.
+//
+// The sync mode is captured here, on the synchronising goroutine, as the sync is
+// run by the state fetcher concurrently with the next sync cycle setting it.
 func newStateSync(d *Downloader, root common.Hash) *stateSync {
+	entries, pending := d.loadStateEntries(root)
+	if len(pending) > 0 {
+		log.Info("Resuming state sync", "root", root, "pending", len(pending))
+	}
+	sched := state.ResumeStateSync(root, d.stateDB, pending)
+	sched.TrackEntryChanges()
+
 	return &stateSync{
 		d:       d,
-		sched:   state.NewStateSync(root, d.stateDB),
+		root:    root,
+		snap:    d.snapSync,
+		resumed: len(pending) > 0,
+		sched:   sched,
+		entries: entries,
 		keccak:  sha3.NewKeccak256(),
 		tasks:   make(map[common.Hash]*stateTask),
 		deliver: make(chan *stateReq),
@@ -252,10 +273,56 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 // it finishes, and finally notifying any goroutines waiting for the loop to
 // finish.
 func (s *stateSync) run() {
+	// Pending trie retrievals are only persisted during healing, so a resumed sync
+	// already has the bulk of the state
+	if s.snap && !s.resumed {
+		if err := s.snapSync(); err != nil {
+			s.err = err
+			close(s.done)
+			return
+		}
+		// The bulk of the state is present, heal the nodes changed meanwhile
+		s.sched = state.NewStateSync(s.root, s.d.stateDB)
+		s.sched.TrackEntryChanges()
+	}
 	s.err = s.loop()
+	if s.err == errCancelStateFetch {
+		// Flush the completed subtries and persist the pending retrievals to resume
+		if err := s.commit(true); err != nil {
+			log.Warn("Failed to persist state sync progress", "err", err)
+		}
+	}
 	close(s.done)
 }
 
+// snapSync retrieves the state as proven account and storage ranges via the snap
+// protocol, blocking until done or the sync is cancelled. Any state that changed
+// during retrieval, or couldn't be served by the peers, is left for healing.
+func (s *stateSync) snapSync() error {
+	var (
+		cancel = make(chan struct{})
+		done   = make(chan struct{})
+	)
+	defer close(done)
+
+	go func() {
+		select {
+		case <-s.cancel:
+		case <-s.d.cancelCh:
+		case <-done:
+			return
+		}
+		close(cancel)
+	}()
+	if err := s.d.snapSyncer.Sync(s.root, cancel); err != nil {
+		if err == snap.ErrCancelled {
+			return errCancelStateFetch
+		}
+		return err
+	}
+	return nil
+}
+
 // Wait blocks until the sync is done or canceled.
 func (s *stateSync) Wait() error {
 	<-s.done
@@ -324,6 +391,14 @@ func (s *stateSync) commit(force bool) error {
 	start := time.Now()
 	b := s.d.stateDB.NewBatch()
 	s.sched.Commit(b)
+
+	// Persist the changes of the pending retrievals atomically with the nodes
+	added, done := s.sched.EntryChanges()
+	states := s.entries.update(b, added, done)
+	s.d.updateProgressTo(b, func(progress *syncProgress) {
+		s.d.trackProgress(progress)
+		progress.Root, progress.States = s.root, states
+	})
 	if err := b.Write(); err != nil {
 		return fmt.Errorf("DB write error: %v", err)
 	}
@@ -0,0 +1,63 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/enr"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+// watEntry is the "wat" entry advertised in the node record, identifying the
+// network the node is participating in.
+type watEntry struct {
+	NetworkId uint64
+	Genesis   common.Hash
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e watEntry) ENRKey() string {
+	return "wat"
+}
+
+// nodeEntry returns the "wat" entry of the local node.
+func (pm *ProtocolManager) nodeEntry() enr.Entry {
+	return watEntry{NetworkId: pm.networkId, Genesis: pm.blockchain.Genesis().Hash()}
+}
+
+// dialFilter reports whwater a discovered node is worth dialing.
+func (pm *ProtocolManager) dialFilter(n *discover.Node) bool {
+	return pm.acceptRecord(n.Record())
+}
+
+// acceptRecord reports whwater a node record advertises a "wat" entry matching
+// the local network. Nodes without a record are accepted for compatibility with
+// older nodes.
+func (pm *ProtocolManager) acceptRecord(record *enr.Record) bool {
+	if record == nil {
+		return true
+	}
+	var entry watEntry
+	if err := record.Load(&entry); err != nil {
+		return false
+	}
+	return entry.NetworkId == pm.networkId && entry.Genesis == pm.blockchain.Genesis().Hash()
+}
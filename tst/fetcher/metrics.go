@@ -41,3 +41,16 @@ var (
 	bodyFilterInMeter    = metrics.NewRegisteredMeter("wat/fetcher/filter/bodies/in", nil)
 	bodyFilterOutMeter   = metrics.NewRegisteredMeter("wat/fetcher/filter/bodies/out", nil)
 )
+
+var (
+	txAnnounceInMeter    = metrics.NewRegisteredMeter("wat/fetcher/transaction/announces/in", nil)
+	txAnnounceKnownMeter = metrics.NewRegisteredMeter("wat/fetcher/transaction/announces/known", nil)
+	txAnnounceDOSMeter   = metrics.NewRegisteredMeter("wat/fetcher/transaction/announces/dos", nil)
+
+	txBroadcastInMeter = metrics.NewRegisteredMeter("wat/fetcher/transaction/broadcasts/in", nil)
+
+	txRequestOutMeter     = metrics.NewRegisteredMeter("wat/fetcher/transaction/request/out", nil)
+	txRequestFailMeter    = metrics.NewRegisteredMeter("wat/fetcher/transaction/request/fail", nil)
+	txRequestTimeoutMeter = metrics.NewRegisteredMeter("wat/fetcher/transaction/request/timeout", nil)
+	txReplyInMeter        = metrics.NewRegisteredMeter("wat/fetcher/transaction/replies/in", nil)
+)
@@ -0,0 +1,363 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/log"
+)
+
+const (
+	txArriveTimeout = 500 * time.Millisecond // Time allowance before an announced transaction is explicitly requested
+	txGatherSlack   = 100 * time.Millisecond // Interval used to collate almost-expired announces with fetches
+	txFetchTimeout  = 5 * time.Second        // Maximum allotted time to return an explicitly requested transaction
+	maxTxAnnounces  = 4096                   // Maximum number of unique transactions a peer may have announced and not delivered
+	maxTxRetrievals = 256                    // Maximum number of transactions to request from a peer in a single go
+)
+
+// txPoolHasFn is a callback type for checking whwater a transaction is already
+// known to the local pool.
+type txPoolHasFn func(common.Hash) bool
+
+// txPoolAddFn is a callback type for adding a batch of transactions to the
+// local pool.
+type txPoolAddFn func([]*types.Transaction) []error
+
+// txRequesterFn is a callback type for requesting a batch of transactions from
+// a remote peer by hash.
+type txRequesterFn func(peer string, hashes []common.Hash) error
+
+// txAnnounce is the hash notification of the availability of a batch of new
+// transactions in the network.
+type txAnnounce struct {
+	origin string        // Identifier of the peer originating the notification
+	hashes []common.Hash // Batch of transaction hashes being announced
+}
+
+// txDelivery is the notification that a batch of transactions arrived, either
+// broadcast or explicitly requested, so the fetcher can forget about them.
+type txDelivery struct {
+	origin string        // Identifier of the peer delivering the transactions
+	hashes []common.Hash // Batch of transaction hashes having been delivered
+	direct bool          // Whwater this is a reply to a request or a broadcast
+}
+
+// txRequest represents an in-flight transaction retrieval request to a peer.
+type txRequest struct {
+	hashes []common.Hash // Transactions having been requested
+	time   time.Time     // Timestamp of the request
+}
+
+// TxFetcher is responsible for retrieving new transactions based on hash
+// announcements. Announced transactions are given a short grace period to arrive
+// via broadcast before they are explicitly requested from one of the announcers,
+// limiting each peer to a single in-flight request.
+type TxFetcher struct {
+	// Various event channels
+	notify  chan *txAnnounce
+	cleanup chan *txDelivery
+	drop    chan string
+	quit    chan struct{}
+
+	// Announce states
+	waittime  map[common.Hash]time.Time           // Announce times of the transactions waiting to be fetched
+	announced map[common.Hash]map[string]struct{} // Peers having announced each tracked transaction
+	announces map[string]map[common.Hash]struct{} // Transactions announced by each peer and not yet delivered
+
+	// Retrieval states
+	fetching map[common.Hash]string // Transactions currently being retrieved, along with the peer asked
+	requests map[string]*txRequest  // In-flight retrieval request of each peer
+
+	// Callbacks
+	hasTx    txPoolHasFn   // Checks whwater a transaction is already in the pool
+	addTxs   txPoolAddFn   // Inserts a batch of transactions into the pool
+	fetchTxs txRequesterFn // Requests a batch of transactions from a peer
+}
+
+// NewTxFetcher creates a transaction fetcher to retrieve transactions based on
+// hash announcements.
+func NewTxFetcher(hasTx txPoolHasFn, addTxs txPoolAddFn, fetchTxs txRequesterFn) *TxFetcher {
+	return &TxFetcher{
+		notify:    make(chan *txAnnounce),
+		cleanup:   make(chan *txDelivery),
+		drop:      make(chan string),
+		quit:      make(chan struct{}),
+		waittime:  make(map[common.Hash]time.Time),
+		announced: make(map[common.Hash]map[string]struct{}),
+		announces: make(map[string]map[common.Hash]struct{}),
+		fetching:  make(map[common.Hash]string),
+		requests:  make(map[string]*txRequest),
+		hasTx:     hasTx,
+		addTxs:    addTxs,
+		fetchTxs:  fetchTxs,
+	}
+}
+
+// Start boots up the announcement based transaction retrieval, accepting and
+// processing hash notifications and deliveries until termination requested.
+func (f *TxFetcher) Start() {
+	go f.loop()
+}
+
+// Stop terminates the announcement based transaction retrieval, canceling all
+// pending operations.
+func (f *TxFetcher) Stop() {
+	close(f.quit)
+}
+
+// Notify announces the fetcher of the potential availability of a batch of new
+// transactions in the network.
+func (f *TxFetcher) Notify(peer string, hashes []common.Hash) error {
+	// Skip any transaction announcements already known to the pool
+	unknown := make([]common.Hash, 0, len(hashes))
+	for _, hash := range hashes {
+		if !f.hasTx(hash) {
+			unknown = append(unknown, hash)
+		}
+	}
+	txAnnounceInMeter.Mark(int64(len(hashes)))
+	txAnnounceKnownMeter.Mark(int64(len(hashes) - len(unknown)))
+
+	if len(unknown) == 0 {
+		return nil
+	}
+	select {
+	case f.notify <- &txAnnounce{origin: peer, hashes: unknown}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Enqueue imports a batch of received transactions into the pool and notifies
+// the fetcher to stop tracking them. Direct deliveries are replies to retrieval
+// requests, any requested transactions missing from them are considered not
+// available from the peer.
+func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool) error {
+	if direct {
+		txReplyInMeter.Mark(int64(len(txs)))
+	} else {
+		txBroadcastInMeter.Mark(int64(len(txs)))
+	}
+	f.addTxs(txs)
+
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	select {
+	case f.cleanup <- &txDelivery{origin: peer, hashes: hashes, direct: direct}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Drop should be called when a peer disconnects. It cleans up all the internal
+// data structures of the given peer, rescheduling its pending retrievals.
+func (f *TxFetcher) Drop(peer string) error {
+	select {
+	case f.drop <- peer:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// loop is the main fetcher loop, checking and processing various notification
+// events.
+func (f *TxFetcher) loop() {
+	ticker := time.NewTicker(txGatherSlack)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ann := <-f.notify:
+			f.announce(ann.origin, ann.hashes, time.Now())
+
+		case delivery := <-f.cleanup:
+			f.deliver(delivery.origin, delivery.hashes, delivery.direct)
+
+		case peer := <-f.drop:
+			f.dropPeer(peer)
+
+		case <-ticker.C:
+			now := time.Now()
+
+			f.expire(now)
+			for peer, hashes := range f.schedule(now) {
+				go func(peer string, hashes []common.Hash) {
+					if err := f.fetchTxs(peer, hashes); err != nil {
+						log.Debug("Failed to request transactions", "peer", peer, "count", len(hashes), "err", err)
+					}
+				}(peer, hashes)
+			}
+
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+// announce starts tracking a batch of transactions announced by a peer, up to
+// the peer's allowance.
+func (f *TxFetcher) announce(peer string, hashes []common.Hash, now time.Time) {
+	announces := f.announces[peer]
+	if announces == nil {
+		announces = make(map[common.Hash]struct{})
+		f.announces[peer] = announces
+	}
+	for i, hash := range hashes {
+		if _, ok := announces[hash]; ok {
+			continue
+		}
+		if len(announces) >= maxTxAnnounces {
+			log.Debug("Peer exceeded outstanding transaction announces", "peer", peer, "limit", maxTxAnnounces)
+			txAnnounceDOSMeter.Mark(int64(len(hashes) - i))
+			break
+		}
+		announces[hash] = struct{}{}
+
+		if f.announced[hash] == nil {
+			f.announced[hash] = make(map[string]struct{})
+			f.waittime[hash] = now
+		}
+		f.announced[hash][peer] = struct{}{}
+	}
+	if len(announces) == 0 {
+		delete(f.announces, peer)
+	}
+}
+
+// deliver stops tracking a batch of transactions having arrived. If they were
+// a reply from a peer, the requested transactions not delivered are rescheduled
+// from other announcers.
+func (f *TxFetcher) deliver(peer string, hashes []common.Hash, direct bool) {
+	for _, hash := range hashes {
+		f.forget(hash)
+	}
+	if !direct {
+		return
+	}
+	req := f.requests[peer]
+	if req == nil {
+		return // Late or unrequested reply, transactions already forgotten
+	}
+	delete(f.requests, peer)
+
+	for _, hash := range req.hashes {
+		if f.fetching[hash] == peer {
+			txRequestFailMeter.Mark(1)
+			f.forgetAnnounce(peer, hash)
+		}
+	}
+}
+
+// dropPeer stops tracking all the announcements of a peer, rescheduling any of
+// its in-flight retrievals from other announcers.
+func (f *TxFetcher) dropPeer(peer string) {
+	for hash := range f.announces[peer] {
+		f.forgetAnnounce(peer, hash)
+	}
+	delete(f.announces, peer)
+	delete(f.requests, peer)
+}
+
+// expire reschedules the in-flight retrievals having timed out from other
+// announcers, freeing up the stalling peers.
+func (f *TxFetcher) expire(now time.Time) {
+	for peer, req := range f.requests {
+		if now.Sub(req.time) <= txFetchTimeout {
+			continue
+		}
+		log.Debug("Transaction retrieval timed out", "peer", peer, "count", len(req.hashes))
+		for _, hash := range req.hashes {
+			if f.fetching[hash] == peer {
+				txRequestTimeoutMeter.Mark(1)
+				f.forgetAnnounce(peer, hash)
+			}
+		}
+		delete(f.requests, peer)
+	}
+}
+
+// schedule assigns the transactions waiting longer than the arrival timeout to
+// idle announcers, returning the retrieval requests to send out.
+func (f *TxFetcher) schedule(now time.Time) map[string][]common.Hash {
+	requests := make(map[string][]common.Hash)
+	for hash, announced := range f.waittime {
+		if now.Sub(announced) < txArriveTimeout {
+			continue
+		}
+		for peer := range f.announced[hash] {
+			if _, busy := f.requests[peer]; busy || len(requests[peer]) >= maxTxRetrievals {
+				continue
+			}
+			requests[peer] = append(requests[peer], hash)
+			break
+		}
+	}
+	for peer, hashes := range requests {
+		f.requests[peer] = &txRequest{hashes: hashes, time: now}
+		for _, hash := range hashes {
+			f.fetching[hash] = peer
+			delete(f.waittime, hash)
+		}
+		txRequestOutMeter.Mark(int64(len(hashes)))
+	}
+	return requests
+}
+
+// forgetAnnounce removes a peer as the announcer of a transaction, moving the
+// transaction back to waiting if the peer was retrieving it. Transactions with
+// no announcers left are forgotten.
+func (f *TxFetcher) forgetAnnounce(peer string, hash common.Hash) {
+	if announces := f.announces[peer]; announces != nil {
+		delete(announces, hash)
+		if len(announces) == 0 {
+			delete(f.announces, peer)
+		}
+	}
+	announced := f.announced[hash]
+	delete(announced, peer)
+	if len(announced) == 0 {
+		f.forget(hash)
+		return
+	}
+	if f.fetching[hash] == peer {
+		delete(f.fetching, hash)
+		f.waittime[hash] = time.Time{} // Already waited enough, retrieve from an alternate asap
+	}
+}
+
+// forget removes all traces of a transaction from the fetcher's internal state.
+func (f *TxFetcher) forget(hash common.Hash) {
+	for peer := range f.announced[hash] {
+		if announces := f.announces[peer]; announces != nil {
+			delete(announces, hash)
+			if len(announces) == 0 {
+				delete(f.announces, peer)
+			}
+		}
+	}
+	delete(f.announced, hash)
+	delete(f.waittime, hash)
+	delete(f.fetching, hash)
+}
@@ -0,0 +1,237 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/types"
+)
+
+// txFetcherTester is a test simulator for mocking out the local transaction pool
+// and the remote peers serving transactions.
+type txFetcherTester struct {
+	fetcher *TxFetcher
+
+	pool     map[common.Hash]*types.Transaction // Transactions in the local pool
+	requests chan []common.Hash                 // Retrieval requests issued by the fetcher
+
+	lock sync.RWMutex
+}
+
+// newTxTester creates a new transaction fetcher test mocker.
+func newTxTester() *txFetcherTester {
+	tester := &txFetcherTester{
+		pool:     make(map[common.Hash]*types.Transaction),
+		requests: make(chan []common.Hash, 16),
+	}
+	tester.fetcher = NewTxFetcher(tester.hasTx, tester.addTxs, tester.fetchTxs)
+	return tester
+}
+
+// hasTx checks whwater a transaction is in the tester's pool.
+func (f *txFetcherTester) hasTx(hash common.Hash) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.pool[hash] != nil
+}
+
+// addTxs injects a batch of transactions into the tester's pool.
+func (f *txFetcherTester) addTxs(txs []*types.Transaction) []error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, tx := range txs {
+		f.pool[tx.Hash()] = tx
+	}
+	return make([]error, len(txs))
+}
+
+// fetchTxs records a retrieval request of the fetcher.
+func (f *txFetcherTester) fetchTxs(peer string, hashes []common.Hash) error {
+	f.requests <- hashes
+	return nil
+}
+
+// makeTxs creates a batch of distinct dummy transactions.
+func makeTxs(n int) []*types.Transaction {
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil)
+	}
+	return txs
+}
+
+// txHashes returns the hashes of a batch of transactions.
+func txHashes(txs []*types.Transaction) []common.Hash {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	return hashes
+}
+
+// verifyTxFetcherEmpty checks that the fetcher doesn't track anything anymore.
+func verifyTxFetcherEmpty(t *testing.T, f *TxFetcher) {
+	if len(f.waittime) != 0 || len(f.announced) != 0 || len(f.announces) != 0 || len(f.fetching) != 0 || len(f.requests) != 0 {
+		t.Errorf("fetcher not empty: waiting %d, announced %d, announcers %d, fetching %d, requests %d",
+			len(f.waittime), len(f.announced), len(f.announces), len(f.fetching), len(f.requests))
+	}
+}
+
+// Tests that announced transactions are only requested after the arrival timeout
+// and that delivering them cleans up all the fetcher's state.
+func TestTxFetcherSchedule(t *testing.T) {
+	f := newTxTester().fetcher
+	txs := makeTxs(4)
+	now := time.Now()
+
+	f.announce("A", txHashes(txs), now)
+	if reqs := f.schedule(now.Add(txArriveTimeout / 2)); len(reqs) != 0 {
+		t.Fatalf("transactions requested before arrival timeout: %v", reqs)
+	}
+	reqs := f.schedule(now.Add(txArriveTimeout))
+	if len(reqs) != 1 || len(reqs["A"]) != len(txs) {
+		t.Fatalf("request mismatch: have %v, want %d hashes from A", reqs, len(txs))
+	}
+	// Ensure a busy peer isn't assigned further retrievals
+	f.announce("A", txHashes(makeTxs(6)[4:]), now)
+	if reqs := f.schedule(now.Add(txArriveTimeout)); len(reqs) != 0 {
+		t.Fatalf("busy peer assigned retrievals: %v", reqs)
+	}
+	f.deliver("A", txHashes(txs), true)
+	if reqs := f.schedule(now.Add(txArriveTimeout)); len(reqs["A"]) != 2 {
+		t.Fatalf("request mismatch: have %v, want 2 hashes from A", reqs)
+	}
+	f.deliver("A", txHashes(makeTxs(6)[4:]), true)
+	verifyTxFetcherEmpty(t, f)
+}
+
+// Tests that transactions broadcast before the arrival timeout are not requested.
+func TestTxFetcherBroadcastArrival(t *testing.T) {
+	f := newTxTester().fetcher
+	txs := makeTxs(4)
+	now := time.Now()
+
+	f.announce("A", txHashes(txs), now)
+	f.announce("B", txHashes(txs[:2]), now)
+	f.deliver("C", txHashes(txs), false)
+
+	if reqs := f.schedule(now.Add(txArriveTimeout)); len(reqs) != 0 {
+		t.Fatalf("broadcast transactions requested: %v", reqs)
+	}
+	verifyTxFetcherEmpty(t, f)
+}
+
+// Tests that transactions not delivered by the peer asked, either by omitting
+// them from the reply, timing out or disconnecting, are rescheduled from other
+// announcers and forgotten if none are left.
+func TestTxFetcherReschedule(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(f *TxFetcher, peer string, now time.Time)
+	}{
+		{"missing", func(f *TxFetcher, peer string, now time.Time) { f.deliver(peer, nil, true) }},
+		{"timeout", func(f *TxFetcher, peer string, now time.Time) {
+			f.expire(now.Add(txArriveTimeout + txFetchTimeout + time.Second))
+		}},
+		{"drop", func(f *TxFetcher, peer string, now time.Time) { f.dropPeer(peer) }},
+	}
+	for _, tt := range tests {
+		f := newTxTester().fetcher
+		txs := makeTxs(1)
+		now := time.Now()
+
+		f.announce("A", txHashes(txs), now)
+		f.announce("B", txHashes(txs), now)
+
+		reqs := f.schedule(now.Add(txArriveTimeout))
+		if len(reqs) != 1 {
+			t.Fatalf("%s: request mismatch: have %v, want 1 request", tt.name, reqs)
+		}
+		var first, second string
+		for peer := range reqs {
+			first, second = peer, map[string]string{"A": "B", "B": "A"}[peer]
+		}
+		tt.fail(f, first, now)
+
+		reqs = f.schedule(now.Add(txArriveTimeout))
+		if len(reqs) != 1 || len(reqs[second]) != 1 {
+			t.Fatalf("%s: rescheduled request mismatch: have %v, want 1 hash from %s", tt.name, reqs, second)
+		}
+		tt.fail(f, second, now)
+		verifyTxFetcherEmpty(t, f)
+	}
+}
+
+// Tests that peers can't make the fetcher track more than the allowed number of
+// announced transactions, and retrieval requests are capped.
+func TestTxFetcherAnnounceLimits(t *testing.T) {
+	f := newTxTester().fetcher
+	txs := makeTxs(maxTxAnnounces + 16)
+	now := time.Now()
+
+	f.announce("A", txHashes(txs), now)
+	f.announce("A", txHashes(txs), now)
+	if len(f.announced) != maxTxAnnounces || len(f.announces["A"]) != maxTxAnnounces {
+		t.Fatalf("tracked announces mismatch: have %d/%d, want %d", len(f.announced), len(f.announces["A"]), maxTxAnnounces)
+	}
+	if reqs := f.schedule(now.Add(txArriveTimeout)); len(reqs["A"]) != maxTxRetrievals {
+		t.Fatalf("request size mismatch: have %d, want %d", len(reqs["A"]), maxTxRetrievals)
+	}
+}
+
+// Tests that the running fetcher retrieves announced transactions missing from
+// the pool and delivers them into it.
+func TestTxFetcherRetrieval(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(8)
+	tester.addTxs(txs[:2])
+
+	if err := tester.fetcher.Notify("A", txHashes(txs)); err != nil {
+		t.Fatalf("failed to notify fetcher: %v", err)
+	}
+	select {
+	case hashes := <-tester.requests:
+		if len(hashes) != len(txs)-2 {
+			t.Fatalf("request size mismatch: have %d, want %d", len(hashes), len(txs)-2)
+		}
+	case <-time.After(txArriveTimeout + 2*txGatherSlack + time.Second):
+		t.Fatalf("announced transactions not requested")
+	}
+	if err := tester.fetcher.Enqueue("A", txs[2:], true); err != nil {
+		t.Fatalf("failed to enqueue transactions: %v", err)
+	}
+	for _, tx := range txs {
+		if !tester.hasTx(tx.Hash()) {
+			t.Errorf("transaction %x missing from pool", tx.Hash())
+		}
+	}
+	select {
+	case hashes := <-tester.requests:
+		t.Fatalf("delivered transactions requested again: %v", hashes)
+	case <-time.After(txArriveTimeout + 2*txGatherSlack):
+	}
+}
@@ -28,6 +28,7 @@ import (
 	watereum "github.com/watchain/go-watchain"
 	"github.com/watchain/go-watchain/common"
 	"github.com/watchain/go-watchain/common/hexutil"
+	"github.com/watchain/go-watchain/core"
 	"github.com/watchain/go-watchain/core/types"
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/event"
@@ -229,6 +230,64 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	return rpcSub, nil
 }
 
+// ReorgNotification describes a canonical chain reorganisation. Both branches
+// are ordered from the common ancestor upwards.
+type ReorgNotification struct {
+	Depth          int             `json:"depth"`
+	CommonAncestor *types.Header   `json:"commonAncestor"`
+	Removed        []*types.Header `json:"removed"`
+	Added          []*types.Header `json:"added"`
+}
+
+// newReorgNotification flattens a chain reorg event into its RPC representation.
+func newReorgNotification(ev core.ChainReorgEvent) *ReorgNotification {
+	n := &ReorgNotification{
+		Depth:          ev.Depth(),
+		CommonAncestor: ev.CommonAncestor.Header(),
+		Removed:        make([]*types.Header, len(ev.OldChain)),
+		Added:          make([]*types.Header, len(ev.NewChain)),
+	}
+	for i, block := range ev.OldChain {
+		n.Removed[i] = block.Header()
+	}
+	for i, block := range ev.NewChain {
+		n.Added[i] = block.Header()
+	}
+	return n
+}
+
+// Reorgs send a notification each time the canonical chain switches to a
+// different branch, containing the common ancestor and the dropped and added
+// headers so that consumers can roll back precisely.
+func (api *PublicFilterAPI) Reorgs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		reorgs := make(chan core.ChainReorgEvent)
+		reorgsSub := api.events.SubscribeReorgs(reorgs)
+
+		for {
+			select {
+			case ev := <-reorgs:
+				notifier.Notify(rpcSub.ID, newReorgNotification(ev))
+			case <-rpcSub.Err():
+				reorgsSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				reorgsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
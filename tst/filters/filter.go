@@ -40,11 +40,22 @@ type Backend interface {
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
+	SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
 }
 
+// batchLogsBackend is implemented by backends able to retrieve the logs of
+// multiple blocks at once, e.g. light clients bundling the network requests.
+type batchLogsBackend interface {
+	GetLogsBatch(ctx context.Context, blockHashes []common.Hash) ([][][]*types.Log, error)
+}
+
+// maxLogsBatch is the maximum number of bloom matched blocks whose logs are
+// retrieved at once, kept low to fit the receipts into a single network reply.
+const maxLogsBatch = 8
+
 // Filter can be used to retrieve and filter logs.
 type Filter struct {
 	backend Backend
@@ -158,14 +169,34 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				}
 				return logs, err
 			}
-			f.begin = int64(number) + 1
+			// Gather further matches to retrieve their logs in one batch if supported
+			numbers := []uint64{number}
+			if _, ok := f.backend.(batchLogsBackend); ok {
+			gather:
+				for len(numbers) < maxLogsBatch {
+					select {
+					case number, ok := <-matches:
+						if !ok {
+							break gather
+						}
+						numbers = append(numbers, number)
+					case <-ctx.Done():
+						return logs, ctx.Err()
+					}
+				}
+			}
+			f.begin = int64(numbers[len(numbers)-1]) + 1
 
-			// Retrieve the suggested block and pull any truly matching logs
-			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
-			if header == nil || err != nil {
-				return logs, err
+			// Retrieve the suggested blocks and pull any truly matching logs
+			headers := make([]*types.Header, len(numbers))
+			for i, number := range numbers {
+				header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+				if header == nil || err != nil {
+					return logs, err
+				}
+				headers[i] = header
 			}
-			found, err := f.checkMatches(ctx, header)
+			found, err := f.checkMatchesBatch(ctx, headers)
 			if err != nil {
 				return logs, err
 			}
@@ -180,20 +211,66 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 // indexedLogs returns the logs matching the filter criteria based on raw block
 // iteration and bloom matching.
 func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
-	var logs []*types.Log
-
-	for ; f.begin <= int64(end); f.begin++ {
-		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
+	var (
+		logs    []*types.Log
+		headers []*types.Header
+	)
+	for number := f.begin; number <= int64(end); number++ {
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
 		if header == nil || err != nil {
 			return logs, err
 		}
 		if bloomFilter(header.Bloom, f.addresses, f.topics) {
+			headers = append(headers, header)
+		}
+		// Retrieve the logs of the bloom matched blocks once a batch is gathered
+		if len(headers) < maxLogsBatch && number < int64(end) {
+			continue
+		}
+		if len(headers) > 0 {
+			found, err := f.checkMatchesBatch(ctx, headers)
+			if err != nil {
+				return logs, err
+			}
+			logs = append(logs, found...)
+		}
+		headers, f.begin = nil, number+1
+	}
+	return logs, nil
+}
+
+// checkMatchesBatch checks the receipts belonging to a batch of headers for log
+// events matching the filter criteria, retrieving the logs of all the blocks at
+// once if the backend supports it. This function is called when the bloombits
+// signal potential matches.
+func (f *Filter) checkMatchesBatch(ctx context.Context, headers []*types.Header) ([]*types.Log, error) {
+	batcher, ok := f.backend.(batchLogsBackend)
+	if !ok || len(headers) == 1 {
+		var logs []*types.Log
+		for _, header := range headers {
 			found, err := f.checkMatches(ctx, header)
 			if err != nil {
 				return logs, err
 			}
 			logs = append(logs, found...)
 		}
+		return logs, nil
+	}
+	hashes := make([]common.Hash, len(headers))
+	for i, header := range headers {
+		hashes[i] = header.Hash()
+	}
+	logsLists, err := batcher.GetLogsBatch(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for i, header := range headers {
+		found, err := f.filterBlockLogs(ctx, header, logsLists[i])
+		if err != nil {
+			return logs, err
+		}
+		logs = append(logs, found...)
 	}
 	return logs, nil
 }
@@ -206,6 +283,12 @@ func (f *Filter) checkMatches(ctx context.Context, header *types.Header) (logs [
 	if err != nil {
 		return nil, err
 	}
+	return f.filterBlockLogs(ctx, header, logsList)
+}
+
+// filterBlockLogs filters the logs of the block belonging to the given header,
+// resolving the derived fields of the matching ones via the receipts if needed.
+func (f *Filter) filterBlockLogs(ctx context.Context, header *types.Header, logsList [][]*types.Log) (logs []*types.Log, err error) {
 	var unfiltered []*types.Log
 	for _, logs := range logsList {
 		unfiltered = append(unfiltered, logs...)
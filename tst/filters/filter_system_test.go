@@ -27,6 +27,7 @@ import (
 
 	watereum "github.com/watchain/go-watchain"
 	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/common/bitutil"
 	"github.com/watchain/go-watchain/consensus/ethash"
 	"github.com/watchain/go-watchain/core"
 	"github.com/watchain/go-watchain/core/bloombits"
@@ -45,6 +46,7 @@ type testBackend struct {
 	rmLogsFeed *event.Feed
 	logsFeed   *event.Feed
 	chainFeed  *event.Feed
+	reorgFeed  *event.Feed
 }
 
 func (b *testBackend) ChainDb() watdb.Database {
@@ -100,6 +102,10 @@ func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subsc
 	return b.chainFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription {
+	return b.reorgFeed.Subscribe(ch)
+}
+
 func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
@@ -122,7 +128,9 @@ func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.Matc
 				for i, section := range task.Sections {
 					if rand.Int()%4 != 0 { // Handle occasional missing deliveries
 						head := core.GetCanonicalHash(b.db, (section+1)*params.BloomBitsBlocks-1)
-						task.Bitsets[i], _ = core.GetBloomBits(b.db, task.Bit, section, head)
+						if compVector, err := core.GetBloomBits(b.db, task.Bit, section, head); err == nil {
+							task.Bitsets[i], _ = bitutil.DecompressBytes(compVector, int(params.BloomBitsBlocks)/8)
+						}
 					}
 				}
 				request <- task
@@ -146,7 +154,7 @@ func TestBlockSubscription(t *testing.T) {
 		rmLogsFeed  = new(event.Feed)
 		logsFeed    = new(event.Feed)
 		chainFeed   = new(event.Feed)
-		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api         = NewPublicFilterAPI(backend, false)
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
@@ -192,6 +200,52 @@ func TestBlockSubscription(t *testing.T) {
 	<-sub1.Err()
 }
 
+// TestReorgSubscription tests if a reorg subscription receives every posted
+// chain reorg event in order, with the branch details intact.
+func TestReorgSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux         = new(event.TypeMux)
+		db, _       = watdb.NewMemDatabase()
+		reorgFeed   = new(event.Feed)
+		backend     = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), reorgFeed}
+		api         = NewPublicFilterAPI(backend, false)
+		genesis     = new(core.Genesis).MustCommit(db)
+		oldChain, _ = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 3, func(i int, gen *core.BlockGen) {})
+		newChain, _ = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 4, func(i int, gen *core.BlockGen) {
+			gen.SetCoinbase(common.Address{0x01})
+		})
+		reorgEvents = []core.ChainReorgEvent{
+			{CommonAncestor: genesis, OldChain: oldChain[:1], NewChain: newChain[:2]},
+			{CommonAncestor: oldChain[0], OldChain: oldChain[1:], NewChain: newChain[1:]},
+		}
+	)
+
+	reorgs := make(chan core.ChainReorgEvent)
+	sub := api.events.SubscribeReorgs(reorgs)
+
+	go func() { // simulate client
+		for i := 0; i < len(reorgEvents); i++ {
+			ev := <-reorgs
+			if ev.CommonAncestor.Hash() != reorgEvents[i].CommonAncestor.Hash() {
+				t.Errorf("reorg %d: ancestor mismatch: have %x, want %x", i, ev.CommonAncestor.Hash(), reorgEvents[i].CommonAncestor.Hash())
+			}
+			n := newReorgNotification(ev)
+			if n.Depth != len(reorgEvents[i].OldChain) || len(n.Added) != len(reorgEvents[i].NewChain) {
+				t.Errorf("reorg %d: branch mismatch: have -%d/+%d, want -%d/+%d", i, n.Depth, len(n.Added), len(reorgEvents[i].OldChain), len(reorgEvents[i].NewChain))
+			}
+		}
+		sub.Unsubscribe()
+	}()
+
+	time.Sleep(1 * time.Second)
+	for _, ev := range reorgEvents {
+		reorgFeed.Send(ev)
+	}
+	<-sub.Err()
+}
+
 // TestPendingTxFilter tests whwater pending tx filters retrieve all pending transactions that are posted to the event mux.
 func TestPendingTxFilter(t *testing.T) {
 	t.Parallel()
@@ -203,7 +257,7 @@ func TestPendingTxFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		transactions = []*types.Transaction{
@@ -266,7 +320,7 @@ func TestLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		testCases = []struct {
@@ -315,7 +369,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 	)
 
@@ -345,7 +399,7 @@ func TestLogFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
@@ -464,7 +518,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
@@ -18,14 +18,17 @@ package filters
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
 	"testing"
 
 	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/common/bitutil"
 	"github.com/watchain/go-watchain/consensus/ethash"
 	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/core/bloombits"
 	"github.com/watchain/go-watchain/core/types"
 	"github.com/watchain/go-watchain/crypto"
 	"github.com/watchain/go-watchain/watdb"
@@ -33,6 +36,31 @@ import (
 	"github.com/watchain/go-watchain/params"
 )
 
+// batchBackend is a test backend retrieving the logs of multiple blocks at once
+// like a light client does, counting the receipt retrievals made.
+type batchBackend struct {
+	*testBackend
+	requests int
+}
+
+func (b *batchBackend) GetLogs(ctx context.Context, blockHash common.Hash) ([][]*types.Log, error) {
+	b.requests++
+	return b.testBackend.GetLogs(ctx, blockHash)
+}
+
+func (b *batchBackend) GetLogsBatch(ctx context.Context, blockHashes []common.Hash) ([][][]*types.Log, error) {
+	if len(blockHashes) > maxLogsBatch {
+		return nil, fmt.Errorf("batch too large: have %d, want <= %d", len(blockHashes), maxLogsBatch)
+	}
+	b.requests++
+
+	logs := make([][][]*types.Log, len(blockHashes))
+	for i, hash := range blockHashes {
+		logs[i], _ = b.testBackend.GetLogs(ctx, hash)
+	}
+	return logs, nil
+}
+
 func makeReceipt(addr common.Address) *types.Receipt {
 	receipt := types.NewReceipt(nil, false, 0)
 	receipt.Logs = []*types.Log{
@@ -56,7 +84,7 @@ func BenchmarkFilters(b *testing.B) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr1      = crypto.PubkeyToAddress(key1.PublicKey)
 		addr2      = common.BytesToAddress([]byte("jeff"))
@@ -121,7 +149,7 @@ func TestFilters(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr       = crypto.PubkeyToAddress(key1.PublicKey)
 
@@ -241,3 +269,74 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+// Tests that the logs of the bloom matched blocks are retrieved in batches, both
+// in the sections indexed by bloom bits and in the unindexed chain head.
+func TestFilterBatchedLogs(t *testing.T) {
+	var (
+		db, _   = watdb.NewMemDatabase()
+		backend = &batchBackend{testBackend: &testBackend{new(event.TypeMux), db, 1, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed)}}
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		size    = params.BloomBitsBlocks
+	)
+	// Generate a chain with a section of bloom bits, logging in 20 indexed and 5
+	// unindexed blocks
+	logged := func(number uint64) bool {
+		return (number >= 100 && number < 120) || (number >= size+10 && number < size+15)
+	}
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, int(size)+32, func(i int, gen *core.BlockGen) {
+		if number := gen.Number().Uint64(); logged(number) {
+			receipt := makeReceipt(addr)
+			receipt.Logs[0].BlockNumber = number
+			gen.AddUncheckedReceipt(receipt)
+		}
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i]); err != nil {
+			t.Fatalf("failed to insert block receipts: %v", err)
+		}
+	}
+	if err := core.WriteHeadBlockHash(db, chain[len(chain)-1].Hash()); err != nil {
+		t.Fatalf("failed to insert head block: %v", err)
+	}
+	gen, err := bloombits.NewGenerator(uint(size))
+	if err != nil {
+		t.Fatalf("failed to create bloom bits generator: %v", err)
+	}
+	for i := uint64(0); i < size; i++ {
+		header := core.GetHeader(db, core.GetCanonicalHash(db, i), i)
+		if err := gen.AddBloom(uint(i), header.Bloom); err != nil {
+			t.Fatalf("failed to add bloom of block %d: %v", i, err)
+		}
+	}
+	head := core.GetCanonicalHash(db, size-1)
+	for i := 0; i < types.BloomBitLength; i++ {
+		bits, err := gen.Bitset(uint(i))
+		if err != nil {
+			t.Fatalf("failed to retrieve bitset %d: %v", i, err)
+		}
+		core.WriteBloomBits(db, uint(i), 0, head, bitutil.CompressBytes(bits))
+	}
+	// Filter the entire chain, checking that the receipts are retrieved in batches
+	logs, err := New(backend, 0, -1, []common.Address{addr}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("failed to filter logs: %v", err)
+	}
+	if len(logs) != 25 {
+		t.Fatalf("log count mismatch: have %d, want %d", len(logs), 25)
+	}
+	for _, log := range logs {
+		if !logged(log.BlockNumber) {
+			t.Errorf("log from unexpected block %d", log.BlockNumber)
+		}
+	}
+	if backend.requests != 4 {
+		t.Fatalf("receipt request count mismatch: have %d, want %d", backend.requests, 4)
+	}
+}
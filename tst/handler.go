@@ -30,14 +30,17 @@ import (
 	"github.com/watchain/go-watchain/consensus"
 	"github.com/watchain/go-watchain/consensus/misc"
 	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/core/forkid"
 	"github.com/watchain/go-watchain/core/types"
 	"github.com/watchain/go-watchain/wat/downloader"
 	"github.com/watchain/go-watchain/wat/fetcher"
+	"github.com/watchain/go-watchain/wat/snap"
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/event"
 	"github.com/watchain/go-watchain/log"
 	"github.com/watchain/go-watchain/p2p"
 	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/p2p/enr"
 	"github.com/watchain/go-watchain/params"
 	"github.com/watchain/go-watchain/rlp"
 )
@@ -45,6 +48,7 @@ import (
 const (
 	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned blocks, headers or node data.
 	estHeaderRlpSize  = 500             // Approximate size of an RLP encoded block header
+	maxTxServe        = 256             // Maximum number of pooled transactions to return per request
 
 	// txChanSize is the size of channel listening to TxPreEvent.
 	// The number is referenced from the size of tx pool.
@@ -69,14 +73,19 @@ type ProtocolManager struct {
 	fastSync  uint32 // Flag whwater fast sync is enabled (gets disabled if we already have blocks)
 	acceptTxs uint32 // Flag whwater we're considered synchronised (enables transaction processing)
 
+	fastSyncMode downloader.SyncMode // Sync mode to use while fast sync is enabled (fast or snap)
+
 	txpool      txPool
 	blockchain  *core.BlockChain
 	chainconfig *params.ChainConfig
-	maxPeers    int
+	forkFilter  forkid.Filter // Fork ID filter, constant across the lifetime of the node
+	maxPeers    int32         // Maximum number of watchain peers, accessed atomically
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
+	txFetcher  *fetcher.TxFetcher
 	peers      *peerSet
+	scorer     *peerScorer
 
 	SubProtocols []p2p.Protocol
 
@@ -98,33 +107,44 @@ type ProtocolManager struct {
 
 // NewProtocolManager returns a new watereum sub protocol manager. The watchain sub protocol manages peers capable
 // with the watereum network.
-func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, networkId uint64, mux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain *core.BlockChain, chaindb watdb.Database) (*ProtocolManager, error) {
+func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, checkpoint *downloader.Checkpoint, networkId uint64, mux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain *core.BlockChain, chaindb watdb.Database) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
-		networkId:   networkId,
-		eventMux:    mux,
-		txpool:      txpool,
-		blockchain:  blockchain,
-		chainconfig: config,
-		peers:       newPeerSet(),
-		newPeerCh:   make(chan *peer),
-		noMorePeers: make(chan struct{}),
-		txsyncCh:    make(chan *txsync),
-		quitSync:    make(chan struct{}),
+		networkId:    networkId,
+		fastSyncMode: downloader.FastSync,
+		eventMux:     mux,
+		txpool:       txpool,
+		blockchain:   blockchain,
+		chainconfig:  config,
+		forkFilter:   forkid.NewFilter(blockchain),
+		peers:        newPeerSet(),
+		scorer:       newPeerScorer(chaindb),
+		newPeerCh:    make(chan *peer),
+		noMorePeers:  make(chan struct{}),
+		txsyncCh:     make(chan *txsync),
+		quitSync:     make(chan struct{}),
 	}
 	// Figure out whwater to allow fast sync or not
-	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
+	fast := mode == downloader.FastSync || mode == downloader.SnapSync
+	if fast && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
-		mode = downloader.FullSync
+		mode, fast = downloader.FullSync, false
 	}
-	if mode == downloader.FastSync {
+	if fast {
 		manager.fastSync = uint32(1)
+		manager.fastSyncMode = mode
+	}
+	// Syncing from a checkpoint skips the state of its ancestors, so a full node
+	// needs to fast sync its first cycle too
+	if mode == downloader.FullSync && checkpoint != nil && blockchain.CurrentHeader().Number.Uint64() == 0 {
+		log.Info("Syncing from checkpoint, fast syncing first cycle", "checkpoint", checkpoint)
+		manager.fastSync, fast = uint32(1), true
 	}
 	// Initiate a sub-protocol for every implemented version we can handle
 	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
 		// Skip protocol version if incompatible with the mode of operation
-		if mode == downloader.FastSync && version < wat63 {
+		if fast && version < wat63 {
 			continue
 		}
 		// Compatible; initialise the sub-protocol
@@ -149,17 +169,37 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 			},
 			PeerInfo: func(id discover.NodeID) interface{} {
 				if p := manager.peers.Peer(fmt.Sprintf("%x", id[:8])); p != nil {
-					return p.Info()
+					info := p.Info()
+					info.Score = manager.scorer.Score(p.id)
+					return info
 				}
 				return nil
 			},
+			DialScore:      manager.scorer.NodeScore,
+			Attributes:     []enr.Entry{manager.nodeEntry()},
+			DialFilter:     manager.dialFilter,
+			DiscoveryTopic: DiscoveryTopic(networkId),
 		})
 	}
 	if len(manager.SubProtocols) == 0 {
 		return nil, errIncompatibleConfig
 	}
+	// Serve the state as proven ranges, and retrieve it if snap syncing
+	manager.SubProtocols = append(manager.SubProtocols, p2p.Protocol{
+		Name:    snap.ProtocolName,
+		Version: snap.ProtocolVersion,
+		Length:  snap.ProtocolLength,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			select {
+			case <-manager.quitSync:
+				return p2p.DiscQuitting
+			default:
+			}
+			return snap.Handle(blockchain.StateCache().TrieDB(), manager.downloader.SnapSyncer(), snap.NewPeer(snap.ProtocolVersion, p, rw))
+		},
+	})
 	// Construct the different synchronisation mechanisms
-	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
+	manager.downloader = downloader.New(mode, checkpoint, chaindb, manager.eventMux, blockchain, nil, manager.removePeer, manager.scorer)
 
 	validator := func(header *types.Header) error {
 		return engine.VerifyHeader(blockchain, header, true)
@@ -176,7 +216,23 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		atomic.StoreUint32(&manager.acceptTxs, 1) // Mark initial sync done on any fetcher import
 		return manager.blockchain.InsertChain(blocks)
 	}
-	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
+	dropper := func(id string) {
+		manager.scorer.Invalid(id) // The fetcher only drops peers propagating invalid blocks
+		manager.removePeer(id)
+	}
+	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, dropper)
+
+	hasTx := func(hash common.Hash) bool {
+		return txpool.Get(hash) != nil
+	}
+	fetchTxs := func(id string, hashes []common.Hash) error {
+		p := manager.peers.Peer(id)
+		if p == nil {
+			return errNotRegistered
+		}
+		return p.RequestTxs(hashes)
+	}
+	manager.txFetcher = fetcher.NewTxFetcher(hasTx, txpool.AddRemotes, fetchTxs)
 
 	return manager, nil
 }
@@ -191,6 +247,8 @@ func (pm *ProtocolManager) removePeer(id string) {
 
 	// Unregister the peer from the downloader and watchain peer set
 	pm.downloader.UnregisterPeer(id)
+	pm.txFetcher.Drop(id)
+	pm.scorer.disconnect(id)
 	if err := pm.peers.Unregister(id); err != nil {
 		log.Error("Peer removal failed", "peer", id, "err", err)
 	}
@@ -200,8 +258,15 @@ func (pm *ProtocolManager) removePeer(id string) {
 	}
 }
 
+// SetMaxPeers changes the maximum number of watchain peers. Peers above the new
+// limit are not disconnected, but no new peers are accepted until the peer count
+// has dropped below it.
+func (pm *ProtocolManager) SetMaxPeers(maxPeers int) {
+	atomic.StoreInt32(&pm.maxPeers, int32(maxPeers))
+}
+
 func (pm *ProtocolManager) Start(maxPeers int) {
-	pm.maxPeers = maxPeers
+	pm.SetMaxPeers(maxPeers)
 
 	// broadcast transactions
 	pm.txCh = make(chan core.TxPreEvent, txChanSize)
@@ -250,7 +315,7 @@ func (pm *ProtocolManager) newPeer(pv int, p *p2p.Peer, rw p2p.MsgReadWriter) *p
 // this function terminates, the peer is disconnected.
 func (pm *ProtocolManager) handle(p *peer) error {
 	// Ignore maxPeers if this is a trusted peer
-	if pm.peers.Len() >= pm.maxPeers && !p.Peer.Info().Network.Trusted {
+	if pm.peers.Len() >= int(atomic.LoadInt32(&pm.maxPeers)) && !p.Peer.Info().Network.Trusted {
 		return p2p.DiscTooManyPeers
 	}
 	p.Log().Debug("watchain peer connected", "name", p.Name())
@@ -263,7 +328,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		number  = head.Number.Uint64()
 		td      = pm.blockchain.GetTd(hash, number)
 	)
-	if err := p.Handshake(pm.networkId, td, hash, genesis.Hash()); err != nil {
+	if err := p.Handshake(pm.networkId, td, hash, genesis.Hash(), forkid.NewID(pm.blockchain), pm.forkFilter); err != nil {
 		p.Log().Debug("watchain handshake failed", "err", err)
 		return err
 	}
@@ -277,6 +342,9 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	}
 	defer pm.removePeer(p.id)
 
+	// Start tracking the peer's reputation, remembering its past behaviour
+	pm.scorer.connect(p.id, p.ID())
+
 	// Register the peer in the downloader. If the downloader considers it banned, we disconnect
 	if err := pm.downloader.RegisterPeer(p.id, p.version, p); err != nil {
 		return err
@@ -654,7 +722,49 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 
-	case msg.Code == TxMsg:
+	case p.version >= wat65 && msg.Code == NewPooledTransactionHashesMsg:
+		// New transaction hashes announced, make sure we have a valid and fresh chain to handle them
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		var hashes []common.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		// Mark the hashes as present at the remote node and schedule them for retrieval
+		for _, hash := range hashes {
+			p.MarkTransaction(hash)
+		}
+		pm.txFetcher.Notify(p.id, hashes)
+
+	case p.version >= wat65 && msg.Code == GetPooledTransactionsMsg:
+		// Decode the retrieval message
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		if _, err := msgStream.List(); err != nil {
+			return err
+		}
+		// Gather transactions until the fetch or network limits is reached
+		var (
+			hash  common.Hash
+			bytes int
+			txs   types.Transactions
+		)
+		for bytes < softResponseLimit && len(txs) < maxTxServe {
+			// Retrieve the hash of the next transaction
+			if err := msgStream.Decode(&hash); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested transaction, skipping if unknown to us
+			if tx := pm.txpool.Get(hash); tx != nil {
+				txs = append(txs, tx)
+				bytes += int(tx.Size())
+			}
+		}
+		return p.SendPooledTransactions(txs)
+
+	case msg.Code == TxMsg || (p.version >= wat65 && msg.Code == PooledTransactionsMsg):
 		// Transactions arrived, make sure we have a valid and fresh chain to handle them
 		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
 			break
@@ -671,7 +781,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 			p.MarkTransaction(tx.Hash())
 		}
-		pm.txpool.AddRemotes(txs)
+		pm.txFetcher.Enqueue(p.id, txs, msg.Code == PooledTransactionsMsg)
 
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
@@ -712,16 +822,29 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 	}
 }
 
-// BroadcastTx will propagate a transaction to all peers which are not known to
-// already have the given transaction.
+// BroadcastTx will propagate a transaction to a subset of the peers which are
+// not known to already have the given transaction, only announcing it to the
+// rest of them able to retrieve it by hash.
 func (pm *ProtocolManager) BroadcastTx(hash common.Hash, tx *types.Transaction) {
-	// Broadcast transaction to a batch of peers not knowing about it
 	peers := pm.peers.PeersWithoutTx(hash)
-	//FIXME include this again: peers = peers[:int(math.Sqrt(float64(len(peers))))]
-	for _, peer := range peers {
-		peer.SendTransactions(types.Transactions{tx})
+
+	// Send the transaction directly to a subset of the peers, and to any peer not
+	// able to retrieve it otherwise
+	var (
+		direct    = int(math.Sqrt(float64(len(peers))))
+		sent      int
+		announced int
+	)
+	for i, peer := range peers {
+		if i < direct || peer.version < wat65 {
+			peer.SendTransactions(types.Transactions{tx})
+			sent++
+			continue
+		}
+		peer.SendPooledTransactionHashes([]common.Hash{hash})
+		announced++
 	}
-	log.Trace("Broadcast transaction", "hash", hash, "recipients", len(peers))
+	log.Trace("Broadcast transaction", "hash", hash, "recipients", sent, "announced", announced)
 }
 
 // Mined broadcast loop
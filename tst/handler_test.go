@@ -20,6 +20,7 @@ import (
 	"math"
 	"math/big"
 	"math/rand"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -34,6 +35,7 @@ import (
 	"github.com/watchain/go-watchain/watdb"
 	"github.com/watchain/go-watchain/event"
 	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/p2p/enr"
 	"github.com/watchain/go-watchain/params"
 )
 
@@ -45,8 +47,9 @@ func TestProtocolCompatibility(t *testing.T) {
 		mode       downloader.SyncMode
 		compatible bool
 	}{
-		{61, downloader.FullSync, true}, {62, downloader.FullSync, true}, {63, downloader.FullSync, true},
-		{61, downloader.FastSync, false}, {62, downloader.FastSync, false}, {63, downloader.FastSync, true},
+		{61, downloader.FullSync, true}, {62, downloader.FullSync, true}, {63, downloader.FullSync, true}, {64, downloader.FullSync, true},
+		{61, downloader.FastSync, false}, {62, downloader.FastSync, false}, {63, downloader.FastSync, true}, {64, downloader.FastSync, true},
+		{62, downloader.SnapSync, false}, {63, downloader.SnapSync, true}, {64, downloader.SnapSync, true},
 	}
 	// Make sure anything we screw up is restored
 	backup := ProtocolVersions
@@ -69,6 +72,7 @@ func TestProtocolCompatibility(t *testing.T) {
 // Tests that block headers can be retrieved from a remote chain based on user queries.
 func TestGetBlockHeaders62(t *testing.T) { testGetBlockHeaders(t, 62) }
 func TestGetBlockHeaders63(t *testing.T) { testGetBlockHeaders(t, 63) }
+func TestGetBlockHeaders64(t *testing.T) { testGetBlockHeaders(t, 64) }
 
 func testGetBlockHeaders(t *testing.T, protocol int) {
 	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxHashFetch+15, nil, nil)
@@ -228,6 +232,7 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 // Tests that block contents can be retrieved from a remote chain based on their hashes.
 func TestGetBlockBodies62(t *testing.T) { testGetBlockBodies(t, 62) }
 func TestGetBlockBodies63(t *testing.T) { testGetBlockBodies(t, 63) }
+func TestGetBlockBodies64(t *testing.T) { testGetBlockBodies(t, 64) }
 
 func testGetBlockBodies(t *testing.T, protocol int) {
 	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxBlockFetch+15, nil, nil)
@@ -299,6 +304,7 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 
 // Tests that the node state database can be retrieved based on hashes.
 func TestGetNodeData63(t *testing.T) { testGetNodeData(t, 63) }
+func TestGetNodeData64(t *testing.T) { testGetNodeData(t, 64) }
 
 func testGetNodeData(t *testing.T, protocol int) {
 	// Define three accounts to simulate transactions with
@@ -391,6 +397,7 @@ func testGetNodeData(t *testing.T, protocol int) {
 
 // Tests that the transaction receipts can be retrieved based on hashes.
 func TestGetReceipt63(t *testing.T) { testGetReceipt(t, 63) }
+func TestGetReceipt64(t *testing.T) { testGetReceipt(t, 64) }
 
 func testGetReceipt(t *testing.T, protocol int) {
 	// Define three accounts to simulate transactions with
@@ -474,7 +481,7 @@ func testDAOChallenge(t *testing.T, localForked, remoteForked bool, timeout bool
 		genesis       = gspec.MustCommit(db)
 		blockchain, _ = core.NewBlockChain(db, nil, config, pow, vm.Config{})
 	)
-	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, evmux, new(testTxPool), pow, blockchain, db)
+	pm, err := NewProtocolManager(config, downloader.FullSync, nil, DefaultConfig.NetworkId, evmux, new(testTxPool), pow, blockchain, db)
 	if err != nil {
 		t.Fatalf("failed to start test protocol manager: %v", err)
 	}
@@ -520,3 +527,103 @@ func testDAOChallenge(t *testing.T, localForked, remoteForked bool, timeout bool
 		}
 	}
 }
+
+// Tests that only nodes advertising a matching "wat" entry in their record, or
+// having no record at all, are accepted as dial candidates.
+func TestDialFilter(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	key, _ := crypto.GenerateKey()
+	sign := func(entries ...enr.Entry) *enr.Record {
+		r := new(enr.Record)
+		for _, e := range entries {
+			r.Set(e)
+		}
+		if err := r.Sign(key); err != nil {
+			t.Fatalf("failed to sign record: %v", err)
+		}
+		return r
+	}
+	genesis := pm.blockchain.Genesis().Hash()
+	tests := []struct {
+		record *enr.Record
+		accept bool
+	}{
+		{nil, true},
+		{sign(), false},
+		{sign(watEntry{NetworkId: pm.networkId, Genesis: genesis}), true},
+		{sign(watEntry{NetworkId: pm.networkId + 1, Genesis: genesis}), false},
+		{sign(watEntry{NetworkId: pm.networkId, Genesis: common.Hash{1}}), false},
+		{sign(pm.nodeEntry()), true},
+	}
+	for i, tt := range tests {
+		if accept := pm.acceptRecord(tt.record); accept != tt.accept {
+			t.Errorf("test %d: acceptance mismatch: have %v, want %v", i, accept, tt.accept)
+		}
+	}
+}
+
+// Tests that raising the server's peer limit at runtime is applied to the
+// watchain peers, accepting a peer that was rejected under the old limit.
+func TestMaxPeersRaise(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	s := &watchain{config: &Config{}, protocolManager: pm}
+	feed := new(event.Feed)
+	limitCh := make(chan int, 1)
+	sub := feed.Subscribe(limitCh)
+	defer sub.Unsubscribe()
+	go s.peerLimitLoop(limitCh, sub)
+
+	waitPeers := func(count int) {
+		for deadline := time.Now().Add(time.Second); pm.peers.Len() != count; {
+			if time.Now().After(deadline) {
+				t.Fatalf("peer count mismatch: have %d, want %d", pm.peers.Len(), count)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// Fill the single peer slot and check that further peers are rejected
+	feed.Send(1)
+	for atomic.LoadInt32(&pm.maxPeers) != 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	first, _ := newTestPeer("first", wat63, pm, true)
+	defer first.close()
+	waitPeers(1)
+
+	rejected, errc := newTestPeer("rejected", wat63, pm, false)
+	defer rejected.close()
+	select {
+	case err := <-errc:
+		if err != p2p.DiscTooManyPeers {
+			t.Fatalf("rejection error mismatch: have %v, want %v", err, p2p.DiscTooManyPeers)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("peer above the limit not rejected")
+	}
+	// Raise the limit and check that an extra peer is accepted
+	feed.Send(2)
+	for atomic.LoadInt32(&pm.maxPeers) != 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	second, _ := newTestPeer("second", wat63, pm, true)
+	defer second.close()
+	waitPeers(2)
+}
+
+// Tests that all watchain protocol versions are advertised under a single
+// discovery topic of the network.
+func TestDiscoveryTopic(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	want := DiscoveryTopic(pm.networkId)
+	for _, proto := range pm.SubProtocols {
+		if proto.Name == ProtocolName && proto.DiscoveryTopic != want {
+			t.Errorf("%s/%d: topic mismatch: have %q, want %q", proto.Name, proto.Version, proto.DiscoveryTopic, want)
+		}
+	}
+}
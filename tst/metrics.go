@@ -22,38 +22,46 @@ import (
 )
 
 var (
-	propTxnInPacketsMeter     = metrics.NewRegisteredMeter("wat/prop/txns/in/packets", nil)
-	propTxnInTrafficMeter     = metrics.NewRegisteredMeter("wat/prop/txns/in/traffic", nil)
-	propTxnOutPacketsMeter    = metrics.NewRegisteredMeter("wat/prop/txns/out/packets", nil)
-	propTxnOutTrafficMeter    = metrics.NewRegisteredMeter("wat/prop/txns/out/traffic", nil)
-	propHashInPacketsMeter    = metrics.NewRegisteredMeter("wat/prop/hashes/in/packets", nil)
-	propHashInTrafficMeter    = metrics.NewRegisteredMeter("wat/prop/hashes/in/traffic", nil)
-	propHashOutPacketsMeter   = metrics.NewRegisteredMeter("wat/prop/hashes/out/packets", nil)
-	propHashOutTrafficMeter   = metrics.NewRegisteredMeter("wat/prop/hashes/out/traffic", nil)
-	propBlockInPacketsMeter   = metrics.NewRegisteredMeter("wat/prop/blocks/in/packets", nil)
-	propBlockInTrafficMeter   = metrics.NewRegisteredMeter("wat/prop/blocks/in/traffic", nil)
-	propBlockOutPacketsMeter  = metrics.NewRegisteredMeter("wat/prop/blocks/out/packets", nil)
-	propBlockOutTrafficMeter  = metrics.NewRegisteredMeter("wat/prop/blocks/out/traffic", nil)
-	reqHeaderInPacketsMeter   = metrics.NewRegisteredMeter("wat/req/headers/in/packets", nil)
-	reqHeaderInTrafficMeter   = metrics.NewRegisteredMeter("wat/req/headers/in/traffic", nil)
-	reqHeaderOutPacketsMeter  = metrics.NewRegisteredMeter("wat/req/headers/out/packets", nil)
-	reqHeaderOutTrafficMeter  = metrics.NewRegisteredMeter("wat/req/headers/out/traffic", nil)
-	reqBodyInPacketsMeter     = metrics.NewRegisteredMeter("wat/req/bodies/in/packets", nil)
-	reqBodyInTrafficMeter     = metrics.NewRegisteredMeter("wat/req/bodies/in/traffic", nil)
-	reqBodyOutPacketsMeter    = metrics.NewRegisteredMeter("wat/req/bodies/out/packets", nil)
-	reqBodyOutTrafficMeter    = metrics.NewRegisteredMeter("wat/req/bodies/out/traffic", nil)
-	reqStateInPacketsMeter    = metrics.NewRegisteredMeter("wat/req/states/in/packets", nil)
-	reqStateInTrafficMeter    = metrics.NewRegisteredMeter("wat/req/states/in/traffic", nil)
-	reqStateOutPacketsMeter   = metrics.NewRegisteredMeter("wat/req/states/out/packets", nil)
-	reqStateOutTrafficMeter   = metrics.NewRegisteredMeter("wat/req/states/out/traffic", nil)
-	reqReceiptInPacketsMeter  = metrics.NewRegisteredMeter("wat/req/receipts/in/packets", nil)
-	reqReceiptInTrafficMeter  = metrics.NewRegisteredMeter("wat/req/receipts/in/traffic", nil)
-	reqReceiptOutPacketsMeter = metrics.NewRegisteredMeter("wat/req/receipts/out/packets", nil)
-	reqReceiptOutTrafficMeter = metrics.NewRegisteredMeter("wat/req/receipts/out/traffic", nil)
-	miscInPacketsMeter        = metrics.NewRegisteredMeter("wat/misc/in/packets", nil)
-	miscInTrafficMeter        = metrics.NewRegisteredMeter("wat/misc/in/traffic", nil)
-	miscOutPacketsMeter       = metrics.NewRegisteredMeter("wat/misc/out/packets", nil)
-	miscOutTrafficMeter       = metrics.NewRegisteredMeter("wat/misc/out/traffic", nil)
+	propTxnInPacketsMeter      = metrics.NewRegisteredMeter("wat/prop/txns/in/packets", nil)
+	propTxnInTrafficMeter      = metrics.NewRegisteredMeter("wat/prop/txns/in/traffic", nil)
+	propTxnOutPacketsMeter     = metrics.NewRegisteredMeter("wat/prop/txns/out/packets", nil)
+	propTxnOutTrafficMeter     = metrics.NewRegisteredMeter("wat/prop/txns/out/traffic", nil)
+	propTxnHashInPacketsMeter  = metrics.NewRegisteredMeter("wat/prop/txhashes/in/packets", nil)
+	propTxnHashInTrafficMeter  = metrics.NewRegisteredMeter("wat/prop/txhashes/in/traffic", nil)
+	propTxnHashOutPacketsMeter = metrics.NewRegisteredMeter("wat/prop/txhashes/out/packets", nil)
+	propTxnHashOutTrafficMeter = metrics.NewRegisteredMeter("wat/prop/txhashes/out/traffic", nil)
+	propHashInPacketsMeter     = metrics.NewRegisteredMeter("wat/prop/hashes/in/packets", nil)
+	propHashInTrafficMeter     = metrics.NewRegisteredMeter("wat/prop/hashes/in/traffic", nil)
+	propHashOutPacketsMeter    = metrics.NewRegisteredMeter("wat/prop/hashes/out/packets", nil)
+	propHashOutTrafficMeter    = metrics.NewRegisteredMeter("wat/prop/hashes/out/traffic", nil)
+	propBlockInPacketsMeter    = metrics.NewRegisteredMeter("wat/prop/blocks/in/packets", nil)
+	propBlockInTrafficMeter    = metrics.NewRegisteredMeter("wat/prop/blocks/in/traffic", nil)
+	propBlockOutPacketsMeter   = metrics.NewRegisteredMeter("wat/prop/blocks/out/packets", nil)
+	propBlockOutTrafficMeter   = metrics.NewRegisteredMeter("wat/prop/blocks/out/traffic", nil)
+	reqHeaderInPacketsMeter    = metrics.NewRegisteredMeter("wat/req/headers/in/packets", nil)
+	reqHeaderInTrafficMeter    = metrics.NewRegisteredMeter("wat/req/headers/in/traffic", nil)
+	reqHeaderOutPacketsMeter   = metrics.NewRegisteredMeter("wat/req/headers/out/packets", nil)
+	reqHeaderOutTrafficMeter   = metrics.NewRegisteredMeter("wat/req/headers/out/traffic", nil)
+	reqBodyInPacketsMeter      = metrics.NewRegisteredMeter("wat/req/bodies/in/packets", nil)
+	reqBodyInTrafficMeter      = metrics.NewRegisteredMeter("wat/req/bodies/in/traffic", nil)
+	reqBodyOutPacketsMeter     = metrics.NewRegisteredMeter("wat/req/bodies/out/packets", nil)
+	reqBodyOutTrafficMeter     = metrics.NewRegisteredMeter("wat/req/bodies/out/traffic", nil)
+	reqStateInPacketsMeter     = metrics.NewRegisteredMeter("wat/req/states/in/packets", nil)
+	reqStateInTrafficMeter     = metrics.NewRegisteredMeter("wat/req/states/in/traffic", nil)
+	reqStateOutPacketsMeter    = metrics.NewRegisteredMeter("wat/req/states/out/packets", nil)
+	reqStateOutTrafficMeter    = metrics.NewRegisteredMeter("wat/req/states/out/traffic", nil)
+	reqReceiptInPacketsMeter   = metrics.NewRegisteredMeter("wat/req/receipts/in/packets", nil)
+	reqReceiptInTrafficMeter   = metrics.NewRegisteredMeter("wat/req/receipts/in/traffic", nil)
+	reqReceiptOutPacketsMeter  = metrics.NewRegisteredMeter("wat/req/receipts/out/packets", nil)
+	reqReceiptOutTrafficMeter  = metrics.NewRegisteredMeter("wat/req/receipts/out/traffic", nil)
+	reqTxnInPacketsMeter       = metrics.NewRegisteredMeter("wat/req/txns/in/packets", nil)
+	reqTxnInTrafficMeter       = metrics.NewRegisteredMeter("wat/req/txns/in/traffic", nil)
+	reqTxnOutPacketsMeter      = metrics.NewRegisteredMeter("wat/req/txns/out/packets", nil)
+	reqTxnOutTrafficMeter      = metrics.NewRegisteredMeter("wat/req/txns/out/traffic", nil)
+	miscInPacketsMeter         = metrics.NewRegisteredMeter("wat/misc/in/packets", nil)
+	miscInTrafficMeter         = metrics.NewRegisteredMeter("wat/misc/in/traffic", nil)
+	miscOutPacketsMeter        = metrics.NewRegisteredMeter("wat/misc/out/packets", nil)
+	miscOutTrafficMeter        = metrics.NewRegisteredMeter("wat/misc/out/traffic", nil)
 )
 
 // meteredMsgReadWriter is a wrapper around a p2p.MsgReadWriter, capable of
@@ -103,6 +111,11 @@ func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
 		packets, traffic = propBlockInPacketsMeter, propBlockInTrafficMeter
 	case msg.Code == TxMsg:
 		packets, traffic = propTxnInPacketsMeter, propTxnInTrafficMeter
+
+	case rw.version >= wat65 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxnHashInPacketsMeter, propTxnHashInTrafficMeter
+	case rw.version >= wat65 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnInPacketsMeter, reqTxnInTrafficMeter
 	}
 	packets.Mark(1)
 	traffic.Mark(int64(msg.Size))
@@ -130,6 +143,11 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 		packets, traffic = propBlockOutPacketsMeter, propBlockOutTrafficMeter
 	case msg.Code == TxMsg:
 		packets, traffic = propTxnOutPacketsMeter, propTxnOutTrafficMeter
+
+	case rw.version >= wat65 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxnHashOutPacketsMeter, propTxnHashOutTrafficMeter
+	case rw.version >= wat65 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnOutPacketsMeter, reqTxnOutTrafficMeter
 	}
 	packets.Mark(1)
 	traffic.Mark(int64(msg.Size))
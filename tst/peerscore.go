@@ -0,0 +1,221 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+const (
+	invalidPenalty  = 4              // Weight of an invalid delivery relative to a useful one
+	timeoutPenalty  = 2              // Weight of a timed out request relative to a useful one
+	scoreConfidence = 8              // Number of neutral observations assumed, damping the score of little known nodes
+	scoreMemory     = 1024           // Number of observations after which the older ones start fading out
+	scoreHalfLife   = 24 * time.Hour // Time after which the observations of an absent node count half
+	latencyImpact   = 0.1            // The impact a single measurement has on a node's average latency
+	latencyHalving  = time.Second    // Average latency at which the useful answers of a node count half
+)
+
+// peerScorePrefix + node id -> RLP encoded reputation of the node
+var peerScorePrefix = []byte("peer-score-")
+
+// peerScoreKey = peerScorePrefix + node id
+func peerScoreKey(node discover.NodeID) []byte {
+	return append(append([]byte{}, peerScorePrefix...), node[:]...)
+}
+
+// reputation is the record of a remote node's behaviour, persisted across restarts.
+type reputation struct {
+	Useful   uint64 // Number of requests answered with useful data
+	Invalid  uint64 // Number of invalid data deliveries
+	Timeouts uint64 // Number of requests not answered in time
+	Latency  uint64 // Average latency of the useful answers, in nanoseconds
+	Updated  uint64 // Unix time of the last persisted update
+}
+
+// score calculates the reputation of the node in the [-1, 1] range, unknown
+// nodes being neutral. The useful answers of slow nodes count less, depending on
+// their average latency.
+func (r *reputation) score() float64 {
+	var (
+		speed = float64(latencyHalving) / float64(uint64(latencyHalving)+r.Latency)
+		total = float64(r.Useful + r.Invalid + r.Timeouts)
+		value = speed*float64(r.Useful) - timeoutPenalty*float64(r.Timeouts) - invalidPenalty*float64(r.Invalid)
+	)
+	return math.Max(-1, math.Min(1, value/(total+scoreConfidence)))
+}
+
+// fade halves the observations once for every half-life elapsed since the last
+// update, so nodes can redeem themselves after misbehaving in the past.
+func (r *reputation) fade(now time.Time) {
+	if r.Updated == 0 || uint64(now.Unix()) <= r.Updated {
+		return
+	}
+	shift := uint64(now.Unix()-int64(r.Updated)) / uint64(scoreHalfLife/time.Second)
+	if shift > 63 {
+		shift = 63
+	}
+	r.Useful >>= shift
+	r.Invalid >>= shift
+	r.Timeouts >>= shift
+}
+
+// peerScorer tracks the reputation of the remote peers, ranking them for data
+// retrievals and dialing. The reputations are persisted keyed by node ID, so
+// misbehaving nodes are remembered across reconnects and restarts.
+type peerScorer struct {
+	db    watdb.Database
+	nodes map[string]discover.NodeID      // Node IDs of the connected peers
+	reps  map[discover.NodeID]*reputation // Reputations of the connected peers
+	lock  sync.RWMutex
+}
+
+// newPeerScorer creates a reputation tracker persisting into the given database.
+func newPeerScorer(db watdb.Database) *peerScorer {
+	return &peerScorer{
+		db:    db,
+		nodes: make(map[string]discover.NodeID),
+		reps:  make(map[discover.NodeID]*reputation),
+	}
+}
+
+// connect starts tracking the reputation of a connected peer, loading its past
+// behaviour from the database.
+func (s *peerScorer) connect(id string, node discover.NodeID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.nodes[id] = node
+	s.reps[node] = s.load(node)
+}
+
+// disconnect stops tracking the reputation of a disconnecting peer, persisting
+// its behaviour into the database.
+func (s *peerScorer) disconnect(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	node, ok := s.nodes[id]
+	if !ok {
+		return
+	}
+	s.store(node, s.reps[node])
+
+	delete(s.nodes, id)
+	delete(s.reps, node)
+}
+
+// Useful records a peer having answered a request with useful data.
+func (s *peerScorer) Useful(id string, latency time.Duration) {
+	s.update(id, func(rep *reputation) {
+		if rep.Useful == 0 {
+			rep.Latency = uint64(latency)
+		} else {
+			rep.Latency = uint64((1-latencyImpact)*float64(rep.Latency) + latencyImpact*float64(latency))
+		}
+		rep.Useful++
+	})
+}
+
+// Invalid records a peer having delivered invalid data.
+func (s *peerScorer) Invalid(id string) {
+	s.update(id, func(rep *reputation) { rep.Invalid++ })
+}
+
+// Timeout records a peer having failed to answer a request in time.
+func (s *peerScorer) Timeout(id string) {
+	s.update(id, func(rep *reputation) { rep.Timeouts++ })
+}
+
+// Score retrieves the reputation of a connected peer in the [-1, 1] range.
+func (s *peerScorer) Score(id string) float64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if node, ok := s.nodes[id]; ok {
+		return s.reps[node].score()
+	}
+	return 0
+}
+
+// NodeScore retrieves the reputation of a node in the [-1, 1] range, irrelevant
+// whwater it's currently connected or not.
+func (s *peerScorer) NodeScore(node discover.NodeID) float64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if rep, ok := s.reps[node]; ok {
+		return rep.score()
+	}
+	return s.load(node).score()
+}
+
+// update modifies the reputation of a connected peer, fading out the oldest
+// observations if too many accumulated.
+func (s *peerScorer) update(id string, modify func(rep *reputation)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	node, ok := s.nodes[id]
+	if !ok {
+		return
+	}
+	rep := s.reps[node]
+	modify(rep)
+
+	if rep.Useful+rep.Invalid+rep.Timeouts > scoreMemory {
+		rep.Useful, rep.Invalid, rep.Timeouts = rep.Useful/2, rep.Invalid/2, rep.Timeouts/2
+	}
+}
+
+// load retrieves the persisted reputation of a node, faded by the time elapsed
+// since it was stored, or a neutral one if none (or a corrupted one) was found.
+func (s *peerScorer) load(node discover.NodeID) *reputation {
+	rep := new(reputation)
+
+	blob, err := s.db.Get(peerScoreKey(node))
+	if err != nil || len(blob) == 0 {
+		return rep
+	}
+	if err := rlp.DecodeBytes(blob, rep); err != nil {
+		log.Warn("Failed to decode peer reputation", "id", node, "err", err)
+		return new(reputation)
+	}
+	rep.fade(time.Now())
+	return rep
+}
+
+// store persists the reputation of a node.
+func (s *peerScorer) store(node discover.NodeID, rep *reputation) {
+	rep.Updated = uint64(time.Now().Unix())
+
+	blob, err := rlp.EncodeToBytes(rep)
+	if err != nil {
+		log.Error("Failed to encode peer reputation", "id", node, "err", err)
+		return
+	}
+	if err := s.db.Put(peerScoreKey(node), blob); err != nil {
+		log.Error("Failed to store peer reputation", "id", node, "err", err)
+	}
+}
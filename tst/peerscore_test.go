@@ -0,0 +1,125 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/p2p/discover"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// Tests that useful deliveries raise a peer's reputation and misbehaviour lowers
+// it, within the allowed range.
+func TestPeerScoreRanges(t *testing.T) {
+	db, _ := watdb.NewMemDatabase()
+	scorer := newPeerScorer(db)
+
+	scorer.connect("good", discover.NodeID{1})
+	scorer.connect("slow", discover.NodeID{2})
+	scorer.connect("evil", discover.NodeID{3})
+
+	if score := scorer.Score("good"); score != 0 {
+		t.Fatalf("unknown peer score mismatch: have %v, want 0", score)
+	}
+	for i := 0; i < 2*scoreMemory; i++ {
+		scorer.Useful("good", time.Millisecond)
+		scorer.Useful("slow", time.Millisecond)
+		scorer.Timeout("slow")
+		scorer.Invalid("evil")
+	}
+	if score := scorer.Score("good"); score <= 0.9 || score > 1 {
+		t.Errorf("useful peer score mismatch: have %v, want (0.9, 1]", score)
+	}
+	if score := scorer.Score("slow"); score >= 0 || score <= -1 {
+		t.Errorf("stalling peer score mismatch: have %v, want (-1, 0)", score)
+	}
+	if score := scorer.Score("evil"); score != -1 {
+		t.Errorf("invalid peer score mismatch: have %v, want -1", score)
+	}
+	if score := scorer.Score("unknown"); score != 0 {
+		t.Errorf("disconnected peer score mismatch: have %v, want 0", score)
+	}
+}
+
+// Tests that the useful answers of slow peers count less than those of fast ones.
+func TestPeerScoreLatency(t *testing.T) {
+	db, _ := watdb.NewMemDatabase()
+	scorer := newPeerScorer(db)
+
+	scorer.connect("fast", discover.NodeID{1})
+	scorer.connect("slow", discover.NodeID{2})
+	for i := 0; i < 16; i++ {
+		scorer.Useful("fast", time.Millisecond)
+		scorer.Useful("slow", latencyHalving)
+	}
+	fast, slow := scorer.Score("fast"), scorer.Score("slow")
+	if slow <= 0 || slow >= fast {
+		t.Fatalf("latency score mismatch: fast %v, slow %v, want 0 < slow < fast", fast, slow)
+	}
+}
+
+// Tests that reputations are persisted across disconnects and restarts, keyed
+// by node ID.
+func TestPeerScorePersistence(t *testing.T) {
+	db, _ := watdb.NewMemDatabase()
+	node := discover.NodeID{1}
+
+	scorer := newPeerScorer(db)
+	scorer.connect("peer", node)
+	scorer.Useful("peer", 100*time.Millisecond)
+	scorer.Timeout("peer")
+	scorer.Invalid("peer")
+
+	score := scorer.Score("peer")
+	if score >= 0 {
+		t.Fatalf("misbehaving peer score mismatch: have %v, want negative", score)
+	}
+	scorer.disconnect("peer")
+	if have := scorer.NodeScore(node); have != score {
+		t.Fatalf("disconnected node score mismatch: have %v, want %v", have, score)
+	}
+	// Restart the scorer and reconnect the node under a different peer id
+	scorer = newPeerScorer(db)
+	if have := scorer.NodeScore(node); have != score {
+		t.Fatalf("restarted node score mismatch: have %v, want %v", have, score)
+	}
+	scorer.connect("other", node)
+	if have := scorer.Score("other"); have != score {
+		t.Fatalf("reconnected peer score mismatch: have %v, want %v", have, score)
+	}
+	if have := scorer.NodeScore(discover.NodeID{2}); have != 0 {
+		t.Fatalf("unknown node score mismatch: have %v, want 0", have)
+	}
+}
+
+// Tests that the observations of absent nodes fade out over time.
+func TestPeerScoreFading(t *testing.T) {
+	now := time.Now()
+
+	rep := &reputation{Useful: 16, Invalid: 8, Timeouts: 4, Updated: uint64(now.Add(-2*scoreHalfLife - time.Minute).Unix())}
+	rep.fade(now)
+	if rep.Useful != 4 || rep.Invalid != 2 || rep.Timeouts != 1 {
+		t.Fatalf("faded observations mismatch: have %d/%d/%d, want 4/2/1", rep.Useful, rep.Invalid, rep.Timeouts)
+	}
+	rep.Updated = uint64(now.Add(-100 * scoreHalfLife).Unix())
+	rep.fade(now)
+	if rep.score() != 0 {
+		t.Fatalf("forgotten node score mismatch: have %v, want 0", rep.score())
+	}
+}
@@ -23,8 +23,10 @@ import (
 
 	"github.com/watchain/go-watchain/common"
 	"github.com/watchain/go-watchain/core"
+	"github.com/watchain/go-watchain/core/forkid"
 	"github.com/watchain/go-watchain/core/types"
 	"github.com/watchain/go-watchain/event"
+	"github.com/watchain/go-watchain/p2p/discv5"
 	"github.com/watchain/go-watchain/rlp"
 )
 
@@ -32,19 +34,28 @@ import (
 const (
 	wat62 = 62
 	wat63 = 63
+	wat64 = 64
+	wat65 = 65
 )
 
 // Official short name of the protocol used during capability negotiation.
 var ProtocolName = "wat"
 
 // Supported versions of the wat protocol (first is primary).
-var ProtocolVersions = []uint{wat63, wat62}
+var ProtocolVersions = []uint{wat65, wat64, wat63, wat62}
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{17, 17, 17, 8}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
+// DiscoveryTopic returns the discovery v5 topic under which nodes serving the
+// protocol on the network are advertised. The topic does not depend on the
+// protocol version, the version is agreed on during the handshake instead.
+func DiscoveryTopic(networkId uint64) discv5.Topic {
+	return discv5.Topic(fmt.Sprintf("%s@%d", ProtocolName, networkId))
+}
+
 // wat protocol message codes
 const (
 	// Protocol messages belonging to wat/62
@@ -57,6 +68,11 @@ const (
 	BlockBodiesMsg     = 0x06
 	NewBlockMsg        = 0x07
 
+	// Protocol messages belonging to wat/65
+	NewPooledTransactionHashesMsg = 0x08
+	GetPooledTransactionsMsg      = 0x09
+	PooledTransactionsMsg         = 0x0a
+
 	// Protocol messages belonging to wat/63
 	GetNodeDataMsg = 0x0d
 	NodeDataMsg    = 0x0e
@@ -76,6 +92,7 @@ const (
 	ErrNoStatusMsg
 	ErrExtraStatusMsg
 	ErrSuspendedPeer
+	ErrForkIDRejected
 )
 
 func (e errCode) String() string {
@@ -93,6 +110,7 @@ var errorToString = map[int]string{
 	ErrNoStatusMsg:             "No status message",
 	ErrExtraStatusMsg:          "Extra status message",
 	ErrSuspendedPeer:           "Suspended peer",
+	ErrForkIDRejected:          "Fork ID rejected",
 }
 
 type txPool interface {
@@ -106,15 +124,31 @@ type txPool interface {
 	// SubscribeTxPreEvent should return an event subscription of
 	// TxPreEvent and send events to the given channel.
 	SubscribeTxPreEvent(chan<- core.TxPreEvent) event.Subscription
+
+	// Get should return a transaction if it is contained in the pool, or nil
+	// otherwise.
+	Get(hash common.Hash) *types.Transaction
+}
+
+// statusData63 is the network packet for the status message for wat/63 and
+// below.
+type statusData63 struct {
+	ProtocolVersion uint32
+	NetworkId       uint64
+	TD              *big.Int
+	CurrentBlock    common.Hash
+	GenesisBlock    common.Hash
 }
 
-// statusData is the network packet for the status message.
+// statusData is the network packet for the status message for wat/64 and later,
+// additionally carrying the fork identifier of the sender's chain.
 type statusData struct {
 	ProtocolVersion uint32
 	NetworkId       uint64
 	TD              *big.Int
 	CurrentBlock    common.Hash
 	GenesisBlock    common.Hash
+	ForkID          forkid.ID
 }
 
 // newBlockHashesData is the network packet for the block announcements.
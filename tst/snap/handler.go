@@ -0,0 +1,289 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/light"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/p2p"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/trie"
+)
+
+const (
+	// softResponseLimit is the target maximum size of replies to data retrievals.
+	softResponseLimit = 2 * 1024 * 1024
+
+	// maxCodeLookups is the maximum number of bytecodes to serve. This number is
+	// there to limit the number of disk lookups.
+	maxCodeLookups = 1024
+)
+
+// Handle is the callback invoked to manage the life cycle of a snap peer. The
+// peer is registered as a data source of the syncer while connected, and all of
+// its queries are served from the given trie database. When this function
+// terminates, the peer is disconnected.
+func Handle(triedb *trie.Database, syncer *Syncer, peer *Peer) error {
+	peer.Log().Debug("Snap peer connected", "name", peer.Name())
+
+	if err := syncer.Register(peer); err != nil {
+		peer.Log().Error("Snap peer registration failed", "err", err)
+		return err
+	}
+	defer syncer.Unregister(peer.id)
+
+	for {
+		if err := handleMessage(triedb, syncer, peer); err != nil {
+			peer.Log().Debug("Snap message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMessage is invoked whenever an inbound message is received from a
+// remote peer. The remote connection is torn down upon returning any error.
+func handleMessage(triedb *trie.Database, syncer *Syncer, peer *Peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		// Decode the account retrieval request and serve it
+		var req getAccountRangeData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		hashes, accounts, proof := ServiceAccountRange(triedb, req.Root, req.Origin, req.Limit, req.Bytes)
+
+		res := &accountRangeData{ID: req.ID, Accounts: make([]*accountData, len(hashes)), Proof: []rlp.RawValue(proof)}
+		for i, hash := range hashes {
+			res.Accounts[i] = &accountData{Hash: hash, Body: accounts[i]}
+		}
+		return p2p.Send(peer.rw, AccountRangeMsg, res)
+
+	case AccountRangeMsg:
+		// A range of accounts arrived to one of our previous requests
+		var res accountRangeData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		hashes, accounts := make([]common.Hash, len(res.Accounts)), make([][]byte, len(res.Accounts))
+		for i, acc := range res.Accounts {
+			hashes[i], accounts[i] = acc.Hash, acc.Body
+		}
+		return syncer.OnAccounts(peer, res.ID, hashes, accounts, light.NodeList(res.Proof))
+
+	case GetStorageRangesMsg:
+		// Decode the storage retrieval request and serve it
+		var req getStorageRangesData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		hashes, slots, proof := ServiceStorageRanges(triedb, req.Roots, req.Origin, req.Bytes)
+
+		res := &storageRangesData{ID: req.ID, Slots: make([][]*storageData, len(hashes)), Proof: []rlp.RawValue(proof)}
+		for i := range hashes {
+			res.Slots[i] = make([]*storageData, len(hashes[i]))
+			for j, hash := range hashes[i] {
+				res.Slots[i][j] = &storageData{Hash: hash, Body: slots[i][j]}
+			}
+		}
+		return p2p.Send(peer.rw, StorageRangesMsg, res)
+
+	case StorageRangesMsg:
+		// A batch of storage slots arrived to one of our previous requests
+		var res storageRangesData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		hashes, slots := make([][]common.Hash, len(res.Slots)), make([][][]byte, len(res.Slots))
+		for i, set := range res.Slots {
+			hashes[i], slots[i] = make([]common.Hash, len(set)), make([][]byte, len(set))
+			for j, slot := range set {
+				hashes[i][j], slots[i][j] = slot.Hash, slot.Body
+			}
+		}
+		return syncer.OnStorage(peer, res.ID, hashes, slots, light.NodeList(res.Proof))
+
+	case GetByteCodesMsg:
+		// Decode the bytecode retrieval request and serve it
+		var req getByteCodesData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p2p.Send(peer.rw, ByteCodesMsg, &byteCodesData{ID: req.ID, Codes: ServiceByteCodes(triedb, req.Hashes, req.Bytes)})
+
+	case ByteCodesMsg:
+		// A batch of bytecodes arrived to one of our previous requests
+		var res byteCodesData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return syncer.OnByteCodes(peer, res.ID, res.Codes)
+
+	default:
+		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+	}
+}
+
+// ServiceAccountRange retrieves the accounts of the trie with the given root,
+// starting at origin and stopping after the first account at or above limit,
+// or when the byte limit is reached. The range is proven by the merkle proofs
+// of the origin and the last returned account. If the state is unavailable, no
+// accounts and no proofs are returned.
+func ServiceAccountRange(triedb *trie.Database, root, origin, limit common.Hash, maxBytes uint64) ([]common.Hash, [][]byte, light.NodeList) {
+	if maxBytes > softResponseLimit {
+		maxBytes = softResponseLimit
+	}
+	tr, err := trie.New(root, triedb)
+	if err != nil {
+		return nil, nil, nil
+	}
+	var (
+		hashes   []common.Hash
+		accounts [][]byte
+		size     uint64
+	)
+	it := trie.NewIterator(tr.NodeIterator(origin[:]))
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		hashes, accounts = append(hashes, hash), append(accounts, common.CopyBytes(it.Value))
+
+		size += uint64(common.HashLength + len(it.Value))
+		if size >= maxBytes || bytes.Compare(hash[:], limit[:]) >= 0 {
+			break
+		}
+	}
+	if it.Err != nil {
+		log.Debug("Failed to iterate account range", "root", root, "err", it.Err)
+		return nil, nil, nil
+	}
+	// Prove the edges of the range, the origin and the last returned account
+	var proof light.NodeList
+	if err := tr.Prove(origin[:], 0, &proof); err != nil {
+		return nil, nil, nil
+	}
+	if len(hashes) > 0 {
+		if err := tr.Prove(hashes[len(hashes)-1][:], 0, &proof); err != nil {
+			return nil, nil, nil
+		}
+	}
+	return hashes, accounts, proof
+}
+
+// ServiceStorageRanges retrieves the slots of the storage tries with the given
+// roots, until the byte limit is reached. If an origin is given, only the first
+// trie is served, starting from the origin. Only the slots of the last served
+// trie may be incomplete, in which case they are proven by the merkle proofs of
+// the origin and the last returned slot.
+func ServiceStorageRanges(triedb *trie.Database, roots []common.Hash, origin []byte, maxBytes uint64) ([][]common.Hash, [][][]byte, light.NodeList) {
+	if maxBytes > softResponseLimit {
+		maxBytes = softResponseLimit
+	}
+	if len(origin) > 0 && len(roots) > 1 {
+		roots = roots[:1]
+	}
+	var (
+		hashes [][]common.Hash
+		slots  [][][]byte
+		proof  light.NodeList
+		size   uint64
+	)
+	for _, root := range roots {
+		// Stop serving new tries if the response is already full
+		if size >= maxBytes {
+			break
+		}
+		tr, err := trie.New(root, triedb)
+		if err != nil {
+			break
+		}
+		// Gather slots until the end of the trie or the byte limit
+		var (
+			keys   []common.Hash
+			values [][]byte
+			abort  bool
+		)
+		it := trie.NewIterator(tr.NodeIterator(origin))
+		for it.Next() {
+			if size >= maxBytes {
+				abort = true
+				break
+			}
+			keys, values = append(keys, common.BytesToHash(it.Key)), append(values, common.CopyBytes(it.Value))
+			size += uint64(common.HashLength + len(it.Value))
+		}
+		if it.Err != nil {
+			break
+		}
+		hashes, slots = append(hashes, keys), append(slots, values)
+
+		// If the slots are not the entire trie, prove the edges of the range
+		if abort || len(origin) > 0 {
+			start := common.BytesToHash(origin)
+			if err := tr.Prove(start[:], 0, &proof); err != nil {
+				return nil, nil, nil
+			}
+			if len(keys) > 0 {
+				if err := tr.Prove(keys[len(keys)-1][:], 0, &proof); err != nil {
+					return nil, nil, nil
+				}
+			}
+			break
+		}
+	}
+	return hashes, slots, proof
+}
+
+// ServiceByteCodes retrieves the contract codes with the given hashes until the
+// byte limit is reached. The codes are returned in the order of the hashes,
+// stopping at the first unknown one, so each code is at its hash's position.
+func ServiceByteCodes(triedb *trie.Database, hashes []common.Hash, maxBytes uint64) [][]byte {
+	if maxBytes > softResponseLimit {
+		maxBytes = softResponseLimit
+	}
+	if len(hashes) > maxCodeLookups {
+		hashes = hashes[:maxCodeLookups]
+	}
+	var (
+		codes [][]byte
+		size  uint64
+	)
+	for _, hash := range hashes {
+		blob, err := triedb.Node(hash)
+		if err != nil {
+			break
+		}
+		codes = append(codes, blob)
+		size += uint64(len(blob))
+		if size >= maxBytes {
+			break
+		}
+	}
+	return codes
+}
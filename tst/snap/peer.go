@@ -0,0 +1,82 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"fmt"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/p2p"
+)
+
+// Peer is a collection of relevant information we have about a snap peer.
+type Peer struct {
+	id string
+
+	*p2p.Peer
+	rw p2p.MsgReadWriter
+
+	version uint // Protocol version negotiated
+}
+
+// NewPeer wraps a devp2p peer running the snap protocol.
+func NewPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
+	id := p.ID()
+
+	return &Peer{
+		Peer:    p,
+		rw:      rw,
+		version: version,
+		id:      fmt.Sprintf("%x", id[:8]),
+	}
+}
+
+// ID retrieves the peer's unique identifier, matching the one used by the wat
+// protocol for the same connection.
+func (p *Peer) ID() string {
+	return p.id
+}
+
+// Version retrieves the peer's negotiated snap protocol version.
+func (p *Peer) Version() uint {
+	return p.version
+}
+
+// RequestAccountRange fetches a batch of accounts rooted in a specific account
+// trie, starting with the origin.
+func (p *Peer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	p.Log().Trace("Fetching range of accounts", "reqid", id, "root", root, "origin", origin, "limit", limit, "bytes", common.StorageSize(bytes))
+	return p2p.Send(p.rw, GetAccountRangeMsg, &getAccountRangeData{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+}
+
+// RequestStorageRanges fetches a batch of storage slots belonging to one or more
+// storage tries. If slots from only one trie are requested, an origin marker may
+// also be used to retrieve from there.
+func (p *Peer) RequestStorageRanges(id uint64, roots []common.Hash, origin []byte, bytes uint64) error {
+	if len(roots) == 1 && origin != nil {
+		p.Log().Trace("Fetching range of large storage slots", "reqid", id, "root", roots[0], "origin", common.BytesToHash(origin), "bytes", common.StorageSize(bytes))
+	} else {
+		p.Log().Trace("Fetching ranges of small storage slots", "reqid", id, "roots", len(roots), "first", roots[0], "bytes", common.StorageSize(bytes))
+	}
+	return p2p.Send(p.rw, GetStorageRangesMsg, &getStorageRangesData{ID: id, Roots: roots, Origin: origin, Bytes: bytes})
+}
+
+// RequestByteCodes fetches a batch of bytecodes by hash.
+func (p *Peer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	p.Log().Trace("Fetching set of byte codes", "reqid", id, "hashes", len(hashes), "bytes", common.StorageSize(bytes))
+	return p2p.Send(p.rw, GetByteCodesMsg, &getByteCodesData{ID: id, Hashes: hashes, Bytes: bytes})
+}
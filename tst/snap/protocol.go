@@ -0,0 +1,132 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snap implements the snap protocol, retrieving the state of the chain
+// as contiguous account and storage ranges proven by merkle range proofs.
+package snap
+
+import (
+	"fmt"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	snap1 = 1
+)
+
+// Official short name of the protocol used during capability negotiation.
+var ProtocolName = "snap"
+
+// Supported version of the snap protocol.
+var ProtocolVersion uint = snap1
+
+// Number of implemented messages of the snap protocol.
+var ProtocolLength uint64 = 6
+
+const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+// snap protocol message codes
+const (
+	GetAccountRangeMsg  = 0x00
+	AccountRangeMsg     = 0x01
+	GetStorageRangesMsg = 0x02
+	StorageRangesMsg    = 0x03
+	GetByteCodesMsg     = 0x04
+	ByteCodesMsg        = 0x05
+)
+
+type errCode int
+
+const (
+	ErrMsgTooLarge = iota
+	ErrDecode
+	ErrInvalidMsgCode
+)
+
+func (e errCode) String() string {
+	return errorToString[int(e)]
+}
+
+var errorToString = map[int]string{
+	ErrMsgTooLarge:    "Message too long",
+	ErrDecode:         "Invalid message",
+	ErrInvalidMsgCode: "Invalid message code",
+}
+
+func errResp(code errCode, format string, v ...interface{}) error {
+	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+}
+
+// getAccountRangeData represents an account range query.
+type getAccountRangeData struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// accountRangeData represents an account range response.
+type accountRangeData struct {
+	ID       uint64         // ID of the request this is a response for
+	Accounts []*accountData // List of consecutive accounts from the trie
+	Proof    []rlp.RawValue // List of trie nodes proving the account range
+}
+
+// accountData represents a single account in an account range response.
+type accountData struct {
+	Hash common.Hash  // Hash of the account
+	Body rlp.RawValue // RLP encoded account
+}
+
+// getStorageRangesData represents a storage slot query. If an origin is given,
+// only the first storage trie is served, starting from the given slot.
+type getStorageRangesData struct {
+	ID     uint64        // Request ID to match up responses with
+	Roots  []common.Hash // Root hashes of the storage tries to serve
+	Origin []byte        // Hash of the first storage slot to retrieve
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// storageRangesData represents a storage slot response. Only the last served
+// trie's slots may be incomplete, in which case they are merkle proven.
+type storageRangesData struct {
+	ID    uint64           // ID of the request this is a response for
+	Slots [][]*storageData // Lists of consecutive storage slots per trie
+	Proof []rlp.RawValue   // Merkle proofs for the last, partial slot range
+}
+
+// storageData represents a single storage slot in a storage range response.
+type storageData struct {
+	Hash common.Hash // Hash of the storage slot
+	Body []byte      // Data content of the slot
+}
+
+// getByteCodesData represents a contract bytecode query.
+type getByteCodesData struct {
+	ID     uint64        // Request ID to match up responses with
+	Hashes []common.Hash // Code hashes to retrieve the code for
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// byteCodesData represents a contract bytecode response.
+type byteCodesData struct {
+	ID    uint64   // ID of the request this is a response for
+	Codes [][]byte // Requested contract bytecodes, a prefix of the requested hashes
+}
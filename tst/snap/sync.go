@@ -0,0 +1,1092 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/state"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/light"
+	"github.com/watchain/go-watchain/log"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/trie"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+const (
+	// maxRequestSize is the maximum number of bytes to request from a remote peer.
+	maxRequestSize = 512 * 1024
+
+	// maxStorageSetRequestCount is the maximum number of storage tries to request
+	// the slots of in a single query.
+	maxStorageSetRequestCount = 64
+
+	// maxCodeRequestCount is the maximum number of bytecode blobs to request in a
+	// single query.
+	maxCodeRequestCount = 64
+
+	// accountConcurrency is the number of chunks to split the account trie into
+	// to allow concurrent retrievals.
+	accountConcurrency = 16
+
+	// requestTimeout is the maximum time a peer is allowed to spend on serving a
+	// single network request.
+	requestTimeout = 10 * time.Second
+
+	// trieFlushSize is the amount of account data to accumulate in the account
+	// trie before it is committed to disk and released from memory.
+	trieFlushSize = 4 * 1024 * 1024
+
+	// statusLogInterval is the time between progress reports to the user.
+	statusLogInterval = 8 * time.Second
+)
+
+var (
+	// ErrCancelled is returned from Sync if the operation was aborted.
+	ErrCancelled = errors.New("sync cancelled")
+
+	errAlreadyRegistered = errors.New("peer is already registered")
+	errNotRegistered     = errors.New("peer is not registered")
+)
+
+// SyncPeer abstracts out the methods required for a peer to be synced against,
+// allowing the construction of mock peers without the full blown networking.
+type SyncPeer interface {
+	// ID retrieves the peer's unique identifier.
+	ID() string
+
+	// RequestAccountRange fetches a batch of accounts rooted in a specific account
+	// trie, starting with the origin.
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+
+	// RequestStorageRanges fetches a batch of storage slots belonging to one or
+	// more storage tries, starting at origin for a single trie.
+	RequestStorageRanges(id uint64, roots []common.Hash, origin []byte, bytes uint64) error
+
+	// RequestByteCodes fetches a batch of bytecodes by hash.
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
+}
+
+// accountTask represents a chunk of the account trie to retrieve.
+type accountTask struct {
+	next common.Hash     // Next account to retrieve in this chunk
+	last common.Hash     // Last account of this chunk
+	req  *accountRequest // Pending request to fill this chunk
+	done bool            // Flag whwater the chunk was fully retrieved
+}
+
+// storageTask represents a storage trie to retrieve, possibly in multiple
+// ranges if it is too large to be delivered in a single response.
+type storageTask struct {
+	next     []byte              // Next slot to retrieve, nil if not started
+	trie     *trie.Trie          // Partially assembled trie of large contracts
+	req      *storageRequest     // Pending request to fill this trie
+	attempts map[string]struct{} // Peers which failed to deliver this trie
+}
+
+// bytecodeTask represents a contract code to retrieve.
+type bytecodeTask struct {
+	req      *bytecodeRequest    // Pending request to retrieve this code
+	attempts map[string]struct{} // Peers which failed to deliver this code
+}
+
+// accountRequest tracks a pending account range request.
+type accountRequest struct {
+	id      uint64      // Request ID of this request
+	peer    string      // Peer to which this request is assigned
+	root    common.Hash // State root the range is requested for
+	origin  common.Hash // First account requested
+	limit   common.Hash // Last account requested
+	timeout *time.Timer // Timer to revert the request if the peer stalls
+	task    *accountTask
+}
+
+// accountResponse is a verified account range response.
+type accountResponse struct {
+	req      *accountRequest
+	hashes   []common.Hash    // Account hashes in the returned range
+	accounts []*state.Account // Decoded accounts in the returned range
+	blobs    [][]byte         // RLP encoded accounts to insert into the trie
+	cont     bool             // Whwater the account trie has more accounts
+}
+
+// storageRequest tracks a pending storage ranges request.
+type storageRequest struct {
+	id      uint64        // Request ID of this request
+	peer    string        // Peer to which this request is assigned
+	roots   []common.Hash // Storage roots requested
+	origin  []byte        // First slot requested of a single, large trie
+	timeout *time.Timer   // Timer to revert the request if the peer stalls
+}
+
+// storageResponse is a verified storage ranges response.
+type storageResponse struct {
+	req    *storageRequest
+	hashes [][]common.Hash // Slot hashes of the served storage tries
+	slots  [][][]byte      // Slot values of the served storage tries
+	cont   bool            // Whwater the last served trie has more slots
+}
+
+// bytecodeRequest tracks a pending bytecode request.
+type bytecodeRequest struct {
+	id      uint64        // Request ID of this request
+	peer    string        // Peer to which this request is assigned
+	hashes  []common.Hash // Code hashes requested
+	timeout *time.Timer   // Timer to revert the request if the peer stalls
+}
+
+// bytecodeResponse is a verified bytecode response.
+type bytecodeResponse struct {
+	req    *bytecodeRequest
+	hashes []common.Hash // Hashes of the delivered codes
+	codes  [][]byte      // Delivered codes
+}
+
+// Syncer is a snap state syncer. It retrieves the state of a given root as
+// contiguous account and storage ranges from remote peers, verifying each range
+// against the root with merkle range proofs, and assembles the tries locally.
+//
+// If the sync root changes midway, progress is retained and the new root is
+// synced against, leaving behind a state mixed from multiple roots. Such state
+// needs to be healed afterwards via a trie node sync.
+type Syncer struct {
+	db     watdb.Database // Database to store the synced state into
+	triedb *trie.Database // Trie database to assemble the synced tries with
+
+	root         common.Hash                   // Current state root being synced
+	accountTasks []*accountTask                // Account trie chunks to retrieve
+	accountTrie  *trie.Trie                    // Account trie assembled from all chunks
+	accountBytes common.StorageSize            // Account data inserted since the last flush
+	storageTasks map[common.Hash]*storageTask  // Storage tries to retrieve, keyed by root
+	codeTasks    map[common.Hash]*bytecodeTask // Contract codes to retrieve, keyed by hash
+	peers        map[string]SyncPeer           // Currently registered peers
+	busy         map[string]struct{}           // Peers with an in-flight request
+	stateless    map[string]struct{}           // Peers not having the current root
+	accountReqs  map[uint64]*accountRequest    // In-flight account range requests
+	storageReqs  map[uint64]*storageRequest    // In-flight storage ranges requests
+	codeReqs     map[uint64]*bytecodeRequest   // In-flight bytecode requests
+	reqID        uint64                        // Last assigned request ID
+
+	// Delivered responses and reverted requests, pending processing by Sync
+	accountResps   []*accountResponse
+	storageResps   []*storageResponse
+	codeResps      []*bytecodeResponse
+	accountReverts []*accountRequest
+	storageReverts []*storageRequest
+	codeReverts    []*bytecodeRequest
+
+	update chan struct{} // Notification channel for possible sync progression
+	lock   sync.Mutex    // Protects the fields shared with the peer goroutines
+
+	// Statistics, only accessed by the sync loop
+	accountSynced  uint64
+	storageSynced  uint64
+	bytecodeSynced uint64
+	logTime        time.Time
+}
+
+// NewSyncer creates a new snap syncer to download the watchain state into the
+// given database.
+func NewSyncer(db watdb.Database) *Syncer {
+	return &Syncer{
+		db:          db,
+		triedb:      trie.NewDatabase(db),
+		peers:       make(map[string]SyncPeer),
+		busy:        make(map[string]struct{}),
+		stateless:   make(map[string]struct{}),
+		accountReqs: make(map[uint64]*accountRequest),
+		storageReqs: make(map[uint64]*storageRequest),
+		codeReqs:    make(map[uint64]*bytecodeRequest),
+		update:      make(chan struct{}, 1),
+	}
+}
+
+// Register injects a new data source into the syncer's peerset.
+func (s *Syncer) Register(peer SyncPeer) error {
+	id := peer.ID()
+
+	s.lock.Lock()
+	if _, ok := s.peers[id]; ok {
+		s.lock.Unlock()
+		return errAlreadyRegistered
+	}
+	s.peers[id] = peer
+	s.lock.Unlock()
+
+	log.Trace("Registered snap sync peer", "peer", id)
+	s.notify()
+	return nil
+}
+
+// Unregister removes a data source from the syncer's peerset, rescheduling any
+// of its in-flight requests.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; !ok {
+		return errNotRegistered
+	}
+	delete(s.peers, id)
+	delete(s.busy, id)
+	delete(s.stateless, id)
+
+	for reqid, req := range s.accountReqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.accountReqs, reqid)
+			s.accountReverts = append(s.accountReverts, req)
+		}
+	}
+	for reqid, req := range s.storageReqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.storageReqs, reqid)
+			s.storageReverts = append(s.storageReverts, req)
+		}
+	}
+	for reqid, req := range s.codeReqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.codeReqs, reqid)
+			s.codeReverts = append(s.codeReverts, req)
+		}
+	}
+	log.Trace("Unregistered snap sync peer", "peer", id)
+	s.notify()
+	return nil
+}
+
+// Sync starts (or resumes a previous) sync cycle to retrieve the state of the
+// given root, blocking until all the account and storage ranges have been
+// downloaded, the sync is cancelled, or none of the connected peers can serve
+// the requested state anymore. In the latter case, nil is returned and the
+// remainder of the state is left to be healed.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	s.lock.Lock()
+	if s.root != root {
+		s.root = root
+		s.stateless = make(map[string]struct{})
+	}
+	if s.accountTasks == nil {
+		if err := s.resetTasks(); err != nil {
+			s.lock.Unlock()
+			return err
+		}
+	}
+	s.lock.Unlock()
+	defer s.cleanup()
+
+	log.Debug("Starting snap sync cycle", "root", root)
+	for {
+		// Process all the deliveries and reverts since the last iteration
+		if err := s.processDeliveries(); err != nil {
+			return err
+		}
+		s.reportProgress(false)
+
+		// If all the chunks and tries were retrieved, finalize the sync
+		if s.complete() {
+			if err := s.commitAccounts(); err != nil {
+				return err
+			}
+			s.reportProgress(true)
+			log.Info("Snap sync completed", "root", root, "accounts", s.accountSynced, "slots", s.storageSynced, "codes", s.bytecodeSynced)
+
+			s.lock.Lock()
+			s.accountTasks, s.accountTrie = nil, nil
+			s.lock.Unlock()
+			return nil
+		}
+		// Assign all the data retrieval tasks to any free peers
+		s.assignAccountTasks()
+		s.assignStorageTasks()
+		s.assignBytecodeTasks()
+
+		// If peers are available but none can serve anything, give up the cycle
+		s.lock.Lock()
+		stalled := len(s.peers) > 0 && len(s.accountReqs)+len(s.storageReqs)+len(s.codeReqs) == 0 &&
+			len(s.accountResps)+len(s.storageResps)+len(s.codeResps) == 0 &&
+			len(s.accountReverts)+len(s.storageReverts)+len(s.codeReverts) == 0
+		s.lock.Unlock()
+
+		if stalled {
+			log.Warn("Snap sync peers lack requested state, deferring to healing", "root", root)
+			return s.commitAccounts()
+		}
+		// Wait for somwating to happen
+		select {
+		case <-s.update:
+		case <-cancel:
+			return ErrCancelled
+		}
+	}
+}
+
+// resetTasks creates the account chunks to retrieve and the empty account trie
+// to assemble them into. The caller must hold the lock.
+func (s *Syncer) resetTasks() error {
+	tr, err := trie.New(common.Hash{}, s.triedb)
+	if err != nil {
+		return err
+	}
+	s.accountTrie = tr
+	s.accountTasks = nil
+	s.storageTasks = make(map[common.Hash]*storageTask)
+	s.codeTasks = make(map[common.Hash]*bytecodeTask)
+
+	// Split the account hash space into equal chunks to retrieve concurrently
+	var (
+		next common.Hash
+		step = new(big.Int).Div(new(big.Int).Lsh(common.Big1, 256), big.NewInt(accountConcurrency))
+	)
+	for i := 0; i < accountConcurrency; i++ {
+		last := common.BigToHash(new(big.Int).Sub(new(big.Int).Mul(step, big.NewInt(int64(i+1))), common.Big1))
+		s.accountTasks = append(s.accountTasks, &accountTask{next: next, last: last})
+		next = incHash(last)
+	}
+	return nil
+}
+
+// cleanup cancels all in-flight requests and discards any pending deliveries
+// when a sync cycle terminates. Late responses will be ignored as unrequested.
+func (s *Syncer) cleanup() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, req := range s.accountReqs {
+		req.timeout.Stop()
+		delete(s.accountReqs, id)
+	}
+	for id, req := range s.storageReqs {
+		req.timeout.Stop()
+		delete(s.storageReqs, id)
+	}
+	for id, req := range s.codeReqs {
+		req.timeout.Stop()
+		delete(s.codeReqs, id)
+	}
+	s.busy = make(map[string]struct{})
+	s.accountResps, s.storageResps, s.codeResps = nil, nil, nil
+	s.accountReverts, s.storageReverts, s.codeReverts = nil, nil, nil
+
+	for _, task := range s.accountTasks {
+		task.req = nil
+	}
+	for _, task := range s.storageTasks {
+		task.req = nil
+	}
+	for _, task := range s.codeTasks {
+		task.req = nil
+	}
+}
+
+// complete reports whwater all the scheduled data has been retrieved.
+func (s *Syncer) complete() bool {
+	for _, task := range s.accountTasks {
+		if !task.done {
+			return false
+		}
+	}
+	return len(s.storageTasks) == 0 && len(s.codeTasks) == 0
+}
+
+// notify signals the sync loop that it might be able to make progress.
+func (s *Syncer) notify() {
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// nextID returns a new request ID. The caller must hold the lock.
+func (s *Syncer) nextID() uint64 {
+	s.reqID++
+	return s.reqID
+}
+
+// idlePeers returns the peers without an in-flight request. If stateful is set,
+// peers known not to have the current state root are skipped too.
+func (s *Syncer) idlePeers(stateful bool) []SyncPeer {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var idle []SyncPeer
+	for id, peer := range s.peers {
+		if _, ok := s.busy[id]; ok {
+			continue
+		}
+		if _, ok := s.stateless[id]; ok && stateful {
+			continue
+		}
+		idle = append(idle, peer)
+	}
+	return idle
+}
+
+// assignAccountTasks attempts to match idle peers to pending account ranges.
+func (s *Syncer) assignAccountTasks() {
+	for _, peer := range s.idlePeers(true) {
+		// Find the first chunk not yet retrieved nor in flight
+		var task *accountTask
+		for _, t := range s.accountTasks {
+			if !t.done && t.req == nil {
+				task = t
+				break
+			}
+		}
+		if task == nil {
+			return
+		}
+		s.lock.Lock()
+		req := &accountRequest{
+			id:     s.nextID(),
+			peer:   peer.ID(),
+			root:   s.root,
+			origin: task.next,
+			limit:  task.last,
+			task:   task,
+		}
+		req.timeout = time.AfterFunc(requestTimeout, func() {
+			s.timeoutAccountRequest(req)
+		})
+		s.accountReqs[req.id] = req
+		s.busy[req.peer] = struct{}{}
+		s.lock.Unlock()
+
+		task.req = req
+		if err := peer.RequestAccountRange(req.id, req.root, req.origin, req.limit, maxRequestSize); err != nil {
+			log.Debug("Failed to request account range", "peer", req.peer, "err", err)
+			s.timeoutAccountRequest(req)
+		}
+	}
+}
+
+// assignStorageTasks attempts to match idle peers to pending storage tries.
+func (s *Syncer) assignStorageTasks() {
+	for _, peer := range s.idlePeers(false) {
+		id := peer.ID()
+
+		// Gather either a single partially retrieved trie, or a batch of new ones
+		var (
+			roots  []common.Hash
+			origin []byte
+		)
+		for root, task := range s.storageTasks {
+			if task.req != nil {
+				continue
+			}
+			if _, ok := task.attempts[id]; ok {
+				continue
+			}
+			if task.next != nil {
+				if len(roots) > 0 {
+					continue
+				}
+				roots, origin = []common.Hash{root}, task.next
+				break
+			}
+			roots = append(roots, root)
+			if len(roots) >= maxStorageSetRequestCount {
+				break
+			}
+		}
+		if len(roots) == 0 {
+			continue
+		}
+		s.lock.Lock()
+		req := &storageRequest{
+			id:     s.nextID(),
+			peer:   id,
+			roots:  roots,
+			origin: origin,
+		}
+		req.timeout = time.AfterFunc(requestTimeout, func() {
+			s.timeoutStorageRequest(req)
+		})
+		s.storageReqs[req.id] = req
+		s.busy[req.peer] = struct{}{}
+		s.lock.Unlock()
+
+		for _, root := range roots {
+			s.storageTasks[root].req = req
+		}
+		if err := peer.RequestStorageRanges(req.id, req.roots, req.origin, maxRequestSize); err != nil {
+			log.Debug("Failed to request storage ranges", "peer", req.peer, "err", err)
+			s.timeoutStorageRequest(req)
+		}
+	}
+}
+
+// assignBytecodeTasks attempts to match idle peers to pending contract codes.
+func (s *Syncer) assignBytecodeTasks() {
+	for _, peer := range s.idlePeers(false) {
+		id := peer.ID()
+
+		var hashes []common.Hash
+		for hash, task := range s.codeTasks {
+			if task.req != nil {
+				continue
+			}
+			if _, ok := task.attempts[id]; ok {
+				continue
+			}
+			hashes = append(hashes, hash)
+			if len(hashes) >= maxCodeRequestCount {
+				break
+			}
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+		s.lock.Lock()
+		req := &bytecodeRequest{
+			id:     s.nextID(),
+			peer:   id,
+			hashes: hashes,
+		}
+		req.timeout = time.AfterFunc(requestTimeout, func() {
+			s.timeoutBytecodeRequest(req)
+		})
+		s.codeReqs[req.id] = req
+		s.busy[req.peer] = struct{}{}
+		s.lock.Unlock()
+
+		for _, hash := range hashes {
+			s.codeTasks[hash].req = req
+		}
+		if err := peer.RequestByteCodes(req.id, req.hashes, maxRequestSize); err != nil {
+			log.Debug("Failed to request bytecodes", "peer", req.peer, "err", err)
+			s.timeoutBytecodeRequest(req)
+		}
+	}
+}
+
+// timeoutAccountRequest reschedules an account request if it's still pending.
+func (s *Syncer) timeoutAccountRequest(req *accountRequest) {
+	s.lock.Lock()
+	if s.accountReqs[req.id] == req {
+		delete(s.accountReqs, req.id)
+		delete(s.busy, req.peer)
+		s.accountReverts = append(s.accountReverts, req)
+	}
+	s.lock.Unlock()
+	s.notify()
+}
+
+// timeoutStorageRequest reschedules a storage request if it's still pending.
+func (s *Syncer) timeoutStorageRequest(req *storageRequest) {
+	s.lock.Lock()
+	if s.storageReqs[req.id] == req {
+		delete(s.storageReqs, req.id)
+		delete(s.busy, req.peer)
+		s.storageReverts = append(s.storageReverts, req)
+	}
+	s.lock.Unlock()
+	s.notify()
+}
+
+// timeoutBytecodeRequest reschedules a bytecode request if it's still pending.
+func (s *Syncer) timeoutBytecodeRequest(req *bytecodeRequest) {
+	s.lock.Lock()
+	if s.codeReqs[req.id] == req {
+		delete(s.codeReqs, req.id)
+		delete(s.busy, req.peer)
+		s.codeReverts = append(s.codeReverts, req)
+	}
+	s.lock.Unlock()
+	s.notify()
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts are
+// received from a remote peer. Invalid responses are rejected with an error.
+func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, hashes []common.Hash, accounts [][]byte, proof light.NodeList) error {
+	// Ensure the response is for a valid request and mark the peer idle
+	s.lock.Lock()
+	req, ok := s.accountReqs[id]
+	if !ok || req.peer != peer.ID() {
+		s.lock.Unlock()
+		log.Debug("Unrequested account range", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	req.timeout.Stop()
+
+	// An empty response means the peer doesn't have the requested state
+	if len(hashes) == 0 && len(proof) == 0 {
+		delete(s.accountReqs, id)
+		delete(s.busy, req.peer)
+		s.stateless[req.peer] = struct{}{}
+		s.accountReverts = append(s.accountReverts, req)
+		s.lock.Unlock()
+
+		log.Debug("Peer rejected account range request", "peer", req.peer, "root", req.root)
+		s.notify()
+		return nil
+	}
+	s.lock.Unlock()
+
+	// Verify the range against the requested root and decode the accounts. The
+	// request is kept in flight meanwhile so the sync loop doesn't deem it stalled.
+	res, err := s.verifyAccounts(req, hashes, accounts, proof)
+	s.lock.Lock()
+	if s.accountReqs[id] != req {
+		s.lock.Unlock()
+		return nil // Reverted during verification, peer dropped
+	}
+	delete(s.accountReqs, id)
+	delete(s.busy, req.peer)
+	if err != nil {
+		s.accountReverts = append(s.accountReverts, req)
+	} else {
+		s.accountResps = append(s.accountResps, res)
+	}
+	s.lock.Unlock()
+	s.notify()
+
+	if err != nil {
+		log.Warn("Invalid account range", "peer", req.peer, "err", err)
+	}
+	return err
+}
+
+// verifyAccounts checks an account range against the root it was requested for.
+func (s *Syncer) verifyAccounts(req *accountRequest, hashes []common.Hash, accounts [][]byte, proof light.NodeList) (*accountResponse, error) {
+	if len(hashes) != len(accounts) {
+		return nil, fmt.Errorf("account count mismatch: %d hashes, %d accounts", len(hashes), len(accounts))
+	}
+	keys := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	var last []byte
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	cont, err := trie.VerifyRangeProof(req.root, req.origin[:], last, keys, accounts, proof.NodeSet())
+	if err != nil {
+		return nil, err
+	}
+	res := &accountResponse{req: req, hashes: hashes, accounts: make([]*state.Account, len(accounts)), blobs: accounts, cont: cont}
+	for i, blob := range accounts {
+		res.accounts[i] = new(state.Account)
+		if err := rlp.DecodeBytes(blob, res.accounts[i]); err != nil {
+			return nil, fmt.Errorf("invalid account %x: %v", hashes[i], err)
+		}
+	}
+	return res, nil
+}
+
+// OnStorage is a callback method to invoke when ranges of storage slots are
+// received from a remote peer. Invalid responses are rejected with an error.
+func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slots [][][]byte, proof light.NodeList) error {
+	// Ensure the response is for a valid request and mark the peer idle
+	s.lock.Lock()
+	req, ok := s.storageReqs[id]
+	if !ok || req.peer != peer.ID() {
+		s.lock.Unlock()
+		log.Debug("Unrequested storage ranges", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	req.timeout.Stop()
+	s.lock.Unlock()
+
+	// Verify all the delivered ranges against their storage roots
+	res, err := s.verifyStorage(req, hashes, slots, proof)
+	s.lock.Lock()
+	if s.storageReqs[id] != req {
+		s.lock.Unlock()
+		return nil // Reverted during verification, peer dropped
+	}
+	delete(s.storageReqs, id)
+	delete(s.busy, req.peer)
+	if err != nil {
+		s.storageReverts = append(s.storageReverts, req)
+	} else {
+		s.storageResps = append(s.storageResps, res)
+	}
+	s.lock.Unlock()
+	s.notify()
+
+	if err != nil {
+		log.Warn("Invalid storage ranges", "peer", req.peer, "err", err)
+	}
+	return err
+}
+
+// verifyStorage checks storage slot ranges against the roots requested. All but
+// the last range must be complete tries, the last may be a proven partial range.
+func (s *Syncer) verifyStorage(req *storageRequest, hashes [][]common.Hash, slots [][][]byte, proof light.NodeList) (*storageResponse, error) {
+	if len(hashes) != len(slots) {
+		return nil, fmt.Errorf("storage set count mismatch: %d hashes, %d slots", len(hashes), len(slots))
+	}
+	if len(hashes) > len(req.roots) {
+		return nil, fmt.Errorf("unrequested storage sets: %d requested, %d delivered", len(req.roots), len(hashes))
+	}
+	res := &storageResponse{req: req, hashes: hashes, slots: slots}
+	for i := range hashes {
+		if len(hashes[i]) != len(slots[i]) {
+			return nil, fmt.Errorf("slot count mismatch: %d hashes, %d slots", len(hashes[i]), len(slots[i]))
+		}
+		keys := make([][]byte, len(hashes[i]))
+		for j, hash := range hashes[i] {
+			keys[j] = common.CopyBytes(hash[:])
+		}
+		if i < len(hashes)-1 || len(proof) == 0 {
+			if _, err := trie.VerifyRangeProof(req.roots[i], nil, nil, keys, slots[i], nil); err != nil {
+				return nil, fmt.Errorf("storage trie %x: %v", req.roots[i], err)
+			}
+			continue
+		}
+		var (
+			origin = common.BytesToHash(req.origin)
+			last   []byte
+		)
+		if len(keys) > 0 {
+			last = keys[len(keys)-1]
+		}
+		cont, err := trie.VerifyRangeProof(req.roots[i], origin[:], last, keys, slots[i], proof.NodeSet())
+		if err != nil {
+			return nil, fmt.Errorf("storage trie %x: %v", req.roots[i], err)
+		}
+		res.cont = cont
+	}
+	return res, nil
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract bytecodes
+// are received from a remote peer. Unrequested codes are rejected with an error.
+func (s *Syncer) OnByteCodes(peer SyncPeer, id uint64, codes [][]byte) error {
+	// Ensure the response is for a valid request and mark the peer idle
+	s.lock.Lock()
+	req, ok := s.codeReqs[id]
+	if !ok || req.peer != peer.ID() {
+		s.lock.Unlock()
+		log.Debug("Unrequested bytecodes", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	req.timeout.Stop()
+	s.lock.Unlock()
+
+	// Match the delivered codes to the requested hashes, in request order
+	res := &bytecodeResponse{req: req}
+
+	var err error
+	for i, code := range codes {
+		hash := crypto.Keccak256Hash(code)
+		if i >= len(req.hashes) || hash != req.hashes[i] {
+			err = fmt.Errorf("unrequested bytecode %x at position %d", hash, i)
+			break
+		}
+		res.hashes, res.codes = append(res.hashes, hash), append(res.codes, code)
+	}
+	s.lock.Lock()
+	if s.codeReqs[id] != req {
+		s.lock.Unlock()
+		return nil // Reverted during verification, peer dropped
+	}
+	delete(s.codeReqs, id)
+	delete(s.busy, req.peer)
+	if err != nil {
+		s.codeReverts = append(s.codeReverts, req)
+	} else {
+		s.codeResps = append(s.codeResps, res)
+	}
+	s.lock.Unlock()
+	s.notify()
+
+	if err != nil {
+		log.Warn("Invalid bytecodes", "peer", req.peer, "err", err)
+	}
+	return err
+}
+
+// processDeliveries integrates all the verified responses into the local state
+// and reschedules all the reverted requests.
+func (s *Syncer) processDeliveries() error {
+	s.lock.Lock()
+	accountResps, storageResps, codeResps := s.accountResps, s.storageResps, s.codeResps
+	accountReverts, storageReverts, codeReverts := s.accountReverts, s.storageReverts, s.codeReverts
+
+	s.accountResps, s.storageResps, s.codeResps = nil, nil, nil
+	s.accountReverts, s.storageReverts, s.codeReverts = nil, nil, nil
+	s.lock.Unlock()
+
+	for _, req := range accountReverts {
+		req.task.req = nil
+	}
+	for _, req := range storageReverts {
+		for _, root := range req.roots {
+			if task := s.storageTasks[root]; task != nil && task.req == req {
+				task.req = nil
+			}
+		}
+	}
+	for _, req := range codeReverts {
+		for _, hash := range req.hashes {
+			if task := s.codeTasks[hash]; task != nil && task.req == req {
+				task.req = nil
+			}
+		}
+	}
+	for _, res := range accountResps {
+		if err := s.processAccountResponse(res); err != nil {
+			return err
+		}
+	}
+	for _, res := range storageResps {
+		if err := s.processStorageResponse(res); err != nil {
+			return err
+		}
+	}
+	for _, res := range codeResps {
+		if err := s.processBytecodeResponse(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processAccountResponse inserts a range of accounts into the account trie and
+// schedules the retrieval of their storage tries and contract codes.
+func (s *Syncer) processAccountResponse(res *accountResponse) error {
+	task := res.req.task
+	task.req = nil
+
+	for i, hash := range res.hashes {
+		// Accounts beyond the chunk belong to the next one, skip them
+		if bytes.Compare(hash[:], task.last[:]) > 0 {
+			res.cont = false
+			break
+		}
+		if err := s.accountTrie.TryUpdate(hash[:], res.blobs[i]); err != nil {
+			return err
+		}
+		s.accountBytes += common.StorageSize(common.HashLength + len(res.blobs[i]))
+		s.accountSynced++
+
+		// Schedule any storage trie or code not yet present locally
+		account := res.accounts[i]
+		if account.Root != emptyRoot && s.storageTasks[account.Root] == nil {
+			if has, _ := s.db.Has(account.Root[:]); !has {
+				s.storageTasks[account.Root] = &storageTask{attempts: make(map[string]struct{})}
+			}
+		}
+		if code := common.BytesToHash(account.CodeHash); code != emptyCode && s.codeTasks[code] == nil {
+			if has, _ := s.db.Has(code[:]); !has {
+				s.codeTasks[code] = &bytecodeTask{attempts: make(map[string]struct{})}
+			}
+		}
+	}
+	// Advance the chunk, unless everything was retrieved
+	if n := len(res.hashes); res.cont && n > 0 && res.hashes[n-1] != task.last {
+		task.next = incHash(res.hashes[n-1])
+	} else {
+		task.done = true
+	}
+	if s.accountBytes >= trieFlushSize {
+		return s.commitAccounts()
+	}
+	return nil
+}
+
+// processStorageResponse inserts ranges of storage slots into their tries and
+// persists all the completed ones.
+func (s *Syncer) processStorageResponse(res *storageResponse) error {
+	req := res.req
+	for _, root := range req.roots {
+		if task := s.storageTasks[root]; task != nil && task.req == req {
+			task.req = nil
+		}
+	}
+	// If nothing was delivered, don't ask this peer for the same tries again
+	if len(res.hashes) == 0 {
+		for _, root := range req.roots {
+			if task := s.storageTasks[root]; task != nil {
+				task.attempts[req.peer] = struct{}{}
+			}
+		}
+		s.dropUnavailableTasks()
+		return nil
+	}
+	for i := range res.hashes {
+		root := req.roots[i]
+		task := s.storageTasks[root]
+		if task == nil {
+			continue
+		}
+		if task.trie == nil {
+			tr, err := trie.New(common.Hash{}, s.triedb)
+			if err != nil {
+				return err
+			}
+			task.trie = tr
+		}
+		for j, hash := range res.hashes[i] {
+			if err := task.trie.TryUpdate(hash[:], res.slots[i][j]); err != nil {
+				return err
+			}
+		}
+		s.storageSynced += uint64(len(res.hashes[i]))
+
+		// If the last trie is incomplete, continue it in a later request
+		if i == len(res.hashes)-1 && res.cont {
+			task.next = incHash(res.hashes[i][len(res.hashes[i])-1]).Bytes()
+			continue
+		}
+		hash, err := task.trie.Commit(nil)
+		if err != nil {
+			return err
+		}
+		if hash != root {
+			log.Warn("Storage trie assembly failed", "root", root, "have", hash)
+			task.next, task.trie = nil, nil
+			continue
+		}
+		if err := s.triedb.Commit(hash, false); err != nil {
+			return err
+		}
+		delete(s.storageTasks, root)
+	}
+	return nil
+}
+
+// processBytecodeResponse persists a batch of contract codes.
+func (s *Syncer) processBytecodeResponse(res *bytecodeResponse) error {
+	req := res.req
+	for _, hash := range req.hashes {
+		if task := s.codeTasks[hash]; task != nil && task.req == req {
+			task.req = nil
+		}
+	}
+	if len(res.codes) == 0 {
+		for _, hash := range req.hashes {
+			if task := s.codeTasks[hash]; task != nil {
+				task.attempts[req.peer] = struct{}{}
+			}
+		}
+		s.dropUnavailableTasks()
+		return nil
+	}
+	batch := s.db.NewBatch()
+	for i, hash := range res.hashes {
+		if s.codeTasks[hash] == nil {
+			continue
+		}
+		if err := batch.Put(hash[:], res.codes[i]); err != nil {
+			return err
+		}
+		delete(s.codeTasks, hash)
+		s.bytecodeSynced++
+	}
+	return batch.Write()
+}
+
+// dropUnavailableTasks removes the storage and code tasks that all connected
+// peers failed to deliver. Such data belongs to accounts changed since they were
+// retrieved, so it will be retrieved during healing instead.
+func (s *Syncer) dropUnavailableTasks() {
+	s.lock.Lock()
+	peers := make([]string, 0, len(s.peers))
+	for id := range s.peers {
+		peers = append(peers, id)
+	}
+	s.lock.Unlock()
+
+	unavailable := func(attempts map[string]struct{}) bool {
+		for _, id := range peers {
+			if _, ok := attempts[id]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	for root, task := range s.storageTasks {
+		if task.req == nil && unavailable(task.attempts) {
+			log.Debug("Storage trie unavailable, deferring to healing", "root", root)
+			delete(s.storageTasks, root)
+		}
+	}
+	for hash, task := range s.codeTasks {
+		if task.req == nil && unavailable(task.attempts) {
+			log.Debug("Bytecode unavailable, deferring to healing", "hash", hash)
+			delete(s.codeTasks, hash)
+		}
+	}
+}
+
+// commitAccounts flushes the account trie assembled so far to disk and reopens
+// it to release the memory held by the already persisted nodes.
+func (s *Syncer) commitAccounts() error {
+	root, err := s.accountTrie.Commit(nil)
+	if err != nil {
+		return err
+	}
+	if err := s.triedb.Commit(root, false); err != nil {
+		return err
+	}
+	tr, err := trie.New(root, s.triedb)
+	if err != nil {
+		return err
+	}
+	s.accountTrie, s.accountBytes = tr, 0
+	return nil
+}
+
+// reportProgress logs the sync progress if enough time passed since the last
+// report, or if forced.
+func (s *Syncer) reportProgress(force bool) {
+	if !force && time.Since(s.logTime) < statusLogInterval {
+		return
+	}
+	s.logTime = time.Now()
+
+	done := 0
+	for _, task := range s.accountTasks {
+		if task.done {
+			done++
+		}
+	}
+	log.Info("State sync in progress", "chunks", fmt.Sprintf("%d/%d", done, len(s.accountTasks)), "accounts", s.accountSynced,
+		"slots", s.storageSynced, "codes", s.bytecodeSynced, "pendingtries", len(s.storageTasks), "pendingcodes", len(s.codeTasks))
+}
+
+// incHash returns the hash following the given one, wrapping around at the end
+// of the hash space.
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,257 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core/state"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/trie"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// testPeer is a mock snap peer serving the state of a local trie database.
+type testPeer struct {
+	id     string
+	triedb *trie.Database
+	syncer *Syncer
+	limit  uint64 // Response size limit overriding the requested one
+
+	// Response mutators to simulate misbehaving peers
+	accounts func(hashes []common.Hash, accounts [][]byte) ([]common.Hash, [][]byte)
+}
+
+func newTestPeer(id string, triedb *trie.Database, syncer *Syncer) *testPeer {
+	return &testPeer{id: id, triedb: triedb, syncer: syncer, limit: softResponseLimit}
+}
+
+func (p *testPeer) ID() string { return p.id }
+
+func (p *testPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	hashes, accounts, proof := ServiceAccountRange(p.triedb, root, origin, limit, p.limit)
+	if p.accounts != nil {
+		hashes, accounts = p.accounts(hashes, accounts)
+	}
+	go p.deliver(func() error { return p.syncer.OnAccounts(p, id, hashes, accounts, proof) })
+	return nil
+}
+
+func (p *testPeer) RequestStorageRanges(id uint64, roots []common.Hash, origin []byte, bytes uint64) error {
+	hashes, slots, proof := ServiceStorageRanges(p.triedb, roots, origin, p.limit)
+	go p.deliver(func() error { return p.syncer.OnStorage(p, id, hashes, slots, proof) })
+	return nil
+}
+
+func (p *testPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	codes := ServiceByteCodes(p.triedb, hashes, p.limit)
+	go p.deliver(func() error { return p.syncer.OnByteCodes(p, id, codes) })
+	return nil
+}
+
+// deliver runs a response delivery, disconnecting the peer if it was rejected
+// as the protocol handler would.
+func (p *testPeer) deliver(fn func() error) {
+	if err := fn(); err != nil {
+		p.syncer.Unregister(p.id)
+	}
+}
+
+// makeTestState creates a state with the given number of accounts, every third
+// having a contract code and every fifth one storage slots.
+func makeTestState(accounts int, slots int) (*trie.Database, common.Hash) {
+	db, _ := watdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	for i := 0; i < accounts; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		statedb.SetNonce(addr, uint64(i))
+		if i%3 == 0 {
+			statedb.SetCode(addr, []byte(fmt.Sprintf("code-%d", i)))
+		}
+		if i%5 == 0 {
+			for j := 0; j < slots; j++ {
+				statedb.Sewatate(addr, common.BigToHash(big.NewInt(int64(j+1))), common.BigToHash(big.NewInt(int64(i*j+1))))
+			}
+		}
+	}
+	root, _ := statedb.Commit(false)
+	statedb.Database().TrieDB().Commit(root, false)
+
+	return statedb.Database().TrieDB(), root
+}
+
+// checkState verifies that the entire state of the given root, including all
+// the storage tries and contract codes, is present in the database.
+func checkState(t *testing.T, db watdb.Database, root common.Hash) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open synced state %x: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("synced state incomplete: %v", it.Error)
+	}
+}
+
+// runSync runs a sync cycle, failing the test if it doesn't finish in time.
+func runSync(t *testing.T, syncer *Syncer, root common.Hash) error {
+	var (
+		cancel = make(chan struct{})
+		done   = make(chan error, 1)
+	)
+	go func() { done <- syncer.Sync(root, cancel) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		close(cancel)
+		<-done
+		t.Fatalf("sync timed out")
+	}
+	return nil
+}
+
+// Tests that a state can be synced from multiple peers.
+func TestSync(t *testing.T) {
+	source, root := makeTestState(1000, 10)
+
+	db, _ := watdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+	for i := 0; i < 3; i++ {
+		syncer.Register(newTestPeer(fmt.Sprintf("peer-%d", i), source, syncer))
+	}
+	if err := runSync(t, syncer, root); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	checkState(t, db, root)
+}
+
+// Tests that accounts and storage tries too large to fit into a single response
+// are retrieved in multiple, proven ranges.
+func TestSyncMultipleRanges(t *testing.T) {
+	source, root := makeTestState(200, 100)
+
+	db, _ := watdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+
+	peer := newTestPeer("peer", source, syncer)
+	peer.limit = 500
+	syncer.Register(peer)
+
+	if err := runSync(t, syncer, root); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	checkState(t, db, root)
+}
+
+// Tests that peers delivering unprovable ranges are rejected, and the sync
+// finishes with the remaining honest peers.
+func TestSyncBadPeer(t *testing.T) {
+	source, root := makeTestState(1000, 10)
+
+	db, _ := watdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+
+	bad := newTestPeer("bad", source, syncer)
+	bad.accounts = func(hashes []common.Hash, accounts [][]byte) ([]common.Hash, [][]byte) {
+		if len(hashes) < 3 {
+			return hashes, accounts
+		}
+		return append(hashes[:1], hashes[2:]...), append(accounts[:1], accounts[2:]...)
+	}
+	syncer.Register(bad)
+	syncer.Register(newTestPeer("good", source, syncer))
+
+	if err := runSync(t, syncer, root); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	checkState(t, db, root)
+}
+
+// Tests that if none of the peers have the requested state, the sync cycle is
+// abandoned, and that a later cycle resumes from where the previous stopped.
+func TestSyncStatelessPeers(t *testing.T) {
+	source, root := makeTestState(1000, 10)
+	empty, _ := watdb.NewMemDatabase()
+
+	db, _ := watdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+	syncer.Register(newTestPeer("stateless", trie.NewDatabase(empty), syncer))
+
+	if err := runSync(t, syncer, root); err != nil {
+		t.Fatalf("failed to run sync cycle: %v", err)
+	}
+	if syncer.complete() {
+		t.Fatalf("sync completed without state")
+	}
+	syncer.Register(newTestPeer("stateful", source, syncer))
+	if err := runSync(t, syncer, root); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	checkState(t, db, root)
+}
+
+// Tests that range proofs served for a state are accepted by the verifier.
+func TestServiceAccountRangeProof(t *testing.T) {
+	source, root := makeTestState(100, 0)
+
+	hashes, accounts, proof := ServiceAccountRange(source, root, common.Hash{}, common.HexToHash("0x8000000000000000000000000000000000000000000000000000000000000000"), softResponseLimit)
+	if len(hashes) == 0 {
+		t.Fatalf("no accounts served")
+	}
+	keys := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	more, err := trie.VerifyRangeProof(root, make([]byte, common.HashLength), keys[len(keys)-1], keys, accounts, proof.NodeSet())
+	if err != nil {
+		t.Fatalf("served range failed verification: %v", err)
+	}
+	if !more {
+		t.Fatalf("half range reported as complete")
+	}
+}
+
+// Tests that bytecodes are served in the requested order, stopping at the first
+// unknown hash instead of shifting the following codes to its position.
+func TestServiceByteCodesOrder(t *testing.T) {
+	db, _ := watdb.NewMemDatabase()
+	var codes [][]byte
+	for i := byte(0); i < 2; i++ {
+		code := []byte{0x60, i}
+		db.Put(crypto.Keccak256(code), code)
+		codes = append(codes, code)
+	}
+	triedb := trie.NewDatabase(db)
+
+	hashes := []common.Hash{crypto.Keccak256Hash(codes[0]), {0xff}, crypto.Keccak256Hash(codes[1])}
+	served := ServiceByteCodes(triedb, hashes, softResponseLimit)
+	if len(served) != 1 || !bytes.Equal(served[0], codes[0]) {
+		t.Fatalf("served codes mismatch: have %x, want [%x]", served, codes[0])
+	}
+}
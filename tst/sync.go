@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/core"
 	"github.com/watchain/go-watchain/core/types"
 	"github.com/watchain/go-watchain/wat/downloader"
 	"github.com/watchain/go-watchain/log"
@@ -31,6 +32,7 @@ import (
 const (
 	forceSyncCycle      = 10 * time.Second // Time interval to force syncs, even if few peers are available
 	minDesiredPeerCount = 5                // Amount of peers desired to start syncing
+	backfillCycle       = 5 * time.Second  // Time interval to backfill the blocks below a sync checkpoint
 
 	// This is the target size for the packs of transactions sent by txsyncLoop.
 	// A pack can get larger than this if a single transactions exceeds this size.
@@ -60,8 +62,9 @@ func (pm *ProtocolManager) syncTransactions(p *peer) {
 
 // txsyncLoop takes care of the initial transaction sync for each new
 // connection. When a new peer appears, we relay all currently pending
-// transactions. In order to minimise egress bandwidth usage, we send
-// the transactions in small packs to one peer at a time.
+// transactions, only announcing them to peers able to retrieve them by
+// hash. In order to minimise egress bandwidth usage, we send the
+// transactions in small packs to one peer at a time.
 func (pm *ProtocolManager) txsyncLoop() {
 	var (
 		pending = make(map[discover.NodeID]*txsync)
@@ -78,7 +81,11 @@ func (pm *ProtocolManager) txsyncLoop() {
 		pack.txs = pack.txs[:0]
 		for i := 0; i < len(s.txs) && size < txsyncPackSize; i++ {
 			pack.txs = append(pack.txs, s.txs[i])
-			size += s.txs[i].Size()
+			if s.p.version >= wat65 {
+				size += common.HashLength
+			} else {
+				size += s.txs[i].Size()
+			}
 		}
 		// Remove the transactions that will be sent.
 		s.txs = s.txs[:copy(s.txs, s.txs[len(pack.txs):])]
@@ -88,7 +95,17 @@ func (pm *ProtocolManager) txsyncLoop() {
 		// Send the pack in the background.
 		s.p.Log().Trace("Sending batch of transactions", "count", len(pack.txs), "bytes", size)
 		sending = true
-		go func() { done <- pack.p.SendTransactions(pack.txs) }()
+		go func() {
+			if pack.p.version < wat65 {
+				done <- pack.p.SendTransactions(pack.txs)
+				return
+			}
+			hashes := make([]common.Hash, len(pack.txs))
+			for i, tx := range pack.txs {
+				hashes[i] = tx.Hash()
+			}
+			done <- pack.p.SendPooledTransactionHashes(hashes)
+		}()
 	}
 
 	// pick chooses the next pending sync.
@@ -135,12 +152,17 @@ func (pm *ProtocolManager) syncer() {
 	// Start and ensure cleanup of sync mechanisms
 	pm.fetcher.Start()
 	defer pm.fetcher.Stop()
+	pm.txFetcher.Start()
+	defer pm.txFetcher.Stop()
 	defer pm.downloader.Terminate()
 
 	// Wait for different events to fire synchronisation operations
 	forceSync := time.NewTicker(forceSyncCycle)
 	defer forceSync.Stop()
 
+	backfill := time.NewTicker(backfillCycle)
+	defer backfill.Stop()
+
 	for {
 		select {
 		case <-pm.newPeerCh:
@@ -154,6 +176,10 @@ func (pm *ProtocolManager) syncer() {
 			// Force a sync even if not enough peers are present
 			go pm.synchronise(pm.peers.BestPeer())
 
+		case <-backfill.C:
+			// Lazily retrieve the ancestors of a sync checkpoint between syncs
+			go pm.backfill(pm.peers.BestPeer())
+
 		case <-pm.noMorePeers:
 			return
 		}
@@ -178,7 +204,7 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	mode := downloader.FullSync
 	if atomic.LoadUint32(&pm.fastSync) == 1 {
 		// Fast sync was explicitly requested, and explicitly granted
-		mode = downloader.FastSync
+		mode = pm.fastSyncMode
 	} else if currentBlock.NumberU64() == 0 && pm.blockchain.CurrentFastBlock().NumberU64() > 0 {
 		// The database seems empty as the current block is the genesis. Yet the fast
 		// block is ahead, so fast sync was enabled for this node at a certain point.
@@ -207,3 +233,33 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 		go pm.BroadcastBlock(head, false)
 	}
 }
+
+// behind reports whwater the remote peer announced a heavier chain than the local
+// one, in which case a regular sync with it is due.
+func (pm *ProtocolManager) behind(peer *peer) bool {
+	currentBlock := pm.blockchain.CurrentBlock()
+	td := pm.blockchain.GetTd(currentBlock.Hash(), currentBlock.NumberU64())
+
+	_, pTd := peer.Head()
+	return pTd.Cmp(td) > 0
+}
+
+// backfill retrieves some of the blocks missing below a sync checkpoint from a
+// remote peer, if the local chain was anchored at one. Backfilling occupies the
+// downloader, so it yields to regular syncs: it's skipped while a sync is running
+// or the node is behind, and a sync due meanwhile is started right after it.
+func (pm *ProtocolManager) backfill(peer *peer) {
+	if peer == nil || pm.downloader.Synchronising() || pm.behind(peer) {
+		return
+	}
+	switch err := pm.downloader.Backfill(peer.id); err.(type) {
+	case nil:
+	case *core.TdMismatchError:
+		log.Error("Checkpoint backfill failed", "err", err)
+	default:
+		log.Trace("Checkpoint backfill failed", "peer", peer.id, "err", err)
+	}
+	if best := pm.peers.BestPeer(); best != nil && pm.behind(best) {
+		pm.synchronise(best)
+	}
+}
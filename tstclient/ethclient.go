@@ -266,6 +266,8 @@ type rpcProgress struct {
 	HighestBlock  hexutil.Uint64
 	PulledStates  hexutil.Uint64
 	KnownStates   hexutil.Uint64
+	PivotBlock    hexutil.Uint64
+	HeaderBlock   hexutil.Uint64
 }
 
 // SyncProgress retrieves the current progress of the sync algorithm. If there's
@@ -290,6 +292,8 @@ func (ec *Client) SyncProgress(ctx context.Context) (*watereum.SyncProgress, err
 		HighestBlock:  uint64(progress.HighestBlock),
 		PulledStates:  uint64(progress.PulledStates),
 		KnownStates:   uint64(progress.KnownStates),
+		PivotBlock:    uint64(progress.PivotBlock),
+		HeaderBlock:   uint64(progress.HeaderBlock),
 	}, nil
 }
 
@@ -346,6 +350,21 @@ func (ec *Client) NonceAt(ctx context.Context, account common.Address, blockNumb
 	return uint64(result), err
 }
 
+// ProofAt returns the Merkle proof of the given account and storage keys, which
+// can be checked against the state root of the block using VerifyProof.
+// The block number can be nil, in which case the proof is taken from the latest known block.
+func (ec *Client) ProofAt(ctx context.Context, account common.Address, keys []common.Hash, blockNumber *big.Int) (*AccountProof, error) {
+	if keys == nil {
+		keys = []common.Hash{}
+	}
+	var result AccountProof
+	err := ec.c.CallContext(ctx, &result, "eth_getProof", account, keys, toBlockNumArg(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // Filters
 
 // FilterLogs executes a filter query.
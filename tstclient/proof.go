@@ -0,0 +1,141 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package watclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/common/hexutil"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/rlp"
+	"github.com/watchain/go-watchain/trie"
+)
+
+// AccountProof is the Merkle proof of an account and some of its storage slots
+// in the state of a block, as returned by ProofAt.
+type AccountProof struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageProof  `json:"storageProof"`
+}
+
+// StorageProof is the Merkle proof of a storage slot in the storage trie of an
+// account.
+type StorageProof struct {
+	Key   common.Hash     `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// proofAccount is the consensus representation of an account in the state trie.
+type proofAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// VerifyProof checks an account proof against the state root of a block. The
+// proof is only valid if the account fields and the values of all the included
+// storage slots match the ones proven by the trie nodes.
+func VerifyProof(root common.Hash, proof *AccountProof) error {
+	value, err := verifyNodes(root, crypto.Keccak256(proof.Address.Bytes()), proof.AccountProof)
+	if err != nil {
+		return fmt.Errorf("invalid account proof: %v", err)
+	}
+	// A proof of absence proves an empty account
+	account := proofAccount{Balance: new(big.Int), Root: types.EmptyRootHash, CodeHash: crypto.Keccak256(nil)}
+	if value != nil {
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return fmt.Errorf("invalid account: %v", err)
+		}
+	}
+	switch {
+	case uint64(proof.Nonce) != account.Nonce:
+		return fmt.Errorf("nonce mismatch: have %d, proven %d", proof.Nonce, account.Nonce)
+	case proof.Balance == nil || proof.Balance.ToInt().Cmp(account.Balance) != 0:
+		return fmt.Errorf("balance mismatch: have %v, proven %v", proof.Balance, account.Balance)
+	case proof.StorageHash != account.Root:
+		return fmt.Errorf("storage hash mismatch: have %x, proven %x", proof.StorageHash, account.Root)
+	case !bytes.Equal(proof.CodeHash[:], account.CodeHash):
+		return fmt.Errorf("code hash mismatch: have %x, proven %x", proof.CodeHash, account.CodeHash)
+	}
+	for i := range proof.StorageProof {
+		if err := VerifyStorageProof(proof.StorageHash, &proof.StorageProof[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyStorageProof checks a storage slot proof against the storage root of an
+// account, as contained in a verified account proof.
+func VerifyStorageProof(root common.Hash, proof *StorageProof) error {
+	value := new(big.Int)
+	if root != types.EmptyRootHash {
+		enc, err := verifyNodes(root, crypto.Keccak256(proof.Key.Bytes()), proof.Proof)
+		if err != nil {
+			return fmt.Errorf("invalid storage proof of %x: %v", proof.Key, err)
+		}
+		if enc != nil {
+			var content []byte
+			if err := rlp.DecodeBytes(enc, &content); err != nil {
+				return fmt.Errorf("invalid storage value of %x: %v", proof.Key, err)
+			}
+			value.SetBytes(content)
+		}
+	}
+	if proof.Value == nil || proof.Value.ToInt().Cmp(value) != 0 {
+		return fmt.Errorf("storage value mismatch of %x: have %v, proven %v", proof.Key, proof.Value, value)
+	}
+	return nil
+}
+
+// verifyNodes checks the Merkle proof of a key against the root of a trie,
+// returning the proven value or nil if the proof shows the key's absence.
+func verifyNodes(root common.Hash, key []byte, nodes []hexutil.Bytes) ([]byte, error) {
+	db := make(proofDB)
+	for _, node := range nodes {
+		db[crypto.Keccak256Hash(node)] = node
+	}
+	value, err, _ := trie.VerifyProof(root, key, db)
+	return value, err
+}
+
+// proofDB is a set of trie nodes keyed by their hashes, used to verify proofs.
+type proofDB map[common.Hash][]byte
+
+func (db proofDB) Get(key []byte) ([]byte, error) {
+	if node, ok := db[common.BytesToHash(key)]; ok {
+		return node, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (db proofDB) Has(key []byte) (bool, error) {
+	_, ok := db[common.BytesToHash(key)]
+	return ok, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-watereum library.
+//
+// The go-watereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-watereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-watereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package watclient
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/watchain/go-watchain/common"
+	"github.com/watchain/go-watchain/common/hexutil"
+	"github.com/watchain/go-watchain/core/state"
+	"github.com/watchain/go-watchain/core/types"
+	"github.com/watchain/go-watchain/crypto"
+	"github.com/watchain/go-watchain/watdb"
+)
+
+// makeProof assembles the proof of an account and some storage slots the same
+// way the RPC API does.
+func makeProof(t *testing.T, statedb *state.StateDB, addr common.Address, keys []common.Hash) *AccountProof {
+	toHex := func(nodes [][]byte) []hexutil.Bytes {
+		res := make([]hexutil.Bytes, len(nodes))
+		for i, node := range nodes {
+			res[i] = node
+		}
+		return res
+	}
+	nodes, err := statedb.GetProof(addr)
+	if err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	proof := &AccountProof{
+		Address:      addr,
+		AccountProof: toHex(nodes),
+		Balance:      (*hexutil.Big)(statedb.GetBalance(addr)),
+		CodeHash:     crypto.Keccak256Hash(nil),
+		Nonce:        hexutil.Uint64(statedb.GetNonce(addr)),
+		StorageHash:  types.EmptyRootHash,
+	}
+	if tr := statedb.StorageTrie(addr); tr != nil {
+		proof.CodeHash, proof.StorageHash = statedb.GetCodeHash(addr), tr.Hash()
+	}
+	for _, key := range keys {
+		var nodes [][]byte
+		if proof.StorageHash != types.EmptyRootHash {
+			if nodes, err = statedb.StorageProof(addr, key); err != nil {
+				t.Fatalf("failed to prove storage slot %x: %v", key, err)
+			}
+		}
+		value := statedb.Gewatate(addr, key)
+		proof.StorageProof = append(proof.StorageProof, StorageProof{Key: key, Value: (*hexutil.Big)(value.Big()), Proof: toHex(nodes)})
+	}
+	return proof
+}
+
+// Tests that account and storage proofs generated from the state verify against
+// its root, and that tampered proven fields are rejected.
+func TestVerifyProof(t *testing.T) {
+	db, _ := watdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	addr := common.Address{1}
+	statedb.SetBalance(addr, big.NewInt(1000))
+	statedb.SetNonce(addr, 3)
+	statedb.SetCode(addr, []byte{0x60, 0x00})
+	statedb.Sewatate(addr, common.Hash{1}, common.Hash{31: 42})
+	statedb.SetBalance(common.Address{2}, big.NewInt(1))
+
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = state.New(root, statedb.Database())
+
+	keys := []common.Hash{{1}, {2}}
+	if err := VerifyProof(root, makeProof(t, statedb, addr, keys)); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	if err := VerifyProof(root, makeProof(t, statedb, common.Address{3}, keys)); err != nil {
+		t.Fatalf("valid proof of absence rejected: %v", err)
+	}
+	tampers := []func(*AccountProof){
+		func(p *AccountProof) { p.Balance = (*hexutil.Big)(big.NewInt(1001)) },
+		func(p *AccountProof) { p.Nonce++ },
+		func(p *AccountProof) { p.CodeHash = common.Hash{} },
+		func(p *AccountProof) { p.StorageProof[0].Value = (*hexutil.Big)(big.NewInt(43)) },
+		func(p *AccountProof) { p.StorageProof[1].Value = (*hexutil.Big)(big.NewInt(1)) },
+		func(p *AccountProof) { p.AccountProof = p.AccountProof[:len(p.AccountProof)-1] },
+	}
+	for i, tamper := range tampers {
+		proof := makeProof(t, statedb, addr, keys)
+		tamper(proof)
+		if err := VerifyProof(root, proof); err == nil {
+			t.Errorf("tamper %d: invalid proof accepted", i)
+		}
+	}
+	if err := VerifyProof(common.Hash{1}, makeProof(t, statedb, addr, keys)); err == nil {
+		t.Errorf("proof accepted against wrong root")
+	}
+}